@@ -189,13 +189,23 @@ func runHandler(c *cli.Context) error {
 	}
 	_ = os.Setenv("TMPDIR", conf.TmpDir)
 
+	// held until the handler exits, so that the dir is not recovered while in use
+	lock, err := config.LockHandlerDir(conf.TmpDir)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return errors.New("handler dir already locked")
+	}
+	defer lock.Close()
+
 	rc, err := lkredis.GetRedisClient(conf.Redis)
 	if err != nil {
 		return err
 	}
 
 	killChan := make(chan os.Signal, 1)
-	signal.Notify(killChan, syscall.SIGINT)
+	signal.Notify(killChan, syscall.SIGTERM, syscall.SIGINT)
 
 	bus := psrpc.NewRedisMessageBus(rc)
 	ioClient, err := rpc.NewIOInfoClient(bus)
@@ -216,9 +226,16 @@ func runHandler(c *cli.Context) error {
 
 	go func() {
 		sig := <-killChan
-		logger.Infow("exit requested, stopping recording and shutting down", "signal", sig)
-		handler.Kill()
+		logger.Infow("exit requested, finishing recording then shutting down", "signal", sig)
+		handler.KillWithTimeout(conf.DrainTimeout)
+
+		sig = <-killChan
+		logger.Infow("exit requested, stopping recording immediately", "signal", sig)
+		handler.ForceStop()
 	}()
 
-	return handler.Run()
+	if err = handler.Run(); errors.Is(err, errors.ErrForcedShutdown) {
+		return cli.Exit(err.Error(), service.ForcedShutdownExitCode)
+	}
+	return err
 }
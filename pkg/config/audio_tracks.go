@@ -0,0 +1,126 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+)
+
+// output types which can mux more than one audio track
+var multitrackOutputTypes = map[types.OutputType]bool{
+	types.OutputTypeMP4:  true,
+	types.OutputTypeWebM: true,
+}
+
+// AudioTrackConfig is a track composite audio track, recorded as its own output track in multitrack mode
+type AudioTrackConfig struct {
+	TrackID  string `json:"track_id"`
+	Language string `json:"language,omitempty"` // ISO 639-2 code tagged on the output track, such as eng
+}
+
+// updateAudioTracks parses audio_tracks request metadata, a json list of the audio tracks to record.
+// The request's audio_track_id is always first, and defaults to the first listed track
+func (p *PipelineConfig) updateAudioTracks(req *rpc.StartEgressRequest) error {
+	v := getMetadataString(req, audioTracksMetadataKey)
+	if v == "" {
+		return nil
+	}
+
+	var tracks []*AudioTrackConfig
+	if err := json.Unmarshal([]byte(v), &tracks); err != nil || len(tracks) == 0 {
+		return errors.ErrInvalidInput(audioTracksMetadataKey)
+	}
+	primary := -1
+	seen := make(map[string]bool)
+	for i, t := range tracks {
+		if t == nil || t.TrackID == "" || t.TrackID == p.VideoTrackID || seen[t.TrackID] || !validLanguage(t.Language) {
+			return errors.ErrInvalidInput(audioTracksMetadataKey)
+		}
+		seen[t.TrackID] = true
+		if t.TrackID == p.AudioTrackID {
+			primary = i
+		}
+	}
+
+	switch {
+	case p.AudioTrackID == "":
+		p.AudioEnabled = true
+		p.AudioTrackID = tracks[0].TrackID
+		p.AudioTranscoding = true
+	case primary == -1:
+		tracks = append([]*AudioTrackConfig{{TrackID: p.AudioTrackID}}, tracks...)
+	case primary > 0:
+		tracks = append([]*AudioTrackConfig{tracks[primary]}, append(tracks[:primary:primary], tracks[primary+1:]...)...)
+	}
+
+	p.AudioTracks = tracks
+	p.AudioTrackSources = make(map[string]*TrackSource)
+	return nil
+}
+
+// updateAudioMode applies audio_mode request metadata. Multitrack recording falls back to mixing unless
+// there are several audio tracks and every output is an mp4 or webm file
+func (p *PipelineConfig) updateAudioMode(req *rpc.StartEgressRequest) error {
+	if v := getMetadataString(req, audioModeMetadataKey); v != "" {
+		switch mode := types.AudioMode(v); mode {
+		case types.AudioModeMix, types.AudioModeMultitrack:
+			p.AudioMode = mode
+		default:
+			return errors.ErrInvalidInput(audioModeMetadataKey)
+		}
+	}
+	if p.AudioMode != types.AudioModeMultitrack {
+		return nil
+	}
+
+	if len(p.AudioTracks) < 2 {
+		p.AudioMode = types.AudioModeMix
+		return nil
+	}
+	for egressType, outputs := range p.Outputs {
+		for _, o := range outputs {
+			if egressType != types.EgressTypeFile || !multitrackOutputTypes[o.GetOutputType()] {
+				logger.Warnw("output cannot carry multiple audio tracks, mixing audio", nil,
+					"egressType", egressType,
+					"outputType", o.GetOutputType(),
+				)
+				p.AudioMode = types.AudioModeMix
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// validLanguage accepts an empty language or a three letter ISO 639-2 code
+func validLanguage(language string) bool {
+	if language == "" {
+		return true
+	}
+	if len(language) != 3 {
+		return false
+	}
+	for _, c := range language {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
@@ -15,9 +15,12 @@
 package config
 
 import (
+	"image/png"
 	"os"
 	"time"
 
+	"github.com/livekit/egress/pkg/logbuffer"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/redis"
 	lksdk "github.com/livekit/server-sdk-go"
@@ -33,13 +36,67 @@ type BaseConfig struct {
 	WsUrl     string             `yaml:"ws_url"`     // (env LIVEKIT_WS_URL)
 
 	// optional
-	Logging             *logger.Config          `yaml:"logging"`               // logging config
-	TemplateBase        string                  `yaml:"template_base"`         // custom template base url
-	BackupStorage       string                  `yaml:"backup_storage"`        // backup file location for failed uploads
-	ClusterID           string                  `yaml:"cluster_id"`            // cluster this instance belongs to
-	EnableChromeSandbox bool                    `yaml:"enable_chrome_sandbox"` // enable Chrome sandbox, requires extra docker configuration
-	StorageConfig       `yaml:",inline"`        // upload config (S3, Azure, GCP, or AliOSS)
-	SessionLimits       `yaml:"session_limits"` // session duration limits
+	Logging             *logger.Config             `yaml:"logging"`               // logging config
+	TemplateBase        string                     `yaml:"template_base"`         // custom template base url
+	BackupStorage       string                     `yaml:"backup_storage"`        // backup file location for failed uploads
+	LocalFileCleanup    types.LocalFileCleanup     `yaml:"local_file_cleanup"`    // retain_on_failure (default) or force_delete local files when an upload can't be confirmed
+	FallbackStorage     *StorageConfig             `yaml:"fallback_storage"`      // secondary upload destination, used once retries to the primary are exhausted
+	UploadRetry         UploadRetryConfig          `yaml:"upload_retry"`          // retry failed uploads with exponential backoff, on top of the storage client's own retries
+	MultipartUpload     MultipartUploadConfig      `yaml:"multipart_upload"`      // part size and parallel part uploads for large files sent to s3, gcp and azure
+	StreamReconnect     StreamReconnectConfig      `yaml:"stream_reconnect"`      // reconnect dropped rtmp outputs with exponential backoff, leaving the rest of the egress running
+	ElementRecovery     ElementRecoveryConfig      `yaml:"element_recovery"`      // rebuild a track's decoding elements after a recoverable error, instead of failing sdk egress
+	HostOverrides       HostOverrides              `yaml:"host_overrides"`        // static hostname to IP overrides for upload and stream connections
+	ElementOverrides    ElementOverrides           `yaml:"element_overrides"`     // allowed gstreamer element tuning properties by factory name, merged with element_overrides request metadata
+	StreamPlatforms     StreamPlatformHosts        `yaml:"stream_platforms"`      // rtmp host to youtube or twitch, for ingest hosts that aren't recognized from the url
+	SignedURLExpiry     time.Duration              `yaml:"signed_url_expiry"`     // report file result locations as pre-signed download urls valid for this long, up to 7 days
+	ClusterID           string                     `yaml:"cluster_id"`            // cluster this instance belongs to
+	IPCTransport        types.IPCTransport         `yaml:"ipc_transport"`         // unix (default) socket in the handler tmp dir, or tcp on an ephemeral loopback port where unix sockets are unavailable. Handler requests are authenticated with a per handler secret
+	EnableChromeSandbox bool                       `yaml:"enable_chrome_sandbox"` // enable Chrome sandbox, requires extra docker configuration
+	DuplicateFrames     bool                       `yaml:"duplicate_frames"`      // duplicate frames to hold low framerate h264 tracks at the output framerate. Overridden by duplicate_frames request metadata
+	DrainTimeout        time.Duration              `yaml:"drain_timeout"`         // time allowed to finalize outputs after SIGTERM before forcing shutdown, must be longer than EOSTimeout
+	FirstFrameTimeout   time.Duration              `yaml:"first_frame_timeout"`   // fail egress if no media reaches the encoders in time, 0 to wait indefinitely
+	NoInputTimeout      time.Duration              `yaml:"no_input_timeout"`      // end egress as no input received if no participant media arrives in time, instead of recording an empty output. 0 to wait indefinitely. Overridden by no_input_timeout request metadata
+	PlaceholderInput    bool                       `yaml:"placeholder_input"`     // count a web template's black video and silence as input for no_input_timeout. Overridden by placeholder_input request metadata
+	EncoderStallTimeout time.Duration              `yaml:"encoder_stall_timeout"` // fail egress if an encoder receives media but emits nothing for this long, 0 to disable
+	DiskStallTimeout    time.Duration              `yaml:"disk_stall_timeout"`    // fail egress if a write to the local output directory blocks for this long, 0 to disable
+	MinFreeDisk         int64                      `yaml:"min_free_disk"`         // bytes kept free in the local output directory, closing chunks early and then finalizing with disk_full below it. 0 to disable
+	SinkStallThreshold  time.Duration              `yaml:"sink_stall_threshold"`  // report handler health as degraded when no buffer reaches an output sink for this long, 0 to disable
+	MinDuration         time.Duration              `yaml:"min_duration"`          // discard outputs and report the egress as too short below this recorded duration, 0 to keep all
+	MaxDuration         time.Duration              `yaml:"max_duration"`          // end any egress gracefully once it has been playing this long, reported as limit reached. 0 for no limit
+	PreRoll             time.Duration              `yaml:"pre_roll"`              // hold this much encoded media before the web start signal or MarkStart, so outputs begin that far before it. At most 30s, 0 to disable. Overridden by pre_roll request metadata
+	PostRoll            time.Duration              `yaml:"post_roll"`             // keep recording this long after a stop request before finalizing outputs, 0 to disable. Overridden by post_roll request metadata
+	MinVideoBitrate     int32                      `yaml:"min_video_bitrate"`     // kbps floor held by the h264 encoder, raising lower requested bitrates. Overridden by min_video_bitrate request metadata
+	VideoEncoders       []types.VideoEncoder       `yaml:"video_encoders"`        // hardware h264 encoders to try in order, such as nvh264enc, vah264enc, vaapih264enc or qsvh264enc. x264enc is used when none are available
+	Upscale             types.UpscaleBehavior      `yaml:"upscale"`               // upscale (default), cap, or letterbox sdk egress output when the requested resolution exceeds the source
+	AudioMode           types.AudioMode            `yaml:"audio_mode"`            // mix (default), or multitrack to record each track composite audio track as a separate mp4 or webm track. Overridden by audio_mode request metadata
+	Chrome              ChromeConfig               `yaml:"chrome"`                // web source rendering and capture tuning
+	MissingVideo        types.MissingVideoBehavior `yaml:"missing_video"`         // placeholder, audio_only, or fail when sdk egress video is not published when the egress joins. With audio_only, video published later is not recorded
+	MaxDiscontinuities  int                        `yaml:"max_discontinuities"`   // source reconnects allowed before segment egress gives up, 0 for unlimited
+	StreamUpdateWindow  time.Duration              `yaml:"stream_update_window"`  // coalesce UpdateStream changes requested within this window, defaults to 250ms, 0 to apply each request immediately
+	TrickleUpload       bool                       `yaml:"trickle_upload"`        // upload single file outputs in parts while they are written, as fragmented mp4 or streamable webm. Overridden by trickle_upload request metadata
+	CrashRecovery       bool                       `yaml:"crash_recovery"`        // keep a state file of closed rotating file chunks or pending segments, uploaded by the service if the handler crashes or on restart, and reported as partially recovered. Recovery after a restart requires api_secret
+	KeyframeIndex       bool                       `yaml:"keyframe_index"`        // upload a keyframe pts to byte offset index alongside video file outputs
+	Waveform            bool                       `yaml:"waveform"`              // upload a waveform png alongside audio only file outputs
+	RecordingSummary    bool                       `yaml:"recording_summary"`     // upload a json summary of encoding, reconnect and upload stats alongside file and segment outputs
+	Bundle              BundleConfig               `yaml:"bundle"`                // package file outputs and their sidecars into a single tar or zip upload
+	Usage               UsageConfig                `yaml:"usage"`                 // usage record for billing, emitted when the egress ends, including after failures
+	Timecodes           TimecodeConfig             `yaml:"timecodes"`             // upload a timecode reference subtitle file alongside file outputs
+	EDL                 EDLConfig                  `yaml:"edl"`                   // upload an edit decision list of room events alongside participant and track composite file outputs
+	ChatSubtitles       ChatSubtitlesConfig        `yaml:"chat_subtitles"`        // burn room chat messages into participant and track composite video
+	Overlays            OverlaysConfig             `yaml:"overlays"`              // burn a utc timecode and an image watermark into room composite and track composite video
+	AudioLevels         AudioLevelsConfig          `yaml:"audio_levels"`          // measure per channel rms and peak levels of the recorded audio, reported by the GetAudioLevels rpc
+	FollowSpeaker       FollowSpeakerConfig        `yaml:"follow_speaker"`        // record whichever participant is the active speaker in participant egress, starting with the requested identity
+	SoloFullscreen      bool                       `yaml:"solo_fullscreen"`       // show a lone participant full screen in room composite grid layouts, overridden by solo_fullscreen request metadata
+	StaleVideoTimeout   time.Duration              `yaml:"stale_video_timeout"`   // cover a room composite tile with a connection lost placeholder after no video packets arrive for this long, 0 to disable
+	HLSEncryption       HLSEncryptionConfig        `yaml:"hls_encryption"`        // encrypt segments with AES-128, rotating the key every rotation_interval segments
+	SegmentUpdates      SegmentUpdatesConfig       `yaml:"segment_updates"`       // notify as each segment upload completes, instead of only when the egress ends
+	UploadEncryption    UploadEncryptionConfig     `yaml:"upload_encryption"`     // encrypt file and segment uploads with AES-256-GCM before they leave the handler
+	Diarization         DiarizationConfig          `yaml:"diarization"`           // upload speaking intervals per participant alongside participant and track composite file outputs
+	EncodingProfiles    EncodingProfilesConfig     `yaml:"encoding_profiles"`     // named encoding settings, selected with encoding_profile request metadata
+	EgressParticipant   EgressParticipantConfig    `yaml:"egress_participant"`    // identity and metadata used by sdk egress when joining the room
+	StopSignal          StopSignalConfig           `yaml:"stop_signal"`           // end the egress gracefully when the io service answers a status update with a stop code
+	StorageConfig       `yaml:",inline"`           // upload config (S3, Azure, GCP, or AliOSS)
+	SessionLimits       `yaml:"session_limits"`    // session duration limits
 
 	// dev/debugging
 	Insecure bool        `yaml:"insecure"` // allow chrome to connect to an insecure websocket
@@ -49,8 +106,174 @@ type BaseConfig struct {
 	LogLevel string `yaml:"log_level"` // Use Logging instead
 }
 
+type ChromeConfig struct {
+	EnableGPU         bool  `yaml:"enable_gpu"`         // allow chrome to use the GPU for rendering
+	RequireGPU        bool  `yaml:"require_gpu"`        // fail web egress when enable_gpu is set but no GPU is found, instead of rendering in software
+	SoftwareFramerate int32 `yaml:"software_framerate"` // capture framerate cap when enable_gpu is set but no GPU is found, 0 for no cap
+	RasterThreads     int   `yaml:"raster_threads"`     // number of chrome raster threads, 0 uses chrome's default
+	CaptureFramerate  int32 `yaml:"capture_framerate"`  // display capture framerate, 0 or above the output framerate captures at the output framerate
+}
+
+type UploadRetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"` // attempts per destination, including the first. Defaults to 3
+	BaseDelay   time.Duration `yaml:"base_delay"`   // delay before the first retry, doubling after each attempt. Defaults to 1s
+	MaxDelay    time.Duration `yaml:"max_delay"`    // longest delay between attempts, defaults to 30s
+}
+
+// Zero values keep each storage client's own defaults
+type MultipartUploadConfig struct {
+	PartSize    int64 `yaml:"part_size"`   // bytes per part, at least 5MiB. Defaults to 5MiB for s3, 4MiB for azure and 16MiB for gcp
+	Concurrency int   `yaml:"concurrency"` // parts uploaded at once. Defaults to 5 for s3 and 16 for azure, gcp uploads a single stream unless set above 1
+}
+
+type StreamReconnectConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"` // consecutive attempts before a stream fails permanently. Defaults to 5, -1 to disable reconnects
+	BaseDelay   time.Duration `yaml:"base_delay"`   // delay before the first attempt, doubling after each attempt. Defaults to 1s
+	MaxDelay    time.Duration `yaml:"max_delay"`    // longest delay between attempts, defaults to 30s
+}
+
+type ElementRecoveryConfig struct {
+	MaxAttempts int `yaml:"max_attempts"` // recoveries per track before its next recoverable error fails the egress. Defaults to 3, -1 to disable recovery
+}
+
+type TimecodeConfig struct {
+	Format   types.TimecodeFormat `yaml:"format"`   // srt or vtt, empty to disable
+	Interval time.Duration        `yaml:"interval"` // duration of each cue, defaults to 1s
+}
+
+type EDLConfig struct {
+	Enabled bool                       `yaml:"enabled"`
+	Events  map[types.RoomEvent]string `yaml:"events"` // room event to marker label, defaults to all events
+}
+
+var defaultEDLEvents = map[types.RoomEvent]string{
+	types.RoomEventActiveSpeaker: "Speaker",
+	types.RoomEventScreenShare:   "Screen share",
+	types.RoomEventHighlight:     "Highlight",
+}
+
+// Label returns the marker label for a room event, or false if the event is not marked
+func (c EDLConfig) Label(event types.RoomEvent) (string, bool) {
+	events := c.Events
+	if events == nil {
+		events = defaultEDLEvents
+	}
+	label, ok := events[event]
+	return label, ok
+}
+
+type ChatSubtitlesConfig struct {
+	Enabled     bool          `yaml:"enabled"`      // default for each egress, overridden by chat_subtitles request metadata
+	Duration    time.Duration `yaml:"duration"`     // display time for each message, defaults to 5s
+	MaxMessages int           `yaml:"max_messages"` // messages shown at once, later messages wait for a free line. Defaults to 3
+	Font        string        `yaml:"font"`         // pango font description, defaults to "Sans 16"
+	Color       uint32        `yaml:"color"`        // ARGB text color, defaults to 0xFFFFFFFF
+	VAlign      string        `yaml:"valign"`       // top, center, or bottom (default)
+	HAlign      string        `yaml:"halign"`       // left (default), center, or right
+}
+
+type OverlaysConfig struct {
+	Timecode  TimecodeOverlayConfig `yaml:"timecode"`
+	Watermark WatermarkConfig       `yaml:"watermark"`
+}
+
+type TimecodeOverlayConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Format  string `yaml:"format"` // go time layout of the utc wall clock time, defaults to "2006-01-02 15:04:05.000 UTC"
+	Font    string `yaml:"font"`   // pango font family, defaults to "Monospace"
+	Size    int    `yaml:"size"`   // font size in points, defaults to 16
+	Color   uint32 `yaml:"color"`  // ARGB text color, defaults to 0xFFFFFFFF
+	VAlign  string `yaml:"valign"` // top (default), center, or bottom
+	HAlign  string `yaml:"halign"` // left, center, or right (default)
+}
+
+type WatermarkConfig struct {
+	Path    string  `yaml:"path"`    // png image blended using its alpha channel, empty to disable
+	VAlign  string  `yaml:"valign"`  // top, center, or bottom (default)
+	HAlign  string  `yaml:"halign"`  // left, center, or right (default)
+	Margin  int     `yaml:"margin"`  // pixels between the image and the nearest video edges
+	Opacity float64 `yaml:"opacity"` // multiplied with the image alpha, defaults to 1
+	Scale   float64 `yaml:"scale"`   // image width as a fraction of the video width, defaults to the image's own size
+}
+
+// ImageSize reads the width and height from the watermark png header
+func (c WatermarkConfig) ImageSize() (int, int, error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	img, err := png.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return img.Width, img.Height, nil
+}
+
+type AudioLevelsConfig struct {
+	Enabled  bool          `yaml:"enabled"`  // default for each egress, overridden by audio_levels request metadata
+	Interval time.Duration `yaml:"interval"` // time between measurements, defaults to 100ms
+}
+
+type FollowSpeakerConfig struct {
+	Enabled  bool          `yaml:"enabled"`   // default for each egress, overridden by follow_speaker request metadata
+	HoldTime time.Duration `yaml:"hold_time"` // time a new speaker must stay the loudest before the egress switches to them, defaults to 2s
+}
+
+type HLSEncryptionConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	RotationInterval int    `yaml:"rotation_interval"` // segments encrypted with each key, defaults to 10
+	KeyURI           string `yaml:"key_uri"`           // prefix for key uris in playlists, defaults to key files next to the playlist
+	KeyEndpoint      string `yaml:"key_endpoint"`      // endpoint keys are posted to instead of uploading key files, requires key_uri
+}
+
+type SegmentUpdatesConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Endpoint  string `yaml:"endpoint"`   // url each segment's details are posted to as json, in addition to the egress update sent to the io service
+	QueueSize int    `yaml:"queue_size"` // notifications held while earlier ones are sent, defaults to 32. Newer ones are dropped when full
+}
+
+type UploadEncryptionConfig struct {
+	Enabled   bool   `yaml:"enabled"`    // default for each egress, enabled by upload_encryption_key or upload_encryption_kms_key_id request metadata
+	Key       string `yaml:"key"`        // base64 encoded 256-bit key
+	KMSKeyID  string `yaml:"kms_key_id"` // aws kms key used to generate a data key for each egress, instead of key
+	KMSRegion string `yaml:"kms_region"` // region of the kms key, defaults to the aws sdk's region resolution
+}
+
+type DiarizationConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	MergeGap time.Duration `yaml:"merge_gap"` // join a participant's intervals separated by less than this, defaults to 500ms
+}
+
+type EgressParticipantConfig struct {
+	Identity   string            `yaml:"identity"`   // defaults to the egress id. {egress_id} and {room_name} are replaced
+	Name       string            `yaml:"name"`       // display name
+	Metadata   string            `yaml:"metadata"`   // participant metadata
+	Attributes map[string]string `yaml:"attributes"` // sent as json participant metadata, cannot be combined with metadata
+}
+
+type StopSignalConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Code         string        `yaml:"code"`          // psrpc error code returned by UpdateEgress to request a stop, defaults to resource_exhausted
+	PollInterval time.Duration `yaml:"poll_interval"` // send status updates this often while active so a stop is picked up promptly, defaults to 10s, 0 to disable
+}
+
+type BundleConfig struct {
+	Format    types.BundleFormat `yaml:"format"`     // tar or zip, empty to disable
+	KeepParts bool               `yaml:"keep_parts"` // also upload the recording and sidecars individually
+}
+
+type UsageConfig struct {
+	Endpoint string `yaml:"endpoint"` // usage records are posted here as json, in addition to being logged
+	Proxy    string `yaml:"proxy"`    // optional http proxy for the usage endpoint
+}
+
 type DebugConfig struct {
 	EnableProfiling bool             `yaml:"enable_profiling"` // create dot file and pprof on internal error
+	DotCacheTTL     time.Duration    `yaml:"dot_cache_ttl"`    // reuse a pipeline dot for this long unless the pipeline changes, 0 to generate on every request
+	Tracers         string           `yaml:"tracers"`          // gstreamer tracers loaded by each handler for GetTracerLogs, such as "latency(flags=pipeline+element);stats"
+	LogLines        int              `yaml:"log_lines"`        // recent log lines kept by each handler for GetLogs, defaults to 1000, -1 to disable
 	PathPrefix      string           `yaml:"path_prefix"`      // filepath prefix for uploads
 	StorageConfig   `yaml:",inline"` // upload config (S3, Azure, GCP, or AliOSS)
 }
@@ -94,7 +317,8 @@ type SessionLimits struct {
 	ImageOutputMaxDuration   time.Duration `yaml:"image_output_max_duration"`
 }
 
-func (c *BaseConfig) initLogger(values ...interface{}) error {
+// initLogger sets the default logger. When logLines is positive, recent lines are also kept in the returned buffer
+func (c *BaseConfig) initLogger(logLines int, values ...interface{}) (*logbuffer.Buffer, error) {
 	if c.LogLevel != "" {
 		logger.Warnw("log_level deprecated. use logging instead", nil)
 		c.Logging.Level = c.LogLevel
@@ -110,17 +334,22 @@ func (c *BaseConfig) initLogger(values ...interface{}) error {
 		gstDebug = "1"
 	}
 	if err := os.Setenv("GST_DEBUG", gstDebug); err != nil {
-		return err
+		return nil, err
 	}
 
 	zl, err := logger.NewZapLogger(c.Logging)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	l := zl.WithValues(values...)
+	var buffer *logbuffer.Buffer
+	if logLines > 0 {
+		buffer = logbuffer.New(logLines, logger.ParseZapLevel(c.Logging.Level))
+		l = logbuffer.Wrap(l, buffer)
+	}
 
 	logger.SetLogger(l, "egress")
 	lksdk.SetLogger(l)
-	return nil
+	return buffer, nil
 }
@@ -15,11 +15,23 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/auth"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/rpc"
 )
@@ -197,3 +209,774 @@ func TestSegmentNaming(t *testing.T) {
 		require.Equal(t, test.expectedSegmentPrefix, o.SegmentPrefix)
 	}
 }
+
+func TestHostOverridesRewriteURL(t *testing.T) {
+	h := HostOverrides{"live.example.com": "10.0.0.5"}
+
+	require.Equal(t, "rtmp://10.0.0.5/app/key", h.RewriteURL("rtmp://live.example.com/app/key"))
+	require.Equal(t, "rtmp://10.0.0.5:1935/app/key", h.RewriteURL("rtmp://live.example.com:1935/app/key"))
+	require.Equal(t, "rtmps://live.example.com/app/key", h.RewriteURL("rtmps://live.example.com/app/key"))
+	require.Equal(t, "rtmp://other.example.com/app/key", h.RewriteURL("rtmp://other.example.com/app/key"))
+}
+
+func TestCorrelationID(t *testing.T) {
+	req := &rpc.StartEgressRequest{EgressId: "EG_test"}
+	require.Equal(t, "EG_test", getCorrelationID(req))
+
+	id, err := anypb.New(wrapperspb.String("trace-123"))
+	require.NoError(t, err)
+	req.Metadata = map[string]*anypb.Any{correlationIDMetadataKey: id}
+	require.Equal(t, "trace-123", getCorrelationID(req))
+}
+
+func TestEncodingProfile(t *testing.T) {
+	p := &PipelineConfig{}
+	p.EncodingProfiles = EncodingProfilesConfig{
+		Profiles: map[string]*EncodingProfile{
+			"social-vertical": {Width: 1080, Height: 1920, Framerate: 30, VideoBitrate: 5000, AudioCodec: "aac"},
+			"lowlatency":      {Framerate: 60, KeyFrameInterval: 1},
+		},
+		Defaults: map[string]string{"stream": "lowlatency"},
+	}
+	require.NoError(t, p.validateEncodingProfiles())
+
+	name, err := anypb.New(wrapperspb.String("social-vertical"))
+	require.NoError(t, err)
+	req := &rpc.StartEgressRequest{
+		EgressId: "EG_test",
+		Request: &rpc.StartEgressRequest_RoomComposite{
+			RoomComposite: &livekit.RoomCompositeEgressRequest{
+				StreamOutputs: []*livekit.StreamOutput{{Urls: []string{"rtmp://localhost/live"}}},
+			},
+		},
+		Metadata: map[string]*anypb.Any{encodingProfileMetadataKey: name},
+	}
+	require.NoError(t, p.applyEncodingProfile(req))
+	require.Equal(t, "social-vertical", p.EncodingProfile)
+	require.Equal(t, int32(1080), p.Width)
+	require.Equal(t, int32(1920), p.Height)
+	require.Equal(t, types.MimeTypeAAC, p.AudioOutCodec)
+
+	// per-request options override profile settings
+	require.NoError(t, p.applyAdvanced(&livekit.EncodingOptions{VideoBitrate: 3000}))
+	require.Equal(t, int32(3000), p.VideoBitrate)
+
+	// default by output type
+	req.Metadata = nil
+	require.NoError(t, p.applyEncodingProfile(req))
+	require.Equal(t, "lowlatency", p.EncodingProfile)
+	require.Equal(t, int32(60), p.Framerate)
+
+	name, err = anypb.New(wrapperspb.String("archive"))
+	require.NoError(t, err)
+	req.Metadata = map[string]*anypb.Any{encodingProfileMetadataKey: name}
+	require.Error(t, p.applyEncodingProfile(req))
+
+	p.EncodingProfiles.Profiles["invalid"] = &EncodingProfile{VideoCodec: "vp9"}
+	require.Error(t, p.validateEncodingProfiles())
+}
+
+func TestEgressParticipantToken(t *testing.T) {
+	p := &PipelineConfig{
+		BaseConfig: BaseConfig{
+			ApiKey:    "key",
+			ApiSecret: "secretsecretsecretsecretsecretsecret",
+			EgressParticipant: EgressParticipantConfig{
+				Identity:   "recorder-{room_name}",
+				Name:       "Recorder",
+				Attributes: map[string]string{"role": "recorder"},
+			},
+		},
+		RequestType: types.RequestTypeParticipant,
+	}
+	p.Info = &livekit.EgressInfo{EgressId: "EG_test", RoomName: "room"}
+	p.SourceType = types.SourceTypeSDK
+	p.Identity = "alice"
+
+	token, err := p.buildToken()
+	require.NoError(t, err)
+	require.Equal(t, "recorder-room", p.EgressIdentity)
+
+	v, err := auth.ParseAPIToken(token)
+	require.NoError(t, err)
+	claims, err := v.Verify(p.ApiSecret)
+	require.NoError(t, err)
+	require.Equal(t, "recorder-room", claims.Identity)
+	require.Equal(t, "Recorder", claims.Name)
+	require.Equal(t, `{"role":"recorder"}`, claims.Metadata)
+	require.True(t, claims.Video.Hidden)
+
+	// recording the participant the egress would replace
+	p.Identity = "recorder-room"
+	_, err = p.buildToken()
+	require.Error(t, err)
+}
+
+func TestStreamPlatforms(t *testing.T) {
+	p := &PipelineConfig{
+		BaseConfig: BaseConfig{
+			StreamPlatforms: StreamPlatformHosts{"ingest.example.com": types.StreamPlatformTwitch},
+		},
+		AudioConfig: AudioConfig{AudioEnabled: true, AudioBitrate: 128, AudioFrequency: 44100},
+		VideoConfig: VideoConfig{VideoEnabled: true, Width: 1920, Height: 1080, Framerate: 30, VideoBitrate: 4500},
+	}
+
+	require.Equal(t, types.StreamPlatformYouTube, p.getStreamPlatform("rtmp://a.rtmp.youtube.com/live2/key"))
+	require.Equal(t, types.StreamPlatformTwitch, p.getStreamPlatform("rtmps://ingest.example.com/app/key"))
+	require.Equal(t, types.StreamPlatform(""), p.getStreamPlatform("rtmp://localhost/live"))
+
+	// key frame interval is set when not requested
+	require.NoError(t, p.applyStreamPlatforms([]string{"rtmp://live.twitch.tv/app/key"}))
+	require.Equal(t, float64(2), p.KeyFrameInterval)
+
+	p.VideoBitrate = 8000
+	require.Error(t, p.applyStreamPlatforms([]string{"rtmp://live.twitch.tv/app/key"}))
+	require.NoError(t, p.applyStreamPlatforms([]string{"rtmp://a.rtmp.youtube.com/live2/key"}))
+
+	p.KeyFrameInterval = 4
+	require.Error(t, p.ValidateStreamPlatform("rtmp://a.rtmp.youtube.com/live2/key"))
+	require.NoError(t, p.ValidateStreamPlatform("rtmp://localhost/live"))
+}
+
+func TestGetStreamOutputType(t *testing.T) {
+	for rawUrl, expected := range map[string]types.OutputType{
+		"rtmp://localhost/live/key":  types.OutputTypeRTMP,
+		"rtmps://localhost/live/key": types.OutputTypeRTMP,
+		"mux://key":                  types.OutputTypeRTMP,
+		"srt://localhost:7001":       types.OutputTypeRTMP,
+		"wss://localhost/audio":      types.OutputTypeRaw,
+	} {
+		outputType, err := GetStreamOutputType(rawUrl)
+		require.NoError(t, err)
+		require.Equal(t, expected, outputType)
+	}
+
+	_, err := GetStreamOutputType("http://localhost/live")
+	require.Error(t, err)
+}
+
+func TestSRTUrls(t *testing.T) {
+	p := &PipelineConfig{}
+
+	url, redacted, err := p.ValidateUrl("srt://localhost:7001?streamid=abcdefghij&latency=200&passphrase=secretsecret", types.OutputTypeRTMP)
+	require.NoError(t, err)
+	require.Equal(t, "srt://localhost:7001?streamid=abcdefghij&latency=200&passphrase=secretsecret", url)
+	require.Equal(t, "srt://localhost:7001?streamid={abc...hij}&latency=200&passphrase={sec...ret}", redacted)
+
+	_, redacted, err = p.ValidateUrl("srt://localhost:7001", types.OutputTypeRTMP)
+	require.NoError(t, err)
+	require.Equal(t, "srt://localhost:7001", redacted)
+
+	// a port is required
+	_, _, err = p.ValidateUrl("srt://localhost?streamid=abcdefghij", types.OutputTypeRTMP)
+	require.Error(t, err)
+	_, _, err = p.ValidateUrl("srt://localhost:7001", types.OutputTypeRaw)
+	require.Error(t, err)
+
+	conf, err := p.getStreamConfig(types.OutputTypeRTMP, []string{"rtmp://localhost/live/stream1", "srt://localhost:7001?streamid=abcdefghij"})
+	require.NoError(t, err)
+	require.Equal(t, "srt://localhost:7001?streamid={abc...hij}", conf.StreamInfo["srt://localhost:7001?streamid=abcdefghij"].Url)
+	require.Equal(t, types.MimeTypeH264, p.VideoOutCodec)
+	require.Equal(t, types.MimeTypeAAC, p.AudioOutCodec)
+}
+
+func TestMinVideoBitrate(t *testing.T) {
+	p := &PipelineConfig{
+		BaseConfig:  BaseConfig{MinVideoBitrate: 3000},
+		VideoConfig: VideoConfig{VideoEnabled: true, VideoEncoding: true, VideoOutCodec: types.MimeTypeH264, VideoBitrate: 2000},
+	}
+	req := &rpc.StartEgressRequest{}
+	require.NoError(t, p.updateMinVideoBitrate(req))
+	require.Equal(t, int32(3000), p.VideoBitrate)
+
+	floor, err := anypb.New(wrapperspb.String("6000"))
+	require.NoError(t, err)
+	req.Metadata = map[string]*anypb.Any{minVideoBitrateMetadataKey: floor}
+	require.NoError(t, p.updateMinVideoBitrate(req))
+	require.Equal(t, int32(6000), p.VideoBitrate)
+
+	p.VideoOutCodec = types.MimeTypeVP9
+	require.Error(t, p.updateMinVideoBitrate(req))
+}
+
+func TestUpscale(t *testing.T) {
+	p := &PipelineConfig{
+		BaseConfig:  BaseConfig{Upscale: types.UpscaleBehaviorCap},
+		VideoConfig: VideoConfig{VideoEnabled: true, VideoEncoding: true, Width: 1920, Height: 1080},
+	}
+	p.applyUpscale(1280, 720)
+	require.Equal(t, int32(1280), p.Width)
+	require.Equal(t, int32(720), p.Height)
+
+	// a portrait source taller than the frame is already scaled down
+	p.Width, p.Height = 1920, 1080
+	p.applyUpscale(720, 1280)
+	require.Equal(t, int32(1920), p.Width)
+	require.Equal(t, int32(1080), p.Height)
+	w, h := p.ContentSize(720, 1280)
+	require.Equal(t, int32(606), w)
+	require.Equal(t, int32(1080), h)
+
+	p.Upscale = types.UpscaleBehaviorLetterbox
+	p.applyUpscale(640, 360)
+	require.Equal(t, int32(1920), p.Width)
+	w, h = p.ContentSize(640, 360)
+	require.Equal(t, int32(640), w)
+	require.Equal(t, int32(360), h)
+
+	p.Upscale = types.UpscaleBehaviorUpscale
+	w, h = p.ContentSize(640, 360)
+	require.Equal(t, int32(1920), w)
+	require.Equal(t, int32(1080), h)
+}
+
+func TestFileRotation(t *testing.T) {
+	require.Equal(t, "recordings/room_00003.mp4", ChunkFilepath("recordings/room.mp4", 3))
+
+	p := &PipelineConfig{Outputs: map[types.EgressType][]OutputConfig{
+		types.EgressTypeFile: {&FileConfig{outputConfig: outputConfig{OutputType: types.OutputTypeMP4}}},
+	}}
+	req := &rpc.StartEgressRequest{}
+	require.NoError(t, p.updateFileRotation(req))
+	require.False(t, p.GetFileConfig().Rotates())
+
+	duration, err := anypb.New(wrapperspb.String("900"))
+	require.NoError(t, err)
+	size, err := anypb.New(wrapperspb.String("1073741824"))
+	require.NoError(t, err)
+	req.Metadata = map[string]*anypb.Any{
+		fileSegmentDurationMetadataKey: duration,
+		maxFileSizeMetadataKey:         size,
+	}
+	require.NoError(t, p.updateFileRotation(req))
+	require.Equal(t, 15*time.Minute, p.GetFileConfig().SegmentDuration)
+	require.Equal(t, int64(1<<30), p.GetFileConfig().MaxFileSize)
+
+	p.GetFileConfig().OutputType = types.OutputTypeIVF
+	require.Error(t, p.updateFileRotation(req))
+}
+
+func TestTrickleUpload(t *testing.T) {
+	newConfig := func(outputType types.OutputType) *PipelineConfig {
+		return &PipelineConfig{Outputs: map[types.EgressType][]OutputConfig{
+			types.EgressTypeFile: {&FileConfig{
+				outputConfig: outputConfig{OutputType: outputType},
+				UploadConfig: &EgressS3Upload{},
+			}},
+		}}
+	}
+
+	enabled, err := anypb.New(wrapperspb.String("true"))
+	require.NoError(t, err)
+	req := &rpc.StartEgressRequest{Metadata: map[string]*anypb.Any{trickleUploadMetadataKey: enabled}}
+	p := newConfig(types.OutputTypeMP4)
+	require.NoError(t, p.updateTrickleUpload(req))
+	require.True(t, p.GetFileConfig().Trickle)
+
+	// requested outputs that can't trickle fail, configured ones upload once finished
+	p = newConfig(types.OutputTypeIVF)
+	require.Error(t, p.updateTrickleUpload(req))
+	p = newConfig(types.OutputTypeIVF)
+	p.TrickleUpload = true
+	require.NoError(t, p.updateTrickleUpload(&rpc.StartEgressRequest{}))
+	require.False(t, p.GetFileConfig().Trickle)
+
+	invalid, err := anypb.New(wrapperspb.String("sometimes"))
+	require.NoError(t, err)
+	req.Metadata[trickleUploadMetadataKey] = invalid
+	require.Error(t, newConfig(types.OutputTypeMP4).updateTrickleUpload(req))
+}
+
+func TestStreamAuth(t *testing.T) {
+	p := &PipelineConfig{}
+	require.NoError(t, p.updateStreamAuth(metadataRequest(t, streamAuthMetadataKey, `[{
+		"url": "rtmps://live.example.com:443",
+		"app": "live",
+		"stream_key": "abcdefghij",
+		"query": {"token": "secret", "region": "eu"},
+		"secure_token": "challenge"
+	}]`)))
+	require.Len(t, p.StreamAuth, 1)
+	require.Equal(t, "live?region=eu&token=secret", p.StreamAuth[0].Application())
+
+	conf, err := p.getStreamConfig(types.OutputTypeRTMP, []string{"rtmp://localhost/app/key"})
+	require.NoError(t, err)
+	url := "rtmps://live.example.com:443/live/abcdefghij"
+	require.Equal(t, []string{"rtmp://localhost/app/key", url}, conf.Urls)
+	require.Equal(t, p.StreamAuth[0], conf.Auth[url])
+
+	// the stream key is redacted, and auth parameters are never part of the reported url
+	require.Equal(t, "rtmps://live.example.com:443/live/{abc...hij}", conf.StreamInfo[url].Url)
+
+	for _, invalid := range []string{
+		`{"url": "rtmp://localhost"}`,
+		`[{"url": "srt://localhost:9000", "app": "live", "stream_key": "key"}]`,
+		`[{"url": "srt://localhost", "stream_id": "abcdefghij"}]`,
+		`[{"url": "srt://localhost:9000?streamid=abc", "passphrase": "0123456789"}]`,
+		`[{"url": "srt://localhost:9000", "passphrase": "short"}]`,
+		`[{"url": "rtmp://localhost", "app": "live", "stream_key": "key", "stream_id": "abc"}]`,
+		`[{"url": "rtmp://localhost?token=secret", "app": "live", "stream_key": "key"}]`,
+		`[{"url": "rtmp://localhost", "app": "live"}]`,
+	} {
+		require.Error(t, p.updateStreamAuth(metadataRequest(t, streamAuthMetadataKey, invalid)))
+	}
+}
+
+func TestSRTStreamAuth(t *testing.T) {
+	value, err := anypb.New(wrapperspb.String(`[
+		{"url": "srt://live.example.com:9000", "stream_id": "abcdefghij", "passphrase": "0123456789abc"},
+		{"url": "srt://backup.example.com:9000"}
+	]`))
+	require.NoError(t, err)
+
+	p := &PipelineConfig{}
+	require.NoError(t, p.updateStreamAuth(&rpc.StartEgressRequest{Metadata: map[string]*anypb.Any{streamAuthMetadataKey: value}}))
+	require.Len(t, p.StreamAuth, 2)
+
+	conf, err := p.getStreamConfig(types.OutputTypeRTMP, []string{"rtmp://localhost/app/key"})
+	require.NoError(t, err)
+
+	// the stream id identifies the output, and is redacted, while the passphrase is never part of the url
+	url := "srt://live.example.com:9000?streamid=abcdefghij"
+	require.Equal(t, []string{"rtmp://localhost/app/key", url, "srt://backup.example.com:9000"}, conf.Urls)
+	require.Equal(t, "srt://live.example.com:9000?streamid={abc...hij}", conf.StreamInfo[url].Url)
+	require.Equal(t, map[string]string{
+		"streamid":   "abcdefghij",
+		"passphrase": "0123456789abc",
+	}, conf.Auth[url].SRTProperties())
+
+	// the passphrase is only set when given
+	require.Equal(t, map[string]string{"streamid": ""}, conf.Auth["srt://backup.example.com:9000"].SRTProperties())
+}
+
+func TestElementOverrides(t *testing.T) {
+	p := &PipelineConfig{BaseConfig: BaseConfig{ElementOverrides: ElementOverrides{
+		"x264enc": {"tune": "film", "speed-preset": "veryfast"},
+	}}}
+
+	overrides, err := anypb.New(wrapperspb.String(`{"x264enc": {"tune": "zerolatency", "bitrate": "3000"}}`))
+	require.NoError(t, err)
+	req := &rpc.StartEgressRequest{Metadata: map[string]*anypb.Any{elementOverridesMetadataKey: overrides}}
+	require.NoError(t, p.updateElementOverrides(req))
+	require.Equal(t, map[string]string{
+		"tune":         "zerolatency",
+		"bitrate":      "3000",
+		"speed-preset": "veryfast",
+	}, p.ElementOverrides["x264enc"])
+
+	caps, err := anypb.New(wrapperspb.String(`{"capsfilter": {"caps": "video/x-raw"}}`))
+	require.NoError(t, err)
+	req.Metadata[elementOverridesMetadataKey] = caps
+	require.Error(t, p.updateElementOverrides(req))
+
+	invalid, err := anypb.New(wrapperspb.String(`{"x264enc": "tune=zerolatency"}`))
+	require.NoError(t, err)
+	req.Metadata[elementOverridesMetadataKey] = invalid
+	require.Error(t, p.updateElementOverrides(req))
+
+	for _, overrides := range []ElementOverrides{
+		{"filesink": {"location": "/etc/passwd"}},
+		{"rtmp2sink": {"location": "rtmp://attacker.example.com/live"}},
+		{"srtsink": {"uri": "srt://attacker.example.com:9000"}},
+		{"x264enc": {"bitrate": "fast"}},
+		{"x264enc": {"speed-preset": "quick"}},
+		{"x264enc": {"tune": "zerolatency+film"}},
+		{"video_encoder": {"bitrate": "3000"}},
+	} {
+		require.Error(t, overrides.Validate(), overrides)
+	}
+	require.NoError(t, ElementOverrides{
+		"x264enc": {"tune": "zerolatency+fastdecode", "b-adapt": "false"},
+		"queue":   {"leaky": "downstream", "max-size-time": "0"},
+	}.Validate())
+}
+
+func TestUploadEncryption(t *testing.T) {
+	key, err := anypb.New(wrapperspb.String(base64.StdEncoding.EncodeToString(make([]byte, 32))))
+	require.NoError(t, err)
+	p := &PipelineConfig{}
+	req := &rpc.StartEgressRequest{Metadata: map[string]*anypb.Any{uploadEncryptionKeyMetadataKey: key}}
+	require.NoError(t, p.updateUploadEncryption(req))
+	require.True(t, p.UploadEncryption.Enabled)
+
+	// the request key replaces a configured kms key
+	p = &PipelineConfig{}
+	p.UploadEncryption = UploadEncryptionConfig{Enabled: true, KMSKeyID: "alias/egress"}
+	require.NoError(t, p.updateUploadEncryption(req))
+	require.Empty(t, p.UploadEncryption.KMSKeyID)
+
+	short, err := anypb.New(wrapperspb.String(base64.StdEncoding.EncodeToString(make([]byte, 16))))
+	require.NoError(t, err)
+	req.Metadata[uploadEncryptionKeyMetadataKey] = short
+	require.Error(t, p.updateUploadEncryption(req))
+
+	kms, err := anypb.New(wrapperspb.String("alias/egress"))
+	require.NoError(t, err)
+	req.Metadata[uploadEncryptionKeyMetadataKey] = key
+	req.Metadata[uploadEncryptionKMSMetadataKey] = kms
+	require.Error(t, p.updateUploadEncryption(req))
+
+	// segments encrypted for hls playback can't also be sealed for upload, while other outputs can
+	delete(req.Metadata, uploadEncryptionKMSMetadataKey)
+	p = &PipelineConfig{BaseConfig: BaseConfig{HLSEncryption: HLSEncryptionConfig{Enabled: true}}}
+	p.Outputs = map[types.EgressType][]OutputConfig{types.EgressTypeFile: {&FileConfig{}}}
+	require.NoError(t, p.updateUploadEncryption(req))
+	p.Outputs[types.EgressTypeSegments] = []OutputConfig{&SegmentConfig{}}
+	require.Error(t, p.updateUploadEncryption(req))
+}
+
+func TestOverlays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermark.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 200, 100))))
+	require.NoError(t, f.Close())
+
+	o := &OverlaysConfig{
+		Timecode:  TimecodeOverlayConfig{Enabled: true},
+		Watermark: WatermarkConfig{Path: path, Scale: 0.1},
+	}
+	require.NoError(t, o.validate())
+	require.Equal(t, "top", o.Timecode.VAlign)
+	require.Equal(t, "right", o.Timecode.HAlign)
+	require.Equal(t, defaultTimecodeOverlay, o.Timecode.Format)
+	require.Equal(t, "bottom", o.Watermark.VAlign)
+	require.Equal(t, 1.0, o.Watermark.Opacity)
+
+	o.Watermark.Opacity = 1.5
+	require.Error(t, o.validate())
+	o.Watermark.Opacity = 0.5
+	o.Watermark.HAlign = "middle"
+	require.Error(t, o.validate())
+	o.Watermark.HAlign = "left"
+	o.Watermark.Path = filepath.Join(t.TempDir(), "missing.png")
+	require.Error(t, o.validate())
+
+	// only room and track composite video has overlays
+	p := &PipelineConfig{
+		BaseConfig:  BaseConfig{Overlays: *o},
+		VideoConfig: VideoConfig{VideoEncoding: true, VideoDecoding: true},
+	}
+	p.RequestType = types.RequestTypeTrackComposite
+	p.updateOverlays()
+	require.True(t, p.Overlays.Timecode.Enabled)
+	p.RequestType = types.RequestTypeParticipant
+	p.updateOverlays()
+	require.False(t, p.Overlays.Timecode.Enabled)
+	require.Empty(t, p.Overlays.Watermark.Path)
+}
+
+func TestFilenameTemplate(t *testing.T) {
+	template := "recordings/{room_name}/{year}/{month}/{day}/{egress_id}-{index}.mp4"
+	resolve := func(egressID string, template string) string {
+		p := &PipelineConfig{Info: &livekit.EgressInfo{EgressId: egressID, RoomName: "room"}}
+		p.RequestType = types.RequestTypeRoomComposite
+		require.NoError(t, p.validateFilename("filepath", template, true))
+		_, replacements := p.getFilenameInfo()
+		return stringReplace(template, replacements)
+	}
+
+	now := time.Now().UTC()
+	filepath := resolve("EG_1", template)
+	require.Equal(t, fmt.Sprintf("recordings/room/%s/EG_1-{index}.mp4", now.Format("2006/01/02")), filepath)
+	require.Equal(t, fmt.Sprintf("recordings/room/%s/EG_1-00002.mp4", now.Format("2006/01/02")), ChunkFilepath(filepath, 2))
+
+	// egresses in the same room only resolve to different keys when the template includes the egress id
+	require.NotEqual(t, resolve("EG_1", template), resolve("EG_2", template))
+	require.Equal(t, resolve("EG_1", "{room_name}/{year}-{month}-{day}.mp4"), resolve("EG_2", "{room_name}/{year}-{month}-{day}.mp4"))
+
+	p := &PipelineConfig{}
+	p.RequestType = types.RequestTypeRoomComposite
+	require.Error(t, p.validateFilename("filepath", "{room}.mp4", true))
+	require.Error(t, p.validateFilename("filepath", "{index}/room.mp4", true))
+	require.Error(t, p.validateFilename("filename_prefix", "room-{index}", false))
+	require.Error(t, p.validateFilename("filepath", "{publisher_identity}.mp4", true))
+	p.RequestType = types.RequestTypeTrack
+	require.NoError(t, p.validateFilename("filepath", "{publisher_identity}-{track_id}.ogg", true))
+
+	// non-rotating files use the first index
+	o := &FileConfig{FileInfo: &livekit.FileInfo{}, StorageFilepath: "room-{index}.mp4", LocalFilepath: "/tmp/room-{index}.mp4"}
+	o.resolveIndex()
+	require.Equal(t, "room-00000.mp4", o.StorageFilepath)
+	require.Equal(t, "room-00000.mp4", o.FileInfo.Filename)
+	require.Empty(t, o.ChunkFilepath)
+
+	// rotating files keep the token for chunks, and name sidecars after the first chunk
+	o = &FileConfig{
+		FileInfo:        &livekit.FileInfo{},
+		StorageFilepath: "recordings/room-{index}.mp4",
+		LocalFilepath:   "/tmp/EG_1/room-{index}.mp4",
+		SegmentDuration: time.Minute,
+	}
+	o.resolveIndex()
+	require.Equal(t, "recordings/room-00000.mp4", o.StorageFilepath)
+	require.Equal(t, "recordings/room-00000.mp4", o.FileInfo.Filename)
+	require.Equal(t, "/tmp/EG_1/room-00000.mp4", o.LocalFilepath)
+	require.Equal(t, "/tmp/EG_1/room-00003.mp4", ChunkFilepath(o.ChunkFilepath, 3))
+	require.NotContains(t, fmt.Sprintf("%s.json", o.StorageFilepath), IndexToken)
+
+	// resolving again, as sdk egresses do once the filepath is known, keeps the chunk template
+	o.resolveIndex()
+	require.Equal(t, "/tmp/EG_1/room-{index}.mp4", o.ChunkFilepath)
+}
+
+func TestAudioTracks(t *testing.T) {
+	tracks := `[{"track_id": "TR_interpretation", "language": "spa"}, {"track_id": "TR_original", "language": "eng"}]`
+
+	// the requested audio track is recorded first
+	p := &PipelineConfig{}
+	p.AudioTrackID = "TR_original"
+	require.NoError(t, p.updateAudioTracks(metadataRequest(t, audioTracksMetadataKey, tracks)))
+	require.Equal(t, []*AudioTrackConfig{
+		{TrackID: "TR_original", Language: "eng"},
+		{TrackID: "TR_interpretation", Language: "spa"},
+	}, p.AudioTracks)
+
+	// or defaults to the first listed track
+	p = &PipelineConfig{}
+	require.NoError(t, p.updateAudioTracks(metadataRequest(t, audioTracksMetadataKey, tracks)))
+	require.True(t, p.AudioEnabled)
+	require.Equal(t, "TR_interpretation", p.AudioTrackID)
+
+	for _, invalid := range []string{
+		`{"track_id": "TR_original"}`,
+		`[]`,
+		`[{"track_id": "TR_original", "language": "english"}]`,
+		`[{"track_id": "TR_original"}, {"track_id": "TR_original"}]`,
+	} {
+		require.Error(t, p.updateAudioTracks(metadataRequest(t, audioTracksMetadataKey, invalid)))
+	}
+
+	// multitrack needs file outputs which can mux several audio tracks
+	p.Outputs = map[types.EgressType][]OutputConfig{
+		types.EgressTypeFile: {&FileConfig{outputConfig: outputConfig{OutputType: types.OutputTypeMP4}}},
+	}
+	require.NoError(t, p.updateAudioMode(metadataRequest(t, audioModeMetadataKey, "multitrack")))
+	require.Equal(t, types.AudioModeMultitrack, p.AudioMode)
+
+	p.Outputs[types.EgressTypeStream] = []OutputConfig{&StreamConfig{outputConfig: outputConfig{OutputType: types.OutputTypeRTMP}}}
+	require.NoError(t, p.updateAudioMode(metadataRequest(t)))
+	require.Equal(t, types.AudioModeMix, p.AudioMode)
+
+	require.Error(t, p.updateAudioMode(metadataRequest(t, audioModeMetadataKey, "stereo")))
+}
+
+func TestRoll(t *testing.T) {
+	p := &PipelineConfig{
+		Outputs: map[types.EgressType][]OutputConfig{
+			types.EgressTypeFile: {&FileConfig{outputConfig: outputConfig{OutputType: types.OutputTypeMP4}}},
+		},
+	}
+	p.RequestType = types.RequestTypeTrackComposite
+	p.VideoEnabled = true
+	require.NoError(t, p.updateRoll(metadataRequest(t, preRollMetadataKey, "5", postRollMetadataKey, "2.5", awaitMarkStartMetadataKey, "true")))
+	require.Equal(t, 5*time.Second, p.PreRoll)
+	require.Equal(t, 2500*time.Millisecond, p.PostRoll)
+	require.True(t, p.StartGated())
+
+	// video holds a keyframe interval beyond the pre-roll
+	require.Equal(t, 5*time.Second+defaultPreRollKeyframeMargin, p.PreRollWindow())
+	p.KeyFrameInterval = 2
+	require.Equal(t, 7*time.Second, p.PreRollWindow())
+
+	require.Error(t, p.updateRoll(metadataRequest(t, preRollMetadataKey, "60")))
+	require.Error(t, p.updateRoll(metadataRequest(t, postRollMetadataKey, "-1")))
+
+	// without encoded outputs, recording can't be held back
+	p.Outputs = map[types.EgressType][]OutputConfig{}
+	require.Error(t, p.updateRoll(metadataRequest(t)))
+	p.AwaitMarkStart = false
+	require.NoError(t, p.updateRoll(metadataRequest(t)))
+	require.Zero(t, p.PreRoll)
+	require.False(t, p.StartGated())
+}
+
+func TestNoInput(t *testing.T) {
+	p := &PipelineConfig{}
+	p.RequestType = types.RequestTypeTrackComposite
+	require.NoError(t, p.updateNoInput(metadataRequest(t, noInputTimeoutMetadataKey, "30")))
+	require.Equal(t, 30*time.Second, p.NoInputTimeout)
+	require.False(t, p.PlaceholderCountsAsInput())
+	require.Error(t, p.updateNoInput(metadataRequest(t, noInputTimeoutMetadataKey, "-1")))
+	require.Error(t, p.updateNoInput(metadataRequest(t, placeholderInputMetadataKey, "maybe")))
+
+	// template output only counts as input for web requests, and only when enabled
+	require.NoError(t, p.updateNoInput(metadataRequest(t, placeholderInputMetadataKey, "true")))
+	require.False(t, p.PlaceholderCountsAsInput())
+	p.RequestType = types.RequestTypeRoomComposite
+	p.AwaitStartSignal = true
+	require.True(t, p.PlaceholderCountsAsInput())
+
+	// web egress without a start signal can't tell participant media from template output
+	p.RequestType = types.RequestTypeWeb
+	p.AwaitStartSignal = false
+	p.PlaceholderInput = false
+	require.NoError(t, p.updateNoInput(metadataRequest(t)))
+	require.Zero(t, p.NoInputTimeout)
+}
+
+func TestRecoveryState(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := ReadRecoveryState(dir)
+	require.NoError(t, err)
+	require.Nil(t, state)
+
+	expected := &RecoveryState{
+		EgressID:        "EG_test",
+		OutputType:      types.OutputTypeMP4,
+		StorageFilepath: "recordings/room.mp4",
+		Chunks: []*RecoveryChunk{
+			{
+				FileChunk:     FileChunk{Filename: "recordings/room_00000.mp4", Location: "s3://bucket/recordings/room_00000.mp4", Size: 100},
+				LocalFilepath: "/tmp/EG_test/room_00000.mp4",
+				Uploaded:      true,
+			},
+			{
+				FileChunk:     FileChunk{Filename: "recordings/room_00001.mp4", Size: 50, Offset: 100},
+				LocalFilepath: "/tmp/EG_test/room_00001.mp4",
+			},
+		},
+	}
+	require.NoError(t, WriteRecoveryState(dir, expected))
+	expected.Chunks[1].Size = 80
+	require.NoError(t, WriteRecoveryState(dir, expected))
+
+	state, err = ReadRecoveryState(dir)
+	require.NoError(t, err)
+	require.Equal(t, expected, state)
+
+	require.NoError(t, RemoveRecoveryState(dir))
+	require.NoError(t, RemoveRecoveryState(dir))
+	state, err = ReadRecoveryState(dir)
+	require.NoError(t, err)
+	require.Nil(t, state)
+}
+
+func TestMarkRecoveryFailed(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, MarkRecoveryFailed(dir))
+
+	require.NoError(t, WriteRecoveryState(dir, &RecoveryState{EgressID: "EG_test"}))
+	require.NoError(t, MarkRecoveryFailed(dir))
+
+	// no longer found by recovery, but kept for operators
+	state, err := ReadRecoveryState(dir)
+	require.NoError(t, err)
+	require.Nil(t, state)
+	require.FileExists(t, filepath.Join(dir, failedRecoveryFilename))
+}
+
+func TestLockHandlerDir(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := LockHandlerDir(dir)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+
+	// held by a running handler
+	other, err := LockHandlerDir(dir)
+	require.NoError(t, err)
+	require.Nil(t, other)
+
+	// released when the handler exits
+	require.NoError(t, lock.Close())
+	other, err = LockHandlerDir(dir)
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	require.NoError(t, other.Close())
+}
+
+func TestRecoveryRequest(t *testing.T) {
+	req := &rpc.StartEgressRequest{
+		EgressId: "EG_test",
+		Request: &rpc.StartEgressRequest_Track{
+			Track: &livekit.TrackEgressRequest{
+				RoomName: "room",
+				TrackId:  "TR_test",
+				Output: &livekit.TrackEgressRequest_File{
+					File: &livekit.DirectFileOutput{
+						Output: &livekit.DirectFileOutput_S3{S3: &livekit.S3Upload{AccessKey: "access", Secret: "secret"}},
+					},
+				},
+			},
+		},
+	}
+
+	sealed, err := SealRecoveryRequest("api_secret", req)
+	require.NoError(t, err)
+	require.NotContains(t, string(sealed), "secret")
+
+	opened, err := OpenRecoveryRequest("api_secret", sealed)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(req, opened))
+
+	_, err = OpenRecoveryRequest("other_secret", sealed)
+	require.Error(t, err)
+	_, err = SealRecoveryRequest("", req)
+	require.Error(t, err)
+
+	// kept in the state written by the handler
+	conf, err := NewPipelineConfig("api_key: key\napi_secret: api_secret\nws_url: wss://test\ncrash_recovery: true", req)
+	require.NoError(t, err)
+	opened, err = OpenRecoveryRequest("api_secret", conf.SealedRequest)
+	require.NoError(t, err)
+	require.Equal(t, "EG_test", opened.EgressId)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	require.Greater(t, defaultDrainTimeout, EOSTimeout)
+
+	// outputs could never be finalized before the drain is abandoned
+	_, err := NewPipelineConfig("drain_timeout: 30s", &rpc.StartEgressRequest{EgressId: "EG_drain"})
+	require.ErrorContains(t, err, "drain_timeout")
+}
+
+// metadataRequest returns a request with string metadata, from alternating keys and values
+func metadataRequest(t *testing.T, kv ...string) *rpc.StartEgressRequest {
+	req := &rpc.StartEgressRequest{Metadata: make(map[string]*anypb.Any)}
+	for i := 0; i < len(kv); i += 2 {
+		value, err := anypb.New(wrapperspb.String(kv[i+1]))
+		require.NoError(t, err)
+		req.Metadata[kv[i]] = value
+	}
+	return req
+}
+
+func TestUpdateMetadataErrors(t *testing.T) {
+	conf := &ServiceConfig{BaseConfig: BaseConfig{NodeID: "server"}}
+
+	req := metadataRequest(t, noInputTimeoutMetadataKey, "-1", audioLevelsMetadataKey, "maybe", duplicateFramesMetadataKey, "often")
+	req.EgressId = "test_metadata"
+	req.Request = &rpc.StartEgressRequest_Web{
+		Web: &livekit.WebEgressRequest{
+			Url: "https://example.com",
+			Output: &livekit.WebEgressRequest_File{
+				File: &livekit.EncodedFileOutput{Filepath: "recording.mp4"},
+			},
+		},
+	}
+
+	// every invalid option is reported, not just the first
+	_, err := GetValidatedPipelineConfig(conf, req)
+	require.Error(t, err)
+	require.Len(t, strings.Split(err.Error(), "\n"), 3)
+	require.Contains(t, err.Error(), audioLevelsMetadataKey)
+	require.Contains(t, err.Error(), duplicateFramesMetadataKey)
+
+	// a valid value overrides the service setting for this request only
+	req = metadataRequest(t, duplicateFramesMetadataKey, "true")
+	req.EgressId = "test_duplicate_frames"
+	req.Request = &rpc.StartEgressRequest_Web{
+		Web: &livekit.WebEgressRequest{
+			Url: "https://example.com",
+			Output: &livekit.WebEgressRequest_File{
+				File: &livekit.EncodedFileOutput{Filepath: "recording.mp4"},
+			},
+		},
+	}
+	p, err := GetValidatedPipelineConfig(conf, req)
+	require.NoError(t, err)
+	require.True(t, p.DuplicateFrames)
+	require.False(t, conf.DuplicateFrames)
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/livekit/egress/pkg/errors"
+)
+
+type propertyKind int
+
+const (
+	propertyInt propertyKind = iota
+	propertyUint
+	propertyBool
+	propertyString
+	propertyEnum
+	propertyFlags
+)
+
+type elementProperty struct {
+	kind  propertyKind
+	nicks []string // enum or flags values
+}
+
+func enumProperty(nicks ...string) elementProperty {
+	return elementProperty{kind: propertyEnum, nicks: nicks}
+}
+
+func flagsProperty(nicks ...string) elementProperty {
+	return elementProperty{kind: propertyFlags, nicks: nicks}
+}
+
+var (
+	intProperty    = elementProperty{kind: propertyInt}
+	uintProperty   = elementProperty{kind: propertyUint}
+	boolProperty   = elementProperty{kind: propertyBool}
+	stringProperty = elementProperty{kind: propertyString}
+)
+
+// overridableProperties lists, by element factory, the tuning properties which can be overridden.
+// Anything else, such as sink locations, uris and hosts or the caps the pipeline links with, is rejected
+var overridableProperties = map[string]map[string]elementProperty{
+	"x264enc": {
+		"bitrate":          uintProperty,
+		"speed-preset":     enumProperty("none", "ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow", "placebo"),
+		"tune":             flagsProperty("stillimage", "fastdecode", "zerolatency"),
+		"pass":             enumProperty("cbr", "quant", "qual", "pass1", "pass2", "pass3"),
+		"quantizer":        uintProperty,
+		"qp-min":           uintProperty,
+		"qp-max":           uintProperty,
+		"key-int-max":      uintProperty,
+		"bframes":          uintProperty,
+		"b-adapt":          boolProperty,
+		"ref":              uintProperty,
+		"rc-lookahead":     intProperty,
+		"vbv-buf-capacity": uintProperty,
+		"threads":          uintProperty,
+		"sliced-threads":   boolProperty,
+		"cabac":            boolProperty,
+		"dct8x8":           boolProperty,
+	},
+	"vp9enc": {
+		"target-bitrate":    intProperty,
+		"end-usage":         enumProperty("vbr", "cbr", "cq", "q"),
+		"cpu-used":          intProperty,
+		"deadline":          intProperty,
+		"keyframe-max-dist": intProperty,
+		"lag-in-frames":     intProperty,
+		"threads":           intProperty,
+		"row-mt":            boolProperty,
+	},
+	"nvh264enc": {
+		"bitrate":     uintProperty,
+		"max-bitrate": uintProperty,
+		"gop-size":    intProperty,
+		"bframes":     uintProperty,
+		"zerolatency": boolProperty,
+	},
+	"vah264enc": {
+		"bitrate":     uintProperty,
+		"key-int-max": uintProperty,
+		"b-frames":    uintProperty,
+		"ref-frames":  uintProperty,
+	},
+	"vaapih264enc": {
+		"bitrate":         uintProperty,
+		"keyframe-period": uintProperty,
+		"max-bframes":     uintProperty,
+	},
+	"qsvh264enc": {
+		"bitrate":     uintProperty,
+		"max-bitrate": uintProperty,
+		"gop-size":    uintProperty,
+		"b-frames":    uintProperty,
+	},
+	"opusenc": {
+		"bitrate":                intProperty,
+		"bitrate-type":           enumProperty("cbr", "vbr", "constrained-vbr"),
+		"complexity":             intProperty,
+		"frame-size":             enumProperty("2.5", "5", "10", "20", "40", "60"),
+		"inband-fec":             boolProperty,
+		"packet-loss-percentage": intProperty,
+		"dtx":                    boolProperty,
+	},
+	"faac": {
+		"bitrate": intProperty,
+	},
+	"queue": {
+		"max-size-buffers": uintProperty,
+		"max-size-bytes":   uintProperty,
+		"max-size-time":    uintProperty,
+		"leaky":            enumProperty("no", "upstream", "downstream"),
+	},
+	"videoscale": {
+		"method": enumProperty("nearest-neighbour", "bilinear", "4-tap", "lanczos", "bilinear2", "sinc", "hermite", "spline", "catrom", "mitchell"),
+	},
+	"audioresample": {
+		"quality": intProperty,
+	},
+	"textoverlay": {
+		"font-desc": stringProperty,
+	},
+	"srtsink": {
+		"latency": intProperty,
+	},
+	"rtmp2sink": {
+		"chunk-size": uintProperty,
+		"peak-kbps":  uintProperty,
+	},
+}
+
+// ElementOverrides maps gstreamer element factory names to property values, set before the pipeline is linked.
+// Values use gst-launch syntax, so enums are set by nick (speed-preset=veryfast) and flags joined with + (tune=zerolatency)
+type ElementOverrides map[string]map[string]string
+
+// Merge returns a copy of h with the properties in o added, replacing values for the same element and property
+func (h ElementOverrides) Merge(o ElementOverrides) ElementOverrides {
+	merged := make(ElementOverrides, len(h)+len(o))
+	for _, overrides := range []ElementOverrides{h, o} {
+		for element, properties := range overrides {
+			if merged[element] == nil {
+				merged[element] = make(map[string]string, len(properties))
+			}
+			for property, value := range properties {
+				merged[element][property] = value
+			}
+		}
+	}
+	return merged
+}
+
+// Validate rejects overrides of elements or properties which are not allowed, and values of the wrong type
+func (h ElementOverrides) Validate() error {
+	for element, properties := range h {
+		allowed, ok := overridableProperties[element]
+		if !ok {
+			return errors.ErrInvalidElementOverride(element, "element cannot be overridden")
+		}
+		for property, value := range properties {
+			p, ok := allowed[property]
+			if !ok {
+				return errors.ErrInvalidElementOverride(element, fmt.Sprintf("%s cannot be overridden", property))
+			}
+			if !p.valid(value) {
+				return errors.ErrInvalidElementOverride(element, fmt.Sprintf("invalid %s %q", property, value))
+			}
+		}
+	}
+	return nil
+}
+
+func (p elementProperty) valid(value string) bool {
+	var err error
+	switch p.kind {
+	case propertyInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case propertyUint:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case propertyBool:
+		_, err = strconv.ParseBool(value)
+	case propertyString:
+		return true
+	case propertyEnum:
+		return slices.Contains(p.nicks, value)
+	case propertyFlags:
+		for _, flag := range strings.Split(value, "+") {
+			if !slices.Contains(p.nicks, flag) {
+				return false
+			}
+		}
+		return true
+	}
+	return err == nil
+}
@@ -15,11 +15,136 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/egress"
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
+)
+
+type EncodingProfilesConfig struct {
+	Profiles map[string]*EncodingProfile `yaml:"profiles"`
+	Defaults map[string]string           `yaml:"defaults"` // profile used when none is requested, by output type (file, stream, segments or multiple)
+}
+
+type EncodingProfile struct {
+	Width            int32   `yaml:"width"`
+	Height           int32   `yaml:"height"`
+	Depth            int32   `yaml:"depth"`
+	Framerate        int32   `yaml:"framerate"`
+	AudioCodec       string  `yaml:"audio_codec"` // opus or aac
+	AudioBitrate     int32   `yaml:"audio_bitrate"`
+	AudioFrequency   int32   `yaml:"audio_frequency"`
+	VideoCodec       string  `yaml:"video_codec"` // h264_baseline, h264_main or h264_high
+	VideoBitrate     int32   `yaml:"video_bitrate"`
+	KeyFrameInterval float64 `yaml:"key_frame_interval"`
+}
+
+var (
+	profileAudioCodecs = map[string]livekit.AudioCodec{
+		"opus": livekit.AudioCodec_OPUS,
+		"aac":  livekit.AudioCodec_AAC,
+	}
+	profileVideoCodecs = map[string]livekit.VideoCodec{
+		"h264_baseline": livekit.VideoCodec_H264_BASELINE,
+		"h264_main":     livekit.VideoCodec_H264_MAIN,
+		"h264_high":     livekit.VideoCodec_H264_HIGH,
+	}
 )
 
+// toEncodingOptions converts a profile so that it is applied and validated like advanced request options
+func (e *EncodingProfile) toEncodingOptions() (*livekit.EncodingOptions, error) {
+	opts := &livekit.EncodingOptions{
+		Width:            e.Width,
+		Height:           e.Height,
+		Depth:            e.Depth,
+		Framerate:        e.Framerate,
+		AudioBitrate:     e.AudioBitrate,
+		AudioFrequency:   e.AudioFrequency,
+		VideoBitrate:     e.VideoBitrate,
+		KeyFrameInterval: e.KeyFrameInterval,
+	}
+	if e.AudioCodec != "" {
+		codec, ok := profileAudioCodecs[e.AudioCodec]
+		if !ok {
+			return nil, fmt.Errorf("invalid audio_codec %s", e.AudioCodec)
+		}
+		opts.AudioCodec = codec
+	}
+	if e.VideoCodec != "" {
+		codec, ok := profileVideoCodecs[e.VideoCodec]
+		if !ok {
+			return nil, fmt.Errorf("invalid video_codec %s", e.VideoCodec)
+		}
+		opts.VideoCodec = codec
+	}
+	return opts, nil
+}
+
+func (c *BaseConfig) validateEncodingProfiles() error {
+	for name, profile := range c.EncodingProfiles.Profiles {
+		if profile == nil {
+			return fmt.Errorf("empty encoding profile %s", name)
+		}
+		opts, err := profile.toEncodingOptions()
+		if err == nil {
+			err = (&PipelineConfig{}).applyAdvanced(opts)
+		}
+		if err != nil {
+			return fmt.Errorf("encoding profile %s: %v", name, err)
+		}
+	}
+	for outputType, name := range c.EncodingProfiles.Defaults {
+		if _, ok := c.EncodingProfiles.Profiles[name]; !ok {
+			return fmt.Errorf("default %s encoding profile %s not found", outputType, name)
+		}
+	}
+	return nil
+}
+
+// applyEncodingProfile applies the profile named in the request metadata, or the default profile for its output type
+func (p *PipelineConfig) applyEncodingProfile(request *rpc.StartEgressRequest) error {
+	var req egress.EncodedOutput
+	switch r := request.Request.(type) {
+	case *rpc.StartEgressRequest_RoomComposite:
+		req = r.RoomComposite
+	case *rpc.StartEgressRequest_Web:
+		req = r.Web
+	case *rpc.StartEgressRequest_Participant:
+		req = r.Participant
+	case *rpc.StartEgressRequest_TrackComposite:
+		req = r.TrackComposite
+	default:
+		// track egress is not transcoded
+		return nil
+	}
+
+	name := getMetadataString(request, encodingProfileMetadataKey)
+	if name == "" {
+		name = p.EncodingProfiles.Defaults[egress.GetOutputType(req)]
+		if name == "" {
+			return nil
+		}
+	}
+
+	profile, ok := p.EncodingProfiles.Profiles[name]
+	if !ok || profile == nil {
+		return errors.ErrUnknownEncodingProfile(name)
+	}
+	opts, err := profile.toEncodingOptions()
+	if err != nil {
+		return errors.ErrCouldNotParseConfig(err)
+	}
+	if err = p.applyAdvanced(opts); err != nil {
+		return err
+	}
+
+	p.EncodingProfile = name
+	return nil
+}
+
 func (p *PipelineConfig) applyPreset(preset livekit.EncodingOptionsPreset) {
 	switch preset {
 	case livekit.EncodingOptionsPreset_H264_720P_30:
@@ -0,0 +1,105 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// IndexToken is replaced by the zero-padded chunk index of rotated file outputs, and by 00000 otherwise
+const IndexToken = "{index}"
+
+var filenameTokenRegexp = regexp.MustCompile(`\{[^{}/]*\}`)
+
+// tokens resolved when the request is parsed
+var filenameTokens = map[string]bool{
+	"{room_name}": true,
+	"{room_id}":   true,
+	"{egress_id}": true,
+	"{time}":      true,
+	"{utc}":       true,
+	"{unix}":      true,
+	"{year}":      true,
+	"{month}":     true,
+	"{day}":       true,
+	"{hour}":      true,
+	"{minute}":    true,
+	"{second}":    true,
+}
+
+// tokens resolved once the sdk source has subscribed to its tracks
+var sdkFilenameTokens = map[types.RequestType]map[string]bool{
+	types.RequestTypeParticipant: {
+		"{publisher_identity}": true,
+	},
+	types.RequestTypeTrackComposite: {
+		"{publisher_identity}": true,
+	},
+	types.RequestTypeTrack: {
+		"{publisher_identity}": true,
+		"{track_id}":           true,
+		"{track_type}":         true,
+		"{track_source}":       true,
+	},
+}
+
+func (p *PipelineConfig) getFilenameInfo() (string, map[string]string) {
+	now := time.Now()
+	utc := fmt.Sprintf("%s%03d", now.Format("20060102150405"), now.UnixMilli()%1000)
+	date := now.UTC()
+	replacements := map[string]string{
+		"{egress_id}": p.Info.EgressId,
+		"{time}":      now.Format("2006-01-02T150405"),
+		"{utc}":       utc,
+		"{unix}":      fmt.Sprint(now.Unix()),
+		"{year}":      date.Format("2006"),
+		"{month}":     date.Format("01"),
+		"{day}":       date.Format("02"),
+		"{hour}":      date.Format("15"),
+		"{minute}":    date.Format("04"),
+		"{second}":    date.Format("05"),
+	}
+
+	if p.Info.RoomName != "" {
+		replacements["{room_name}"] = p.Info.RoomName
+		replacements["{room_id}"] = p.Info.RoomId
+		return p.Info.RoomName, replacements
+	}
+	return "web", replacements
+}
+
+// validateFilename rejects tokens that would be left in the filename unreplaced.
+// The index token is only allowed in the file name of file outputs, where each chunk is written.
+func (p *PipelineConfig) validateFilename(field, filename string, allowIndex bool) error {
+	for _, token := range filenameTokenRegexp.FindAllString(filename, -1) {
+		switch {
+		case filenameTokens[token], sdkFilenameTokens[p.RequestType][token]:
+		case token == IndexToken && allowIndex:
+			if strings.Contains(path.Dir(filename), IndexToken) {
+				return errors.ErrInvalidFilenameToken(field, token, "only supported in the file name")
+			}
+		default:
+			return errors.ErrInvalidFilenameToken(field, token, "unknown token")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// HostOverrides maps hostnames to static IPs for outbound upload and stream connections
+type HostOverrides map[string]string
+
+// DialContext wraps dialer, connecting to the overridden IP for matching hosts
+func (h HostOverrides) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if ip, ok := h[host]; ok {
+				logger.Debugw("dialing host override", "host", host, "ip", ip)
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// RewriteURL replaces an overridden hostname with its IP, for clients which do their own resolution.
+// TLS urls are left unchanged, since certificate validation requires the original hostname.
+func (h HostOverrides) RewriteURL(rawUrl string) string {
+	if len(h) == 0 {
+		return rawUrl
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	ip, ok := h[u.Hostname()]
+	if !ok {
+		return rawUrl
+	}
+	if u.Scheme != "rtmp" && u.Scheme != "srt" {
+		logger.Warnw("host override not applied", nil, "host", u.Hostname(), "scheme", u.Scheme)
+		return rawUrl
+	}
+
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(ip, port)
+	} else {
+		u.Host = ip
+	}
+	return u.String()
+}
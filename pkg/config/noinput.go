@@ -0,0 +1,60 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+)
+
+// updateNoInput applies no_input_timeout request metadata in seconds, and placeholder_input
+func (p *PipelineConfig) updateNoInput(req *rpc.StartEgressRequest) error {
+	if v := getMetadataString(req, noInputTimeoutMetadataKey); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil || seconds < 0 {
+			return errors.ErrInvalidInput(noInputTimeoutMetadataKey)
+		}
+		p.NoInputTimeout = time.Duration(seconds * float64(time.Second))
+	}
+	if v := getMetadataString(req, placeholderInputMetadataKey); v != "" {
+		placeholder, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.ErrInvalidInput(placeholderInputMetadataKey)
+		}
+		p.PlaceholderInput = placeholder
+	}
+
+	if p.NoInputTimeout > 0 && p.isWebRequest() && !p.AwaitStartSignal && !p.PlaceholderInput {
+		// the template only reports participant media through the start signal
+		logger.Warnw("no_input_timeout requires await_start_signal or placeholder_input for web egress, disabling", nil)
+		p.NoInputTimeout = 0
+	}
+	return nil
+}
+
+// PlaceholderCountsAsInput is true when media rendered by a web template counts as input,
+// rather than the template's start signal
+func (p *PipelineConfig) PlaceholderCountsAsInput() bool {
+	return p.PlaceholderInput && p.isWebRequest()
+}
+
+func (p *PipelineConfig) isWebRequest() bool {
+	return p.RequestType == types.RequestTypeRoomComposite || p.RequestType == types.RequestTypeWeb
+}
@@ -18,7 +18,6 @@ import (
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
-	"github.com/livekit/protocol/utils"
 )
 
 type OutputConfig interface {
@@ -109,7 +108,7 @@ func (p *PipelineConfig) updateEncodedOutputs(req EncodedOutput) error {
 		}
 
 		p.Outputs[types.EgressTypeStream] = []OutputConfig{conf}
-		p.OutputCount += len(stream.Urls)
+		p.OutputCount += len(conf.Urls)
 		if p.VideoEnabled {
 			p.VideoEncoding = true
 		}
@@ -121,7 +120,7 @@ func (p *PipelineConfig) updateEncodedOutputs(req EncodedOutput) error {
 		p.Info.StreamResults = streamInfoList
 		if len(files)+len(segments) == 0 {
 			// empty stream output only valid in combination with other outputs
-			if len(stream.Urls) == 0 {
+			if len(conf.Urls) == 0 {
 				return errors.ErrInvalidInput("stream url")
 			}
 
@@ -266,7 +265,7 @@ func redactEncodedOutputs(out EncodedOutput) {
 
 func redactStreamKeys(stream *livekit.StreamOutput) {
 	for i, url := range stream.Urls {
-		if redacted, ok := utils.RedactStreamKey(url); ok {
+		if redacted, ok := RedactStreamUrl(url); ok {
 			stream.Urls[i] = redacted
 		}
 	}
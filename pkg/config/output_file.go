@@ -34,6 +34,56 @@ type FileConfig struct {
 
 	DisableManifest bool
 	UploadConfig    UploadConfig
+	Trickle         bool // upload in parts while the file is written, with a muxer that never rewrites earlier bytes
+
+	// rotation, set from request metadata
+	SegmentDuration time.Duration // start a new file after this much media
+	MaxFileSize     int64         // start a new file before reaching this many bytes
+	ChunkFilepath   string        // local filepath chunks are named from, which may contain the index token
+	Chunks          []*FileChunk  // completed files, in order
+	Waveform        *FileArtifact // uploaded waveform png, for audio only outputs
+}
+
+// FileArtifact is a file uploaded alongside the recording, which is reported in the manifest rather than as a file result
+type FileArtifact struct {
+	Filename string `json:"filename"`
+	Location string `json:"location,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// FileChunk is a completed file of a rotating file output
+type FileChunk struct {
+	Filename  string `json:"filename"`
+	Location  string `json:"location,omitempty"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset"` // byte offset of the chunk within the whole recording
+	StartedAt int64  `json:"started_at"`
+	EndedAt   int64  `json:"ended_at"`
+}
+
+// Rotates returns true if the output is split into multiple files
+func (o *FileConfig) Rotates() bool {
+	return o.SegmentDuration > 0 || o.MaxFileSize > 0
+}
+
+// ChunkFilepath replaces the index token with the chunk index, or inserts it before the file extension
+func ChunkFilepath(filepath string, index uint) string {
+	if strings.Contains(filepath, IndexToken) {
+		return strings.ReplaceAll(filepath, IndexToken, fmt.Sprintf("%05d", index))
+	}
+	ext := path.Ext(filepath)
+	return fmt.Sprintf("%s_%05d%s", strings.TrimSuffix(filepath, ext), index, ext)
+}
+
+// resolveIndex replaces the index token with the first index. Rotating outputs keep the token in the chunk filepath,
+// while sidecars such as the manifest are named after the first chunk
+func (o *FileConfig) resolveIndex() {
+	if o.Rotates() && o.ChunkFilepath == "" {
+		o.ChunkFilepath = o.LocalFilepath
+	}
+	o.StorageFilepath = strings.ReplaceAll(o.StorageFilepath, IndexToken, fmt.Sprintf("%05d", 0))
+	o.LocalFilepath = strings.ReplaceAll(o.LocalFilepath, IndexToken, fmt.Sprintf("%05d", 0))
+	o.FileInfo.Filename = o.StorageFilepath
 }
 
 func (p *PipelineConfig) GetFileConfig() *FileConfig {
@@ -77,6 +127,9 @@ func (p *PipelineConfig) getFileConfig(outputType types.OutputType, req fileRequ
 		DisableManifest: req.GetDisableManifest(),
 		UploadConfig:    p.getUploadConfig(req),
 	}
+	if err := p.validateFilename("filepath", conf.StorageFilepath, true); err != nil {
+		return nil, err
+	}
 
 	// filename
 	identifier, replacements := p.getFilenameInfo()
@@ -92,24 +145,6 @@ func (p *PipelineConfig) getFileConfig(outputType types.OutputType, req fileRequ
 	return conf, nil
 }
 
-func (p *PipelineConfig) getFilenameInfo() (string, map[string]string) {
-	now := time.Now()
-	utc := fmt.Sprintf("%s%03d", now.Format("20060102150405"), now.UnixMilli()%1000)
-	if p.Info.RoomName != "" {
-		return p.Info.RoomName, map[string]string{
-			"{room_name}": p.Info.RoomName,
-			"{room_id}":   p.Info.RoomId,
-			"{time}":      now.Format("2006-01-02T150405"),
-			"{utc}":       utc,
-		}
-	}
-
-	return "web", map[string]string{
-		"{time}": now.Format("2006-01-02T150405"),
-		"{utc}":  utc,
-	}
-}
-
 func (o *FileConfig) updateFilepath(p *PipelineConfig, identifier string, replacements map[string]string) error {
 	o.StorageFilepath = stringReplace(o.StorageFilepath, replacements)
 
@@ -37,6 +37,7 @@ type SegmentConfig struct {
 	SegmentPrefix        string
 	SegmentSuffix        livekit.SegmentedFileSuffix
 	SegmentDuration      int
+	AudioOnly            bool
 
 	DisableManifest bool
 	UploadConfig    UploadConfig
@@ -59,10 +60,21 @@ func (p *PipelineConfig) getSegmentConfig(segments *livekit.SegmentedFileOutput)
 		PlaylistFilename:     clean(segments.PlaylistName),
 		LivePlaylistFilename: clean(segments.LivePlaylistName),
 		SegmentDuration:      int(segments.SegmentDuration),
+		AudioOnly:            !p.VideoEnabled,
 		DisableManifest:      segments.DisableManifest,
 		UploadConfig:         p.getUploadConfig(segments),
 	}
 
+	for field, filename := range map[string]string{
+		"filename_prefix":    conf.SegmentPrefix,
+		"playlist_name":      conf.PlaylistFilename,
+		"live_playlist_name": conf.LivePlaylistFilename,
+	} {
+		if err := p.validateFilename(field, filename, false); err != nil {
+			return nil, err
+		}
+	}
+
 	if conf.SegmentDuration == 0 {
 		conf.SegmentDuration = 4
 	}
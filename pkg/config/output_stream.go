@@ -15,8 +15,13 @@
 package config
 
 import (
+	"net/url"
+	"strings"
+
+	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/utils"
 )
 
 type StreamConfig struct {
@@ -24,6 +29,7 @@ type StreamConfig struct {
 
 	Urls       []string
 	StreamInfo map[string]*livekit.StreamInfo
+	Auth       map[string]*StreamAuth // keyed by url, for outputs given in parts
 }
 
 func (p *PipelineConfig) GetStreamConfig() *StreamConfig {
@@ -42,6 +48,59 @@ func (p *PipelineConfig) GetWebsocketConfig() *StreamConfig {
 	return o[0].(*StreamConfig)
 }
 
+// GetStreamOutputType returns the stream output type for a url, based on its scheme.
+// srt urls share the rtmp output's h264/aac encoders, muxed to mpegts instead of flv
+func GetStreamOutputType(rawUrl string) (types.OutputType, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", errors.ErrInvalidUrl(rawUrl, err.Error())
+	}
+
+	switch parsed.Scheme {
+	case "rtmp", "rtmps", "mux", "srt":
+		return types.OutputTypeRTMP, nil
+	case "ws", "wss":
+		return types.OutputTypeRaw, nil
+	default:
+		return "", errors.ErrInvalidUrl(rawUrl, "invalid scheme")
+	}
+}
+
+// IsSRTUrl returns true for srt stream urls
+func IsSRTUrl(rawUrl string) bool {
+	return strings.HasPrefix(rawUrl, "srt://")
+}
+
+// srt query parameters which may hold credentials
+var srtRedactedParams = map[string]bool{
+	"streamid":   true,
+	"passphrase": true,
+}
+
+// RedactStreamUrl redacts the stream key of an rtmp url, or the stream id and passphrase of an srt url.
+// It returns false if the url is not a valid stream url
+func RedactStreamUrl(rawUrl string) (string, bool) {
+	if !IsSRTUrl(rawUrl) {
+		return utils.RedactStreamKey(rawUrl)
+	}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Hostname() == "" || parsed.Port() == "" {
+		return rawUrl, false
+	}
+	if parsed.RawQuery == "" {
+		return rawUrl, true
+	}
+
+	params := strings.Split(parsed.RawQuery, "&")
+	for i, param := range params {
+		if key, value, ok := strings.Cut(param, "="); ok && srtRedactedParams[key] {
+			params[i] = key + "=" + utils.RedactIdentifier(value)
+		}
+	}
+	return strings.SplitN(rawUrl, "?", 2)[0] + "?" + strings.Join(params, "&"), true
+}
+
 func (p *PipelineConfig) getStreamConfig(outputType types.OutputType, urls []string) (*StreamConfig, error) {
 	conf := &StreamConfig{
 		outputConfig: outputConfig{OutputType: outputType},
@@ -62,6 +121,26 @@ func (p *PipelineConfig) getStreamConfig(outputType types.OutputType, urls []str
 		streamInfoList = append(streamInfoList, info)
 	}
 
+	if outputType == types.OutputTypeRTMP && len(p.StreamAuth) > 0 {
+		conf.Auth = make(map[string]*StreamAuth)
+		for _, a := range p.StreamAuth {
+			url, redacted, err := p.ValidateUrl(a.Url(), outputType)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := conf.StreamInfo[url]; ok {
+				return nil, errors.ErrInvalidInput(streamAuthMetadataKey)
+			}
+
+			conf.Urls = append(conf.Urls, url)
+			conf.Auth[url] = a
+
+			info := &livekit.StreamInfo{Url: redacted}
+			conf.StreamInfo[url] = info
+			streamInfoList = append(streamInfoList, info)
+		}
+	}
+
 	switch outputType {
 	case types.OutputTypeRTMP:
 		p.AudioOutCodec = types.MimeTypeAAC
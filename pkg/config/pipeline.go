@@ -16,37 +16,78 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-gst/go-gst/gst/app"
 	"github.com/pion/webrtc/v3"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"gopkg.in/yaml.v3"
 
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/logbuffer"
 	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/auth"
 	"github.com/livekit/protocol/egress"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
 	"github.com/livekit/protocol/tracer"
-	"github.com/livekit/protocol/utils"
 	lksdk "github.com/livekit/server-sdk-go"
 )
 
 const (
 	webLatency = uint64(2e9)
 	sdkLatency = uint64(3e9)
+
+	// EOSTimeout is the time allowed for EOS to reach the sinks before the pipeline is considered frozen
+	EOSTimeout = time.Second * 30
+
+	defaultDrainTimeout        = EOSTimeout * 2 // EOS, then finalizing and uploading the outputs
+	defaultEncoderStallTimeout = time.Second * 30
+	defaultDiskStallTimeout    = time.Second * 30
+	defaultSinkStallThreshold  = time.Second * 30
+	defaultStreamUpdateWindow  = time.Millisecond * 250
+	defaultLogLines            = 1000
+
+	// request metadata keys
+	correlationIDMetadataKey       = "correlation_id"
+	chatSubtitlesMetadataKey       = "chat_subtitles"
+	encodingProfileMetadataKey     = "encoding_profile"
+	soloFullscreenMetadataKey      = "solo_fullscreen"
+	followSpeakerMetadataKey       = "follow_speaker"
+	minVideoBitrateMetadataKey     = "min_video_bitrate"
+	fileSegmentDurationMetadataKey = "file_segment_duration"
+	maxFileSizeMetadataKey         = "max_file_size"
+	elementOverridesMetadataKey    = "element_overrides"
+	uploadEncryptionKeyMetadataKey = "upload_encryption_key"
+	uploadEncryptionKMSMetadataKey = "upload_encryption_kms_key_id"
+	trickleUploadMetadataKey       = "trickle_upload"
+	audioLevelsMetadataKey         = "audio_levels"
+	streamAuthMetadataKey          = "stream_auth"
+	audioModeMetadataKey           = "audio_mode"
+	audioTracksMetadataKey         = "audio_tracks"
+	preRollMetadataKey             = "pre_roll"
+	postRollMetadataKey            = "post_roll"
+	awaitMarkStartMetadataKey      = "await_mark_start"
+	noInputTimeoutMetadataKey      = "no_input_timeout"
+	placeholderInputMetadataKey    = "placeholder_input"
+	duplicateFramesMetadataKey     = "duplicate_frames"
+	// uploaded object metadata name, valid for every storage provider
+	correlationIDObjectMetadata = "correlationid"
 )
 
 type PipelineConfig struct {
 	BaseConfig `yaml:",inline"`
 
-	HandlerID string `yaml:"handler_id"`
-	TmpDir    string `yaml:"tmp_dir"`
+	HandlerID     string `yaml:"handler_id"`
+	HandlerSecret string `yaml:"-"` // required on every request from the service to the handler, passed in the handler environment
+	TmpDir        string `yaml:"tmp_dir"`
 
 	types.RequestType `yaml:"-"`
 	SourceConfig      `yaml:"-"`
@@ -56,6 +97,13 @@ type PipelineConfig struct {
 	Outputs              map[types.EgressType][]OutputConfig `yaml:"-"`
 	OutputCount          int                                 `yaml:"-"`
 	FinalizationRequired bool                                `yaml:"-"`
+	CorrelationID        string                              `yaml:"-"`
+	EncodingProfile      string                              `yaml:"-"`
+	StreamAuth           []*StreamAuth                       `yaml:"-"`
+	AudioTracks          []*AudioTrackConfig                 `yaml:"-"`
+	AwaitMarkStart       bool                                `yaml:"-"`
+	SealedRequest        []byte                              `yaml:"-"` // written to the recovery state
+	LogBuffer            *logbuffer.Buffer                   `yaml:"-"`
 
 	Info *livekit.EgressInfo `yaml:"-"`
 }
@@ -87,6 +135,12 @@ type SDKSourceParams struct {
 	VideoInCodec types.MimeType
 	AudioTrack   *TrackSource
 	VideoTrack   *TrackSource
+
+	// track composite audio tracks other than AudioTrack, subscribed before the pipeline was built
+	AudioTrackSources map[string]*TrackSource
+
+	// identity the egress joins the room with, when the token is built from the api key and secret
+	EgressIdentity string
 }
 
 type TrackSource struct {
@@ -118,6 +172,7 @@ type VideoConfig struct {
 	Framerate        int32
 	VideoBitrate     int32
 	KeyFrameInterval float64
+	VideoEncoder     types.VideoEncoder // h264 encoder selected when the pipeline was built
 }
 
 func NewPipelineConfig(confString string, req *rpc.StartEgressRequest) (*PipelineConfig, error) {
@@ -126,6 +181,11 @@ func NewPipelineConfig(confString string, req *rpc.StartEgressRequest) (*Pipelin
 			Logging: &logger.Config{
 				Level: "info",
 			},
+			DrainTimeout:        defaultDrainTimeout,
+			EncoderStallTimeout: defaultEncoderStallTimeout,
+			DiskStallTimeout:    defaultDiskStallTimeout,
+			SinkStallThreshold:  defaultSinkStallThreshold,
+			StreamUpdateWindow:  defaultStreamUpdateWindow,
 		},
 		Outputs: make(map[types.EgressType][]OutputConfig),
 	}
@@ -134,11 +194,21 @@ func NewPipelineConfig(confString string, req *rpc.StartEgressRequest) (*Pipelin
 		return nil, errors.ErrCouldNotParseConfig(err)
 	}
 
-	if err := p.initLogger(
+	if p.Debug.LogLines == 0 {
+		p.Debug.LogLines = defaultLogLines
+	}
+	if p.DrainTimeout <= EOSTimeout {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("drain_timeout must be longer than %s", EOSTimeout))
+	}
+
+	var err error
+	if p.LogBuffer, err = p.initLogger(
+		p.Debug.LogLines,
 		"nodeID", p.NodeID,
 		"handlerID", p.HandlerID,
 		"clusterID", p.ClusterID,
 		"egressID", req.EgressId,
+		"correlationID", getCorrelationID(req),
 	); err != nil {
 		return nil, err
 	}
@@ -163,6 +233,15 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		return errors.ErrInvalidInput("egressID")
 	}
 
+	p.CorrelationID = getCorrelationID(request)
+	if p.CrashRecovery && p.ApiSecret != "" {
+		sealed, err := SealRecoveryRequest(p.ApiSecret, request)
+		if err != nil {
+			return err
+		}
+		p.SealedRequest = sealed
+	}
+
 	// start with defaults
 	p.Info = &livekit.EgressInfo{
 		EgressId:  request.EgressId,
@@ -183,6 +262,14 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		VideoBitrate: 4500,
 	}
 
+	// profile settings can be overridden by request encoding options
+	if err := p.applyEncodingProfile(request); err != nil {
+		return err
+	}
+	if err := p.updateStreamAuth(request); err != nil {
+		return err
+	}
+
 	connectionInfoRequired := true
 	switch req := request.Request.(type) {
 	case *rpc.StartEgressRequest_RoomComposite:
@@ -199,6 +286,13 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 
 		p.Info.RoomName = req.RoomComposite.RoomName
 		p.Layout = req.RoomComposite.Layout
+		if v := getMetadataString(request, soloFullscreenMetadataKey); v != "" {
+			solo, err := strconv.ParseBool(v)
+			if err != nil {
+				return errors.ErrInvalidInput(soloFullscreenMetadataKey)
+			}
+			p.SoloFullscreen = solo
+		}
 		if req.RoomComposite.CustomBaseUrl != "" {
 			p.BaseUrl = req.RoomComposite.CustomBaseUrl
 		} else {
@@ -308,6 +402,16 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		if p.Identity == "" {
 			return errors.ErrInvalidInput("identity")
 		}
+		if err := p.setMissingVideo(types.MissingVideoPlaceholder); err != nil {
+			return err
+		}
+		if v := getMetadataString(request, followSpeakerMetadataKey); v != "" {
+			follow, err := strconv.ParseBool(v)
+			if err != nil {
+				return errors.ErrInvalidInput(followSpeakerMetadataKey)
+			}
+			p.FollowSpeaker.Enabled = follow
+		}
 
 		// encoding options
 		switch opts := req.Participant.Options.(type) {
@@ -347,9 +451,15 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 			p.VideoTrackID = videoTrackID
 			p.VideoDecoding = true
 		}
+		if err := p.updateAudioTracks(request); err != nil {
+			return err
+		}
 		if !p.AudioEnabled && !p.VideoEnabled {
 			return errors.ErrInvalidInput("audio_track_id or video_track_id")
 		}
+		if err := p.setMissingVideo(types.MissingVideoFail); err != nil {
+			return err
+		}
 
 		// encoding options
 		switch opts := req.TrackComposite.Options.(type) {
@@ -404,7 +514,7 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		if request.Token != "" {
 			p.Token = request.Token
 		} else if p.ApiKey != "" && p.ApiSecret != "" {
-			token, err := egress.BuildEgressToken(p.Info.EgressId, p.ApiKey, p.ApiSecret, p.Info.RoomName)
+			token, err := p.buildToken()
 			if err != nil {
 				return err
 			}
@@ -421,11 +531,74 @@ func (p *PipelineConfig) Update(request *rpc.StartEgressRequest) error {
 		}
 	}
 
+	if len(p.StreamAuth) > 0 && p.GetStreamConfig() == nil {
+		// added to a requested stream output
+		return errors.ErrInvalidInput(streamAuthMetadataKey)
+	}
+
 	if p.RequestType != types.RequestTypeTrack {
 		err := p.validateAndUpdateOutputParams()
 		if err != nil {
 			return err
 		}
+		if err = p.updateMinVideoBitrate(request); err != nil {
+			return err
+		}
+		if err = p.updateFileRotation(request); err != nil {
+			return err
+		}
+		if o := p.GetStreamConfig(); o != nil {
+			if err = p.applyStreamPlatforms(o.Urls); err != nil {
+				return err
+			}
+		}
+	}
+
+	// request metadata options are independent, so every invalid one is reported
+	errs := errors.ErrArray{}
+	errs.Check(p.updateChatSubtitles(request))
+	p.updateOverlays()
+	errs.Check(p.updateAudioMode(request))
+	errs.Check(p.updateRoll(request))
+	errs.Check(p.updateNoInput(request))
+	errs.Check(p.updateElementOverrides(request))
+	errs.Check(p.updateUploadEncryption(request))
+	errs.Check(p.updateTrickleUpload(request))
+	if v := getMetadataString(request, audioLevelsMetadataKey); v != "" {
+		if enabled, err := strconv.ParseBool(v); err != nil {
+			errs.AppendErr(errors.ErrInvalidInput(audioLevelsMetadataKey))
+		} else {
+			p.AudioLevels.Enabled = enabled
+		}
+	}
+	if v := getMetadataString(request, duplicateFramesMetadataKey); v != "" {
+		if enabled, err := strconv.ParseBool(v); err != nil {
+			errs.AppendErr(errors.ErrInvalidInput(duplicateFramesMetadataKey))
+		} else {
+			p.DuplicateFrames = enabled
+		}
+	}
+	if err := errs.ToError(); err != nil {
+		return err
+	}
+	if o := p.GetFileConfig(); o != nil && o.LocalFilepath != "" {
+		// sdk outputs without a file type are resolved once the filepath is known, in UpdateInfoFromSDK
+		o.resolveIndex()
+	}
+
+	if p.EncodingProfile != "" {
+		logger.Infow("encoding profile applied",
+			"profile", p.EncodingProfile,
+			"width", p.Width,
+			"height", p.Height,
+			"framerate", p.Framerate,
+			"videoCodec", p.VideoOutCodec,
+			"videoBitrate", p.VideoBitrate,
+			"keyFrameInterval", p.KeyFrameInterval,
+			"audioCodec", p.AudioOutCodec,
+			"audioBitrate", p.AudioBitrate,
+			"audioFrequency", p.AudioFrequency,
+		)
 	}
 
 	return nil
@@ -560,15 +733,285 @@ func (p *PipelineConfig) updateOutputType(compatibleAudioCodecs map[types.MimeTy
 	return nil
 }
 
+// buildToken creates the room token. Sdk egress joins with the configured egress participant identity and metadata
+func (p *PipelineConfig) buildToken() (string, error) {
+	if p.SourceType != types.SourceTypeSDK {
+		return egress.BuildEgressToken(p.Info.EgressId, p.ApiKey, p.ApiSecret, p.Info.RoomName)
+	}
+
+	conf := p.EgressParticipant
+	p.EgressIdentity = p.Info.EgressId
+	if conf.Identity != "" {
+		p.EgressIdentity = stringReplace(conf.Identity, map[string]string{
+			"{egress_id}": p.Info.EgressId,
+			"{room_name}": p.Info.RoomName,
+		})
+	}
+	if p.RequestType == types.RequestTypeParticipant && p.EgressIdentity == p.Identity {
+		return "", errors.ErrIdentityConflict(p.EgressIdentity)
+	}
+
+	metadata := conf.Metadata
+	if len(conf.Attributes) > 0 {
+		b, err := json.Marshal(conf.Attributes)
+		if err != nil {
+			return "", err
+		}
+		metadata = string(b)
+	}
+
+	f := false
+	t := true
+	grant := &auth.VideoGrant{
+		RoomJoin:       true,
+		Room:           p.Info.RoomName,
+		CanSubscribe:   &t,
+		CanPublish:     &f,
+		CanPublishData: &f,
+		Hidden:         true,
+		Recorder:       true,
+	}
+
+	return auth.NewAccessToken(p.ApiKey, p.ApiSecret).
+		AddGrant(grant).
+		SetIdentity(p.EgressIdentity).
+		SetName(conf.Name).
+		SetMetadata(metadata).
+		SetValidFor(24 * time.Hour).
+		ToJWT()
+}
+
+// getCorrelationID returns the correlation_id request metadata, defaulting to the egress id
+func getCorrelationID(req *rpc.StartEgressRequest) string {
+	if id := getMetadataString(req, correlationIDMetadataKey); id != "" {
+		return id
+	}
+	return req.EgressId
+}
+
+func getMetadataString(req *rpc.StartEgressRequest, key string) string {
+	v, ok := req.Metadata[key]
+	if !ok {
+		return ""
+	}
+	s := &wrapperspb.StringValue{}
+	if err := v.UnmarshalTo(s); err != nil {
+		logger.Warnw("invalid request metadata", err, "key", key)
+		return ""
+	}
+	return s.Value
+}
+
+// updateChatSubtitles applies the per egress toggle. Chat is only drawn on decoded sdk video
+func (p *PipelineConfig) updateChatSubtitles(req *rpc.StartEgressRequest) error {
+	if v := getMetadataString(req, chatSubtitlesMetadataKey); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.ErrInvalidInput(chatSubtitlesMetadataKey)
+		}
+		p.ChatSubtitles.Enabled = enabled
+	}
+
+	if p.ChatSubtitles.Enabled && (p.SourceType != types.SourceTypeSDK || !p.VideoDecoding) {
+		logger.Debugw("chat subtitles not supported for this request")
+		p.ChatSubtitles.Enabled = false
+	}
+	return nil
+}
+
+// updateOverlays disables overlays for requests without an encoded room or track composite video branch
+func (p *PipelineConfig) updateOverlays() {
+	if !p.Overlays.Timecode.Enabled && p.Overlays.Watermark.Path == "" {
+		return
+	}
+
+	composite := p.RequestType == types.RequestTypeRoomComposite ||
+		(p.RequestType == types.RequestTypeTrackComposite && p.VideoDecoding)
+	if !p.VideoEncoding || !composite {
+		logger.Debugw("overlays not supported for this request")
+		p.Overlays = OverlaysConfig{}
+	}
+}
+
+// updateElementOverrides merges per egress element_overrides, a json object of element names to properties,
+// into the configured overrides
+func (p *PipelineConfig) updateElementOverrides(req *rpc.StartEgressRequest) error {
+	if v := getMetadataString(req, elementOverridesMetadataKey); v != "" {
+		overrides := make(ElementOverrides)
+		if err := json.Unmarshal([]byte(v), &overrides); err != nil {
+			return errors.ErrInvalidInput(elementOverridesMetadataKey)
+		}
+		p.ElementOverrides = p.ElementOverrides.Merge(overrides)
+	}
+	return p.ElementOverrides.Validate()
+}
+
+// updateUploadEncryption enables upload encryption with a per egress customer key or kms key,
+// either of which replaces the configured key
+func (p *PipelineConfig) updateUploadEncryption(req *rpc.StartEgressRequest) error {
+	key := getMetadataString(req, uploadEncryptionKeyMetadataKey)
+	kmsKeyID := getMetadataString(req, uploadEncryptionKMSMetadataKey)
+	switch {
+	case key != "" && kmsKeyID != "":
+		return errors.ErrInvalidInput(uploadEncryptionKeyMetadataKey)
+	case key != "":
+		p.UploadEncryption.Enabled = true
+		p.UploadEncryption.Key = key
+		p.UploadEncryption.KMSKeyID = ""
+	case kmsKeyID != "":
+		p.UploadEncryption.Enabled = true
+		p.UploadEncryption.Key = ""
+		p.UploadEncryption.KMSKeyID = kmsKeyID
+	}
+
+	if p.UploadEncryption.Enabled {
+		if err := p.UploadEncryption.validate(); err != nil {
+			return errors.ErrInvalidInput(uploadEncryptionKeyMetadataKey)
+		}
+		if p.HLSEncryption.Enabled && p.GetSegmentConfig() != nil {
+			// hls keys and playlists must stay readable by players
+			return errors.ErrNotSupported("upload encryption with hls encryption")
+		}
+	}
+	return nil
+}
+
+// updateTrickleUpload uploads the file output while it is written. When trickle_upload is only configured,
+// outputs that can't be uploaded incrementally are uploaded once finished instead of failing.
+func (p *PipelineConfig) updateTrickleUpload(req *rpc.StartEgressRequest) error {
+	requested := false
+	if v := getMetadataString(req, trickleUploadMetadataKey); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.ErrInvalidInput(trickleUploadMetadataKey)
+		}
+		p.TrickleUpload = enabled
+		requested = enabled
+	}
+	if !p.TrickleUpload {
+		return nil
+	}
+
+	o := p.GetFileConfig()
+	var unsupported string
+	switch {
+	case o == nil || p.RequestType == types.RequestTypeTrack:
+		unsupported = "trickle upload without a file output"
+	case o.OutputType == types.OutputTypeIVF:
+		// the ivf header is rewritten with the frame count once the file is finished
+		unsupported = "trickle upload for ivf"
+	case o.Rotates():
+		unsupported = "trickle upload with file rotation"
+	case p.Bundle.Format != "":
+		unsupported = "trickle upload with bundles"
+	case p.UploadEncryption.Enabled:
+		unsupported = "trickle upload with upload encryption"
+	}
+	if unsupported != "" {
+		if requested {
+			return errors.ErrNotSupported(unsupported)
+		}
+		return nil
+	}
+
+	o.Trickle = o.UploadConfig != nil
+	return nil
+}
+
+// updateMinVideoBitrate raises the video bitrate to the configured floor, which the encoder then holds
+func (p *PipelineConfig) updateMinVideoBitrate(req *rpc.StartEgressRequest) error {
+	if v := getMetadataString(req, minVideoBitrateMetadataKey); v != "" {
+		floor, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || floor < 0 {
+			return errors.ErrInvalidInput(minVideoBitrateMetadataKey)
+		}
+		p.MinVideoBitrate = int32(floor)
+	}
+
+	if p.MinVideoBitrate <= 0 || !p.VideoEnabled || !p.VideoEncoding {
+		return nil
+	}
+	if p.VideoOutCodec != types.MimeTypeH264 {
+		return errors.ErrNotSupported(fmt.Sprintf("%s with %s encoding", minVideoBitrateMetadataKey, p.VideoOutCodec))
+	}
+	if p.VideoBitrate < p.MinVideoBitrate {
+		logger.Infow("raising video bitrate to minimum", "requested", p.VideoBitrate, "minimum", p.MinVideoBitrate)
+		p.VideoBitrate = p.MinVideoBitrate
+	}
+	return nil
+}
+
+// updateFileRotation splits the file output into chunks of file_segment_duration seconds or max_file_size bytes.
+// Chunks split on keyframes, so they can run slightly longer than requested.
+func (p *PipelineConfig) updateFileRotation(req *rpc.StartEgressRequest) error {
+	duration := getMetadataString(req, fileSegmentDurationMetadataKey)
+	size := getMetadataString(req, maxFileSizeMetadataKey)
+	if duration == "" && size == "" {
+		return nil
+	}
+
+	o := p.GetFileConfig()
+	if o == nil {
+		return errors.ErrNotSupported("file rotation without a file output")
+	}
+	if duration != "" {
+		seconds, err := strconv.ParseUint(duration, 10, 32)
+		if err != nil || seconds == 0 {
+			return errors.ErrInvalidInput(fileSegmentDurationMetadataKey)
+		}
+		o.SegmentDuration = time.Duration(seconds) * time.Second
+	}
+	if size != "" {
+		maxSize, err := strconv.ParseInt(size, 10, 64)
+		if err != nil || maxSize <= 0 {
+			return errors.ErrInvalidInput(maxFileSizeMetadataKey)
+		}
+		o.MaxFileSize = maxSize
+	}
+
+	if o.OutputType == types.OutputTypeIVF {
+		return errors.ErrNotSupported("file rotation for ivf")
+	}
+	if p.Bundle.Format != "" {
+		return errors.ErrNotSupported("file rotation with bundles")
+	}
+	return nil
+}
+
+// UploadMetadata returns the metadata attached to every uploaded object
+func (p *PipelineConfig) UploadMetadata() map[string]string {
+	return map[string]string{
+		correlationIDObjectMetadata: p.CorrelationID,
+	}
+}
+
 // used for sdk input source
+func (p *PipelineConfig) setMissingVideo(defaultBehavior types.MissingVideoBehavior) error {
+	switch p.MissingVideo {
+	case "":
+		p.MissingVideo = defaultBehavior
+	case types.MissingVideoPlaceholder, types.MissingVideoAudioOnly, types.MissingVideoFail:
+	default:
+		return errors.ErrCouldNotParseConfig(fmt.Errorf("invalid missing_video %s", p.MissingVideo))
+	}
+	return nil
+}
+
 func (p *PipelineConfig) UpdateInfoFromSDK(identifier string, replacements map[string]string, w, h uint32) error {
+	p.applyUpscale(w, h)
+
 	for egressType, c := range p.Outputs {
 		if len(c) == 0 {
 			continue
 		}
 		switch egressType {
 		case types.EgressTypeFile:
-			return c[0].(*FileConfig).updateFilepath(p, identifier, replacements)
+			o := c[0].(*FileConfig)
+			if err := o.updateFilepath(p, identifier, replacements); err != nil {
+				return err
+			}
+			o.resolveIndex()
+			return nil
 
 		case types.EgressTypeSegments:
 			o := c[0].(*SegmentConfig)
@@ -619,8 +1062,11 @@ func (p *PipelineConfig) ValidateUrl(rawUrl string, outputType types.OutputType)
 			rawUrl = fmt.Sprintf("rtmps://global-live.mux.com:443/app/%s", parsed.Host)
 		}
 
-		redacted, ok := utils.RedactStreamKey(rawUrl)
+		redacted, ok := RedactStreamUrl(rawUrl)
 		if !ok {
+			if parsed.Scheme == "srt" {
+				return "", "", errors.ErrInvalidUrl(rawUrl, "srt urls must be of format srt://{host}:{port}(?streamid={stream_id})")
+			}
 			return "", "", errors.ErrInvalidUrl(rawUrl, "rtmp urls must be of format rtmp(s)://{host}(/{path})/{app}/{stream_key}( live=1)")
 		}
 		return rawUrl, redacted, nil
@@ -0,0 +1,200 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"syscall"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/rpc"
+)
+
+// RecoveryStateFilename is written to the handler tmp dir while a rotating file or segment output records
+const RecoveryStateFilename = "recovery_state.json"
+
+const (
+	// failedRecoveryFilename keeps the state of a failed recovery for operators, without it being retried
+	failedRecoveryFilename = RecoveryStateFilename + ".failed"
+	// handlerLockFilename is locked by the handler for as long as it runs
+	handlerLockFilename = "handler.lock"
+)
+
+// RecoveryState lists the closed chunks of a rotating file output, or the segments not yet in the playlist,
+// so that the service can upload them if the handler crashes
+type RecoveryState struct {
+	EgressID string `json:"egress_id"`
+	// Request is the start request sealed with the api secret, so that the upload config can be rebuilt
+	// after a service restart without credentials in the clear
+	Request         []byte            `json:"request,omitempty"`
+	OutputType      types.OutputType  `json:"output_type"`
+	StorageFilepath string            `json:"storage_filepath,omitempty"`
+	Chunks          []*RecoveryChunk  `json:"chunks,omitempty"`
+	Segments        *RecoverySegments `json:"segments,omitempty"`
+}
+
+// RecoveryChunk is a closed chunk. Its location, size and offset are those reported by the upload once uploaded,
+// and of the local file until then
+type RecoveryChunk struct {
+	FileChunk
+	LocalFilepath string `json:"local_filepath"`
+	Duration      int64  `json:"duration"`
+	Uploaded      bool   `json:"uploaded"`
+}
+
+// RecoverySegments are the segments closed but not yet added to the playlist. Their start time and duration
+// are in nanoseconds
+type RecoverySegments struct {
+	LocalDir             string             `json:"local_dir"`
+	StorageDir           string             `json:"storage_dir"`
+	PlaylistFilename     string             `json:"playlist_filename"`
+	LivePlaylistFilename string             `json:"live_playlist_filename,omitempty"`
+	Pending              []*RecoverySegment `json:"pending"`
+}
+
+type RecoverySegment struct {
+	Filename      string `json:"filename"`
+	StartedAt     int64  `json:"started_at"`
+	Duration      int64  `json:"duration"`
+	Discontinuity bool   `json:"discontinuity,omitempty"`
+}
+
+// SealRecoveryRequest encrypts the request with a key derived from secret
+func SealRecoveryRequest(secret string, req *rpc.StartEgressRequest) ([]byte, error) {
+	gcm, err := newRecoveryCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, b, nil), nil
+}
+
+// OpenRecoveryRequest decrypts a request sealed by SealRecoveryRequest
+func OpenRecoveryRequest(secret string, sealed []byte) (*rpc.StartEgressRequest, error) {
+	gcm, err := newRecoveryCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed request too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	b, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	req := &rpc.StartEgressRequest{}
+	if err = proto.Unmarshal(b, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func newRecoveryCipher(secret string) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, errors.New("api secret required")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("egress recovery state"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// WriteRecoveryState replaces the state file in dir, so that a crash never leaves a partially written state
+func WriteRecoveryState(dir string, state *RecoveryState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := path.Join(dir, RecoveryStateFilename+".tmp")
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path.Join(dir, RecoveryStateFilename))
+}
+
+// ReadRecoveryState reads the state file in dir, returning nil if there is none
+func ReadRecoveryState(dir string) (*RecoveryState, error) {
+	b, err := os.ReadFile(path.Join(dir, RecoveryStateFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := &RecoveryState{}
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func RemoveRecoveryState(dir string) error {
+	err := os.Remove(path.Join(dir, RecoveryStateFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// MarkRecoveryFailed renames the state file in dir, so that the recovery is not retried on every restart
+func MarkRecoveryFailed(dir string) error {
+	err := os.Rename(path.Join(dir, RecoveryStateFilename), path.Join(dir, failedRecoveryFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// LockHandlerDir takes the lock on a handler tmp dir, held until the returned file is closed or the process exits,
+// including when it crashes. It returns nil if another process, such as a running handler, holds the lock
+func LockHandlerDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(path.Join(dir, handlerLockFilename), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return f, nil
+}
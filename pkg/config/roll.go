@@ -0,0 +1,86 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/rpc"
+)
+
+const (
+	// maxPreRoll bounds the encoded media held in memory before recording starts
+	maxPreRoll = time.Second * 30
+
+	// video recording starts at a keyframe, held beyond the pre-roll when no key_frame_interval is requested
+	defaultPreRollKeyframeMargin = time.Second * 4
+)
+
+// updateRoll applies pre_roll and post_roll request metadata in seconds, and await_mark_start,
+// which holds recording until MarkStart
+func (p *PipelineConfig) updateRoll(req *rpc.StartEgressRequest) error {
+	if v := getMetadataString(req, preRollMetadataKey); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		preRoll := time.Duration(seconds * float64(time.Second))
+		if err != nil || preRoll < 0 || preRoll > maxPreRoll {
+			return errors.ErrInvalidInput(preRollMetadataKey)
+		}
+		p.PreRoll = preRoll
+	}
+	if v := getMetadataString(req, postRollMetadataKey); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil || seconds < 0 {
+			return errors.ErrInvalidInput(postRollMetadataKey)
+		}
+		p.PostRoll = time.Duration(seconds * float64(time.Second))
+	}
+	if v := getMetadataString(req, awaitMarkStartMetadataKey); v != "" {
+		await, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.ErrInvalidInput(awaitMarkStartMetadataKey)
+		}
+		p.AwaitMarkStart = await
+	}
+
+	// media is held after encoding, so track egress and image only outputs record from the start
+	if p.RequestType == types.RequestTypeTrack || len(p.GetEncodedOutputs()) == 0 {
+		if p.AwaitMarkStart {
+			return errors.ErrNotSupported("await_mark_start without encoded outputs")
+		}
+		p.PreRoll = 0
+	}
+	return nil
+}
+
+// StartGated is true when the pipeline plays before recording starts, holding encoded media in pre-roll
+// queues until the web start signal, or MarkStart with await_mark_start
+func (p *PipelineConfig) StartGated() bool {
+	return p.AwaitMarkStart || (p.PreRoll > 0 && p.AwaitStartSignal)
+}
+
+// PreRollWindow is the encoded media held while the start is gated. Video recording begins at the first
+// keyframe within it, so up to a keyframe interval more than the pre-roll is held
+func (p *PipelineConfig) PreRollWindow() time.Duration {
+	if !p.VideoEnabled {
+		return p.PreRoll
+	}
+	if p.KeyFrameInterval > 0 {
+		return p.PreRoll + time.Duration(p.KeyFrameInterval*float64(time.Second))
+	}
+	return p.PreRoll + defaultPreRollKeyframeMargin
+}
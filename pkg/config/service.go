@@ -15,12 +15,16 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/utils"
 )
@@ -36,6 +40,34 @@ const (
 
 	defaultTemplatePort         = 7980
 	defaultTemplateBaseTemplate = "http://localhost:%d/"
+	defaultTimecodeInterval     = time.Second
+	defaultSoftwareFramerate    = 15
+	defaultDiarizationMergeGap  = time.Millisecond * 500
+	defaultKeyRotationInterval  = 10
+	defaultChatDuration         = time.Second * 5
+	defaultDotCacheTTL          = time.Second
+	defaultStopSignalCode       = "resource_exhausted"
+	defaultStopSignalPoll       = time.Second * 10
+	maxSignedURLExpiry          = time.Hour * 24 * 7
+	defaultChatMaxMessages      = 3
+	defaultChatFont             = "Sans 16"
+	defaultChatColor            = 0xFFFFFFFF
+	defaultTimecodeOverlay      = "2006-01-02 15:04:05.000 UTC"
+	defaultTimecodeFont         = "Monospace"
+	defaultTimecodeSize         = 16
+	defaultTimecodeColor        = 0xFFFFFFFF
+	defaultUploadMaxAttempts    = 3
+	defaultUploadBaseDelay      = time.Second
+	defaultUploadMaxDelay       = time.Second * 30
+	minMultipartPartSize        = 5 * 1024 * 1024
+	defaultReconnectMaxAttempts = 5
+	defaultReconnectBaseDelay   = time.Second
+	defaultReconnectMaxDelay    = time.Second * 30
+	defaultRecoveryMaxAttempts  = 3
+	defaultFollowSpeakerHold    = time.Second * 2
+	defaultAudioLevelInterval   = time.Millisecond * 100
+	uploadEncryptionKeySize     = 32
+	defaultSegmentUpdateQueue   = 32
 )
 
 type ServiceConfig struct {
@@ -69,6 +101,10 @@ func NewServiceConfig(confString string) (*ServiceConfig, error) {
 		},
 		TemplatePort: defaultTemplatePort,
 	}
+	conf.Chrome.SoftwareFramerate = defaultSoftwareFramerate
+	conf.Diarization.MergeGap = defaultDiarizationMergeGap
+	conf.Debug.DotCacheTTL = defaultDotCacheTTL
+	conf.StopSignal.PollInterval = defaultStopSignalPoll
 	if confString != "" {
 		if err := yaml.Unmarshal([]byte(confString), conf); err != nil {
 			return nil, errors.ErrCouldNotParseConfig(err)
@@ -99,9 +135,304 @@ func NewServiceConfig(confString string) (*ServiceConfig, error) {
 		conf.TemplateBase = fmt.Sprintf(defaultTemplateBaseTemplate, conf.TemplatePort)
 	}
 
-	if err := conf.initLogger("nodeID", conf.NodeID, "clusterID", conf.ClusterID); err != nil {
+	if err := conf.validateEncodingProfiles(); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+
+	switch conf.LocalFileCleanup {
+	case "":
+		conf.LocalFileCleanup = types.LocalFileCleanupRetainOnFailure
+	case types.LocalFileCleanupRetainOnFailure, types.LocalFileCleanupForceDelete:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid local_file_cleanup %s", conf.LocalFileCleanup))
+	}
+
+	for _, encoder := range conf.VideoEncoders {
+		switch encoder {
+		case types.VideoEncoderNVENC, types.VideoEncoderVA, types.VideoEncoderVAAPI, types.VideoEncoderQSV, types.VideoEncoderX264:
+		default:
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid video_encoders %s", encoder))
+		}
+	}
+
+	if conf.UploadRetry.MaxAttempts <= 0 {
+		conf.UploadRetry.MaxAttempts = defaultUploadMaxAttempts
+	}
+	if conf.UploadRetry.BaseDelay <= 0 {
+		conf.UploadRetry.BaseDelay = defaultUploadBaseDelay
+	}
+	if conf.UploadRetry.MaxDelay <= 0 {
+		conf.UploadRetry.MaxDelay = defaultUploadMaxDelay
+	}
+	if conf.UploadRetry.MaxDelay < conf.UploadRetry.BaseDelay {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("upload_retry max_delay %s is less than base_delay %s", conf.UploadRetry.MaxDelay, conf.UploadRetry.BaseDelay))
+	}
+
+	if conf.MultipartUpload.PartSize < 0 || (conf.MultipartUpload.PartSize > 0 && conf.MultipartUpload.PartSize < minMultipartPartSize) {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("multipart_upload part_size %d is less than %d", conf.MultipartUpload.PartSize, minMultipartPartSize))
+	}
+	if conf.MultipartUpload.Concurrency < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid multipart_upload concurrency %d", conf.MultipartUpload.Concurrency))
+	}
+
+	if conf.StreamReconnect.MaxAttempts == 0 {
+		conf.StreamReconnect.MaxAttempts = defaultReconnectMaxAttempts
+	}
+	if conf.StreamReconnect.BaseDelay <= 0 {
+		conf.StreamReconnect.BaseDelay = defaultReconnectBaseDelay
+	}
+	if conf.StreamReconnect.MaxDelay <= 0 {
+		conf.StreamReconnect.MaxDelay = defaultReconnectMaxDelay
+	}
+	if conf.StreamReconnect.MaxDelay < conf.StreamReconnect.BaseDelay {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("stream_reconnect max_delay %s is less than base_delay %s", conf.StreamReconnect.MaxDelay, conf.StreamReconnect.BaseDelay))
+	}
+	if conf.MinFreeDisk < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid min_free_disk %d", conf.MinFreeDisk))
+	}
+	if conf.ElementRecovery.MaxAttempts == 0 {
+		conf.ElementRecovery.MaxAttempts = defaultRecoveryMaxAttempts
+	}
+	if conf.FollowSpeaker.HoldTime <= 0 {
+		conf.FollowSpeaker.HoldTime = defaultFollowSpeakerHold
+	}
+	if conf.AudioLevels.Interval <= 0 {
+		conf.AudioLevels.Interval = defaultAudioLevelInterval
+	}
+
+	switch conf.Timecodes.Format {
+	case "", types.TimecodeFormatSRT, types.TimecodeFormatVTT:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid timecodes format %s", conf.Timecodes.Format))
+	}
+	if conf.Timecodes.Interval <= 0 {
+		conf.Timecodes.Interval = defaultTimecodeInterval
+	}
+	switch conf.Bundle.Format {
+	case "", types.BundleFormatTar, types.BundleFormatZip:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid bundle format %s", conf.Bundle.Format))
+	}
+	for host, platform := range conf.StreamPlatforms {
+		if streamPlatformLimits[platform] == nil {
+			return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid stream platform %s for %s", platform, host))
+		}
+	}
+	if err := conf.ElementOverrides.Validate(); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+	if err := conf.ChatSubtitles.validate(); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+	if err := conf.Overlays.validate(); err != nil {
+		return nil, errors.ErrCouldNotParseConfig(err)
+	}
+
+	if conf.HLSEncryption.Enabled {
+		if conf.HLSEncryption.RotationInterval <= 0 {
+			conf.HLSEncryption.RotationInterval = defaultKeyRotationInterval
+		}
+		if conf.HLSEncryption.KeyEndpoint != "" && conf.HLSEncryption.KeyURI == "" {
+			return nil, errors.ErrCouldNotParseConfig(errors.New("hls_encryption key_endpoint requires key_uri"))
+		}
+	}
+	if conf.SegmentUpdates.Enabled {
+		if conf.SegmentUpdates.QueueSize <= 0 {
+			conf.SegmentUpdates.QueueSize = defaultSegmentUpdateQueue
+		}
+		if conf.SegmentUpdates.Endpoint != "" {
+			if u, err := url.Parse(conf.SegmentUpdates.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid segment_updates endpoint %s", conf.SegmentUpdates.Endpoint))
+			}
+		}
+	}
+	if conf.UploadEncryption.Enabled {
+		if err := conf.UploadEncryption.validate(); err != nil {
+			return nil, errors.ErrCouldNotParseConfig(err)
+		}
+		if conf.HLSEncryption.Enabled {
+			// players could no longer fetch the keys or playlists, which would be sealed along with the segments
+			return nil, errors.ErrCouldNotParseConfig(errors.New("hls_encryption cannot be combined with upload_encryption"))
+		}
+	}
+	if conf.Diarization.MergeGap < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid diarization merge_gap %s", conf.Diarization.MergeGap))
+	}
+	switch conf.Upscale {
+	case "":
+		conf.Upscale = types.UpscaleBehaviorUpscale
+	case types.UpscaleBehaviorUpscale, types.UpscaleBehaviorCap, types.UpscaleBehaviorLetterbox:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid upscale %s", conf.Upscale))
+	}
+	if conf.PreRoll < 0 || conf.PreRoll > maxPreRoll {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid pre_roll %s", conf.PreRoll))
+	}
+	if conf.PostRoll < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid post_roll %s", conf.PostRoll))
+	}
+	if conf.NoInputTimeout < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid no_input_timeout %s", conf.NoInputTimeout))
+	}
+	switch conf.IPCTransport {
+	case "":
+		conf.IPCTransport = types.IPCTransportUnix
+	case types.IPCTransportUnix, types.IPCTransportTCP:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid ipc_transport %s", conf.IPCTransport))
+	}
+	switch conf.AudioMode {
+	case "":
+		conf.AudioMode = types.AudioModeMix
+	case types.AudioModeMix, types.AudioModeMultitrack:
+	default:
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid audio_mode %s", conf.AudioMode))
+	}
+	if conf.StreamUpdateWindow < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid stream_update_window %s", conf.StreamUpdateWindow))
+	}
+	if conf.StaleVideoTimeout < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid stale_video_timeout %s", conf.StaleVideoTimeout))
+	}
+	if conf.StopSignal.Code == "" {
+		conf.StopSignal.Code = defaultStopSignalCode
+	}
+	if conf.StopSignal.PollInterval < 0 {
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid stop_signal poll_interval %s", conf.StopSignal.PollInterval))
+	}
+	if conf.SignedURLExpiry < 0 || conf.SignedURLExpiry > maxSignedURLExpiry {
+		// s3 and gcs reject signatures valid for longer than 7 days
+		return nil, errors.ErrCouldNotParseConfig(fmt.Errorf("invalid signed_url_expiry %s", conf.SignedURLExpiry))
+	}
+	if conf.EgressParticipant.Metadata != "" && len(conf.EgressParticipant.Attributes) > 0 {
+		return nil, errors.ErrCouldNotParseConfig(errors.New("egress_participant metadata and attributes cannot both be set"))
+	}
+
+	if _, err := conf.initLogger(0, "nodeID", conf.NodeID, "clusterID", conf.ClusterID); err != nil {
 		return nil, err
 	}
 
 	return conf, nil
 }
+
+// validate requires exactly one of key or kms_key_id, with a key of the aes-256 size
+func (c *UploadEncryptionConfig) validate() error {
+	switch {
+	case c.Key != "" && c.KMSKeyID != "":
+		return errors.New("upload_encryption key and kms_key_id are mutually exclusive")
+	case c.KMSKeyID != "":
+		return nil
+	case c.Key == "":
+		return errors.New("upload_encryption requires key or kms_key_id")
+	}
+
+	key, err := c.DecodeKey()
+	if err != nil {
+		return err
+	}
+	if len(key) != uploadEncryptionKeySize {
+		return fmt.Errorf("upload_encryption key must be %d bytes, got %d", uploadEncryptionKeySize, len(key))
+	}
+	return nil
+}
+
+func (c *UploadEncryptionConfig) DecodeKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.Key)
+	if err != nil {
+		return nil, errors.New("upload_encryption key must be base64 encoded")
+	}
+	return key, nil
+}
+
+// validate checks alignments and fills in defaults, so that chat_subtitles request metadata can enable it
+func (c *ChatSubtitlesConfig) validate() error {
+	switch c.VAlign {
+	case "":
+		c.VAlign = "bottom"
+	case "top", "center", "bottom":
+	default:
+		return fmt.Errorf("invalid chat_subtitles valign %s", c.VAlign)
+	}
+	switch c.HAlign {
+	case "":
+		c.HAlign = "left"
+	case "left", "center", "right":
+	default:
+		return fmt.Errorf("invalid chat_subtitles halign %s", c.HAlign)
+	}
+
+	if c.Duration <= 0 {
+		c.Duration = defaultChatDuration
+	}
+	if c.MaxMessages <= 0 {
+		c.MaxMessages = defaultChatMaxMessages
+	}
+	if c.Font == "" {
+		c.Font = defaultChatFont
+	}
+	if c.Color == 0 {
+		c.Color = defaultChatColor
+	}
+	return nil
+}
+
+func (c *OverlaysConfig) validate() error {
+	if t := &c.Timecode; t.Enabled {
+		if !validAlignment(&t.VAlign, "top", "top", "center", "bottom") {
+			return fmt.Errorf("invalid overlays timecode valign %s", t.VAlign)
+		}
+		if !validAlignment(&t.HAlign, "right", "left", "center", "right") {
+			return fmt.Errorf("invalid overlays timecode halign %s", t.HAlign)
+		}
+		if t.Format == "" {
+			t.Format = defaultTimecodeOverlay
+		}
+		if t.Font == "" {
+			t.Font = defaultTimecodeFont
+		}
+		if t.Size <= 0 {
+			t.Size = defaultTimecodeSize
+		}
+		if t.Color == 0 {
+			t.Color = defaultTimecodeColor
+		}
+	}
+
+	if w := &c.Watermark; w.Path != "" {
+		if _, _, err := w.ImageSize(); err != nil {
+			return fmt.Errorf("invalid overlays watermark %s: %v", w.Path, err)
+		}
+		if !validAlignment(&w.VAlign, "bottom", "top", "center", "bottom") {
+			return fmt.Errorf("invalid overlays watermark valign %s", w.VAlign)
+		}
+		if !validAlignment(&w.HAlign, "right", "left", "center", "right") {
+			return fmt.Errorf("invalid overlays watermark halign %s", w.HAlign)
+		}
+		if w.Margin < 0 {
+			return fmt.Errorf("invalid overlays watermark margin %d", w.Margin)
+		}
+		if w.Opacity == 0 {
+			w.Opacity = 1
+		} else if w.Opacity < 0 || w.Opacity > 1 {
+			return fmt.Errorf("invalid overlays watermark opacity %v", w.Opacity)
+		}
+		if w.Scale < 0 || w.Scale > 1 {
+			return fmt.Errorf("invalid overlays watermark scale %v", w.Scale)
+		}
+	}
+	return nil
+}
+
+// validAlignment fills in the default for an empty alignment, and checks any other value is allowed
+func validAlignment(value *string, def string, allowed ...string) bool {
+	if *value == "" {
+		*value = def
+		return true
+	}
+	for _, a := range allowed {
+		if *value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/rpc"
+)
+
+// StreamAuth is an rtmp or srt output given in parts, for ingest servers that expect the stream key or
+// auth parameters as separate values rather than parsed from the url
+type StreamAuth struct {
+	URL         string            `json:"url"` // rtmp, rtmps or srt server, such as rtmps://live.example.com:443
+	App         string            `json:"app,omitempty"`
+	StreamKey   string            `json:"stream_key,omitempty"`
+	Query       map[string]string `json:"query,omitempty"`        // auth parameters sent with the app when connecting, such as token
+	SecureToken string            `json:"secure_token,omitempty"` // answer to the server's secure token challenge
+	StreamID    string            `json:"stream_id,omitempty"`    // srt stream id
+	Passphrase  string            `json:"passphrase,omitempty"`   // srt encryption passphrase, 10 to 79 characters
+}
+
+// Url identifies the output. It carries the stream key or srt stream id, which are redacted like any other
+// stream url, but not the auth parameters or passphrase
+func (a *StreamAuth) Url() string {
+	if a.isSRT() {
+		if a.StreamID == "" {
+			return a.URL
+		}
+		return a.URL + "?streamid=" + url.QueryEscape(a.StreamID)
+	}
+	return strings.TrimSuffix(a.URL, "/") + "/" + a.App + "/" + a.StreamKey
+}
+
+// Application returns the app to connect to, including any auth parameters
+func (a *StreamAuth) Application() string {
+	if len(a.Query) == 0 {
+		return a.App
+	}
+	query := make(url.Values, len(a.Query))
+	for k, v := range a.Query {
+		query.Set(k, v)
+	}
+	return a.App + "?" + query.Encode()
+}
+
+// SRTProperties returns the srtsink properties set from an srt output's auth, keyed by property name
+func (a *StreamAuth) SRTProperties() map[string]string {
+	props := map[string]string{"streamid": a.StreamID}
+	if a.Passphrase != "" {
+		props["passphrase"] = a.Passphrase
+	}
+	return props
+}
+
+func (a *StreamAuth) isSRT() bool {
+	return IsSRTUrl(a.URL)
+}
+
+func (a *StreamAuth) validate() bool {
+	parsed, err := url.Parse(a.URL)
+	if err != nil || parsed.Host == "" || parsed.RawQuery != "" {
+		return false
+	}
+
+	switch parsed.Scheme {
+	case "rtmp", "rtmps":
+		if a.StreamID != "" || a.Passphrase != "" {
+			return false
+		}
+		return a.App != "" && a.StreamKey != "" && !strings.Contains(a.App, "?")
+
+	case "srt":
+		if a.App != "" || a.StreamKey != "" || len(a.Query) > 0 || a.SecureToken != "" {
+			return false
+		}
+		if a.Passphrase != "" && (len(a.Passphrase) < 10 || len(a.Passphrase) > 79) {
+			return false
+		}
+		return parsed.Port() != "" && strings.Trim(parsed.Path, "/") == ""
+
+	default:
+		return false
+	}
+}
+
+// updateStreamAuth reads stream_auth request metadata, a json list of outputs added to the stream urls
+func (p *PipelineConfig) updateStreamAuth(req *rpc.StartEgressRequest) error {
+	v := getMetadataString(req, streamAuthMetadataKey)
+	if v == "" {
+		p.StreamAuth = nil
+		return nil
+	}
+
+	var streamAuth []*StreamAuth
+	if err := json.Unmarshal([]byte(v), &streamAuth); err != nil || len(streamAuth) == 0 {
+		return errors.ErrInvalidInput(streamAuthMetadataKey)
+	}
+	for _, a := range streamAuth {
+		if a == nil || !a.validate() {
+			return errors.ErrInvalidInput(streamAuthMetadataKey)
+		}
+	}
+	p.StreamAuth = streamAuth
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// StreamPlatformHosts maps rtmp ingest hostnames to the platform behind them
+type StreamPlatformHosts map[string]types.StreamPlatform
+
+type platformLimits struct {
+	KeyFrameInterval float64 // seconds, used when no interval is requested
+	MaxVideoBitrate  int32   // kbps
+	MaxAudioBitrate  int32   // kbps
+	MaxFramerate     int32
+	MaxDimension     int32 // longest side, so portrait streams are allowed
+	MinDimension     int32 // shortest side
+	AudioFrequencies []int32
+}
+
+var streamPlatformLimits = map[types.StreamPlatform]*platformLimits{
+	types.StreamPlatformYouTube: {
+		KeyFrameInterval: 2,
+		MaxVideoBitrate:  51000,
+		MaxAudioBitrate:  384,
+		MaxFramerate:     60,
+		MaxDimension:     3840,
+		MinDimension:     2160,
+		AudioFrequencies: []int32{44100, 48000},
+	},
+	types.StreamPlatformTwitch: {
+		KeyFrameInterval: 2,
+		MaxVideoBitrate:  6000,
+		MaxAudioBitrate:  160,
+		MaxFramerate:     60,
+		MaxDimension:     1920,
+		MinDimension:     1080,
+		AudioFrequencies: []int32{44100, 48000},
+	},
+}
+
+// known ingest domains, matched against the end of the url host
+var streamPlatformDomains = map[string]types.StreamPlatform{
+	"youtube.com":    types.StreamPlatformYouTube,
+	"twitch.tv":      types.StreamPlatformTwitch,
+	"live-video.net": types.StreamPlatformTwitch,
+}
+
+func (p *PipelineConfig) getStreamPlatform(rawUrl string) types.StreamPlatform {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	host := parsed.Hostname()
+	if platform, ok := p.StreamPlatforms[host]; ok {
+		return platform
+	}
+	for domain, platform := range streamPlatformDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return platform
+		}
+	}
+	return ""
+}
+
+// applyStreamPlatforms sets the key frame interval required by each stream's platform when none was requested,
+// and rejects requested settings that the platform would refuse or throttle
+func (p *PipelineConfig) applyStreamPlatforms(urls []string) error {
+	for _, u := range urls {
+		platform := p.getStreamPlatform(u)
+		limits := streamPlatformLimits[platform]
+		if limits == nil {
+			continue
+		}
+
+		if p.KeyFrameInterval == 0 {
+			p.KeyFrameInterval = limits.KeyFrameInterval
+		}
+		if err := p.checkStreamPlatform(platform, limits); err != nil {
+			return err
+		}
+		logger.Debugw("applied stream platform constraints", "platform", platform)
+	}
+	return nil
+}
+
+// ValidateStreamPlatform checks the running encode against the platform of a stream added after the egress started
+func (p *PipelineConfig) ValidateStreamPlatform(url string) error {
+	platform := p.getStreamPlatform(url)
+	limits := streamPlatformLimits[platform]
+	if limits == nil {
+		return nil
+	}
+	if p.KeyFrameInterval == 0 {
+		return errors.ErrStreamPlatformConstraint(string(platform), "key_frame_interval at most", "encoder default", limits.KeyFrameInterval)
+	}
+	return p.checkStreamPlatform(platform, limits)
+}
+
+func (p *PipelineConfig) checkStreamPlatform(platform types.StreamPlatform, limits *platformLimits) error {
+	name := string(platform)
+
+	if p.KeyFrameInterval > limits.KeyFrameInterval {
+		return errors.ErrStreamPlatformConstraint(name, "key_frame_interval at most", p.KeyFrameInterval, limits.KeyFrameInterval)
+	}
+	if p.VideoEnabled {
+		if p.VideoBitrate > limits.MaxVideoBitrate {
+			return errors.ErrStreamPlatformConstraint(name, "video_bitrate at most", p.VideoBitrate, limits.MaxVideoBitrate)
+		}
+		if p.Framerate > limits.MaxFramerate {
+			return errors.ErrStreamPlatformConstraint(name, "framerate at most", p.Framerate, limits.MaxFramerate)
+		}
+		if max(p.Width, p.Height) > limits.MaxDimension || min(p.Width, p.Height) > limits.MinDimension {
+			return errors.ErrStreamPlatformConstraint(name, "resolution at most",
+				fmt.Sprintf("%dx%d", p.Width, p.Height),
+				fmt.Sprintf("%dx%d", limits.MaxDimension, limits.MinDimension),
+			)
+		}
+	}
+	if p.AudioEnabled {
+		if p.AudioBitrate > limits.MaxAudioBitrate {
+			return errors.ErrStreamPlatformConstraint(name, "audio_bitrate at most", p.AudioBitrate, limits.MaxAudioBitrate)
+		}
+		supported := false
+		for _, frequency := range limits.AudioFrequencies {
+			supported = supported || p.AudioFrequency == frequency
+		}
+		if !supported {
+			return errors.ErrStreamPlatformConstraint(name, "audio_frequency", p.AudioFrequency, limits.AudioFrequencies)
+		}
+	}
+	return nil
+}
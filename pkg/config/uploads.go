@@ -144,6 +144,14 @@ func (c StorageConfig) ToUploadConfig() UploadConfig {
 	return nil
 }
 
+// ToFallbackUploadConfig returns the secondary upload destination, or nil if none is configured
+func (c *BaseConfig) ToFallbackUploadConfig() UploadConfig {
+	if c.FallbackStorage == nil {
+		return nil
+	}
+	return c.FallbackStorage.ToUploadConfig()
+}
+
 func redactUpload(req uploadRequest) {
 	if s3 := req.GetS3(); s3 != nil {
 		s3.AccessKey = utils.Redact(s3.AccessKey, "{access_key}")
@@ -0,0 +1,72 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// applyUpscale adjusts the output frame to the source resolution reported by the sdk. With cap, the frame shrinks
+// until the source fits without upscaling, keeping the requested aspect ratio. With letterbox, the frame is kept
+// and the video converter pads the unscaled source instead
+func (p *PipelineConfig) applyUpscale(srcWidth, srcHeight uint32) {
+	if !p.VideoEncoding || srcWidth == 0 || srcHeight == 0 {
+		return
+	}
+
+	if p.Upscale == types.UpscaleBehaviorCap {
+		f := max(float64(srcWidth)/float64(p.Width), float64(srcHeight)/float64(p.Height))
+		if f < 1 {
+			p.Width = evenDimension(float64(p.Width) * f)
+			p.Height = evenDimension(float64(p.Height) * f)
+		}
+	}
+
+	w, h := p.ContentSize(int32(srcWidth), int32(srcHeight))
+	logger.Infow("output resolution",
+		"upscale", p.Upscale,
+		"sourceWidth", srcWidth,
+		"sourceHeight", srcHeight,
+		"width", p.Width,
+		"height", p.Height,
+		"contentWidth", w,
+		"contentHeight", h,
+	)
+}
+
+// UpscaleDisabled is true when sources smaller than the output frame are padded rather than scaled up
+func (p *PipelineConfig) UpscaleDisabled() bool {
+	return p.Upscale == types.UpscaleBehaviorCap || p.Upscale == types.UpscaleBehaviorLetterbox
+}
+
+// ContentSize returns the size a source is scaled to within the output frame, preserving its aspect ratio.
+// Unless upscaling is allowed, sources that already fit are kept at their own resolution
+func (p *PipelineConfig) ContentSize(srcWidth, srcHeight int32) (int32, int32) {
+	if srcWidth <= 0 || srcHeight <= 0 {
+		return p.Width, p.Height
+	}
+
+	f := min(float64(p.Width)/float64(srcWidth), float64(p.Height)/float64(srcHeight))
+	if p.UpscaleDisabled() {
+		f = min(f, 1)
+	}
+	return min(evenDimension(float64(srcWidth)*f), p.Width), min(evenDimension(float64(srcHeight)*f), p.Height)
+}
+
+// evenDimension rounds down to a multiple of 2, as required by I420
+func evenDimension(v float64) int32 {
+	return max(int32(v)&^1, 2)
+}
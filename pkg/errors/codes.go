@@ -0,0 +1,99 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/status"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
+)
+
+// codedError attaches an ErrorCode to a psrpc error, keeping its psrpc code for rpc responses
+type codedError struct {
+	err   psrpc.Error
+	code  types.ErrorCode
+	cause error // underlying error, still reachable with errors.As
+}
+
+func withCode(code types.ErrorCode, err psrpc.Error) error {
+	return &codedError{err: err, code: code}
+}
+
+func withCodeAndCause(code types.ErrorCode, err psrpc.Error, cause error) error {
+	return &codedError{err: err, code: code, cause: cause}
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Code() psrpc.ErrorCode {
+	return e.err.Code()
+}
+
+func (e *codedError) ToHttp() int {
+	return e.err.ToHttp()
+}
+
+func (e *codedError) GRPCStatus() *status.Status {
+	return e.err.GRPCStatus()
+}
+
+func (e *codedError) Unwrap() []error {
+	if e.cause == nil {
+		return []error{e.err}
+	}
+	return []error{e.err, e.cause}
+}
+
+// GetErrorCode maps an error to the code reported for failed egresses.
+// Errors without an explicit code are mapped from their psrpc code.
+func GetErrorCode(err error) types.ErrorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	if errors.Is(err, ErrNoCompatibleCodec) || errors.Is(err, ErrNoCompatibleFileOutputType) {
+		return types.ErrorCodeUnsupportedCodec
+	}
+
+	var psrpcErr psrpc.Error
+	if !errors.As(err, &psrpcErr) {
+		return types.ErrorCodeInternal
+	}
+	switch psrpcErr.Code() {
+	case psrpc.InvalidArgument, psrpc.FailedPrecondition, psrpc.AlreadyExists:
+		return types.ErrorCodeInvalidRequest
+	case psrpc.NotFound:
+		return types.ErrorCodeNotFound
+	case psrpc.Unavailable, psrpc.DeadlineExceeded, psrpc.ResourceExhausted, psrpc.Aborted:
+		return types.ErrorCodeUnavailable
+	default:
+		return types.ErrorCodeInternal
+	}
+}
+
+// IsTransient returns true if an egress that failed with code may succeed when retried
+func IsTransient(code types.ErrorCode) bool {
+	switch code {
+	case types.ErrorCodeUnavailable, types.ErrorCodeUploadFailed, types.ErrorCodeDiskFull, types.ErrorCodeInternal:
+		return true
+	default:
+		return false
+	}
+}
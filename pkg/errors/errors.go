@@ -18,9 +18,11 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-gst/go-gst/gst"
 
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/psrpc"
 )
 
@@ -36,8 +38,23 @@ var (
 	ErrNoCompatibleFileOutputType = psrpc.NewErrorf(psrpc.InvalidArgument, "no supported file output type is compatible with the selected codecs")
 	ErrResourceExhausted          = psrpc.NewErrorf(psrpc.ResourceExhausted, "not enough CPU")
 	ErrSubscriptionFailed         = psrpc.NewErrorf(psrpc.Internal, "failed to subscribe to track")
+	ErrNoVideoTrack               = psrpc.NewErrorf(psrpc.NotFound, "no video track published")
 	ErrPipelineFrozen             = psrpc.NewErrorf(psrpc.Internal, "pipeline frozen")
+	ErrFirstFrameTimeout          = psrpc.NewErrorf(psrpc.DeadlineExceeded, "no media reached the encoder before first frame timeout")
+	ErrGPUUnavailable             = psrpc.NewErrorf(psrpc.Unavailable, "gpu required but not available")
+	ErrNoContent                  = psrpc.NewErrorf(psrpc.FailedPrecondition, "egress ended before any media was recorded")
+	ErrForcedShutdown             = psrpc.NewErrorf(psrpc.Aborted, "egress forcibly stopped, output may be truncated")
 	ErrSinkNotFound               = psrpc.NewErrorf(psrpc.Internal, "sink not found")
+	ErrEgressNotActive            = psrpc.NewErrorf(psrpc.FailedPrecondition, "egress is not active")
+	ErrEgressEnding               = psrpc.NewErrorf(psrpc.FailedPrecondition, "egress is ending")
+	ErrNotAwaitingMarkStart       = psrpc.NewErrorf(psrpc.FailedPrecondition, "egress was not started with await_mark_start")
+	ErrRecordingStarted           = psrpc.NewErrorf(psrpc.FailedPrecondition, "recording has already started")
+	ErrNoDecodedVideo             = psrpc.NewErrorf(psrpc.FailedPrecondition, "egress has no decoded video")
+	ErrSnapshotTimeout            = psrpc.NewErrorf(psrpc.DeadlineExceeded, "timed out waiting for a video frame")
+	ErrAudioLevelsDisabled        = psrpc.NewErrorf(psrpc.FailedPrecondition, "audio levels are not enabled for this egress")
+	ErrTracersDisabled            = psrpc.NewErrorf(psrpc.FailedPrecondition, "gstreamer tracers are not enabled, set debug tracers in the config")
+	ErrLogBufferDisabled          = psrpc.NewErrorf(psrpc.FailedPrecondition, "log buffer is disabled, set debug log_lines in the config")
+	ErrTracerCaptureRunning       = psrpc.NewErrorf(psrpc.Unavailable, "a tracer capture is already running")
 )
 
 func New(err string) error {
@@ -68,6 +85,12 @@ func Fatal(err error) error {
 	return &FatalError{err}
 }
 
+// IsStopSignal returns true if the io service answered with the error code it uses to request a stop
+func IsStopSignal(err error, code string) bool {
+	var psrpcErr psrpc.Error
+	return errors.As(err, &psrpcErr) && string(psrpcErr.Code()) == code
+}
+
 func IsFatal(err error) bool {
 	e := &FatalError{}
 
@@ -83,7 +106,8 @@ func ErrNotSupported(feature string) error {
 }
 
 func ErrIncompatible(format, codec interface{}) error {
-	return psrpc.NewErrorf(psrpc.InvalidArgument, "format %v incompatible with codec %v", format, codec)
+	return withCode(types.ErrorCodeUnsupportedCodec,
+		psrpc.NewErrorf(psrpc.InvalidArgument, "format %v incompatible with codec %v", format, codec))
 }
 
 func ErrInvalidInput(field string) error {
@@ -91,7 +115,11 @@ func ErrInvalidInput(field string) error {
 }
 
 func ErrInvalidUrl(url string, reason string) error {
-	return psrpc.NewErrorf(psrpc.InvalidArgument, "invalid url %s: %s", url, reason)
+	return withCode(types.ErrorCodeInvalidUrl, psrpc.NewErrorf(psrpc.InvalidArgument, "invalid url %s: %s", url, reason))
+}
+
+func ErrTemplateUnreachable(err error) error {
+	return withCode(types.ErrorCodeUnreachableTemplate, psrpc.NewErrorf(psrpc.Unavailable, "could not load template: %v", err))
 }
 
 func ErrStreamNotFound(url string) error {
@@ -106,6 +134,62 @@ func ErrParticipantNotFound(identity string) error {
 	return psrpc.NewErrorf(psrpc.NotFound, "participant %s not found", identity)
 }
 
+func ErrIdentityConflict(identity string) error {
+	return psrpc.NewErrorf(psrpc.AlreadyExists, "egress identity %s is already in use by a room participant", identity)
+}
+
+func ErrRoomDisconnected(reason string) error {
+	return psrpc.NewErrorf(psrpc.Unavailable, "disconnected from room: %s", reason)
+}
+
+func ErrTooManyDiscontinuities(count int) error {
+	return psrpc.NewErrorf(psrpc.Unavailable, "too many discontinuities: %d", count)
+}
+
+func ErrEncoderStalled(encoder string, d time.Duration) error {
+	return psrpc.NewErrorf(psrpc.Internal, "encoder %s produced no output for %s while receiving media", encoder, d.Round(time.Second))
+}
+
+func ErrDiskStalled(dir string, d time.Duration) error {
+	return psrpc.NewErrorf(psrpc.Unavailable, "writes to %s stalled for %s", dir, d.Round(time.Second))
+}
+
+func ErrDiskFull(dir string, free, minFree int64) error {
+	return withCode(types.ErrorCodeDiskFull, psrpc.NewErrorf(psrpc.ResourceExhausted, "%s has %d bytes free, below the %d byte minimum", dir, free, minFree))
+}
+
+// ErrPartiallyRecovered counts recovered outputs, such as file chunks or segments
+func ErrPartiallyRecovered(recovered, lost int, outputs string) error {
+	if lost > 0 {
+		return psrpc.NewErrorf(psrpc.Internal, "handler crashed, partially recovered %d %s, %d could not be uploaded", recovered, outputs, lost)
+	}
+	return psrpc.NewErrorf(psrpc.Internal, "handler crashed, partially recovered %d %s", recovered, outputs)
+}
+
+func ErrNoInputReceived(timeout time.Duration) error {
+	return withCode(types.ErrorCodeNoInput, psrpc.NewErrorf(psrpc.FailedPrecondition, "no input received within %s", timeout))
+}
+
+func ErrEgressTooShort(d, minDuration time.Duration) error {
+	return psrpc.NewErrorf(psrpc.FailedPrecondition, "egress too short: recorded %s, minimum %s", d.Round(time.Millisecond), minDuration)
+}
+
+func ErrUnknownEncodingProfile(name string) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "unknown encoding profile %s", name)
+}
+
+func ErrInvalidFilenameToken(field, token, reason string) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "invalid token %s in %s: %s", token, field, reason)
+}
+
+func ErrInvalidElementOverride(element, reason string) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "invalid element override for %s: %s", element, reason)
+}
+
+func ErrStreamPlatformConstraint(platform, setting string, requested, limit interface{}) error {
+	return psrpc.NewErrorf(psrpc.InvalidArgument, "%s ingest requires %s %v, requested %v", platform, setting, limit, requested)
+}
+
 func ErrPadLinkFailed(src, sink, status string) error {
 	return psrpc.NewErrorf(psrpc.Internal, "failed to link %s to %s: %s", src, sink, status)
 }
@@ -115,9 +199,22 @@ func ErrGstPipelineError(err error) error {
 }
 
 // This can have many reasons, some related to invalid parameters, other because of system failure.
-// Do not provide an error code until we have code to analyze the error from the underlying upload library further.
+// Do not provide a psrpc code until we have code to analyze the error from the underlying upload library further.
+// Rejected credentials are reported by the uploader with ErrUploadAuthFailed, and keep their code when wrapped.
 func ErrUploadFailed(location string, err error) error {
-	return psrpc.NewErrorf(psrpc.Unknown, "%s upload failed: %v", location, err)
+	code := types.ErrorCodeUploadFailed
+	if GetErrorCode(err) == types.ErrorCodeUploadAuthFailed {
+		code = types.ErrorCodeUploadAuthFailed
+	}
+	return withCodeAndCause(code, psrpc.NewErrorf(psrpc.Unknown, "%s upload failed: %v", location, err), err)
+}
+
+func ErrUploadAuthFailed(location string, err error) error {
+	return withCodeAndCause(types.ErrorCodeUploadAuthFailed, psrpc.NewErrorf(psrpc.PermissionDenied, "%s upload failed: %v", location, err), err)
+}
+
+func ErrUploadEncryptionFailed(err error) error {
+	return withCodeAndCause(types.ErrorCodeUploadFailed, psrpc.NewErrorf(psrpc.Internal, "upload encryption failed: %v", err), err)
 }
 
 func ErrWebsocketClosed(addr string) error {
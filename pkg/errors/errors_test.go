@@ -15,9 +15,15 @@
 package errors
 
 import (
+	"fmt"
+	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/psrpc"
 )
 
 func TestFatalError(t *testing.T) {
@@ -25,3 +31,42 @@ func TestFatalError(t *testing.T) {
 	assert.True(t, IsFatal(Fatal(ErrNoConfig)))
 	assert.Equal(t, ErrNoConfig, Fatal(ErrNoConfig).(*FatalError).Unwrap())
 }
+
+func TestGetErrorCode(t *testing.T) {
+	assert.Equal(t, types.ErrorCodeInvalidUrl, GetErrorCode(ErrInvalidUrl("rtmp://", "invalid scheme")))
+	assert.Equal(t, types.ErrorCodeUnsupportedCodec, GetErrorCode(ErrIncompatible("mp4", "vp8")))
+	assert.Equal(t, types.ErrorCodeUnsupportedCodec, GetErrorCode(ErrNoCompatibleCodec))
+	assert.Equal(t, types.ErrorCodeUnreachableTemplate, GetErrorCode(ErrTemplateUnreachable(New("timeout"))))
+	assert.Equal(t, types.ErrorCodeInvalidRequest, GetErrorCode(ErrInvalidInput("url")))
+	assert.Equal(t, types.ErrorCodeNotFound, GetErrorCode(ErrTrackNotFound("TR_1")))
+	assert.Equal(t, types.ErrorCodeUnavailable, GetErrorCode(ErrResourceExhausted))
+	assert.Equal(t, types.ErrorCodeInternal, GetErrorCode(New("unknown")))
+	assert.Equal(t, types.ErrorCodeInternal, GetErrorCode(Fatal(ErrNoConfig)))
+	assert.Equal(t, types.ErrorCodeDiskFull, GetErrorCode(ErrDiskFull("/tmp", 100, 1000)))
+	assert.Equal(t, types.ErrorCodeNoInput, GetErrorCode(ErrNoInputReceived(time.Minute)))
+
+	// upload codes survive wrapping
+	assert.Equal(t, types.ErrorCodeUploadFailed, GetErrorCode(ErrUploadFailed("S3", New("timeout"))))
+	authErr := ErrUploadAuthFailed("S3", New("access denied"))
+	assert.Equal(t, types.ErrorCodeUploadAuthFailed, GetErrorCode(authErr))
+	assert.Equal(t, types.ErrorCodeUploadAuthFailed, GetErrorCode(ErrUploadFailed("segment.ts", authErr)))
+	assert.Equal(t, types.ErrorCodeUploadAuthFailed, GetErrorCode(fmt.Errorf("closing sink: %w", authErr)))
+
+	// upload errors keep their cause
+	var pathErr *fs.PathError
+	assert.True(t, As(ErrUploadFailed("S3", &fs.PathError{Op: "open", Err: fs.ErrNotExist}), &pathErr))
+
+	// codes do not change the psrpc code
+	var psrpcErr psrpc.Error
+	assert.True(t, As(ErrInvalidUrl("rtmp://", "invalid scheme"), &psrpcErr))
+	assert.Equal(t, psrpc.InvalidArgument, psrpcErr.Code())
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, IsTransient(types.ErrorCodeUnavailable))
+	assert.True(t, IsTransient(types.ErrorCodeUploadFailed))
+	assert.True(t, IsTransient(types.ErrorCodeDiskFull))
+	assert.False(t, IsTransient(types.ErrorCodeInvalidUrl))
+	assert.False(t, IsTransient(types.ErrorCodeUploadAuthFailed))
+	assert.False(t, IsTransient(types.ErrorCodeNoInput))
+}
@@ -251,7 +251,9 @@ func (b *Bin) probeRemoveSink(sink *Bin) {
 			logger.Warnw(fmt.Sprintf("failed to change %s state", sink.bin.GetName()), err)
 		}
 
-		b.elements[len(b.elements)-1].ReleaseRequestPad(srcGhostPad.GetTarget())
+		// the linked pad may belong to any of the bin's elements when a custom sink pad function is set
+		srcPad := srcGhostPad.GetTarget()
+		srcPad.GetParentElement().ReleaseRequestPad(srcPad)
 		b.bin.RemovePad(srcGhostPad.Pad)
 		return gst.PadProbeRemove
 	})
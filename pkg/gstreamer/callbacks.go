@@ -22,6 +22,7 @@ import (
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
 )
 
 type Callbacks struct {
@@ -29,18 +30,25 @@ type Callbacks struct {
 	GstReady chan struct{}
 
 	// upstream callbacks
-	onError func(error)
-	onStop  []func() error
+	onError           func(error)
+	onStop            []func() error
+	onOutputUpdated   []func()
+	onSegmentUploaded []func(string, uint64, time.Duration, time.Time)
 
 	// source callbacks
 	onTrackAdded   []func(*config.TrackSource)
 	onTrackMuted   []func(string)
 	onTrackUnmuted []func(string, time.Duration)
 	onTrackRemoved []func(string)
+	onReconnected  []func()
+	onRoomEvent    []func(types.RoomEvent, string)
+	onSpeakers     []func([]string, int64)
+	onChatMessage  []func(string, string)
 
 	// internal
-	addBin    func(bin *gst.Bin)
-	removeBin func(bin *gst.Bin)
+	addBin      func(bin *gst.Bin)
+	removeBin   func(bin *gst.Bin)
+	runningTime func() time.Duration
 }
 
 func (c *Callbacks) SetOnError(f func(error)) {
@@ -77,6 +85,41 @@ func (c *Callbacks) OnStop() error {
 	return errArray.ToError()
 }
 
+func (c *Callbacks) AddOnOutputUpdated(f func()) {
+	c.mu.Lock()
+	c.onOutputUpdated = append(c.onOutputUpdated, f)
+	c.mu.Unlock()
+}
+
+// OnOutputUpdated is called by sinks when their output info changes mid-egress
+func (c *Callbacks) OnOutputUpdated() {
+	c.mu.RLock()
+	onOutputUpdated := c.onOutputUpdated
+	c.mu.RUnlock()
+
+	for _, f := range onOutputUpdated {
+		f()
+	}
+}
+
+func (c *Callbacks) AddOnSegmentUploaded(f func(string, uint64, time.Duration, time.Time)) {
+	c.mu.Lock()
+	c.onSegmentUploaded = append(c.onSegmentUploaded, f)
+	c.mu.Unlock()
+}
+
+// OnSegmentUploaded is called by the segment sink as each segment reaches storage, with its filename, media sequence, and duration.
+// Callbacks must not block, since they run on the playlist update goroutine
+func (c *Callbacks) OnSegmentUploaded(filename string, sequence uint64, duration time.Duration, uploadedAt time.Time) {
+	c.mu.RLock()
+	onSegmentUploaded := c.onSegmentUploaded
+	c.mu.RUnlock()
+
+	for _, f := range onSegmentUploaded {
+		f(filename, sequence, duration, uploadedAt)
+	}
+}
+
 func (c *Callbacks) AddOnTrackAdded(f func(*config.TrackSource)) {
 	c.mu.Lock()
 	c.onTrackAdded = append(c.onTrackAdded, f)
@@ -140,3 +183,86 @@ func (c *Callbacks) OnTrackRemoved(trackID string) {
 		f(trackID)
 	}
 }
+
+func (c *Callbacks) AddOnReconnected(f func()) {
+	c.mu.Lock()
+	c.onReconnected = append(c.onReconnected, f)
+	c.mu.Unlock()
+}
+
+func (c *Callbacks) OnReconnected() {
+	c.mu.RLock()
+	onReconnected := c.onReconnected
+	c.mu.RUnlock()
+
+	for _, f := range onReconnected {
+		f()
+	}
+}
+
+func (c *Callbacks) AddOnRoomEvent(f func(types.RoomEvent, string)) {
+	c.mu.Lock()
+	c.onRoomEvent = append(c.onRoomEvent, f)
+	c.mu.Unlock()
+}
+
+func (c *Callbacks) OnRoomEvent(event types.RoomEvent, description string) {
+	c.mu.RLock()
+	onRoomEvent := c.onRoomEvent
+	c.mu.RUnlock()
+
+	for _, f := range onRoomEvent {
+		f(event, description)
+	}
+}
+
+func (c *Callbacks) AddOnSpeakersChanged(f func([]string, int64)) {
+	c.mu.Lock()
+	c.onSpeakers = append(c.onSpeakers, f)
+	c.mu.Unlock()
+}
+
+func (c *Callbacks) OnSpeakersChanged(identities []string, at int64) {
+	c.mu.RLock()
+	onSpeakers := c.onSpeakers
+	c.mu.RUnlock()
+
+	for _, f := range onSpeakers {
+		f(identities, at)
+	}
+}
+
+func (c *Callbacks) AddOnChatMessage(f func(string, string)) {
+	c.mu.Lock()
+	c.onChatMessage = append(c.onChatMessage, f)
+	c.mu.Unlock()
+}
+
+func (c *Callbacks) OnChatMessage(sender, message string) {
+	c.mu.RLock()
+	onChatMessage := c.onChatMessage
+	c.mu.RUnlock()
+
+	for _, f := range onChatMessage {
+		f(sender, message)
+	}
+}
+
+// SetRunningTime is called once the pipeline is built
+func (c *Callbacks) SetRunningTime(f func() time.Duration) {
+	c.mu.Lock()
+	c.runningTime = f
+	c.mu.Unlock()
+}
+
+// RunningTime returns the pipeline running time, or 0 before the pipeline is built
+func (c *Callbacks) RunningTime() time.Duration {
+	c.mu.RLock()
+	runningTime := c.runningTime
+	c.mu.RUnlock()
+
+	if runningTime == nil {
+		return 0
+	}
+	return runningTime()
+}
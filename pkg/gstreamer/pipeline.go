@@ -139,6 +139,21 @@ func (p *Pipeline) Run() error {
 	return nil
 }
 
+// SetPaused pauses or resumes a running pipeline. Live sources stop producing while paused,
+// and running time excludes the pause, so timestamps continue where they left off
+func (p *Pipeline) SetPaused(paused bool) error {
+	p.LockStateShared()
+	defer p.UnlockStateShared()
+
+	if p.GetStateLocked() != StateRunning {
+		return errors.ErrEgressNotActive
+	}
+	if paused {
+		return p.SetState(gst.StatePaused)
+	}
+	return p.SetState(gst.StatePlaying)
+}
+
 func (p *Pipeline) SendEOS() {
 	old, ok := p.UpgradeState(StateEOS)
 	if ok {
@@ -170,6 +185,31 @@ func (p *Pipeline) Stop() {
 	p.UpgradeState(StateFinished)
 }
 
+// GetElements returns every element in the pipeline, including those within bins
+func (p *Pipeline) GetElements() ([]*gst.Element, error) {
+	return p.pipeline.GetElementsRecursive()
+}
+
+// GetElementByName searches the pipeline and its bins for an element
+func (p *Pipeline) GetElementByName(name string) (*gst.Element, error) {
+	return p.pipeline.GetElementByName(name)
+}
+
+// RunningTime returns the time since the pipeline started playing, matching the timestamps of live sources
+func (p *Pipeline) RunningTime() time.Duration {
+	clock := p.pipeline.GetClock()
+	if clock == nil {
+		return 0
+	}
+	return time.Duration(clock.GetTime() - p.pipeline.GetBaseTime())
+}
+
+// Transitioning returns true while an asynchronous state change is in progress
+func (p *Pipeline) Transitioning() bool {
+	ret, _ := p.pipeline.GetState(gst.VoidPending, 0)
+	return ret == gst.StateChangeAsync
+}
+
 func (p *Pipeline) DebugBinToDotData(details gst.DebugGraphDetails) string {
 	return p.pipeline.DebugBinToDotData(details)
 }
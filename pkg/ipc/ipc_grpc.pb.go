@@ -24,7 +24,21 @@ const _ = grpc.SupportPackageIsVersion7
 type EgressHandlerClient interface {
 	GetPipelineDot(ctx context.Context, in *GstPipelineDebugDotRequest, opts ...grpc.CallOption) (*GstPipelineDebugDotResponse, error)
 	GetPProf(ctx context.Context, in *PProfRequest, opts ...grpc.CallOption) (*PProfResponse, error)
+	GetTracerLogs(ctx context.Context, in *TracerLogsRequest, opts ...grpc.CallOption) (*TracerLogsResponse, error)
+	GetLogs(ctx context.Context, in *LogsRequest, opts ...grpc.CallOption) (*LogsResponse, error)
 	GetMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error)
+	WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (EgressHandler_WatchStatsClient, error)
+	GetReadiness(ctx context.Context, in *ReadinessRequest, opts ...grpc.CallOption) (*ReadinessResponse, error)
+	GetHealth(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+	GetEgressStatus(ctx context.Context, in *EgressStatusRequest, opts ...grpc.CallOption) (*EgressStatusResponse, error)
+	GetActiveOutputs(ctx context.Context, in *ActiveOutputsRequest, opts ...grpc.CallOption) (*ActiveOutputsResponse, error)
+	PauseEgress(ctx context.Context, in *PauseEgressRequest, opts ...grpc.CallOption) (*PauseStateResponse, error)
+	ResumeEgress(ctx context.Context, in *ResumeEgressRequest, opts ...grpc.CallOption) (*PauseStateResponse, error)
+	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error)
+	MarkStart(ctx context.Context, in *MarkStartRequest, opts ...grpc.CallOption) (*MarkStartResponse, error)
+	UpdateLayout(ctx context.Context, in *UpdateLayoutRequest, opts ...grpc.CallOption) (*UpdateLayoutResponse, error)
+	GetSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*SnapshotResponse, error)
+	GetAudioLevels(ctx context.Context, in *AudioLevelsRequest, opts ...grpc.CallOption) (*AudioLevelsResponse, error)
 }
 
 type egressHandlerClient struct {
@@ -53,6 +67,24 @@ func (c *egressHandlerClient) GetPProf(ctx context.Context, in *PProfRequest, op
 	return out, nil
 }
 
+func (c *egressHandlerClient) GetTracerLogs(ctx context.Context, in *TracerLogsRequest, opts ...grpc.CallOption) (*TracerLogsResponse, error) {
+	out := new(TracerLogsResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetTracerLogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetLogs(ctx context.Context, in *LogsRequest, opts ...grpc.CallOption) (*LogsResponse, error) {
+	out := new(LogsResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetLogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *egressHandlerClient) GetMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error) {
 	out := new(MetricsResponse)
 	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetMetrics", in, out, opts...)
@@ -62,13 +94,158 @@ func (c *egressHandlerClient) GetMetrics(ctx context.Context, in *MetricsRequest
 	return out, nil
 }
 
+func (c *egressHandlerClient) WatchStats(ctx context.Context, in *WatchStatsRequest, opts ...grpc.CallOption) (EgressHandler_WatchStatsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EgressHandler_ServiceDesc.Streams[0], "/ipc.EgressHandler/WatchStats", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &egressHandlerWatchStatsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EgressHandler_WatchStatsClient interface {
+	Recv() (*PipelineStats, error)
+	grpc.ClientStream
+}
+
+type egressHandlerWatchStatsClient struct {
+	grpc.ClientStream
+}
+
+func (x *egressHandlerWatchStatsClient) Recv() (*PipelineStats, error) {
+	m := new(PipelineStats)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *egressHandlerClient) GetReadiness(ctx context.Context, in *ReadinessRequest, opts ...grpc.CallOption) (*ReadinessResponse, error) {
+	out := new(ReadinessResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetReadiness", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetHealth(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetHealth", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetEgressStatus(ctx context.Context, in *EgressStatusRequest, opts ...grpc.CallOption) (*EgressStatusResponse, error) {
+	out := new(EgressStatusResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetEgressStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetActiveOutputs(ctx context.Context, in *ActiveOutputsRequest, opts ...grpc.CallOption) (*ActiveOutputsResponse, error) {
+	out := new(ActiveOutputsResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetActiveOutputs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) PauseEgress(ctx context.Context, in *PauseEgressRequest, opts ...grpc.CallOption) (*PauseStateResponse, error) {
+	out := new(PauseStateResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/PauseEgress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) ResumeEgress(ctx context.Context, in *ResumeEgressRequest, opts ...grpc.CallOption) (*PauseStateResponse, error) {
+	out := new(PauseStateResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/ResumeEgress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*StopResponse, error) {
+	out := new(StopResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/Stop", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) MarkStart(ctx context.Context, in *MarkStartRequest, opts ...grpc.CallOption) (*MarkStartResponse, error) {
+	out := new(MarkStartResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/MarkStart", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) UpdateLayout(ctx context.Context, in *UpdateLayoutRequest, opts ...grpc.CallOption) (*UpdateLayoutResponse, error) {
+	out := new(UpdateLayoutResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/UpdateLayout", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (*SnapshotResponse, error) {
+	out := new(SnapshotResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetSnapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *egressHandlerClient) GetAudioLevels(ctx context.Context, in *AudioLevelsRequest, opts ...grpc.CallOption) (*AudioLevelsResponse, error) {
+	out := new(AudioLevelsResponse)
+	err := c.cc.Invoke(ctx, "/ipc.EgressHandler/GetAudioLevels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EgressHandlerServer is the server API for EgressHandler service.
 // All implementations must embed UnimplementedEgressHandlerServer
 // for forward compatibility
 type EgressHandlerServer interface {
 	GetPipelineDot(context.Context, *GstPipelineDebugDotRequest) (*GstPipelineDebugDotResponse, error)
 	GetPProf(context.Context, *PProfRequest) (*PProfResponse, error)
+	GetTracerLogs(context.Context, *TracerLogsRequest) (*TracerLogsResponse, error)
+	GetLogs(context.Context, *LogsRequest) (*LogsResponse, error)
 	GetMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error)
+	WatchStats(*WatchStatsRequest, EgressHandler_WatchStatsServer) error
+	GetReadiness(context.Context, *ReadinessRequest) (*ReadinessResponse, error)
+	GetHealth(context.Context, *HealthRequest) (*HealthResponse, error)
+	GetEgressStatus(context.Context, *EgressStatusRequest) (*EgressStatusResponse, error)
+	GetActiveOutputs(context.Context, *ActiveOutputsRequest) (*ActiveOutputsResponse, error)
+	PauseEgress(context.Context, *PauseEgressRequest) (*PauseStateResponse, error)
+	ResumeEgress(context.Context, *ResumeEgressRequest) (*PauseStateResponse, error)
+	Stop(context.Context, *StopRequest) (*StopResponse, error)
+	MarkStart(context.Context, *MarkStartRequest) (*MarkStartResponse, error)
+	UpdateLayout(context.Context, *UpdateLayoutRequest) (*UpdateLayoutResponse, error)
+	GetSnapshot(context.Context, *SnapshotRequest) (*SnapshotResponse, error)
+	GetAudioLevels(context.Context, *AudioLevelsRequest) (*AudioLevelsResponse, error)
 	mustEmbedUnimplementedEgressHandlerServer()
 }
 
@@ -82,9 +259,51 @@ func (UnimplementedEgressHandlerServer) GetPipelineDot(context.Context, *GstPipe
 func (UnimplementedEgressHandlerServer) GetPProf(context.Context, *PProfRequest) (*PProfResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetPProf not implemented")
 }
+func (UnimplementedEgressHandlerServer) GetTracerLogs(context.Context, *TracerLogsRequest) (*TracerLogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTracerLogs not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetLogs(context.Context, *LogsRequest) (*LogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLogs not implemented")
+}
 func (UnimplementedEgressHandlerServer) GetMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
 }
+func (UnimplementedEgressHandlerServer) WatchStats(*WatchStatsRequest, EgressHandler_WatchStatsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStats not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetReadiness(context.Context, *ReadinessRequest) (*ReadinessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReadiness not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetHealth(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHealth not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetEgressStatus(context.Context, *EgressStatusRequest) (*EgressStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEgressStatus not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetActiveOutputs(context.Context, *ActiveOutputsRequest) (*ActiveOutputsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetActiveOutputs not implemented")
+}
+func (UnimplementedEgressHandlerServer) PauseEgress(context.Context, *PauseEgressRequest) (*PauseStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseEgress not implemented")
+}
+func (UnimplementedEgressHandlerServer) ResumeEgress(context.Context, *ResumeEgressRequest) (*PauseStateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeEgress not implemented")
+}
+func (UnimplementedEgressHandlerServer) Stop(context.Context, *StopRequest) (*StopResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedEgressHandlerServer) MarkStart(context.Context, *MarkStartRequest) (*MarkStartResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MarkStart not implemented")
+}
+func (UnimplementedEgressHandlerServer) UpdateLayout(context.Context, *UpdateLayoutRequest) (*UpdateLayoutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLayout not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetSnapshot(context.Context, *SnapshotRequest) (*SnapshotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSnapshot not implemented")
+}
+func (UnimplementedEgressHandlerServer) GetAudioLevels(context.Context, *AudioLevelsRequest) (*AudioLevelsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAudioLevels not implemented")
+}
 func (UnimplementedEgressHandlerServer) mustEmbedUnimplementedEgressHandlerServer() {}
 
 // UnsafeEgressHandlerServer may be embedded to opt out of forward compatibility for this service.
@@ -134,6 +353,42 @@ func _EgressHandler_GetPProf_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EgressHandler_GetTracerLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TracerLogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetTracerLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetTracerLogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetTracerLogs(ctx, req.(*TracerLogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetLogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetLogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetLogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetLogs(ctx, req.(*LogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _EgressHandler_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(MetricsRequest)
 	if err := dec(in); err != nil {
@@ -152,6 +407,225 @@ func _EgressHandler_GetMetrics_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _EgressHandler_WatchStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EgressHandlerServer).WatchStats(m, &egressHandlerWatchStatsServer{stream})
+}
+
+type EgressHandler_WatchStatsServer interface {
+	Send(*PipelineStats) error
+	grpc.ServerStream
+}
+
+type egressHandlerWatchStatsServer struct {
+	grpc.ServerStream
+}
+
+func (x *egressHandlerWatchStatsServer) Send(m *PipelineStats) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _EgressHandler_GetReadiness_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadinessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetReadiness(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetReadiness",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetReadiness(ctx, req.(*ReadinessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetHealth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetHealth(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetEgressStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EgressStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetEgressStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetEgressStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetEgressStatus(ctx, req.(*EgressStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetActiveOutputs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ActiveOutputsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetActiveOutputs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetActiveOutputs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetActiveOutputs(ctx, req.(*ActiveOutputsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_PauseEgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseEgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).PauseEgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/PauseEgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).PauseEgress(ctx, req.(*PauseEgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_ResumeEgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeEgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).ResumeEgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/ResumeEgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).ResumeEgress(ctx, req.(*ResumeEgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/Stop",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).Stop(ctx, req.(*StopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_MarkStart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MarkStartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).MarkStart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/MarkStart",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).MarkStart(ctx, req.(*MarkStartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_UpdateLayout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLayoutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).UpdateLayout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/UpdateLayout",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).UpdateLayout(ctx, req.(*UpdateLayoutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetSnapshot(ctx, req.(*SnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EgressHandler_GetAudioLevels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AudioLevelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EgressHandlerServer).GetAudioLevels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ipc.EgressHandler/GetAudioLevels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EgressHandlerServer).GetAudioLevels(ctx, req.(*AudioLevelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // EgressHandler_ServiceDesc is the grpc.ServiceDesc for EgressHandler service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -167,11 +641,69 @@ var EgressHandler_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetPProf",
 			Handler:    _EgressHandler_GetPProf_Handler,
 		},
+		{
+			MethodName: "GetTracerLogs",
+			Handler:    _EgressHandler_GetTracerLogs_Handler,
+		},
+		{
+			MethodName: "GetLogs",
+			Handler:    _EgressHandler_GetLogs_Handler,
+		},
 		{
 			MethodName: "GetMetrics",
 			Handler:    _EgressHandler_GetMetrics_Handler,
 		},
+		{
+			MethodName: "GetReadiness",
+			Handler:    _EgressHandler_GetReadiness_Handler,
+		},
+		{
+			MethodName: "GetHealth",
+			Handler:    _EgressHandler_GetHealth_Handler,
+		},
+		{
+			MethodName: "GetEgressStatus",
+			Handler:    _EgressHandler_GetEgressStatus_Handler,
+		},
+		{
+			MethodName: "GetActiveOutputs",
+			Handler:    _EgressHandler_GetActiveOutputs_Handler,
+		},
+		{
+			MethodName: "PauseEgress",
+			Handler:    _EgressHandler_PauseEgress_Handler,
+		},
+		{
+			MethodName: "ResumeEgress",
+			Handler:    _EgressHandler_ResumeEgress_Handler,
+		},
+		{
+			MethodName: "Stop",
+			Handler:    _EgressHandler_Stop_Handler,
+		},
+		{
+			MethodName: "MarkStart",
+			Handler:    _EgressHandler_MarkStart_Handler,
+		},
+		{
+			MethodName: "UpdateLayout",
+			Handler:    _EgressHandler_UpdateLayout_Handler,
+		},
+		{
+			MethodName: "GetSnapshot",
+			Handler:    _EgressHandler_GetSnapshot_Handler,
+		},
+		{
+			MethodName: "GetAudioLevels",
+			Handler:    _EgressHandler_GetAudioLevels_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchStats",
+			Handler:       _EgressHandler_WatchStats_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "ipc.proto",
 }
@@ -0,0 +1,117 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logbuffer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
+)
+
+// Entry is a single formatted log line
+type Entry struct {
+	Time    time.Time
+	Level   zapcore.Level
+	Message string // message followed by its key=value pairs
+
+	seq uint64
+}
+
+// Buffer keeps the most recent log lines at or above a level. Writers claim a slot with a single
+// atomic increment, so logging never waits on a lock or on readers
+type Buffer struct {
+	level zapcore.Level
+	slots []atomic.Pointer[Entry]
+	next  atomic.Uint64
+}
+
+func New(size int, level zapcore.Level) *Buffer {
+	return &Buffer{
+		level: level,
+		slots: make([]atomic.Pointer[Entry], size),
+	}
+}
+
+// Enabled returns true if lines at this level are kept
+func (b *Buffer) Enabled(level zapcore.Level) bool {
+	return b != nil && len(b.slots) > 0 && level >= b.level
+}
+
+// Add formats and stores a line, overwriting the oldest one once the buffer is full
+func (b *Buffer) Add(level zapcore.Level, msg string, keysAndValues ...interface{}) {
+	if !b.Enabled(level) {
+		return
+	}
+
+	e := &Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: format(msg, keysAndValues),
+	}
+	e.seq = b.next.Inc()
+	b.slots[(e.seq-1)%uint64(len(b.slots))].Store(e)
+}
+
+// Entries returns up to limit of the most recent lines at or above minLevel, oldest first. 0 returns every line kept
+func (b *Buffer) Entries(minLevel zapcore.Level, limit int) []*Entry {
+	if b == nil || len(b.slots) == 0 {
+		return nil
+	}
+
+	size := uint64(len(b.slots))
+	end := b.next.Load()
+	start := uint64(1)
+	if end > size {
+		start = end - size + 1
+	}
+
+	entries := make([]*Entry, 0, end-start+1)
+	for seq := start; seq <= end; seq++ {
+		e := b.slots[(seq-1)%size].Load()
+		if e == nil || e.seq != seq {
+			// not stored yet, or already overwritten
+			continue
+		}
+		if e.Level >= minLevel {
+			entries = append(entries, e)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+func format(msg string, keysAndValues []interface{}) string {
+	if len(keysAndValues) == 0 {
+		return msg
+	}
+
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		sb.WriteByte(' ')
+		if i+1 == len(keysAndValues) {
+			// missing value
+			fmt.Fprintf(&sb, "%v", keysAndValues[i])
+			break
+		}
+		fmt.Fprintf(&sb, "%v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	return sb.String()
+}
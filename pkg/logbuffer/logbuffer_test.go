@@ -0,0 +1,82 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logbuffer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/livekit/protocol/logger"
+)
+
+func messages(entries []*Entry) []string {
+	m := make([]string, 0, len(entries))
+	for _, e := range entries {
+		m = append(m, e.Message)
+	}
+	return m
+}
+
+func TestBuffer(t *testing.T) {
+	b := New(3, zapcore.InfoLevel)
+	b.Add(zapcore.DebugLevel, "dropped")
+	b.Add(zapcore.InfoLevel, "one", "key", "value")
+	b.Add(zapcore.WarnLevel, "two", "error", errors.New("failed"), "odd")
+	require.Equal(t, []string{"one key=value", "two error=failed odd"}, messages(b.Entries(zapcore.DebugLevel, 0)))
+
+	// oldest lines are overwritten
+	b.Add(zapcore.InfoLevel, "three")
+	b.Add(zapcore.ErrorLevel, "four")
+	require.Equal(t, []string{"two error=failed odd", "three", "four"}, messages(b.Entries(zapcore.DebugLevel, 0)))
+	require.Equal(t, []string{"two error=failed odd", "four"}, messages(b.Entries(zapcore.WarnLevel, 0)))
+	require.Equal(t, []string{"four"}, messages(b.Entries(zapcore.DebugLevel, 1)))
+
+	var disabled *Buffer
+	disabled.Add(zapcore.ErrorLevel, "dropped")
+	require.Empty(t, disabled.Entries(zapcore.DebugLevel, 0))
+}
+
+func TestBufferConcurrent(t *testing.T) {
+	b := New(64, zapcore.DebugLevel)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.Add(zapcore.InfoLevel, "line")
+				_ = b.Entries(zapcore.DebugLevel, 0)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, b.Entries(zapcore.DebugLevel, 0), 64)
+}
+
+func TestLogger(t *testing.T) {
+	b := New(10, zapcore.InfoLevel)
+	l := Wrap(logger.GetLogger(), b).WithValues("egressID", "EG_1").WithName("test")
+	l.Debugw("dropped")
+	l.Infow("started", "outputs", 2)
+	l.Errorw("failed", errors.New("timeout"))
+	require.Equal(t, []string{
+		"started egressID=EG_1 outputs=2",
+		"failed egressID=EG_1 error=timeout",
+	}, messages(b.Entries(zapcore.DebugLevel, 0)))
+}
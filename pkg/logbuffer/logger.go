@@ -0,0 +1,107 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logbuffer
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// Logger writes to the wrapped logger and to a Buffer
+type Logger struct {
+	logger.Logger
+	buffer *Buffer
+	values []interface{}
+}
+
+// Wrap returns a logger that also keeps each line in the buffer
+func Wrap(l logger.Logger, buffer *Buffer) logger.Logger {
+	// account for the extra frame, so callers are still reported correctly
+	return &Logger{Logger: l.WithCallDepth(1), buffer: buffer}
+}
+
+// ToZap returns the wrapped zap logger, which writes around the buffer
+func ToZap(l logger.Logger) *zap.SugaredLogger {
+	if w, ok := l.(*Logger); ok {
+		l = w.Logger
+	}
+	return l.(*logger.ZapLogger).ToZap()
+}
+
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.Logger.Debugw(msg, keysAndValues...)
+	l.add(zapcore.DebugLevel, msg, nil, keysAndValues)
+}
+
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.Logger.Infow(msg, keysAndValues...)
+	l.add(zapcore.InfoLevel, msg, nil, keysAndValues)
+}
+
+func (l *Logger) Warnw(msg string, err error, keysAndValues ...interface{}) {
+	l.Logger.Warnw(msg, err, keysAndValues...)
+	l.add(zapcore.WarnLevel, msg, err, keysAndValues)
+}
+
+func (l *Logger) Errorw(msg string, err error, keysAndValues ...interface{}) {
+	l.Logger.Errorw(msg, err, keysAndValues...)
+	l.add(zapcore.ErrorLevel, msg, err, keysAndValues)
+}
+
+func (l *Logger) add(level zapcore.Level, msg string, err error, keysAndValues []interface{}) {
+	if !l.buffer.Enabled(level) {
+		return
+	}
+
+	values := make([]interface{}, 0, len(l.values)+len(keysAndValues)+2)
+	values = append(values, l.values...)
+	values = append(values, keysAndValues...)
+	if err != nil {
+		values = append(values, "error", err)
+	}
+	l.buffer.Add(level, msg, values...)
+}
+
+func (l *Logger) WithValues(keysAndValues ...interface{}) logger.Logger {
+	values := make([]interface{}, 0, len(l.values)+len(keysAndValues))
+	values = append(values, l.values...)
+	return l.with(l.Logger.WithValues(keysAndValues...), append(values, keysAndValues...))
+}
+
+func (l *Logger) WithName(name string) logger.Logger {
+	return l.with(l.Logger.WithName(name), l.values)
+}
+
+func (l *Logger) WithComponent(component string) logger.Logger {
+	return l.with(l.Logger.WithComponent(component), l.values)
+}
+
+func (l *Logger) WithCallDepth(depth int) logger.Logger {
+	return l.with(l.Logger.WithCallDepth(depth), l.values)
+}
+
+func (l *Logger) WithItemSampler() logger.Logger {
+	return l.with(l.Logger.WithItemSampler(), l.values)
+}
+
+func (l *Logger) WithoutSampler() logger.Logger {
+	return l.with(l.Logger.WithoutSampler(), l.values)
+}
+
+func (l *Logger) with(inner logger.Logger, values []interface{}) logger.Logger {
+	return &Logger{Logger: inner, buffer: l.buffer, values: values}
+}
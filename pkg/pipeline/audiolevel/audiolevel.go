@@ -0,0 +1,86 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audiolevel
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FloorDB is reported for silence, which the level element measures as -inf
+const FloorDB = -100.0
+
+var (
+	errInvalidLevel = errors.New("invalid level message")
+
+	arrayRegExp    = regexp.MustCompile(`(rms|peak)=\([A-Za-z]+\)<([^>]*)>`)
+	durationRegExp = regexp.MustCompile(`duration=\(guint64\)(\d+)`)
+)
+
+// Levels is a single measurement by the level element, in dBFS per channel
+type Levels struct {
+	RMS        []float64
+	Peak       []float64
+	Duration   time.Duration // measurement interval
+	MeasuredAt time.Time
+}
+
+// Parse reads the rms and peak values of a serialized level message structure, such as
+// "level, duration=(guint64)100000000, rms=(double)< -20.5, -21 >, peak=(double)< -12, -13.5 >;"
+func Parse(structure string) (*Levels, error) {
+	l := &Levels{}
+	for _, m := range arrayRegExp.FindAllStringSubmatch(structure, -1) {
+		values, err := parseArray(m[2])
+		if err != nil {
+			return nil, err
+		}
+		if m[1] == "rms" {
+			l.RMS = values
+		} else {
+			l.Peak = values
+		}
+	}
+	if len(l.RMS) == 0 || len(l.RMS) != len(l.Peak) {
+		return nil, errInvalidLevel
+	}
+
+	if m := durationRegExp.FindStringSubmatch(structure); m != nil {
+		ns, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, errInvalidLevel
+		}
+		l.Duration = time.Duration(ns)
+	}
+	return l, nil
+}
+
+func parseArray(s string) ([]float64, error) {
+	var values []float64
+	for _, v := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, errInvalidLevel
+		}
+		if math.IsNaN(f) || f < FloorDB {
+			f = FloorDB
+		}
+		values = append(values, min(f, 0))
+	}
+	return values, nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audiolevel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	l, err := Parse("level, endtime=(guint64)1000000000, timestamp=(guint64)900000000, stream-time=(guint64)900000000, " +
+		"running-time=(guint64)900000000, duration=(guint64)100000000, rms=(double)< -20.5, -inf >, " +
+		"peak=(double)< -12, -13.25 >, decay=(double)< -12, -13.25 >;")
+	require.NoError(t, err)
+	require.Equal(t, []float64{-20.5, FloorDB}, l.RMS)
+	require.Equal(t, []float64{-12, -13.25}, l.Peak)
+	require.Equal(t, 100*time.Millisecond, l.Duration)
+
+	// older versions serialize the arrays as GValueArray
+	l, err = Parse("level, duration=(guint64)50000000, rms=(GValueArray)< -30 >, peak=(GValueArray)< -25 >;")
+	require.NoError(t, err)
+	require.Equal(t, []float64{-30}, l.RMS)
+	require.Equal(t, []float64{-25}, l.Peak)
+
+	_, err = Parse("level, rms=(double)< -20.5, -21 >, peak=(double)< -12 >;")
+	require.Error(t, err)
+	_, err = Parse("level, rms=(double)< loud >, peak=(double)< -12 >;")
+	require.Error(t, err)
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/audiolevel"
+	"github.com/livekit/protocol/logger"
+)
+
+// updateAudioLevels keeps the latest measurement of the audio_level element
+func (c *Controller) updateAudioLevels(s *gst.Structure) {
+	levels, err := audiolevel.Parse(s.String())
+	if err != nil {
+		logger.Debugw("failed to parse audio levels", err)
+		return
+	}
+	levels.MeasuredAt = time.Now()
+	c.audioLevels.Store(levels)
+}
+
+// GetAudioLevels returns the most recent per channel rms and peak levels, or nil before the first measurement
+func (c *Controller) GetAudioLevels() (*audiolevel.Levels, error) {
+	if !c.AudioLevels.Enabled || !c.AudioEnabled {
+		return nil, errors.ErrAudioLevelsDisabled
+	}
+	return c.audioLevels.Load(), nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/sink/waveform"
 	"github.com/livekit/egress/pkg/types"
 	lksdk "github.com/livekit/server-sdk-go"
 )
@@ -30,17 +31,41 @@ import (
 const audioMixerLatency = uint64(2e9)
 
 type AudioBin struct {
-	bin  *gstreamer.Bin
-	conf *config.PipelineConfig
+	bin    *gstreamer.Bin
+	conf   *config.PipelineConfig
+	levels *waveform.Levels
+	track  *config.AudioTrackConfig // in multitrack mode, the only track recorded by this bin
 
 	mu     sync.Mutex
 	tracks map[string]struct{}
 }
 
-func BuildAudioBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) error {
+// BuildAudioBin builds the audio input. When levels is not nil, it is fed the mixed raw audio.
+// In multitrack mode, each audio track gets its own bin and output track, with levels measured on the first
+func BuildAudioBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig, levels *waveform.Levels) error {
+	if p.AudioMode != types.AudioModeMultitrack {
+		return buildAudioBin(pipeline, p, "audio", nil, levels)
+	}
+
+	for i, track := range p.AudioTracks {
+		name := "audio"
+		if i > 0 {
+			name = fmt.Sprintf("audio_%d", i)
+		}
+		if err := buildAudioBin(pipeline, p, name, track, levels); err != nil {
+			return err
+		}
+		levels = nil
+	}
+	return nil
+}
+
+func buildAudioBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig, name string, track *config.AudioTrackConfig, levels *waveform.Levels) error {
 	b := &AudioBin{
-		bin:    pipeline.NewBin("audio"),
+		bin:    pipeline.NewBin(name),
 		conf:   p,
+		levels: levels,
+		track:  track,
 		tracks: make(map[string]struct{}),
 	}
 
@@ -59,8 +84,14 @@ func BuildAudioBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) error
 		pipeline.AddOnTrackRemoved(b.onTrackRemoved)
 	}
 
+	if p.StartGated() {
+		if err := addPreRollQueue(b.bin, name, p); err != nil {
+			return err
+		}
+	}
+
 	if len(p.GetEncodedOutputs()) > 1 {
-		tee, err := gst.NewElementWithName("tee", "audio_tee")
+		tee, err := gst.NewElementWithName("tee", name+"_tee")
 		if err != nil {
 			return err
 		}
@@ -68,7 +99,7 @@ func BuildAudioBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) error
 			return err
 		}
 	} else {
-		queue, err := gstreamer.BuildQueue("audio_queue", p.Latency, true)
+		queue, err := gstreamer.BuildQueue(name+"_queue", p.Latency, true)
 		if err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
@@ -85,7 +116,7 @@ func (b *AudioBin) onTrackAdded(ts *config.TrackSource) {
 		return
 	}
 
-	if ts.Kind == lksdk.TrackKindAudio {
+	if ts.Kind == lksdk.TrackKindAudio && (b.track == nil || ts.TrackID == b.track.TrackID) {
 		if err := b.addAudioAppSrcBin(ts); err != nil {
 			b.bin.OnError(err)
 		}
@@ -124,6 +155,11 @@ func (b *AudioBin) buildWebInput() error {
 	if err = addAudioConverter(b.bin, b.conf); err != nil {
 		return err
 	}
+	if b.conf.AudioLevels.Enabled {
+		if err = b.addLevel(); err != nil {
+			return err
+		}
+	}
 	if b.conf.AudioTranscoding {
 		if err = b.addEncoder(); err != nil {
 			return err
@@ -134,8 +170,8 @@ func (b *AudioBin) buildWebInput() error {
 }
 
 func (b *AudioBin) buildSDKInput() error {
-	if b.conf.AudioTrack != nil {
-		if err := b.addAudioAppSrcBin(b.conf.AudioTrack); err != nil {
+	for _, ts := range b.trackSources() {
+		if err := b.addAudioAppSrcBin(ts); err != nil {
 			return err
 		}
 	}
@@ -145,15 +181,44 @@ func (b *AudioBin) buildSDKInput() error {
 	if err := b.addMixer(); err != nil {
 		return err
 	}
+	if b.conf.AudioLevels.Enabled && b.measured() {
+		if err := b.addLevel(); err != nil {
+			return err
+		}
+	}
 	if b.conf.AudioTranscoding {
 		if err := b.addEncoder(); err != nil {
 			return err
 		}
 	}
+	if b.track != nil && b.track.Language != "" {
+		if err := b.addLanguageTag(); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+// trackSources returns the tracks subscribed before the pipeline was built which this bin records
+func (b *AudioBin) trackSources() []*config.TrackSource {
+	var sources []*config.TrackSource
+	if b.conf.AudioTrack != nil && (b.track == nil || b.track.TrackID == b.conf.AudioTrack.TrackID) {
+		sources = append(sources, b.conf.AudioTrack)
+	}
+	for trackID, ts := range b.conf.AudioTrackSources {
+		if b.track == nil || b.track.TrackID == trackID {
+			sources = append(sources, ts)
+		}
+	}
+	return sources
+}
+
+// measured is true for the bin carrying the primary audio track, the only one with levels
+func (b *AudioBin) measured() bool {
+	return b.track == nil || b.track.TrackID == b.conf.AudioTrackID
+}
+
 func (b *AudioBin) addAudioAppSrcBin(ts *config.TrackSource) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -255,34 +320,66 @@ func (b *AudioBin) addMixer() error {
 	return b.bin.AddElements(audioMixer, mixedCaps)
 }
 
+// addLevel measures the mixed audio, posting a level message on the bus after each interval
+func (b *AudioBin) addLevel() error {
+	level, err := gst.NewElementWithName("level", "audio_level")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = level.SetProperty("interval", uint64(b.conf.AudioLevels.Interval)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = level.SetProperty("post-messages", true); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	return b.bin.AddElement(level)
+}
+
 func (b *AudioBin) addEncoder() error {
+	var encoder *gst.Element
+	var err error
 	switch b.conf.AudioOutCodec {
 	case types.MimeTypeOpus:
-		opusEnc, err := gst.NewElement("opusenc")
-		if err != nil {
-			return errors.ErrGstPipelineError(err)
-		}
-		if err = opusEnc.SetProperty("bitrate", int(b.conf.AudioBitrate*1000)); err != nil {
-			return errors.ErrGstPipelineError(err)
-		}
-		return b.bin.AddElement(opusEnc)
-
+		encoder, err = gst.NewElement("opusenc")
 	case types.MimeTypeAAC:
-		faac, err := gst.NewElement("faac")
-		if err != nil {
-			return errors.ErrGstPipelineError(err)
-		}
-		if err = faac.SetProperty("bitrate", int(b.conf.AudioBitrate*1000)); err != nil {
-			return errors.ErrGstPipelineError(err)
-		}
-		return b.bin.AddElement(faac)
-
+		encoder, err = gst.NewElement("faac")
 	case types.MimeTypeRawAudio:
 		return nil
-
 	default:
 		return errors.ErrNotSupported(string(b.conf.AudioOutCodec))
 	}
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = encoder.SetProperty("bitrate", int(b.conf.AudioBitrate*1000)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	if b.levels != nil {
+		encoder.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+			if buffer := info.GetBuffer(); buffer != nil {
+				b.levels.Write(buffer.Map(gst.MapRead).Bytes())
+				buffer.Unmap()
+			}
+			return gst.PadProbeOK
+		})
+	}
+
+	return b.bin.AddElement(encoder)
+}
+
+// addLanguageTag marks the encoded track with its language, written by mp4mux and webmmux
+func (b *AudioBin) addLanguageTag() error {
+	tagInject, err := gst.NewElement("taginject")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = tagInject.SetProperty("tags", fmt.Sprintf("language-code=%s", b.track.Language)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	return b.bin.AddElement(tagInject)
 }
 
 func addAudioConverter(b *gstreamer.Bin, p *config.PipelineConfig) error {
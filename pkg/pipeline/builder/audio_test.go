@@ -0,0 +1,79 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"testing"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestMultitrackAudio(t *testing.T) {
+	gst.Init(nil)
+
+	p := &config.PipelineConfig{}
+	p.SourceType = types.SourceTypeSDK
+	p.AudioMode = types.AudioModeMultitrack
+	p.AudioTracks = []*config.AudioTrackConfig{
+		{TrackID: "TR_1", Language: "eng"},
+		{TrackID: "TR_2", Language: "fra"},
+		{TrackID: "TR_3"},
+	}
+	p.AudioTranscoding = true
+	p.AudioOutCodec = types.MimeTypeOpus
+	p.AudioBitrate = 128
+
+	pipeline, err := gstreamer.NewPipeline("pipeline", 0, &gstreamer.Callbacks{GstReady: make(chan struct{})})
+	require.NoError(t, err)
+	require.NoError(t, BuildAudioBin(pipeline, p, nil))
+
+	// each track gets its own bin, tagged with its language when it has one
+	for name, tagged := range map[string]bool{"audio": true, "audio_1": true, "audio_2": false} {
+		bin, err := pipeline.GetElementByName(name)
+		require.NoError(t, err, name)
+		elements, err := gst.ToGstBin(bin).GetElementsRecursive()
+		require.NoError(t, err)
+
+		tagInjects := 0
+		for _, e := range elements {
+			if e.GetFactory().GetName() == "taginject" {
+				tagInjects++
+			}
+		}
+		if tagged {
+			require.Equal(t, 1, tagInjects, name)
+		} else {
+			require.Zero(t, tagInjects, name)
+		}
+	}
+
+	// every audio bin requests its own track from the muxer
+	mux, err := gst.NewElement("mp4mux")
+	require.NoError(t, err)
+	pads := make(map[string]bool)
+	for _, name := range []string{"audio", "audio_1", "audio_2"} {
+		require.Equal(t, "audio_%u", muxPadTemplate(name))
+		pad := mux.GetRequestPad(muxPadTemplate(name))
+		require.NotNil(t, pad)
+		pads[pad.GetName()] = true
+	}
+	require.Len(t, pads, 3)
+	require.Equal(t, "video_%u", muxPadTemplate("video"))
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxPending       = 20
+	maxMessageLength = 200
+)
+
+type Message struct {
+	Sender string
+	Text   string
+}
+
+type visibleMessage struct {
+	line    string
+	expires time.Time
+}
+
+// Queue shows up to maxVisible messages at once, each for duration.
+// Later messages wait for a free line, and the oldest waiting messages are dropped once too many build up.
+type Queue struct {
+	mu         sync.Mutex
+	duration   time.Duration
+	maxVisible int
+	visible    []visibleMessage
+	pending    []string
+}
+
+func NewQueue(duration time.Duration, maxVisible int) *Queue {
+	return &Queue{
+		duration:   duration,
+		maxVisible: maxVisible,
+	}
+}
+
+func (q *Queue) Push(m Message, now time.Time) {
+	text := strings.Join(strings.Fields(m.Text), " ")
+	if text == "" {
+		return
+	}
+	if r := []rune(text); len(r) > maxMessageLength {
+		text = string(r[:maxMessageLength]) + "…"
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(q.pending, fmt.Sprintf("%s: %s", m.Sender, text))
+	if len(q.pending) > maxPending {
+		q.pending = q.pending[len(q.pending)-maxPending:]
+	}
+	q.update(now)
+}
+
+// Text returns the lines to display at now, and when they next change. The time is zero when nothing is displayed.
+func (q *Queue) Text(now time.Time) (string, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.update(now)
+
+	lines := make([]string, 0, len(q.visible))
+	var next time.Time
+	for _, v := range q.visible {
+		lines = append(lines, v.line)
+		if next.IsZero() || v.expires.Before(next) {
+			next = v.expires
+		}
+	}
+	return strings.Join(lines, "\n"), next
+}
+
+func (q *Queue) update(now time.Time) {
+	visible := q.visible[:0]
+	for _, v := range q.visible {
+		if now.Before(v.expires) {
+			visible = append(visible, v)
+		}
+	}
+	q.visible = visible
+
+	for len(q.visible) < q.maxVisible && len(q.pending) > 0 {
+		q.visible = append(q.visible, visibleMessage{
+			line:    q.pending[0],
+			expires: now.Add(q.duration),
+		})
+		q.pending = q.pending[1:]
+	}
+}
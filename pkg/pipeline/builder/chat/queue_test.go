@@ -0,0 +1,49 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	now := time.Unix(0, 0)
+	q := NewQueue(5*time.Second, 2)
+
+	text, next := q.Text(now)
+	require.Equal(t, "", text)
+	require.True(t, next.IsZero())
+
+	q.Push(Message{Sender: "alice", Text: "hello\neveryone"}, now)
+	q.Push(Message{Sender: "bob", Text: "hi"}, now.Add(time.Second))
+	q.Push(Message{Sender: "carol", Text: "hey"}, now.Add(2*time.Second))
+	q.Push(Message{Sender: "dave", Text: "   "}, now.Add(2*time.Second))
+
+	// carol waits for a free line
+	text, next = q.Text(now.Add(2 * time.Second))
+	require.Equal(t, "alice: hello everyone\nbob: hi", text)
+	require.Equal(t, now.Add(5*time.Second), next)
+
+	text, next = q.Text(now.Add(5 * time.Second))
+	require.Equal(t, "bob: hi\ncarol: hey", text)
+	require.Equal(t, now.Add(6*time.Second), next)
+
+	text, next = q.Text(now.Add(10 * time.Second))
+	require.Equal(t, "", text)
+	require.True(t, next.IsZero())
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	encoderInputCaps  = "video/x-raw,format=I420"
+	encoderProbeCaps  = "video/x-raw,format=I420,width=320,height=240,framerate=30/1"
+	encoderProbeLimit = time.Second * 5
+)
+
+// buildH264Encoder tries each configured hardware encoder in order, falling back to x264
+// when none of them can be created, support the requested profile, or open a session.
+// It returns the elements to link in order, a converter followed by the encoder when the encoder does not take I420
+func (b *VideoBin) buildH264Encoder(profileCaps *gst.Caps) ([]*gst.Element, error) {
+	var elements []*gst.Element
+	name := selectH264Encoder(b.conf.VideoEncoders, func(name types.VideoEncoder) error {
+		var err error
+		elements, err = openHardwareEncoder(name, profileCaps)
+		return err
+	})
+	if name != types.VideoEncoderX264 {
+		b.configureHardwareEncoder(elements[len(elements)-1], name)
+		b.conf.VideoEncoder = name
+		return elements, nil
+	}
+
+	encoder, err := b.buildX264Encoder()
+	if err != nil {
+		return nil, err
+	}
+	b.conf.VideoEncoder = types.VideoEncoderX264
+	return []*gst.Element{encoder}, nil
+}
+
+// selectH264Encoder returns the first configured hardware encoder that opens, or x264 once the list reaches x264 or runs out
+func selectH264Encoder(encoders []types.VideoEncoder, open func(types.VideoEncoder) error) types.VideoEncoder {
+	for _, name := range encoders {
+		if name == types.VideoEncoderX264 {
+			break
+		}
+		if err := open(name); err != nil {
+			logger.Infow("video encoder unavailable", "encoder", name, "reason", err)
+			continue
+		}
+
+		logger.Infow("video encoder selected", "encoder", name)
+		return name
+	}
+
+	if len(encoders) > 0 {
+		logger.Infow("video encoder selected", "encoder", types.VideoEncoderX264)
+	}
+	return types.VideoEncoderX264
+}
+
+// openHardwareEncoder checks the encoder's pad templates, then encodes a test frame with a separate instance.
+// Taking the encoder to ready is not enough, since some plugins, such as nvenc, only open a session once caps are set.
+// This fails when the plugin or device is missing, or when the device has no free sessions
+func openHardwareEncoder(name types.VideoEncoder, profileCaps *gst.Caps) ([]*gst.Element, error) {
+	encoder, err := gst.NewElement(string(name))
+	if err != nil {
+		return nil, err
+	}
+
+	src := encoder.GetStaticPad("src")
+	if src == nil {
+		return nil, errors.New("missing src pad")
+	}
+	if caps := src.GetPadTemplateCaps(); caps == nil || !caps.CanIntersect(profileCaps) {
+		return nil, fmt.Errorf("%s not supported", profileCaps.String())
+	}
+
+	sink := encoder.GetStaticPad("sink")
+	if sink == nil {
+		return nil, errors.New("missing sink pad")
+	}
+	convert, err := needsConversion(sink.GetPadTemplateCaps())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = probeEncoder(name, convert, profileCaps); err != nil {
+		return nil, err
+	}
+
+	if !convert {
+		return []*gst.Element{encoder}, nil
+	}
+	videoConvert, err := gst.NewElement("videoconvert")
+	if err != nil {
+		return nil, err
+	}
+	return []*gst.Element{videoConvert, encoder}, nil
+}
+
+// needsConversion returns true if the encoder takes raw video in system memory, but not I420.
+// It fails if the encoder only takes video in device memory
+func needsConversion(sinkCaps *gst.Caps) (bool, error) {
+	switch {
+	case sinkCaps == nil:
+		return false, errors.New("missing sink caps")
+	case sinkCaps.CanIntersect(gst.NewCapsFromString(encoderInputCaps)):
+		return false, nil
+	case sinkCaps.CanIntersect(gst.NewCapsFromString("video/x-raw")):
+		return true, nil
+	default:
+		return false, fmt.Errorf("%s not supported", encoderInputCaps)
+	}
+}
+
+// probeEncoder encodes a single frame through a new instance of the encoder
+func probeEncoder(name types.VideoEncoder, convert bool, profileCaps *gst.Caps) error {
+	pipeline, err := gst.NewPipeline("")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = pipeline.SetState(gst.StateNull)
+	}()
+
+	factories := []string{"videotestsrc", "capsfilter"}
+	if convert {
+		factories = append(factories, "videoconvert")
+	}
+	factories = append(factories, string(name), "capsfilter", "fakesink")
+
+	elements := make([]*gst.Element, 0, len(factories))
+	for _, factory := range factories {
+		e, err := gst.NewElement(factory)
+		if err != nil {
+			return err
+		}
+		elements = append(elements, e)
+	}
+	if err = elements[0].SetProperty("num-buffers", 1); err != nil {
+		return err
+	}
+	if err = elements[1].SetProperty("caps", gst.NewCapsFromString(encoderProbeCaps)); err != nil {
+		return err
+	}
+	if err = elements[len(elements)-2].SetProperty("caps", profileCaps); err != nil {
+		return err
+	}
+	if err = pipeline.AddMany(elements...); err != nil {
+		return err
+	}
+	if err = gst.ElementLinkMany(elements...); err != nil {
+		return err
+	}
+
+	if err = pipeline.SetState(gst.StatePlaying); err != nil {
+		return err
+	}
+	msg := pipeline.GetPipelineBus().TimedPopFiltered(gst.ClockTime(uint64(encoderProbeLimit)), gst.MessageEOS|gst.MessageError)
+	switch {
+	case msg == nil:
+		return errors.New("timed out encoding a test frame")
+	case msg.Type() == gst.MessageError:
+		if gErr := msg.ParseError(); gErr != nil {
+			return gErr
+		}
+		return errors.New("failed to encode a test frame")
+	default:
+		return nil
+	}
+}
+
+// configureHardwareEncoder sets constant bitrate and the key frame interval, which each plugin names differently
+func (b *VideoBin) configureHardwareEncoder(encoder *gst.Element, name types.VideoEncoder) {
+	var rateControl, keyFrames string
+	switch name {
+	case types.VideoEncoderNVENC:
+		rateControl, keyFrames = "rc-mode", "gop-size"
+	case types.VideoEncoderVA:
+		rateControl, keyFrames = "rate-control", "key-int-max"
+	case types.VideoEncoderVAAPI:
+		rateControl, keyFrames = "rate-control", "keyframe-period"
+	case types.VideoEncoderQSV:
+		rateControl, keyFrames = "rate-control", "gop-size"
+	}
+
+	// bitrates are in kbps for every supported encoder
+	encoder.SetArg("bitrate", strconv.Itoa(int(b.conf.VideoBitrate)))
+	encoder.SetArg(rateControl, "cbr")
+	if b.conf.KeyFrameInterval != 0 {
+		encoder.SetArg(keyFrames, strconv.Itoa(int(b.conf.KeyFrameInterval*float64(b.conf.Framerate))))
+	}
+}
+
+func (b *VideoBin) buildX264Encoder() (*gst.Element, error) {
+	x264Enc, err := gst.NewElement("x264enc")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = x264Enc.SetProperty("bitrate", uint(b.conf.VideoBitrate)); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	x264Enc.SetArg("speed-preset", "veryfast")
+	if b.conf.KeyFrameInterval != 0 {
+		if err = x264Enc.SetProperty("key-int-max", uint(b.conf.KeyFrameInterval*float64(b.conf.Framerate))); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+	var options []string
+	bufCapacity := uint(2000) // 2s
+	if b.conf.GetSegmentConfig() != nil {
+		// avoid key frames other than at segments boundaries as splitmuxsink can become inconsistent otherwise
+		options = append(options, "scenecut=0")
+		bufCapacity = uint(time.Duration(b.conf.GetSegmentConfig().SegmentDuration) * (time.Second / time.Millisecond))
+	}
+	if b.conf.MinVideoBitrate > 0 {
+		// strict cbr with filler data, so the bitrate never drops below the floor on simple scenes
+		options = append(options, "nal-hrd=cbr", "filler=1")
+	}
+	if len(options) > 0 {
+		if err = x264Enc.SetProperty("option-string", strings.Join(options, ":")); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+	if bufCapacity > 10000 {
+		// Max value allowed by gstreamer
+		bufCapacity = 10000
+	}
+	if err = x264Enc.SetProperty("vbv-buf-capacity", bufCapacity); err != nil {
+		return nil, err
+	}
+	return x264Enc, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"testing"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestSelectH264Encoder(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		encoders  []types.VideoEncoder
+		available []types.VideoEncoder
+		expected  types.VideoEncoder
+		opened    []types.VideoEncoder
+	}{
+		{
+			name:     "Default",
+			expected: types.VideoEncoderX264,
+		},
+		{
+			name:      "Fallback",
+			encoders:  []types.VideoEncoder{types.VideoEncoderNVENC, types.VideoEncoderVA, types.VideoEncoderX264},
+			available: []types.VideoEncoder{types.VideoEncoderVA},
+			expected:  types.VideoEncoderVA,
+			opened:    []types.VideoEncoder{types.VideoEncoderNVENC, types.VideoEncoderVA},
+		},
+		{
+			name:      "StopsAtX264",
+			encoders:  []types.VideoEncoder{types.VideoEncoderNVENC, types.VideoEncoderX264, types.VideoEncoderVA},
+			available: []types.VideoEncoder{types.VideoEncoderVA},
+			expected:  types.VideoEncoderX264,
+			opened:    []types.VideoEncoder{types.VideoEncoderNVENC},
+		},
+		{
+			name:     "NoneAvailable",
+			encoders: []types.VideoEncoder{types.VideoEncoderQSV, types.VideoEncoderVAAPI},
+			expected: types.VideoEncoderX264,
+			opened:   []types.VideoEncoder{types.VideoEncoderQSV, types.VideoEncoderVAAPI},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var opened []types.VideoEncoder
+			selected := selectH264Encoder(test.encoders, func(name types.VideoEncoder) error {
+				opened = append(opened, name)
+				for _, available := range test.available {
+					if name == available {
+						return nil
+					}
+				}
+				return errors.New("no free sessions")
+			})
+			require.Equal(t, test.expected, selected)
+			require.Equal(t, test.opened, opened)
+		})
+	}
+}
+
+func TestNeedsConversion(t *testing.T) {
+	gst.Init(nil)
+
+	convert, err := needsConversion(gst.NewCapsFromString("video/x-raw,format={ I420, NV12 }"))
+	require.NoError(t, err)
+	require.False(t, convert)
+
+	// qsvh264enc and vah264enc take nv12
+	convert, err = needsConversion(gst.NewCapsFromString("video/x-raw(memory:VAMemory),format=NV12; video/x-raw,format=NV12"))
+	require.NoError(t, err)
+	require.True(t, convert)
+
+	_, err = needsConversion(gst.NewCapsFromString("video/x-raw(memory:VAMemory),format=NV12"))
+	require.Error(t, err)
+}
@@ -15,6 +15,9 @@
 package builder
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/go-gst/go-gst/gst"
 
 	"github.com/livekit/egress/pkg/config"
@@ -23,9 +26,21 @@ import (
 	"github.com/livekit/egress/pkg/types"
 )
 
+// FileSplitMuxSinkName names the sink of rotating file outputs, to tell its fragment messages from segment outputs
+const FileSplitMuxSinkName = "file_splitmuxsink"
+
+// SegmentSplitMuxSinkName names the sink of segment outputs
+const SegmentSplitMuxSinkName = "segment_splitmuxsink"
+
+// trickleFragmentDuration is the fragment length in ms of mp4 files uploaded while they are written
+const trickleFragmentDuration = 1000
+
 func BuildFileBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) (*gstreamer.Bin, error) {
 	b := pipeline.NewBin("file")
 	o := p.GetFileConfig()
+	if o.Rotates() {
+		return buildRotatingFileBin(b, p, o)
+	}
 
 	var mux *gst.Element
 	var err error
@@ -44,6 +59,11 @@ func BuildFileBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) (*gstr
 	if err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
+	if o.Trickle {
+		if err = setStreamable(mux, o.OutputType); err != nil {
+			return nil, err
+		}
+	}
 
 	sink, err := gst.NewElement("filesink")
 	if err != nil {
@@ -60,9 +80,88 @@ func BuildFileBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) (*gstr
 	}
 
 	b.SetGetSrcPad(func(name string) *gst.Pad {
-		var padName = name + "_%u"
+		return mux.GetRequestPad(muxPadTemplate(name))
+	})
+
+	return b, nil
+}
 
-		return mux.GetRequestPad(padName)
+// muxPadTemplate returns the request pad template for a source bin. Every audio bin
+// requests an audio pad, adding a track per bin in multitrack mode
+func muxPadTemplate(name string) string {
+	if strings.HasPrefix(name, "audio") {
+		return "audio_%u"
+	}
+	return name + "_%u"
+}
+
+// setStreamable configures the muxer to never seek back, so bytes already uploaded are never rewritten.
+// Mp4 is fragmented, and webm is written without cues or a final duration
+func setStreamable(mux *gst.Element, outputType types.OutputType) error {
+	switch outputType {
+	case types.OutputTypeMP4:
+		if err := mux.SetProperty("fragment-duration", uint(trickleFragmentDuration)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		fallthrough
+	case types.OutputTypeWebM:
+		if err := mux.SetProperty("streamable", true); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+	}
+	return nil
+}
+
+// buildRotatingFileBin starts a new file at the first keyframe past the duration or size limit
+func buildRotatingFileBin(b *gstreamer.Bin, p *config.PipelineConfig, o *config.FileConfig) (*gstreamer.Bin, error) {
+	var muxer string
+	switch o.OutputType {
+	case types.OutputTypeOGG:
+		muxer = "oggmux"
+	case types.OutputTypeMP4:
+		muxer = "mp4mux"
+	case types.OutputTypeWebM:
+		muxer = "webmmux"
+	default:
+		return nil, errors.ErrNotSupported(fmt.Sprintf("file rotation for %s", o.OutputType))
+	}
+
+	sink, err := gst.NewElementWithName("splitmuxsink", FileSplitMuxSinkName)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = sink.SetProperty("muxer-factory", muxer); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if o.SegmentDuration > 0 {
+		if err = sink.SetProperty("max-size-time", uint64(o.SegmentDuration)); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+	if o.MaxFileSize > 0 {
+		if err = sink.SetProperty("max-size-bytes", uint64(o.MaxFileSize)); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+	if p.VideoEnabled {
+		if err = sink.SetProperty("send-keyframe-requests", true); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
+	if _, err = sink.Connect("format-location", func(self *gst.Element, fragmentId uint) string {
+		return config.ChunkFilepath(o.ChunkFilepath, fragmentId)
+	}); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = b.AddElements(sink); err != nil {
+		return nil, err
+	}
+
+	b.SetGetSrcPad(func(name string) *gst.Pad {
+		if name == "video" {
+			return sink.GetRequestPad("video")
+		}
+		return sink.GetRequestPad(muxPadTemplate(name))
 	})
 
 	return b, nil
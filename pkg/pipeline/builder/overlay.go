@@ -0,0 +1,132 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/logger"
+)
+
+func (b *VideoBin) addOverlays() error {
+	if b.conf.Overlays.Watermark.Path != "" {
+		if err := b.addWatermark(); err != nil {
+			return err
+		}
+	}
+	if b.conf.Overlays.Timecode.Enabled {
+		if err := b.addTimecodeOverlay(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTimecodeOverlay draws the utc wall clock time as each frame reaches the overlay. Buffer timestamps are
+// not used, since they stop advancing while the pipeline is paused
+func (b *VideoBin) addTimecodeOverlay() error {
+	o := b.conf.Overlays.Timecode
+	textOverlay, err := gst.NewElementWithName("textoverlay", "timecode_overlay")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("font-desc", fmt.Sprintf("%s %d", o.Font, o.Size)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("color", uint(o.Color)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("shaded-background", true); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("wait-text", false); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	textOverlay.SetArg("valignment", o.VAlign)
+	textOverlay.SetArg("halignment", o.HAlign)
+
+	if err = b.bin.AddElement(textOverlay); err != nil {
+		return err
+	}
+
+	// the probe runs on the streaming thread, right before the overlay renders the buffer
+	var text string
+	textOverlay.GetStaticPad("video_sink").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+		if now := time.Now().UTC().Format(o.Format); now != text {
+			text = now
+			if err := textOverlay.SetProperty("text", text); err != nil {
+				logger.Warnw("failed to update timecode overlay", err)
+			}
+		}
+		return gst.PadProbeOK
+	})
+	return nil
+}
+
+// addWatermark blends a png into each frame, positioned from the output size since
+// gdkpixbufoverlay offsets are relative to the top left corner
+func (b *VideoBin) addWatermark() error {
+	o := b.conf.Overlays.Watermark
+	width, height, err := o.ImageSize()
+	if err != nil {
+		return errors.ErrCouldNotParseConfig(err)
+	}
+
+	watermark, err := gst.NewElementWithName("gdkpixbufoverlay", "watermark_overlay")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = watermark.SetProperty("location", o.Path); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = watermark.SetProperty("alpha", o.Opacity); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if o.Scale > 0 {
+		scaled := int(math.Round(o.Scale * float64(b.conf.Width)))
+		height = int(math.Round(float64(height*scaled) / float64(width)))
+		width = scaled
+		if err = watermark.SetProperty("overlay-width", width); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = watermark.SetProperty("overlay-height", height); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+	}
+	if err = watermark.SetProperty("offset-x", alignOffset(o.HAlign, int(b.conf.Width), width, o.Margin)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = watermark.SetProperty("offset-y", alignOffset(o.VAlign, int(b.conf.Height), height, o.Margin)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	return b.bin.AddElement(watermark)
+}
+
+func alignOffset(align string, frame, size, margin int) int {
+	switch align {
+	case "left", "top":
+		return margin
+	case "center":
+		return (frame - size) / 2
+	default:
+		return frame - size - margin
+	}
+}
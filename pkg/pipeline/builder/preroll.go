@@ -0,0 +1,33 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/gstreamer"
+)
+
+// PreRollQueueSuffix names the queues holding encoded media until recording starts
+const PreRollQueueSuffix = "_preroll"
+
+// addPreRollQueue adds a leaky queue after encoding, sized to the pre-roll window. While its output is
+// blocked, the oldest media is dropped so memory stays bounded
+func addPreRollQueue(b *gstreamer.Bin, name string, p *config.PipelineConfig) error {
+	queue, err := gstreamer.BuildQueue(name+PreRollQueueSuffix, uint64(p.PreRollWindow()), true)
+	if err != nil {
+		return err
+	}
+	return b.AddElement(queue)
+}
@@ -28,6 +28,8 @@ import (
 	"github.com/livekit/protocol/logger"
 )
 
+const aacFrameSamples = 1024
+
 type FirstSampleMetadata struct {
 	StartDate int64 // Real time date of the first media sample
 }
@@ -49,16 +51,23 @@ func BuildSegmentBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) (*g
 		}
 	}
 
-	sink, err := gst.NewElement("splitmuxsink")
+	sink, err := gst.NewElementWithName("splitmuxsink", SegmentSplitMuxSinkName)
 	if err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
-	if err = sink.SetProperty("max-size-time", uint64(time.Duration(o.SegmentDuration)*time.Second)); err != nil {
-		return nil, errors.ErrGstPipelineError(err)
+	maxSizeTime := time.Duration(o.SegmentDuration) * time.Second
+	if o.AudioOnly {
+		// without video, splitmuxsink can split on any buffer
+		maxSizeTime = alignToAudioFrames(maxSizeTime, p.AudioFrequency)
 	}
-	if err = sink.SetProperty("send-keyframe-requests", true); err != nil {
+	if err = sink.SetProperty("max-size-time", uint64(maxSizeTime)); err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
+	if p.VideoEnabled {
+		if err = sink.SetProperty("send-keyframe-requests", true); err != nil {
+			return nil, errors.ErrGstPipelineError(err)
+		}
+	}
 	if err = sink.SetProperty("muxer-factory", "mpegtsmux"); err != nil {
 		return nil, errors.ErrGstPipelineError(err)
 	}
@@ -116,3 +125,17 @@ func BuildSegmentBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) (*g
 
 	return b, nil
 }
+
+// alignToAudioFrames rounds a segment duration down to a whole number of aac frames,
+// so that every audio-only segment holds the same number of frames
+func alignToAudioFrames(d time.Duration, frequency int32) time.Duration {
+	if frequency <= 0 {
+		return d
+	}
+
+	frames := int64(d) * int64(frequency) / (aacFrameSamples * int64(time.Second))
+	if frames == 0 {
+		return d
+	}
+	return time.Duration(frames * aacFrameSamples * int64(time.Second) / int64(frequency))
+}
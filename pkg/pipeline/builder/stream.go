@@ -17,7 +17,6 @@ package builder
 import (
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/go-gst/go-gst/gst"
 
@@ -25,7 +24,6 @@ import (
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/gstreamer"
 	"github.com/livekit/egress/pkg/types"
-	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/utils"
 )
 
@@ -34,78 +32,258 @@ type StreamBin struct {
 	pipeline   *gstreamer.Pipeline
 	b          *gstreamer.Bin
 	outputType types.OutputType
+	hosts      config.HostOverrides
+	auth       map[string]*config.StreamAuth
+	latency    uint64
+	tees       map[string]*gst.Element // encoded tracks, by name
+	rtmpTee    *gst.Element            // flv, for rtmp urls
+	srtTee     *gst.Element            // mpegts, for srt urls. Built with the first srt url
+	linkSRT    func() error            // links the srt branch when it is built before the pipeline
 	sinks      map[string]*StreamSink
 }
 
 type StreamSink struct {
-	bin            *gstreamer.Bin
-	sink           *gst.Element
-	url            string
-	reconnections  int
-	disconnectedAt time.Time
+	bin       *gstreamer.Bin
+	sink      *gst.Element
+	url       string
+	srt       bool
+	connected bool   // the server has acknowledged data at least once
+	attempts  int    // reconnect attempts since the stream was last connected
+	lastAcked uint64 // bytes acknowledged when the stream was last disconnected
 }
 
 func BuildStreamBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) (*StreamBin, *gstreamer.Bin, error) {
 	b := pipeline.NewBin("stream")
 	o := p.GetStreamConfig()
-
-	var mux *gst.Element
-	var err error
-	switch o.OutputType {
-	case types.OutputTypeRTMP:
-		mux, err = gst.NewElement("flvmux")
-		if err != nil {
-			return nil, nil, errors.ErrGstPipelineError(err)
-		}
-		if err = mux.SetProperty("streamable", true); err != nil {
-			return nil, nil, errors.ErrGstPipelineError(err)
-		}
-		if err = mux.SetProperty("skip-backwards-streams", true); err != nil {
-			return nil, nil, errors.ErrGstPipelineError(err)
-		}
-		// add latency to give time for flvmux to receive and order packets from both streams
-		if err = mux.SetProperty("latency", p.Latency); err != nil {
-			return nil, nil, errors.ErrGstPipelineError(err)
-		}
-
-	default:
-		err = errors.ErrInvalidInput("output type")
-	}
-	if err != nil {
-		return nil, nil, err
+	if o.OutputType != types.OutputTypeRTMP {
+		return nil, nil, errors.ErrInvalidInput("output type")
 	}
 
-	tee, err := gst.NewElement("tee")
+	flvMux, err := gst.NewElement("flvmux")
 	if err != nil {
 		return nil, nil, errors.ErrGstPipelineError(err)
 	}
-	if err = tee.SetProperty("allow-not-linked", true); err != nil {
+	if err = flvMux.SetProperty("streamable", true); err != nil {
+		return nil, nil, errors.ErrGstPipelineError(err)
+	}
+	if err = flvMux.SetProperty("skip-backwards-streams", true); err != nil {
+		return nil, nil, errors.ErrGstPipelineError(err)
+	}
+	// add latency to give time for flvmux to receive and order packets from both streams
+	if err = flvMux.SetProperty("latency", p.Latency); err != nil {
 		return nil, nil, errors.ErrGstPipelineError(err)
 	}
 
-	if err = b.AddElements(mux, tee); err != nil {
+	rtmpTee, err := buildStreamTee("rtmp_tee")
+	if err != nil {
 		return nil, nil, err
 	}
+	if err = b.AddElements(flvMux, rtmpTee); err != nil {
+		return nil, nil, err
+	}
+
+	// each encoded track is teed, so an srt branch added with the first srt url shares the same encoders
+	tees := make(map[string]*gst.Element)
+	var links []func() error
+	for _, track := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"audio", p.AudioEnabled},
+		{"video", p.VideoEnabled},
+	} {
+		if !track.enabled {
+			continue
+		}
+
+		tee, err := buildStreamTee(fmt.Sprintf("%s_tee", track.name))
+		if err != nil {
+			return nil, nil, err
+		}
+		flvQueue, err := gstreamer.BuildQueue(fmt.Sprintf("%s_flv_queue", track.name), p.Latency, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = b.AddElements(tee, flvQueue); err != nil {
+			return nil, nil, err
+		}
+
+		tees[track.name] = tee
+		padName := track.name
+		links = append(links, func() error {
+			if err := gst.ElementLinkMany(tee, flvQueue); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+			return linkMuxPad(flvQueue, flvMux, padName)
+		})
+	}
 
 	sb := &StreamBin{
 		b:          b,
 		outputType: o.OutputType,
+		hosts:      p.HostOverrides,
+		auth:       o.Auth,
+		latency:    p.Latency,
+		tees:       tees,
+		rtmpTee:    rtmpTee,
 		sinks:      make(map[string]*StreamSink),
 	}
 
+	b.SetLinkFunc(func() error {
+		for _, link := range links {
+			if err := link(); err != nil {
+				return err
+			}
+		}
+		if err := gst.ElementLinkMany(flvMux, rtmpTee); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+
+		sb.mu.RLock()
+		linkSRT := sb.linkSRT
+		sb.mu.RUnlock()
+		if linkSRT != nil {
+			return linkSRT()
+		}
+		return nil
+	})
+
+	b.SetGetSrcPad(func(name string) *gst.Pad {
+		if tee := tees[name]; tee != nil {
+			return tee.GetStaticPad("sink")
+		}
+		return nil
+	})
+
+	b.SetGetSinkPad(func(name string) *gst.Pad {
+		sb.mu.RLock()
+		sink := sb.sinks[name]
+		srtTee := sb.srtTee
+		sb.mu.RUnlock()
+
+		if sink != nil && sink.srt {
+			return srtTee.GetRequestPad("src_%u")
+		}
+		return sb.rtmpTee.GetRequestPad("src_%u")
+	})
+
 	for _, url := range o.Urls {
 		if err = sb.AddStream(url); err != nil {
 			return nil, nil, err
 		}
 	}
 
-	b.SetGetSrcPad(func(name string) *gst.Pad {
-		return mux.GetRequestPad(name)
-	})
-
 	return sb, b, nil
 }
 
+// addSRTBranch builds the mpegts muxer the first time an srt url is added, so rtmp only egresses don't run it
+func (sb *StreamBin) addSRTBranch() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.srtTee != nil {
+		return nil
+	}
+
+	tsMux, err := gst.NewElement("mpegtsmux")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = tsMux.SetProperty("latency", sb.latency); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	srtTee, err := buildStreamTee("srt_tee")
+	if err != nil {
+		return err
+	}
+
+	elements := []*gst.Element{srtTee, tsMux}
+	branches := make(map[string][]*gst.Element)
+	for name := range sb.tees {
+		tsQueue, err := gstreamer.BuildQueue(fmt.Sprintf("%s_ts_queue", name), sb.latency, false)
+		if err != nil {
+			return err
+		}
+		branch := []*gst.Element{tsQueue}
+		if name == "video" {
+			// mpegtsmux requires byte-stream h264
+			h264parse, err := gst.NewElement("h264parse")
+			if err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+			branch = append(branch, h264parse)
+		}
+		branches[name] = branch
+		elements = append(elements, branch...)
+	}
+	if err = sb.b.AddElements(elements...); err != nil {
+		return err
+	}
+
+	linkBranches := func() error {
+		if err := gst.ElementLinkMany(tsMux, srtTee); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		for _, branch := range branches {
+			if err := gst.ElementLinkMany(branch...); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+			if err := linkMuxPad(branch[len(branch)-1], tsMux, "sink_%d"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	linkTees := func() error {
+		for name, branch := range branches {
+			if padReturn := sb.tees[name].GetRequestPad("src_%u").Link(branch[0].GetStaticPad("sink")); padReturn != gst.PadLinkOK {
+				return errors.ErrPadLinkFailed(sb.tees[name].GetName(), branch[0].GetName(), padReturn.String())
+			}
+		}
+		return nil
+	}
+	sb.srtTee = srtTee
+
+	if sb.b.GetState() == gstreamer.StateBuilding {
+		sb.linkSRT = func() error {
+			if err := linkBranches(); err != nil {
+				return err
+			}
+			return linkTees()
+		}
+		return nil
+	}
+
+	// the pipeline is running. Media only reaches the branch once its elements are playing
+	if err = linkBranches(); err != nil {
+		return err
+	}
+	for _, e := range elements {
+		if !e.SyncStateWithParent() {
+			return errors.ErrGstPipelineError(fmt.Errorf("failed to sync %s state", e.GetName()))
+		}
+	}
+	return linkTees()
+}
+
+func buildStreamTee(name string) (*gst.Element, error) {
+	tee, err := gst.NewElementWithName("tee", name)
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = tee.SetProperty("allow-not-linked", true); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	return tee, nil
+}
+
+func linkMuxPad(src, mux *gst.Element, padName string) error {
+	if padReturn := src.GetStaticPad("src").Link(mux.GetRequestPad(padName)); padReturn != gst.PadLinkOK {
+		return errors.ErrPadLinkFailed(src.GetName(), mux.GetName(), padReturn.String())
+	}
+	return nil
+}
+
 func (sb *StreamBin) GetStreamUrl(name string) (string, error) {
 	sb.mu.RLock()
 	sink, ok := sb.sinks[name]
@@ -126,10 +304,18 @@ func (sb *StreamBin) AddStream(url string) error {
 	}
 	queue.SetArg("leaky", "downstream")
 
+	srt := config.IsSRTUrl(url)
+
 	var sink *gst.Element
-	switch sb.outputType {
-	case types.OutputTypeRTMP:
-		sink, err = gst.NewElementWithName("rtmp2sink", fmt.Sprintf("rtmp2sink_%s", name))
+	switch {
+	case sb.outputType != types.OutputTypeRTMP:
+		return errors.ErrInvalidInput("output type")
+
+	case srt:
+		if err = sb.addSRTBranch(); err != nil {
+			return err
+		}
+		sink, err = gst.NewElementWithName("srtsink", fmt.Sprintf("srtsink_%s", name))
 		if err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
@@ -139,15 +325,53 @@ func (sb *StreamBin) AddStream(url string) error {
 		if err = sink.SetProperty("sync", false); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
-		if err = sink.SetProperty("async-connect", false); err != nil {
+		// don't block the pipeline while the caller connects
+		if err = sink.SetProperty("wait-for-connection", false); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
-		if err = sink.Set("location", url); err != nil {
+		if err = sink.Set("uri", sb.hosts.RewriteURL(url)); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
+		if auth := sb.auth[url]; auth != nil {
+			// set after the uri, which would otherwise reset them
+			for property, value := range auth.SRTProperties() {
+				if err = sink.Set(property, value); err != nil {
+					return errors.ErrGstPipelineError(err)
+				}
+			}
+		}
 
 	default:
-		return errors.ErrInvalidInput("output type")
+		sink, err = gst.NewElementWithName("rtmp2sink", fmt.Sprintf("rtmp2sink_%s", name))
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = sink.SetProperty("async", false); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = sink.SetProperty("sync", false); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = sink.SetProperty("async-connect", false); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = sink.Set("location", sb.hosts.RewriteURL(url)); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if auth := sb.auth[url]; auth != nil {
+			// set after the location, so the app and key are sent as given instead of parsed from the url
+			if err = sink.Set("application", auth.Application()); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+			if err = sink.Set("stream", auth.StreamKey); err != nil {
+				return errors.ErrGstPipelineError(err)
+			}
+			if auth.SecureToken != "" {
+				if err = sink.Set("securetoken", auth.SecureToken); err != nil {
+					return errors.ErrGstPipelineError(err)
+				}
+			}
+		}
 	}
 
 	if err = b.AddElements(queue, sink); err != nil {
@@ -161,7 +385,7 @@ func (sb *StreamBin) AddStream(url string) error {
 		// It is later released in RemoveSink
 		proxy.Ref()
 
-		// Intercept flows from rtmp2sink. Anything besides EOS will be ignored
+		// Intercept flows from the sink. Anything besides EOS will be ignored
 		proxy.SetChainFunction(func(self *gst.Pad, _ *gst.Object, buffer *gst.Buffer) gst.FlowReturn {
 			// Buffer gets automatically unreferenced by go-gst.
 			// Without referencing it here, it will sometimes be garbage collected before being written
@@ -190,53 +414,138 @@ func (sb *StreamBin) AddStream(url string) error {
 		bin:  b,
 		sink: sink,
 		url:  url,
+		srt:  srt,
 	}
 	sb.mu.Unlock()
 
 	return sb.b.AddSinkBin(b)
 }
 
-func (sb *StreamBin) MaybeResetStream(name string, streamErr error) (bool, error) {
+// bytesSent returns the bytes acknowledged by an rtmp server, or sent to an srt listener
+func (s *StreamSink) bytesSent() (uint64, error) {
+	stats, err := s.sink.GetProperty("stats")
+	if err != nil {
+		return 0, err
+	}
+	field := "out-bytes-acked"
+	if s.srt {
+		field = "bytes-sent"
+	}
+	// stats may not hold a structure before the sink has connected
+	structure, ok := stats.(*gst.Structure)
+	if !ok || structure == nil {
+		return 0, nil
+	}
+	bytesSent, _ := structure.Values()[field].(uint64)
+	return bytesSent, nil
+}
+
+// BytesSent returns the bytes acknowledged by each stream server, keyed by url
+func (sb *StreamBin) BytesSent() map[string]uint64 {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	sent := make(map[string]uint64, len(sb.sinks))
+	for _, sink := range sb.sinks {
+		if bytesSent, err := sink.bytesSent(); err == nil {
+			sent[sink.url] = bytesSent
+		}
+	}
+	return sent
+}
+
+// StreamState reports whether a stream's connection is up, and the bytes acknowledged by the server
+type StreamState struct {
+	State     types.OutputState
+	BytesSent uint64
+}
+
+// StreamStates returns the connection state of each stream, keyed by url. Reset streams are reconnecting
+// until the server acknowledges data again
+func (sb *StreamBin) StreamStates() map[string]*StreamState {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	states := make(map[string]*StreamState, len(sb.sinks))
+	for _, sink := range sb.sinks {
+		state := &StreamState{State: types.OutputStateStarting}
+		state.BytesSent, _ = sink.bytesSent()
+		switch {
+		case sink.attempts > 0:
+			state.State = types.OutputStateReconnecting
+		case state.BytesSent > 0:
+			state.State = types.OutputStateConnected
+		}
+		states[sink.url] = state
+	}
+	return states
+}
+
+// DisconnectStream stops a stream's sink after an error, leaving the rest of the bin running.
+// It returns the reconnect attempt this disconnection starts, and whether the stream ever connected
+func (sb *StreamBin) DisconnectStream(name string) (int, bool, error) {
 	sb.mu.Lock()
-	sink := sb.sinks[name]
-	sb.mu.Unlock()
+	defer sb.mu.Unlock()
 
+	sink := sb.sinks[name]
 	if sink == nil {
-		return false, errors.ErrStreamNotFound(name)
+		return 0, false, errors.ErrStreamNotFound(name)
 	}
 
-	s, err := sink.sink.GetProperty("stats")
+	outBytes, err := sink.bytesSent()
 	if err != nil {
-		return false, err
+		return 0, false, err
 	}
-	values := s.(*gst.Structure).Values()
-	outBytes := values["out-bytes-acked"].(uint64)
-
-	if sink.reconnections == 0 && outBytes == 0 {
-		// unable to connect, probably a bad stream key or url
-		return false, nil
+	if outBytes > 0 && outBytes != sink.lastAcked {
+		// dropped after connecting
+		sink.connected = true
+		sink.attempts = 0
 	}
+	sink.lastAcked = outBytes
+	sink.attempts++
 
-	if outBytes > 0 {
-		// first disconnection
-		sink.disconnectedAt = time.Now()
-		sink.reconnections = 0
-	} else if time.Since(sink.disconnectedAt) > time.Second*30 {
-		return false, nil
+	// buffers pushed to the stopped sink are discarded by its proxy pad
+	if err = sink.sink.SetState(gst.StateNull); err != nil {
+		return 0, false, err
 	}
+	return sink.attempts, sink.connected, nil
+}
 
-	sink.reconnections++
-	redacted, _ := utils.RedactStreamKey(sink.url)
-	logger.Warnw("resetting stream", streamErr, "url", redacted)
+// ReconnectStream restarts a disconnected stream's sink, which connects to the server again
+func (sb *StreamBin) ReconnectStream(name string) error {
+	sb.mu.RLock()
+	sink := sb.sinks[name]
+	sb.mu.RUnlock()
 
-	if err = sink.bin.SetState(gst.StateNull); err != nil {
-		return false, err
+	if sink == nil {
+		return errors.ErrStreamNotFound(name)
 	}
-	if err = sink.bin.SetState(gst.StatePlaying); err != nil {
-		return false, err
+	if !sink.sink.SyncStateWithParent() {
+		return errors.ErrStateChangeFailed(sink.sink.GetName(), gst.StatePlaying)
 	}
+	return nil
+}
+
+// StreamReconnected returns true once the server acknowledges data after the given reconnect attempt.
+// current is false once the attempt has been superseded, because the stream dropped again or was removed
+func (sb *StreamBin) StreamReconnected(name string, attempt int) (reconnected, current bool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
 
-	return true, nil
+	sink := sb.sinks[name]
+	if sink == nil || sink.attempts != attempt {
+		return false, false
+	}
+	outBytes, err := sink.bytesSent()
+	if err != nil {
+		return false, true
+	}
+	if outBytes == 0 || outBytes == sink.lastAcked {
+		// stats may be kept from the previous connection until a new one is established
+		return false, true
+	}
+	sink.attempts = 0
+	return true, true
 }
 
 func (sb *StreamBin) RemoveStream(url string) error {
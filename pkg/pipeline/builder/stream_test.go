@@ -0,0 +1,63 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"testing"
+
+	"github.com/go-gst/go-gst/gst"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestStreamBinSRTBranch(t *testing.T) {
+	gst.Init(nil)
+
+	o := &config.StreamConfig{Urls: []string{"rtmp://localhost/live/stream"}}
+	o.OutputType = types.OutputTypeRTMP
+	p := &config.PipelineConfig{}
+	p.AudioEnabled = true
+	p.VideoEnabled = true
+	p.Outputs = map[types.EgressType][]config.OutputConfig{types.EgressTypeStream: {o}}
+
+	pipeline, err := gstreamer.NewPipeline("pipeline", 0, &gstreamer.Callbacks{GstReady: make(chan struct{})})
+	require.NoError(t, err)
+	sb, bin, err := BuildStreamBin(pipeline, p)
+	require.NoError(t, err)
+	require.NoError(t, pipeline.AddSinkBin(bin))
+
+	countMuxers := func() int {
+		elements, err := pipeline.GetElements()
+		require.NoError(t, err)
+		muxers := 0
+		for _, e := range elements {
+			if e.GetFactory().GetName() == "mpegtsmux" {
+				muxers++
+			}
+		}
+		return muxers
+	}
+
+	// rtmp only egresses don't mux to mpegts
+	require.Zero(t, countMuxers())
+
+	// the branch is built once, with the first srt url
+	require.NoError(t, sb.AddStream("srt://localhost:9000"))
+	require.NoError(t, sb.AddStream("srt://localhost:9001"))
+	require.Equal(t, 1, countMuxers())
+}
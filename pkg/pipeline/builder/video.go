@@ -28,12 +28,18 @@ import (
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/builder/chat"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/logger"
 	lksdk "github.com/livekit/server-sdk-go"
 )
 
-const videoTestSrcName = "video_test_src"
+const (
+	videoTestSrcName = "video_test_src"
+
+	// RawVideoTeeName is the tee carrying decoded frames, before encoding
+	RawVideoTeeName = "raw_video_tee"
+)
 
 type VideoBin struct {
 	bin  *gstreamer.Bin
@@ -73,6 +79,12 @@ func BuildVideoBin(pipeline *gstreamer.Pipeline, p *config.PipelineConfig) error
 		pipeline.AddOnTrackUnmuted(b.onTrackUnmuted)
 	}
 
+	if p.StartGated() && len(p.GetEncodedOutputs()) > 0 {
+		if err := addPreRollQueue(b.bin, "video", p); err != nil {
+			return err
+		}
+	}
+
 	var getPad func() *gst.Pad
 	if len(p.GetEncodedOutputs()) > 1 {
 		tee, err := gst.NewElementWithName("tee", "video_tee")
@@ -204,13 +216,19 @@ func (b *VideoBin) buildWebInput() error {
 		return errors.ErrGstPipelineError(err)
 	}
 
+	captureFramerate := b.conf.Framerate
+	if b.conf.Chrome.CaptureFramerate > 0 && b.conf.Chrome.CaptureFramerate < b.conf.Framerate {
+		captureFramerate = b.conf.Chrome.CaptureFramerate
+	}
+	logger.Infow("capturing display", "captureFramerate", captureFramerate, "framerate", b.conf.Framerate)
+
 	caps, err := gst.NewElement("capsfilter")
 	if err != nil {
 		return errors.ErrGstPipelineError(err)
 	}
 	if err = caps.SetProperty("caps", gst.NewCapsFromString(fmt.Sprintf(
 		"video/x-raw,framerate=%d/1",
-		b.conf.Framerate,
+		captureFramerate,
 	),
 	)); err != nil {
 		return errors.ErrGstPipelineError(err)
@@ -220,6 +238,29 @@ func (b *VideoBin) buildWebInput() error {
 		return err
 	}
 
+	if captureFramerate != b.conf.Framerate {
+		// duplicate captured frames up to the output framerate, keeping the original timestamps
+		videoRate, err := newVideoRate(b.conf)
+		if err != nil {
+			return err
+		}
+
+		rateCaps, err := gst.NewElement("capsfilter")
+		if err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+		if err = rateCaps.SetProperty("caps", gst.NewCapsFromString(fmt.Sprintf(
+			"video/x-raw,framerate=%d/1",
+			b.conf.Framerate,
+		))); err != nil {
+			return errors.ErrGstPipelineError(err)
+		}
+
+		if err = b.bin.AddElements(videoRate, rateCaps); err != nil {
+			return err
+		}
+	}
+
 	if err = b.addDecodedVideoSink(); err != nil {
 		return err
 	}
@@ -474,14 +515,8 @@ func (b *VideoBin) addSelector() error {
 		return errors.ErrGstPipelineError(err)
 	}
 
-	videoRate, err := gst.NewElement("videorate")
+	videoRate, err := newVideoRate(b.conf)
 	if err != nil {
-		return errors.ErrGstPipelineError(err)
-	}
-	if err = videoRate.SetProperty("max-duplication-time", uint64(time.Second)); err != nil {
-		return err
-	}
-	if err = videoRate.SetProperty("skip-to-first", true); err != nil {
 		return err
 	}
 
@@ -510,32 +545,12 @@ func (b *VideoBin) addEncoder() error {
 	switch b.conf.VideoOutCodec {
 	// we only encode h264, the rest are too slow
 	case types.MimeTypeH264:
-		x264Enc, err := gst.NewElement("x264enc")
+		profileCaps := gst.NewCapsFromString(fmt.Sprintf(
+			"video/x-h264,profile=%s",
+			b.conf.VideoProfile,
+		))
+		elements, err := b.buildH264Encoder(profileCaps)
 		if err != nil {
-			return errors.ErrGstPipelineError(err)
-		}
-		if err = x264Enc.SetProperty("bitrate", uint(b.conf.VideoBitrate)); err != nil {
-			return errors.ErrGstPipelineError(err)
-		}
-		x264Enc.SetArg("speed-preset", "veryfast")
-		if b.conf.KeyFrameInterval != 0 {
-			if err = x264Enc.SetProperty("key-int-max", uint(b.conf.KeyFrameInterval*float64(b.conf.Framerate))); err != nil {
-				return errors.ErrGstPipelineError(err)
-			}
-		}
-		bufCapacity := uint(2000) // 2s
-		if b.conf.GetSegmentConfig() != nil {
-			// avoid key frames other than at segments boundaries as splitmuxsink can become inconsistent otherwise
-			if err = x264Enc.SetProperty("option-string", "scenecut=0"); err != nil {
-				return errors.ErrGstPipelineError(err)
-			}
-			bufCapacity = uint(time.Duration(b.conf.GetSegmentConfig().SegmentDuration) * (time.Second / time.Millisecond))
-		}
-		if bufCapacity > 10000 {
-			// Max value allowed by gstreamer
-			bufCapacity = 10000
-		}
-		if err = x264Enc.SetProperty("vbv-buf-capacity", bufCapacity); err != nil {
 			return err
 		}
 
@@ -543,14 +558,11 @@ func (b *VideoBin) addEncoder() error {
 		if err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
-		if err = caps.SetProperty("caps", gst.NewCapsFromString(fmt.Sprintf(
-			"video/x-h264,profile=%s",
-			b.conf.VideoProfile,
-		))); err != nil {
+		if err = caps.SetProperty("caps", profileCaps); err != nil {
 			return errors.ErrGstPipelineError(err)
 		}
 
-		if err = b.bin.AddElements(x264Enc, caps); err != nil {
+		if err = b.bin.AddElements(append(elements, caps)...); err != nil {
 			return err
 		}
 
@@ -594,8 +606,18 @@ func (b *VideoBin) addEncoder() error {
 }
 
 func (b *VideoBin) addDecodedVideoSink() error {
+	if err := b.addOverlays(); err != nil {
+		return err
+	}
+
 	var err error
-	b.rawVideoTee, err = gst.NewElement("tee")
+	if b.conf.ChatSubtitles.Enabled {
+		if err = b.addChatOverlay(); err != nil {
+			return err
+		}
+	}
+
+	b.rawVideoTee, err = gst.NewElementWithName("tee", RawVideoTeeName)
 	if err != nil {
 		return err
 	}
@@ -613,6 +635,61 @@ func (b *VideoBin) addDecodedVideoSink() error {
 	return nil
 }
 
+// addChatOverlay burns room chat messages into the video, queueing them so only a few are shown at once
+func (b *VideoBin) addChatOverlay() error {
+	o := b.conf.ChatSubtitles
+	textOverlay, err := gst.NewElementWithName("textoverlay", "chat_overlay")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("font-desc", o.Font); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("color", uint(o.Color)); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("shaded-background", true); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = textOverlay.SetProperty("wait-text", false); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	textOverlay.SetArg("valignment", o.VAlign)
+	textOverlay.SetArg("halignment", o.HAlign)
+	textOverlay.SetArg("line-alignment", o.HAlign)
+
+	if err = b.bin.AddElement(textOverlay); err != nil {
+		return err
+	}
+
+	queue := chat.NewQueue(o.Duration, o.MaxMessages)
+	var mu sync.Mutex
+	var timer *time.Timer
+	var update func()
+	update = func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		text, next := queue.Text(now)
+		if err := textOverlay.SetProperty("text", text); err != nil {
+			logger.Warnw("failed to update chat overlay", err)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !next.IsZero() {
+			timer = time.AfterFunc(next.Sub(now), update)
+		}
+	}
+
+	b.bin.AddOnChatMessage(func(sender, message string) {
+		queue.Push(chat.Message{Sender: sender, Text: message}, time.Now())
+		update()
+	})
+	return nil
+}
+
 func addVideoConverter(b *gstreamer.Bin, p *config.PipelineConfig) error {
 	videoQueue, err := gstreamer.BuildQueue("video_input_queue", p.Latency, true)
 	if err != nil {
@@ -629,14 +706,8 @@ func addVideoConverter(b *gstreamer.Bin, p *config.PipelineConfig) error {
 		return errors.ErrGstPipelineError(err)
 	}
 
-	videoRate, err := gst.NewElement("videorate")
+	videoRate, err := newVideoRate(p)
 	if err != nil {
-		return errors.ErrGstPipelineError(err)
-	}
-	if err = videoRate.SetProperty("max-duplication-time", uint64(time.Second)); err != nil {
-		return err
-	}
-	if err = videoRate.SetProperty("skip-to-first", true); err != nil {
 		return err
 	}
 
@@ -645,7 +716,92 @@ func addVideoConverter(b *gstreamer.Bin, p *config.PipelineConfig) error {
 		return errors.ErrGstPipelineError(err)
 	}
 
-	return b.AddElements(videoQueue, videoConvert, videoScale, videoRate, caps)
+	if !p.UpscaleDisabled() {
+		return b.AddElements(videoQueue, videoConvert, videoScale, videoRate, caps)
+	}
+
+	// scale to the content size, then pad to the output frame
+	contentCaps, err := gst.NewElement("capsfilter")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	videoBox, err := gst.NewElement("videobox")
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	if err = videoBox.SetProperty("autocrop", true); err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+	watchSourceSize(videoScale, contentCaps, p)
+
+	return b.AddElements(videoQueue, videoConvert, videoScale, contentCaps, videoBox, videoRate, caps)
+}
+
+// watchSourceSize updates the content size whenever the source resolution changes, so that the source is never
+// scaled up past its own resolution, and videobox pads the remainder of the frame
+func watchSourceSize(videoScale, contentCaps *gst.Element, p *config.PipelineConfig) {
+	var width, height int32
+	videoScale.GetStaticPad("sink").AddProbe(gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		event := info.GetEvent()
+		if event == nil || event.Type() != gst.EventTypeCaps {
+			return gst.PadProbeOK
+		}
+
+		s := event.ParseCaps().GetStructureAt(0)
+		if s == nil {
+			return gst.PadProbeOK
+		}
+		srcWidth, err := s.GetValue("width")
+		if err != nil {
+			return gst.PadProbeOK
+		}
+		srcHeight, err := s.GetValue("height")
+		if err != nil {
+			return gst.PadProbeOK
+		}
+		sw, _ := srcWidth.(int)
+		sh, _ := srcHeight.(int)
+
+		w, h := p.ContentSize(int32(sw), int32(sh))
+		if w == width && h == height {
+			return gst.PadProbeOK
+		}
+		width, height = w, h
+
+		logger.Infow("source resolution",
+			"sourceWidth", sw,
+			"sourceHeight", sh,
+			"contentWidth", w,
+			"contentHeight", h,
+		)
+		if err = contentCaps.SetProperty("caps", gst.NewCapsFromString(fmt.Sprintf(
+			"video/x-raw,width=%d,height=%d,pixel-aspect-ratio=1/1", w, h,
+		))); err != nil {
+			logger.Errorw("failed to update content caps", err)
+		}
+		return gst.PadProbeOK
+	})
+}
+
+func newVideoRate(p *config.PipelineConfig) (*gst.Element, error) {
+	videoRate, err := gst.NewElement("videorate")
+	if err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	// by default, stop duplicating after a second without new frames. 0 duplicates indefinitely
+	maxDuplicationTime := uint64(time.Second)
+	if p.DuplicateFrames {
+		maxDuplicationTime = 0
+	}
+	if err = videoRate.SetProperty("max-duplication-time", maxDuplicationTime); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+	if err = videoRate.SetProperty("skip-to-first", true); err != nil {
+		return nil, errors.ErrGstPipelineError(err)
+	}
+
+	return videoRate, nil
 }
 
 func newVideoCapsFilter(p *config.PipelineConfig, includeFramerate bool) (*gst.Element, error) {
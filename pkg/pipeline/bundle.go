@@ -0,0 +1,38 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+type bundleSink interface {
+	UploadBundle() error
+}
+
+// uploadBundles packages file outputs with their sidecars. It runs once every sink has closed,
+// so that all parts are finalized before being bundled
+func (c *Controller) uploadBundles() error {
+	if c.Bundle.Format == "" {
+		return nil
+	}
+
+	for _, si := range c.sinks {
+		for _, s := range si {
+			if b, ok := s.(bundleSink); ok {
+				if err := b.UploadBundle(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coalesce
+
+import (
+	"sync"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+)
+
+// ApplyFunc applies the net changes of a batch. Urls are in the order they were first requested.
+// It returns the errors of individual urls, keyed by url, and an error which fails the whole batch
+type ApplyFunc func(add, remove []string) (map[string]error, error)
+
+// Batcher merges stream url changes requested within a window. The last change requested for each url wins,
+// so an add followed by a remove of the same url cancels out instead of building and tearing down an output
+type Batcher struct {
+	window    time.Duration
+	apply     ApplyFunc
+	afterFunc func(time.Duration, func()) // schedules a batch's flush, replaced in tests
+
+	applyMu sync.Mutex
+	mu      sync.Mutex
+	pending *batch
+}
+
+type batch struct {
+	changes  map[string]bool // true to add, false to remove
+	order    []string
+	requests int // callers waiting on the batch
+	done     chan struct{}
+	urlErrs  map[string]error
+	err      error
+}
+
+func NewBatcher(window time.Duration, apply ApplyFunc) *Batcher {
+	return &Batcher{
+		window: window,
+		apply:  apply,
+		afterFunc: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+// Update queues changes and waits until the batch containing them has been applied. It returns the errors
+// for the urls this caller requested, along with any error that failed the whole batch.
+// The window starts with the first change of a batch, so continuous churn is still applied at a steady rate
+func (b *Batcher) Update(add, remove []string) error {
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	p := b.pending
+	if p == nil {
+		p = &batch{
+			changes: make(map[string]bool),
+			done:    make(chan struct{}),
+		}
+		b.pending = p
+		if b.window > 0 {
+			b.afterFunc(b.window, b.flush)
+		}
+	}
+	for _, url := range add {
+		p.set(url, true)
+	}
+	for _, url := range remove {
+		p.set(url, false)
+	}
+	p.requests++
+	b.mu.Unlock()
+
+	if b.window <= 0 {
+		b.flush()
+	}
+
+	<-p.done
+
+	errs := errors.ErrArray{}
+	errs.Check(p.err)
+	reported := make(map[string]bool)
+	for _, urls := range [][]string{add, remove} {
+		for _, url := range urls {
+			if !reported[url] {
+				reported[url] = true
+				errs.Check(p.urlErrs[url])
+			}
+		}
+	}
+	return errs.ToError()
+}
+
+func (p *batch) set(url string, add bool) {
+	if _, ok := p.changes[url]; !ok {
+		p.order = append(p.order, url)
+	}
+	p.changes[url] = add
+}
+
+func (b *Batcher) flush() {
+	// batches are applied one at a time, in order
+	b.applyMu.Lock()
+	defer b.applyMu.Unlock()
+
+	b.mu.Lock()
+	p := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if p == nil {
+		return
+	}
+
+	var add, remove []string
+	for _, url := range p.order {
+		if p.changes[url] {
+			add = append(add, url)
+		} else {
+			remove = append(remove, url)
+		}
+	}
+
+	p.urlErrs, p.err = b.apply(add, remove)
+	close(p.done)
+}
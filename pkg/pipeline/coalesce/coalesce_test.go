@@ -0,0 +1,193 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coalesce
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// streams mimics the stream bin, counting every output built or torn down
+type streams struct {
+	mu      sync.Mutex
+	urls    map[string]bool
+	fail    map[string]bool
+	applied int
+	changes int
+}
+
+func (s *streams) apply(add, remove []string) (map[string]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applied++
+	errs := make(map[string]error)
+	for _, url := range add {
+		if s.fail[url] {
+			errs[url] = fmt.Errorf("failed to add %s", url)
+			continue
+		}
+		if !s.urls[url] {
+			s.urls[url] = true
+			s.changes++
+		}
+	}
+	for _, url := range remove {
+		if s.urls[url] {
+			delete(s.urls, url)
+			s.changes++
+		}
+	}
+	return errs, nil
+}
+
+// manualWindow replaces the batcher's timer, so the test decides when each window closes
+func manualWindow(b *Batcher) chan func() {
+	flushes := make(chan func(), 100)
+	b.afterFunc = func(_ time.Duration, flush func()) {
+		flushes <- flush
+	}
+	return flushes
+}
+
+// waitForRequests waits until n callers are waiting on the pending batch
+func waitForRequests(t *testing.T, b *Batcher, n int) {
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.pending != nil && b.pending.requests == n
+	}, time.Second, time.Millisecond)
+}
+
+// closeWindow applies the pending batch, which must be the only one scheduled
+func closeWindow(t *testing.T, flushes chan func()) {
+	require.Len(t, flushes, 1)
+	(<-flushes)()
+}
+
+func update(b *Batcher, errs chan error, add, remove []string) {
+	go func() {
+		errs <- b.Update(add, remove)
+	}()
+}
+
+func TestBatcher(t *testing.T) {
+	s := &streams{urls: map[string]bool{"rtmp://host/live/a": true}}
+	b := NewBatcher(time.Minute, s.apply)
+	flushes := manualWindow(b)
+	errs := make(chan error, 20)
+
+	// a flaky control loop toggling b, and re-adding a which is already live
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			update(b, errs, []string{"rtmp://host/live/a", "rtmp://host/live/b"}, nil)
+		} else {
+			update(b, errs, nil, []string{"rtmp://host/live/b"})
+		}
+	}
+	waitForRequests(t, b, 20)
+	closeWindow(t, flushes)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, 1, s.applied)
+	require.LessOrEqual(t, s.changes, 1)
+
+	// the final request decides b
+	update(b, errs, nil, []string{"rtmp://host/live/b"})
+	waitForRequests(t, b, 1)
+	closeWindow(t, flushes)
+	require.NoError(t, <-errs)
+	require.Equal(t, 2, s.applied)
+	require.Equal(t, map[string]bool{"rtmp://host/live/a": true}, s.urls)
+
+	// add then remove within the window never builds the output
+	changes := s.changes
+	update(b, errs, []string{"rtmp://host/live/c"}, nil)
+	waitForRequests(t, b, 1)
+	update(b, errs, nil, []string{"rtmp://host/live/c"})
+	waitForRequests(t, b, 2)
+	closeWindow(t, flushes)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	require.Equal(t, 3, s.applied)
+	require.Equal(t, changes, s.changes)
+	require.Equal(t, map[string]bool{"rtmp://host/live/a": true}, s.urls)
+}
+
+func TestBatcherRapidUpdates(t *testing.T) {
+	s := &streams{urls: map[string]bool{"rtmp://host/live/a": true}}
+	b := NewBatcher(time.Minute, s.apply)
+	flushes := manualWindow(b)
+
+	// each window of churn is applied once, changing b at most once, while a is never rebuilt
+	const windows, requests = 10, 50
+	for w := 0; w < windows; w++ {
+		errs := make(chan error, requests)
+		for i := 0; i < requests; i++ {
+			switch i % 3 {
+			case 0:
+				update(b, errs, []string{"rtmp://host/live/b"}, nil)
+			case 1:
+				update(b, errs, nil, []string{"rtmp://host/live/b"})
+			default:
+				update(b, errs, []string{"rtmp://host/live/a"}, nil)
+			}
+		}
+		waitForRequests(t, b, requests)
+		closeWindow(t, flushes)
+		for i := 0; i < requests; i++ {
+			require.NoError(t, <-errs)
+		}
+
+		require.Equal(t, w+1, s.applied)
+		require.LessOrEqual(t, s.changes, w+1)
+		require.True(t, s.urls["rtmp://host/live/a"])
+		require.LessOrEqual(t, len(s.urls), 2)
+	}
+}
+
+func TestBatcherImmediate(t *testing.T) {
+	s := &streams{urls: map[string]bool{}}
+	b := NewBatcher(0, s.apply)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, b.Update([]string{fmt.Sprintf("rtmp://host/live/%d", i)}, nil))
+	}
+	require.NoError(t, b.Update(nil, []string{"rtmp://host/live/0", "rtmp://host/live/missing"}))
+	require.Equal(t, 6, s.applied)
+	require.Len(t, s.urls, 4)
+}
+
+func TestBatcherErrors(t *testing.T) {
+	s := &streams{urls: map[string]bool{}, fail: map[string]bool{"rtmp://host/live/bad": true}}
+	b := NewBatcher(0, s.apply)
+
+	// only the caller that requested a failing url sees its error
+	err := b.Update([]string{"rtmp://host/live/good", "rtmp://host/live/bad"}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rtmp://host/live/bad")
+	require.NoError(t, b.Update([]string{"rtmp://host/live/other"}, nil))
+
+	// errors failing the whole batch are returned to every caller
+	b = NewBatcher(0, func(add, remove []string) (map[string]error, error) {
+		return nil, fmt.Errorf("egress ending")
+	})
+	require.EqualError(t, b.Update([]string{"rtmp://host/live/good"}, nil), "egress ending")
+}
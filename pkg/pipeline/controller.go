@@ -16,18 +16,27 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/frostbyte73/core"
 	"github.com/go-gst/go-gst/gst"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/logbuffer"
+	"github.com/livekit/egress/pkg/pipeline/audiolevel"
 	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/pipeline/coalesce"
 	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/egress/pkg/pipeline/sink/waveform"
 	"github.com/livekit/egress/pkg/pipeline/source"
 	"github.com/livekit/egress/pkg/stats"
 	"github.com/livekit/egress/pkg/types"
@@ -35,11 +44,15 @@ import (
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
 	"github.com/livekit/protocol/tracer"
-	"github.com/livekit/protocol/utils"
 )
 
 const (
 	pipelineName = "pipeline"
+
+	diskWatchdogInterval = time.Second * 5
+
+	// less than the handler waits for a forced stop, before abandoning the pipeline
+	forceStopFlushTimeout = time.Second * 2
 )
 
 type Controller struct {
@@ -49,19 +62,67 @@ type Controller struct {
 	src       source.Source
 	p         *gstreamer.Pipeline
 	sinks     map[types.EgressType][]sink.Sink
-	streamBin *builder.StreamBin
+	streamBin streamOutputs
 	callbacks *gstreamer.Callbacks
 	ioClient  rpc.IOInfoClient
 
 	// internal
-	mu         sync.Mutex
-	gstLogger  *zap.SugaredLogger
-	monitor    *stats.HandlerMonitor
-	limitTimer *time.Timer
-	playing    core.Fuse
-	eos        core.Fuse
-	eosTimer   *time.Timer
-	stopped    core.Fuse
+	mu              sync.Mutex
+	gstLogger       *zap.SugaredLogger
+	monitor         *stats.HandlerMonitor
+	limitTimer      *time.Timer
+	playing         core.Fuse
+	eos             core.Fuse
+	eosTimer        atomic.Pointer[time.Timer] // set when EOS is sent, fails the egress if EOS does not arrive in time
+	stopped         core.Fuse
+	closed          core.Fuse
+	diskStall       core.Fuse
+	diskFull        core.Fuse
+	stopSignal      core.Fuse
+	controlMu       sync.Mutex // serializes stream updates, pause, resume and EOS
+	finalizeOnError bool       // outputs are finalized although the egress failed, guarded by controlMu
+	paused          atomic.Bool
+	layoutMu        sync.Mutex
+	stateMu         sync.Mutex // orders recovery state writes
+
+	streamUpdates  *coalesce.Batcher
+	segmentUpdates chan *segmentUpdate
+
+	status          atomic.Int32
+	errMu           sync.Mutex // guards Info.Error and errorCode, which are set from watchdog and callback goroutines
+	errorCode       atomic.String
+	diskFullErr     error // set before diskFull is broken
+	dot             dotCache
+	dotGeneration   atomic.Uint64
+	discontinuities atomic.Int32
+	reconnects      atomic.Int32
+	recoveries      map[string]int // element recoveries by track id, guarded by mu
+	audioLevels     atomic.Pointer[audiolevel.Levels]
+	tracerCapture   atomic.Pointer[tracerCapture]
+	stats           *pipelineStats
+	noOutput        core.Fuse
+	noInput         core.Fuse
+	maxDuration     core.Fuse
+	discarded       core.Fuse
+	uploading       core.Fuse
+	flowExpectedAt  atomic.Int64
+	preRoll         []*preRollQueue
+	preRollFlowing  core.Fuse // broken once media reaches the pre-roll queues
+	recording       core.Fuse // broken once outputs receive media, at the start unless StartGated
+	markStart       core.Fuse
+	usagePosted     core.Fuse
+}
+
+// streamOutputs manages the running stream urls, and is implemented by builder.StreamBin
+type streamOutputs interface {
+	AddStream(url string) error
+	RemoveStream(url string) error
+	GetStreamUrl(name string) (string, error)
+	DisconnectStream(name string) (int, bool, error)
+	ReconnectStream(name string) error
+	StreamReconnected(name string, attempt int) (bool, bool)
+	BytesSent() map[string]uint64
+	StreamStates() map[string]*builder.StreamState
 }
 
 func New(ctx context.Context, conf *config.PipelineConfig, ioClient rpc.IOInfoClient) (*Controller, error) {
@@ -75,15 +136,49 @@ func New(ctx context.Context, conf *config.PipelineConfig, ioClient rpc.IOInfoCl
 			GstReady: make(chan struct{}),
 		},
 		ioClient:  ioClient,
-		gstLogger: logger.GetLogger().(*logger.ZapLogger).ToZap().WithOptions(zap.WithCaller(false)),
+		gstLogger: logbuffer.ToZap(logger.GetLogger()).WithOptions(zap.WithCaller(false)),
 		monitor:   stats.NewHandlerMonitor(conf.NodeID, conf.ClusterID, conf.Info.EgressId),
 		playing:   core.NewFuse(),
 		eos:       core.NewFuse(),
 		stopped:   core.NewFuse(),
+		closed:    core.NewFuse(),
+		diskStall: core.NewFuse(),
+		diskFull:  core.NewFuse(),
+
+		stats:          newPipelineStats(),
+		noOutput:       core.NewFuse(),
+		noInput:        core.NewFuse(),
+		stopSignal:     core.NewFuse(),
+		maxDuration:    core.NewFuse(),
+		discarded:      core.NewFuse(),
+		uploading:      core.NewFuse(),
+		recording:      core.NewFuse(),
+		markStart:      core.NewFuse(),
+		preRollFlowing: core.NewFuse(),
+		usagePosted:    core.NewFuse(),
 	}
+	c.streamUpdates = coalesce.NewBatcher(conf.StreamUpdateWindow, c.applyStreamUpdates)
+	c.status.Store(int32(conf.Info.Status))
 	c.callbacks.SetOnError(c.OnError)
+	c.callbacks.AddOnReconnected(c.onReconnected)
+	c.callbacks.AddOnOutputUpdated(c.onOutputUpdated)
+	if conf.SegmentUpdates.Enabled && conf.GetSegmentConfig() != nil {
+		c.segmentUpdates = make(chan *segmentUpdate, conf.SegmentUpdates.QueueSize)
+		c.callbacks.AddOnSegmentUploaded(c.onSegmentUploaded)
+	}
+	if conf.CrashRecovery && conf.GetSegmentConfig() != nil {
+		// keeps the state close to the playlist, recovery skips segments the playlist already lists
+		c.callbacks.AddOnSegmentUploaded(func(string, uint64, time.Duration, time.Time) { c.saveRecoveryState() })
+	}
+	c.callbacks.AddOnTrackAdded(func(*config.TrackSource) { c.invalidateDot() })
+	c.callbacks.AddOnTrackRemoved(func(string) { c.invalidateDot() })
 
 	// initialize gst
+	if conf.Debug.Tracers != "" {
+		if err = enableTracers(conf.Debug.Tracers); err != nil {
+			return nil, err
+		}
+	}
 	go func() {
 		_, span := tracer.Start(ctx, "gst.Init")
 		defer span.End()
@@ -134,7 +229,11 @@ func (c *Controller) BuildPipeline() error {
 	}
 
 	if c.AudioEnabled {
-		if err = builder.BuildAudioBin(p, c.PipelineConfig); err != nil {
+		var levels *waveform.Levels
+		if s := c.sinks[types.EgressTypeFile]; len(s) > 0 {
+			levels = s[0].(*sink.FileSink).Levels()
+		}
+		if err = builder.BuildAudioBin(p, c.PipelineConfig, levels); err != nil {
 			return err
 		}
 	}
@@ -158,8 +257,11 @@ func (c *Controller) BuildPipeline() error {
 			sinkBins = append(sinkBins, sinkBin)
 
 		case types.EgressTypeStream:
+			var streamBin *builder.StreamBin
 			var sinkBin *gstreamer.Bin
-			c.streamBin, sinkBin, err = builder.BuildStreamBin(p, c.PipelineConfig)
+			if streamBin, sinkBin, err = builder.BuildStreamBin(p, c.PipelineConfig); err == nil {
+				c.streamBin = streamBin
+			}
 			sinkBins = append(sinkBins, sinkBin)
 
 		case types.EgressTypeWebsocket:
@@ -184,11 +286,23 @@ func (c *Controller) BuildPipeline() error {
 		}
 	}
 
+	if err = c.applyElementOverrides(p); err != nil {
+		return err
+	}
 	if err = p.Link(); err != nil {
 		return err
 	}
+	if err = c.blockPreRoll(p); err != nil {
+		return err
+	}
+	if err = c.stats.watchElements(p); err != nil {
+		return err
+	}
+	// registered after the builders, so track bins have been added by the time it runs
+	p.AddOnTrackAdded(func(*config.TrackSource) { c.rewatchElements(p) })
 
 	c.p = p
+	c.callbacks.SetRunningTime(p.RunningTime)
 	return nil
 }
 
@@ -202,19 +316,37 @@ func (c *Controller) Run(ctx context.Context) *livekit.EgressInfo {
 	// session limit timer
 	c.startSessionLimitTimer(ctx)
 
+	// end if no participant media arrives, fail if no media reaches the encoders or the encoders stop producing output
+	c.startNoInputTimer()
+	c.startFirstFrameTimer()
+	c.startEncoderWatchdog()
+
+	// fail if the local output directory stops accepting writes or runs out of space
+	c.startDiskWatchdog(ctx)
+	c.startDiskSpaceMonitor(ctx)
+
+	// end gracefully when the io service requests a stop
+	c.startStopSignalPoll(ctx)
+
+	// notify as each segment reaches storage
+	c.startSegmentUpdates(ctx)
+
+	go c.stats.samplePeakBitrate(c.stopped.Watch())
+	go c.sampleLatency(c.stopped.Watch())
+
 	// close when room ends
 	go func() {
 		<-c.src.EndRecording()
 		c.SendEOS(ctx)
 	}()
 
-	// wait until room is ready
+	// wait until room is ready. A gated start plays into the pre-roll queues instead
 	start := c.src.StartRecording()
-	if start != nil {
+	if start != nil && !c.StartGated() {
 		logger.Debugw("waiting for start signal")
 		select {
 		case <-c.stopped.Watch():
-			c.Info.Status = livekit.EgressStatus_EGRESS_ABORTED
+			c.setStatus(livekit.EgressStatus_EGRESS_ABORTED)
 			return c.Info
 		case <-start:
 			// continue
@@ -224,14 +356,37 @@ func (c *Controller) Run(ctx context.Context) *livekit.EgressInfo {
 	for _, si := range c.sinks {
 		for _, s := range si {
 			if err := s.Start(); err != nil {
-				c.Info.Error = err.Error()
+				c.setError(err)
 				return c.Info
 			}
 		}
 	}
 
-	if err := c.p.Run(); err != nil {
-		c.Info.Error = err.Error()
+	if c.StartGated() {
+		go c.awaitRecordingStart(start)
+	}
+
+	err := c.p.Run()
+	if !c.startUploads() {
+		c.closeDiscardedSinks()
+		return c.Info
+	}
+	if err != nil {
+		c.setError(err)
+		return c.Info
+	}
+
+	if c.eos.IsBroken() {
+		// stopped before enough media was recorded. Reported instead of any muxer error from finalizing empty outputs
+		if err := c.checkContent(); err != nil {
+			logger.Infow("discarding outputs", "reason", err)
+			c.setError(err)
+			return c.Info
+		}
+	}
+
+	if c.noOutput.IsBroken() {
+		// no media was encoded, skip uploading empty outputs
 		return c.Info
 	}
 
@@ -239,47 +394,124 @@ func (c *Controller) Run(ctx context.Context) *livekit.EgressInfo {
 	for _, si := range c.sinks {
 		for _, s := range si {
 			if err := s.Close(); err != nil {
-				c.Info.Error = err.Error()
+				c.setError(err)
 				return c.Info
 			}
 		}
 	}
 
+	if err := c.uploadBundles(); err != nil {
+		c.setError(err)
+		return c.Info
+	}
+
 	return c.Info
 }
 
 func (c *Controller) UpdateStream(ctx context.Context, req *livekit.UpdateStreamRequest) error {
-	ctx, span := tracer.Start(ctx, "Pipeline.UpdateStream")
+	_, span := tracer.Start(ctx, "Pipeline.UpdateStream")
 	defer span.End()
 
 	o := c.GetStreamConfig()
 	if o == nil {
 		return errors.ErrNonStreamingPipeline
 	}
+	if c.eos.IsBroken() {
+		return errors.ErrEgressEnding
+	}
 
-	sendUpdate := false
 	errs := errors.ErrArray{}
-	now := time.Now().UnixNano()
 
-	// add stream outputs first
+	// validate before queueing, so invalid urls are reported to the caller that requested them
+	var add, remove []string
 	for _, rawUrl := range req.AddOutputUrls {
-		// validate and redact url
-		url, redacted, err := c.ValidateUrl(rawUrl, types.OutputTypeRTMP)
+		url, err := c.validateStreamUrl(o, rawUrl)
 		if err != nil {
 			errs.AppendErr(err)
 			continue
 		}
+		if err = c.ValidateStreamPlatform(url); err != nil {
+			errs.AppendErr(err)
+			continue
+		}
+		add = append(add, url)
+	}
+	for _, rawUrl := range req.RemoveOutputUrls {
+		url, err := c.validateStreamUrl(o, rawUrl)
+		if err != nil {
+			errs.AppendErr(err)
+			continue
+		}
+		remove = append(remove, url)
+	}
+
+	if err := c.streamUpdates.Update(add, remove); err != nil {
+		errs.AppendErr(err)
+	}
+
+	return errs.ToError()
+}
+
+// validateStreamUrl dispatches a url by scheme. rtmp and srt urls share the stream bin's encoders,
+// while urls for a different output type than the running stream are rejected individually.
+// Websocket urls are always rejected: they carry raw audio from a sink of their own, which can't be added while running
+func (c *Controller) validateStreamUrl(o *config.StreamConfig, rawUrl string) (string, error) {
+	outputType, err := config.GetStreamOutputType(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	if outputType == types.OutputTypeRaw {
+		return "", errors.ErrInvalidUrl(rawUrl, "websocket outputs cannot be added to or removed from a running egress")
+	}
+	if outputType != o.OutputType {
+		return "", errors.ErrInvalidUrl(rawUrl, fmt.Sprintf("cannot add %s output to %s stream", outputType, o.OutputType))
+	}
+
+	url, _, err := c.ValidateUrl(rawUrl, outputType)
+	return url, err
+}
+
+// applyStreamUpdates applies the net changes of coalesced UpdateStream requests. Adding a url that is already
+// streaming and removing one that isn't are no-ops, so repeated requests don't rebuild outputs.
+// Errors are returned per url, so each caller in the batch only sees failures of the urls it requested
+func (c *Controller) applyStreamUpdates(add, remove []string) (map[string]error, error) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	// the stream bin is torn down once EOS has been sent
+	if c.eos.IsBroken() {
+		return nil, errors.ErrEgressEnding
+	}
+
+	ctx := context.Background()
+	o := c.GetStreamConfig()
+
+	sendUpdate := false
+	errs := make(map[string]error)
+	now := time.Now().UnixNano()
+
+	// add stream outputs first
+	for _, url := range add {
+		c.mu.Lock()
+		_, exists := o.StreamInfo[url]
+		c.mu.Unlock()
+		if exists {
+			continue
+		}
 
 		// add stream
-		if err = c.streamBin.AddStream(url); err != nil {
-			errs.AppendErr(err)
+		if err := c.streamBin.AddStream(url); err != nil {
+			errs[url] = err
 			continue
 		}
 
+		c.rewatchElements(c.p)
+
 		// add to output count
 		c.OutputCount++
 
 		// add stream info to results
+		redacted, _ := config.RedactStreamUrl(url)
 		c.mu.Lock()
 		streamInfo := &livekit.StreamInfo{
 			Url:       redacted,
@@ -296,15 +528,16 @@ func (c *Controller) UpdateStream(ctx context.Context, req *livekit.UpdateStream
 	}
 
 	// remove stream outputs
-	for _, rawUrl := range req.RemoveOutputUrls {
-		url, _, err := c.ValidateUrl(rawUrl, types.OutputTypeRTMP)
-		if err != nil {
-			errs.AppendErr(err)
+	for _, url := range remove {
+		c.mu.Lock()
+		_, exists := o.StreamInfo[url]
+		c.mu.Unlock()
+		if !exists {
 			continue
 		}
 
-		if err = c.removeSink(ctx, url, nil); err != nil {
-			errs.AppendErr(err)
+		if err := c.removeSink(ctx, url, nil); err != nil {
+			errs[url] = err
 		} else {
 			sendUpdate = true
 		}
@@ -312,12 +545,13 @@ func (c *Controller) UpdateStream(ctx context.Context, req *livekit.UpdateStream
 
 	if sendUpdate {
 		c.Info.UpdatedAt = time.Now().UnixNano()
-		_, _ = c.ioClient.UpdateEgress(ctx, c.Info)
+		c.updateEgress(ctx)
 	}
 
-	return errs.ToError()
+	return errs, nil
 }
 
+// removeSink must be called with controlMu held
 func (c *Controller) removeSink(ctx context.Context, url string, streamErr error) error {
 	now := time.Now().UnixNano()
 
@@ -352,7 +586,7 @@ func (c *Controller) removeSink(ctx context.Context, url string, streamErr error
 	c.mu.Unlock()
 
 	// log removal
-	redacted, _ := utils.RedactStreamKey(url)
+	redacted, _ := config.RedactStreamUrl(url)
 	logger.Infow("removing stream sink",
 		"url", redacted,
 		"status", streamInfo.Status,
@@ -364,7 +598,7 @@ func (c *Controller) removeSink(ctx context.Context, url string, streamErr error
 		if streamErr != nil {
 			return streamErr
 		} else {
-			c.SendEOS(ctx)
+			c.sendEOS(ctx)
 			return nil
 		}
 	}
@@ -372,7 +606,7 @@ func (c *Controller) removeSink(ctx context.Context, url string, streamErr error
 	// only send updates if the egress will continue, otherwise it's handled by UpdateStream RPC
 	if streamErr != nil {
 		c.Info.UpdatedAt = time.Now().UnixNano()
-		_, _ = c.ioClient.UpdateEgress(ctx, c.Info)
+		c.updateEgress(ctx)
 	}
 
 	return c.streamBin.RemoveStream(url)
@@ -382,6 +616,14 @@ func (c *Controller) SendEOS(ctx context.Context) {
 	ctx, span := tracer.Start(ctx, "Pipeline.SendEOS")
 	defer span.End()
 
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	c.sendEOS(ctx)
+}
+
+// sendEOS must be called with controlMu held
+func (c *Controller) sendEOS(ctx context.Context) {
 	c.eos.Once(func() {
 		logger.Debugw("sending EOS")
 
@@ -390,7 +632,7 @@ func (c *Controller) SendEOS(ctx context.Context) {
 		}
 		switch c.Info.Status {
 		case livekit.EgressStatus_EGRESS_STARTING:
-			c.Info.Status = livekit.EgressStatus_EGRESS_ABORTED
+			c.setStatus(livekit.EgressStatus_EGRESS_ABORTED)
 			fallthrough
 
 		case livekit.EgressStatus_EGRESS_ABORTED,
@@ -399,21 +641,32 @@ func (c *Controller) SendEOS(ctx context.Context) {
 
 		case livekit.EgressStatus_EGRESS_ACTIVE:
 			c.Info.UpdatedAt = time.Now().UnixNano()
-			if c.Info.Error != "" {
-				c.Info.Status = livekit.EgressStatus_EGRESS_FAILED
+			switch {
+			case c.errorMessage() == "":
+				c.setStatus(livekit.EgressStatus_EGRESS_ENDING)
+				c.updateEgress(ctx)
+			case c.finalizeOnError:
+				// the failure is reported right away, while outputs are finalized
+				c.setStatus(livekit.EgressStatus_EGRESS_FAILED)
+				c.updateEgress(ctx)
+			default:
+				c.setStatus(livekit.EgressStatus_EGRESS_FAILED)
 				c.p.Stop()
-			} else {
-				c.Info.Status = livekit.EgressStatus_EGRESS_ENDING
-				_, _ = c.ioClient.UpdateEgress(ctx, c.Info)
 			}
 			fallthrough
 
 		case livekit.EgressStatus_EGRESS_ENDING,
 			livekit.EgressStatus_EGRESS_LIMIT_REACHED:
+			if !c.recording.IsBroken() {
+				// the pre-roll queues hold back EOS, and nothing has been recorded
+				c.p.Stop()
+				break
+			}
+			c.eosTimer.Store(time.AfterFunc(config.EOSTimeout, func() {
+				c.OnError(errors.ErrPipelineFrozen)
+			}))
 			go func() {
-				c.eosTimer = time.AfterFunc(time.Second*30, func() {
-					c.OnError(errors.ErrPipelineFrozen)
-				})
+				c.resumeForEOS()
 				c.p.SendEOS()
 			}()
 		}
@@ -424,19 +677,127 @@ func (c *Controller) SendEOS(ctx context.Context) {
 	})
 }
 
+// endWithError records err and sends EOS, so outputs are still finalized while the egress is reported as failed.
+// The error is recorded first, so the egress is never reported as ending without it
+func (c *Controller) endWithError(ctx context.Context, err error) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	c.setErrorOnce(err)
+	c.finalizeOnError = true
+	c.sendEOS(ctx)
+}
+
+// onOutputUpdated sends an update when a sink reports new results before the egress ends, such as a rotated file
+func (c *Controller) onOutputUpdated() {
+	if c.closed.IsBroken() {
+		// included in the final update
+		return
+	}
+	c.saveRecoveryState()
+	c.Info.UpdatedAt = time.Now().UnixNano()
+	c.updateEgress(context.Background())
+}
+
+func (c *Controller) onReconnected() {
+	c.reconnects.Inc()
+
+	segmentSink := c.getSegmentSink()
+	if segmentSink == nil {
+		return
+	}
+	segmentSink.Discontinuity()
+
+	count := int(c.discontinuities.Inc())
+	logger.Infow("source reconnected, adding discontinuity", "discontinuities", count)
+	if c.MaxDiscontinuities > 0 && count > c.MaxDiscontinuities {
+		// finalize the playlist, but report the egress as failed
+		logger.Warnw("too many discontinuities, stopping egress", nil, "discontinuities", count)
+		c.endWithError(context.Background(), errors.ErrTooManyDiscontinuities(count))
+	}
+}
+
 func (c *Controller) OnError(err error) {
 	if errors.Is(err, errors.ErrPipelineFrozen) && c.Debug.EnableProfiling {
 		c.uploadDebugFiles()
 	}
 
-	if c.Info.Error == "" && (!c.eos.IsBroken() || c.FinalizationRequired) {
-		c.Info.Error = err.Error()
+	if !c.eos.IsBroken() || c.FinalizationRequired {
+		c.setErrorOnce(err)
 	}
 
 	go c.p.Stop()
 }
 
+// ForceStop stops the pipeline without waiting for EOS, recording the error even if EOS was already sent.
+// Muxers are flushed first, so file outputs are playable up to where they were cut off
+func (c *Controller) ForceStop(err error) {
+	c.stopEOSTimer()
+	c.setErrorOnce(err)
+
+	go func() {
+		if elements, err := c.p.GetElements(); err == nil {
+			flushMuxers(elements, forceStopFlushTimeout)
+		}
+		c.p.Stop()
+	}()
+}
+
+// flushMuxers sends EOS straight into each muxer, bypassing any wedged element upstream, and waits up to timeout
+// for it to reach the file sinks. An mp4 muxer writes its moov atom on EOS, without which the file can't be played
+func flushMuxers(elements []*gst.Element, timeout time.Duration) {
+	var muxers []*gst.Element
+	flushed := make(chan struct{}, len(elements))
+	sinks := 0
+	for _, e := range elements {
+		switch {
+		case strings.Contains(e.GetFactory().GetMetadata("klass"), "Muxer"):
+			muxers = append(muxers, e)
+		case e.GetFactory().GetName() == "filesink":
+			sinks++
+			e.GetStaticPad("sink").AddProbe(gst.PadProbeTypeEventDownstream, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+				if event := info.GetEvent(); event != nil && event.Type() == gst.EventTypeEOS {
+					flushed <- struct{}{}
+					return gst.PadProbeRemove
+				}
+				return gst.PadProbeOK
+			})
+		}
+	}
+	if len(muxers) == 0 || sinks == 0 {
+		return
+	}
+
+	for _, mux := range muxers {
+		pads, err := mux.GetSinkPads()
+		if err != nil {
+			continue
+		}
+		for _, pad := range pads {
+			// blocks while a wedged upstream element holds the pad's stream lock
+			go pad.SendEvent(gst.NewEOSEvent())
+		}
+	}
+
+	deadline := time.After(timeout)
+	for i := 0; i < sinks; i++ {
+		select {
+		case <-flushed:
+		case <-deadline:
+			logger.Warnw("muxers not flushed before forced stop", nil, "timeout", timeout)
+			return
+		}
+	}
+}
+
+func (c *Controller) stopEOSTimer() {
+	if t := c.eosTimer.Load(); t != nil {
+		t.Stop()
+	}
+}
+
 func (c *Controller) Close() {
+	c.closed.Break()
 	if c.SourceType == types.SourceTypeSDK || !c.eos.IsBroken() {
 		c.updateDuration(c.src.GetEndedAt())
 	}
@@ -444,13 +805,21 @@ func (c *Controller) Close() {
 	logger.Debugw("closing source")
 	c.src.Close()
 
+	if sdkSource, ok := c.src.(*source.SDKSource); ok {
+		if err := sdkSource.DisconnectError(); err != nil {
+			c.setErrorOnce(err)
+		}
+	}
+
+	c.applyDiskFull()
+
 	now := time.Now().UnixNano()
 	c.Info.UpdatedAt = now
 	c.Info.EndedAt = now
 
 	// update status
-	if c.Info.Error != "" {
-		c.Info.Status = livekit.EgressStatus_EGRESS_FAILED
+	if c.errorMessage() != "" {
+		c.setStatus(livekit.EgressStatus_EGRESS_FAILED)
 		if o := c.GetStreamConfig(); o != nil {
 			for _, streamInfo := range o.StreamInfo {
 				streamInfo.Status = livekit.StreamInfo_FAILED
@@ -461,18 +830,202 @@ func (c *Controller) Close() {
 	// ensure egress ends with a final state
 	switch c.Info.Status {
 	case livekit.EgressStatus_EGRESS_STARTING:
-		c.Info.Status = livekit.EgressStatus_EGRESS_ABORTED
+		c.setStatus(livekit.EgressStatus_EGRESS_ABORTED)
 
 	case livekit.EgressStatus_EGRESS_ACTIVE,
 		livekit.EgressStatus_EGRESS_ENDING:
-		c.Info.Status = livekit.EgressStatus_EGRESS_COMPLETE
+		c.setStatus(livekit.EgressStatus_EGRESS_COMPLETE)
 	}
 
+	// before cleanup, so the summary can be written next to any retained local files
+	c.finalizeSummary()
+	c.finalizeUsage()
+
 	for _, si := range c.sinks {
 		for _, s := range si {
 			s.Cleanup()
 		}
 	}
+	c.removeRecoveryState()
+}
+
+// checkContent returns an error if no media was encoded, or less than MinDuration was recorded
+func (c *Controller) checkContent() error {
+	if len(c.stats.getEncoders()) == 0 {
+		return nil
+	}
+	if c.stats.encodedBytes.Load() == 0 {
+		return errors.ErrNoContent
+	}
+	if c.MinDuration > 0 {
+		if d := c.stats.mediaDuration(c.src.GetEndedAt()); d < c.MinDuration {
+			return errors.ErrEgressTooShort(d, c.MinDuration)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) startFirstFrameTimer() {
+	if c.FirstFrameTimeout <= 0 || len(c.stats.getEncoders()) == 0 {
+		return
+	}
+
+	go func() {
+		select {
+		case <-c.stats.mediaReceived():
+		case <-c.stopped.Watch():
+		case <-time.After(c.FirstFrameTimeout):
+			logger.Warnw("no media received", nil, "timeout", c.FirstFrameTimeout)
+			c.noOutput.Break()
+			c.OnError(errors.ErrFirstFrameTimeout)
+		}
+	}()
+}
+
+// startEncoderWatchdog fails the egress if an encoder receives media but emits nothing for EncoderStallTimeout.
+// Silent audio and static video still produce encoded buffers, so only a stalled encoder triggers it.
+func (c *Controller) startEncoderWatchdog() {
+	encoders := c.stats.getEncoders()
+	if c.EncoderStallTimeout <= 0 || len(encoders) == 0 {
+		return
+	}
+
+	type progress struct {
+		in, out uint64
+		since   time.Time
+	}
+
+	go func() {
+		last := make([]progress, len(encoders))
+		for i := range last {
+			last[i].since = time.Now()
+		}
+
+		ticker := time.NewTicker(encoderWatchdogInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stopped.Watch():
+				return
+			case <-c.eos.Watch():
+				// encoders may legitimately stop while draining
+				return
+			case now := <-ticker.C:
+				for i, e := range encoders {
+					in, out := e.buffersIn.Load(), e.buffersOut.Load()
+					if out != last[i].out || in == last[i].in {
+						// producing output, or no media to encode
+						last[i] = progress{in: in, out: out, since: now}
+						continue
+					}
+
+					if stalled := now.Sub(last[i].since); stalled >= c.EncoderStallTimeout {
+						logger.Warnw("encoder stalled", nil,
+							"encoder", e.name,
+							"buffersIn", in,
+							"buffersOut", out,
+							"stalled", stalled,
+						)
+						if c.stats.encodedBytes.Load() == 0 {
+							c.noOutput.Break()
+						}
+						c.OnError(errors.ErrEncoderStalled(e.name, stalled))
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// startDiskWatchdog fails the egress if a probe write to a local output directory blocks for DiskStallTimeout.
+// EOS is still sent so outputs are finalized and uploaded if the disk recovers.
+func (c *Controller) startDiskWatchdog(ctx context.Context) {
+	dirs := c.getLocalDirs()
+	if c.DiskStallTimeout <= 0 || len(dirs) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(diskWatchdogInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.closed.Watch():
+				return
+			case <-ticker.C:
+				for _, dir := range dirs {
+					if probeDisk(dir, c.DiskStallTimeout) {
+						continue
+					}
+
+					logger.Warnw("disk stalled", nil, "dir", dir, "timeout", c.DiskStallTimeout)
+					c.diskStall.Break()
+					c.endWithError(ctx, errors.ErrDiskStalled(dir, c.DiskStallTimeout))
+					return
+				}
+			}
+		}
+	}()
+}
+
+// DiskStalled is closed when the disk watchdog fails the egress
+func (c *Controller) DiskStalled() <-chan struct{} {
+	return c.diskStall.Watch()
+}
+
+func (c *Controller) getLocalDirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		if dir == "" {
+			dir = "."
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for egressType, o := range c.Outputs {
+		switch egressType {
+		case types.EgressTypeFile:
+			add(path.Dir(o[0].(*config.FileConfig).LocalFilepath))
+		case types.EgressTypeSegments:
+			add(o[0].(*config.SegmentConfig).LocalDir)
+		case types.EgressTypeImages:
+			for _, ci := range o {
+				add(ci.(*config.ImageConfig).LocalDir)
+			}
+		}
+	}
+	return dirs
+}
+
+// probeDisk returns false if a small synced write to dir does not complete within timeout.
+// Other write errors are left for the muxers to report.
+func probeDisk(dir string, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f, err := os.CreateTemp(dir, ".probe")
+		if err != nil {
+			return
+		}
+		_, _ = f.Write([]byte{0})
+		_ = f.Sync()
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func (c *Controller) startSessionLimitTimer(ctx context.Context) {
@@ -500,7 +1053,7 @@ func (c *Controller) startSessionLimitTimer(ctx context.Context) {
 			switch c.Info.Status {
 			case livekit.EgressStatus_EGRESS_STARTING,
 				livekit.EgressStatus_EGRESS_ACTIVE:
-				c.Info.Status = livekit.EgressStatus_EGRESS_LIMIT_REACHED
+				c.setStatus(livekit.EgressStatus_EGRESS_LIMIT_REACHED)
 			}
 			if c.playing.IsBroken() {
 				c.SendEOS(ctx)
@@ -539,10 +1092,121 @@ func (c *Controller) updateStartTime(startedAt int64) {
 	}
 
 	if c.Info.Status == livekit.EgressStatus_EGRESS_STARTING {
-		c.Info.Status = livekit.EgressStatus_EGRESS_ACTIVE
+		c.flowExpectedAt.Store(time.Now().UnixNano())
+		c.setStatus(livekit.EgressStatus_EGRESS_ACTIVE)
 		c.Info.UpdatedAt = time.Now().UnixNano()
-		_, _ = c.ioClient.UpdateEgress(context.Background(), c.Info)
+		c.updateEgress(context.Background())
+	}
+}
+
+// setStatus updates the egress status, which is also read outside the pipeline goroutines
+func (c *Controller) setStatus(status livekit.EgressStatus) {
+	c.Info.Status = status
+	c.status.Store(int32(status))
+	c.invalidateDot()
+}
+
+// Status returns the current egress status
+func (c *Controller) Status() livekit.EgressStatus {
+	return livekit.EgressStatus(c.status.Load())
+}
+
+// setError records the error reported in the egress info, along with its code
+func (c *Controller) setError(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+
+	c.Info.Error = err.Error()
+	c.errorCode.Store(string(errors.GetErrorCode(err)))
+}
+
+// setErrorOnce records the error unless the egress has already failed, and returns true if it was recorded
+func (c *Controller) setErrorOnce(err error) bool {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+
+	if c.Info.Error != "" {
+		return false
+	}
+	c.Info.Error = err.Error()
+	c.errorCode.Store(string(errors.GetErrorCode(err)))
+	return true
+}
+
+// errorMessage returns the error the egress failed with, or an empty string
+func (c *Controller) errorMessage() string {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+
+	return c.Info.Error
+}
+
+// ErrorCode returns the code of the error the egress failed with, if any
+func (c *Controller) ErrorCode() types.ErrorCode {
+	return types.ErrorCode(c.errorCode.Load())
+}
+
+// DisconnectReason returns why the room connection ended, for sdk egresses which have been disconnected
+func (c *Controller) DisconnectReason() types.DisconnectReason {
+	if sdkSource, ok := c.src.(*source.SDKSource); ok {
+		return sdkSource.DisconnectReason()
+	}
+	return ""
+}
+
+// Active returns true from the time the pipeline starts playing until it is closed
+func (c *Controller) Active() bool {
+	return c.playing.IsBroken() && !c.closed.IsBroken()
+}
+
+// Readiness reports whether the pipeline is producing media, as opposed to starting up or shutting down
+func (c *Controller) Readiness() types.Readiness {
+	switch {
+	case c.eos.IsBroken(), c.stopped.IsBroken(), c.closed.IsBroken():
+		return types.ReadinessShuttingDown
+	case !c.playing.IsBroken():
+		return types.ReadinessStarting
+	}
+
+	switch c.Status() {
+	case livekit.EgressStatus_EGRESS_STARTING:
+		return types.ReadinessWaitingForMedia
+	case livekit.EgressStatus_EGRESS_ACTIVE:
+		if c.paused.Load() {
+			return types.ReadinessPaused
+		}
+		// ready once the encoders produce output, or once playing when everything is passed through
+		if len(c.stats.getEncoders()) > 0 && c.stats.encodedBytes.Load() == 0 {
+			return types.ReadinessWaitingForMedia
+		}
+		return types.ReadinessReady
+	default:
+		return types.ReadinessShuttingDown
+	}
+}
+
+// LastBufferAt returns when a buffer last reached an output sink, or 0 if none has
+func (c *Controller) LastBufferAt() int64 {
+	return c.stats.lastBufferAt.Load()
+}
+
+// Health reports the pipeline as degraded once an active egress has gone SinkStallThreshold without a buffer
+// reaching its output sinks, along with the time since media was last seen or expected
+func (c *Controller) Health() (types.Health, time.Duration) {
+	if c.SinkStallThreshold <= 0 || c.Readiness() == types.ReadinessShuttingDown || c.paused.Load() {
+		return types.HealthOK, 0
+	}
+	since := max(c.stats.lastBufferAt.Load(), c.flowExpectedAt.Load())
+	if since == 0 {
+		// not active yet
+		return types.HealthOK, 0
+	}
+
+	idle := time.Duration(time.Now().UnixNano() - since)
+	if idle >= c.SinkStallThreshold {
+		return types.HealthDegraded, idle
 	}
+	return types.HealthOK, idle
 }
 
 func (c *Controller) updateDuration(endedAt int64) {
@@ -0,0 +1,539 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/go-gst/go-gst/gst"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/pipeline/coalesce"
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/egress/pkg/pipeline/source"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/rpc"
+	"github.com/livekit/psrpc"
+)
+
+// fakeStreams mimics the stream bin, recording the running urls
+type fakeStreams struct {
+	mu   sync.Mutex
+	urls map[string]bool
+	fail map[string]bool
+}
+
+func (f *fakeStreams) AddStream(url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail[url] {
+		return errors.ErrInvalidInput("url")
+	}
+	f.urls[url] = true
+	return nil
+}
+
+func (f *fakeStreams) RemoveStream(url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.urls[url] {
+		return errors.ErrStreamNotFound(url)
+	}
+	delete(f.urls, url)
+	return nil
+}
+
+func (f *fakeStreams) GetStreamUrl(name string) (string, error) {
+	return "", errors.ErrStreamNotFound(name)
+}
+func (f *fakeStreams) DisconnectStream(name string) (int, bool, error) { return 0, false, nil }
+func (f *fakeStreams) ReconnectStream(name string) error               { return nil }
+func (f *fakeStreams) StreamReconnected(string, int) (bool, bool)      { return false, false }
+func (f *fakeStreams) BytesSent() map[string]uint64                    { return nil }
+func (f *fakeStreams) StreamStates() map[string]*builder.StreamState   { return nil }
+
+func (f *fakeStreams) running() map[string]bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	running := make(map[string]bool, len(f.urls))
+	for url := range f.urls {
+		running[url] = true
+	}
+	return running
+}
+
+// fakeIOClient counts egress updates, and keeps the last one
+type fakeIOClient struct {
+	rpc.IOInfoClient
+	mu      sync.Mutex
+	updates int
+	last    *livekit.EgressInfo
+}
+
+func (f *fakeIOClient) UpdateEgress(_ context.Context, info *livekit.EgressInfo, _ ...psrpc.RequestOption) (*emptypb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates++
+	f.last = info
+	return &emptypb.Empty{}, nil
+}
+
+func newStreamController(urls ...string) (*Controller, *fakeStreams, *fakeIOClient) {
+	o := &config.StreamConfig{StreamInfo: make(map[string]*livekit.StreamInfo)}
+	o.OutputType = types.OutputTypeRTMP
+	streams := &fakeStreams{urls: make(map[string]bool), fail: make(map[string]bool)}
+	info := &livekit.EgressInfo{}
+	for _, url := range urls {
+		o.Urls = append(o.Urls, url)
+		o.StreamInfo[url] = &livekit.StreamInfo{Url: url, Status: livekit.StreamInfo_ACTIVE}
+		info.StreamResults = append(info.StreamResults, o.StreamInfo[url])
+		streams.urls[url] = true
+	}
+
+	ioClient := &fakeIOClient{}
+	c := &Controller{
+		PipelineConfig: &config.PipelineConfig{
+			Info:        info,
+			OutputCount: len(urls),
+			Outputs:     map[types.EgressType][]config.OutputConfig{types.EgressTypeStream: {o}},
+		},
+		streamBin: streams,
+		ioClient:  ioClient,
+		eos:       core.NewFuse(),
+	}
+	c.streamUpdates = coalesce.NewBatcher(0, c.applyStreamUpdates)
+	return c, streams, ioClient
+}
+
+func TestApplyStreamUpdatesMixedProtocols(t *testing.T) {
+	const (
+		rtmp1 = "rtmp://localhost/live/stream1"
+		rtmp2 = "rtmp://localhost/live/stream2"
+		srt1  = "srt://localhost:9000?streamid=abcdefghij"
+		srt2  = "srt://localhost:9001"
+	)
+
+	c, streams, ioClient := newStreamController(rtmp1)
+
+	// srt and rtmp urls are added to the same stream, and an existing url is a no-op
+	errs, err := c.applyStreamUpdates([]string{srt1, rtmp1, rtmp2}, nil)
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Equal(t, map[string]bool{rtmp1: true, rtmp2: true, srt1: true}, streams.running())
+	require.Equal(t, 3, c.OutputCount)
+	require.Equal(t, 1, ioClient.updates)
+
+	// srt credentials are redacted in the reported results
+	o := c.GetStreamConfig()
+	require.Equal(t, "srt://localhost:9000?streamid={abc...hij}", o.StreamInfo[srt1].Url)
+	require.Len(t, c.Info.StreamResults, 3)
+
+	// removing an rtmp url leaves the srt output running, and removing an unknown url is a no-op
+	errs, err = c.applyStreamUpdates([]string{srt2}, []string{rtmp1, "rtmp://localhost/live/unknown"})
+	require.NoError(t, err)
+	require.Empty(t, errs)
+	require.Equal(t, map[string]bool{rtmp2: true, srt1: true, srt2: true}, streams.running())
+	require.Equal(t, 3, c.OutputCount)
+	require.Equal(t, livekit.StreamInfo_FINISHED, c.Info.StreamResults[0].Status)
+	require.Equal(t, 2, ioClient.updates)
+
+	// a failed add is reported without affecting the other changes in the batch
+	streams.fail[rtmp1] = true
+	errs, err = c.applyStreamUpdates([]string{rtmp1}, []string{srt1})
+	require.NoError(t, err)
+	require.Len(t, errs, 1)
+	require.Error(t, errs[rtmp1])
+	require.Equal(t, map[string]bool{rtmp2: true, srt2: true}, streams.running())
+	require.Equal(t, 2, c.OutputCount)
+	require.NotContains(t, o.StreamInfo, rtmp1)
+
+	// websocket urls are rejected with an error rather than ignored
+	err = c.UpdateStream(context.Background(), &livekit.UpdateStreamRequest{AddOutputUrls: []string{"wss://localhost/audio"}})
+	require.ErrorContains(t, err, "websocket outputs cannot be added")
+	require.Equal(t, map[string]bool{rtmp2: true, srt2: true}, streams.running())
+
+	// updates are rejected once the egress is ending
+	c.eos.Break()
+	_, err = c.applyStreamUpdates([]string{srt1}, nil)
+	require.ErrorIs(t, err, errors.ErrEgressEnding)
+	require.Equal(t, map[string]bool{rtmp2: true, srt2: true}, streams.running())
+}
+
+func TestUpdateStreamRapidUpdates(t *testing.T) {
+	const (
+		rtmp1 = "rtmp://localhost/live/stream1"
+		rtmp2 = "rtmp://localhost/live/stream2"
+		srt1  = "srt://localhost:9000?streamid=abcdefghij"
+	)
+
+	c, streams, _ := newStreamController(rtmp1)
+
+	// concurrent callers toggling outputs never tear down the stream, and the outputs stay consistent
+	const requests = 100
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		req := &livekit.UpdateStreamRequest{}
+		switch i % 4 {
+		case 0:
+			req.AddOutputUrls = []string{rtmp2, srt1}
+		case 1:
+			req.RemoveOutputUrls = []string{rtmp2}
+		case 2:
+			req.RemoveOutputUrls = []string{srt1}
+		default:
+			req.AddOutputUrls = []string{rtmp1}
+		}
+		go func() {
+			errs <- c.UpdateStream(context.Background(), req)
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	running := streams.running()
+	require.True(t, running[rtmp1])
+	require.Equal(t, len(running), c.OutputCount)
+	require.Len(t, c.GetStreamConfig().StreamInfo, c.OutputCount)
+	require.False(t, c.eos.IsBroken())
+}
+
+// fakeWebSource records the pages chrome is navigated to
+type fakeWebSource struct {
+	source.Source
+	pages []string
+	fail  map[string]bool
+}
+
+func (f *fakeWebSource) UpdateLayout(p *config.PipelineConfig) error {
+	f.pages = append(f.pages, p.WebUrl)
+	if f.fail[p.WebUrl] {
+		return errors.New("page failed to load")
+	}
+	return nil
+}
+
+func TestUpdateLayoutRollback(t *testing.T) {
+	const (
+		prevUrl   = "https://example.com/prev"
+		failedUrl = "https://example.com/failed"
+		nextUrl   = "https://example.com/next"
+	)
+
+	src := &fakeWebSource{fail: map[string]bool{failedUrl: true}}
+	req := &livekit.EgressInfo_Web{Web: &livekit.WebEgressRequest{Url: prevUrl}}
+	c := &Controller{
+		PipelineConfig: &config.PipelineConfig{
+			Info: &livekit.EgressInfo{Request: req},
+		},
+		src:      src,
+		ioClient: &fakeIOClient{},
+		eos:      core.NewFuse(),
+	}
+	c.RequestType = types.RequestTypeWeb
+	c.WebUrl = prevUrl
+	c.status.Store(int32(livekit.EgressStatus_EGRESS_ACTIVE))
+
+	// the config is restored, and chrome navigates back to the previous page
+	require.Error(t, c.UpdateLayout(context.Background(), "", failedUrl))
+	require.Equal(t, prevUrl, c.WebUrl)
+	require.Equal(t, prevUrl, req.Web.Url)
+	require.Equal(t, []string{failedUrl, prevUrl}, src.pages)
+
+	require.NoError(t, c.UpdateLayout(context.Background(), "", nextUrl))
+	require.Equal(t, nextUrl, c.WebUrl)
+	require.Equal(t, nextUrl, req.Web.Url)
+	require.Equal(t, []string{failedUrl, prevUrl, nextUrl}, src.pages)
+}
+
+func TestKeyframeHistory(t *testing.T) {
+	h := &keyframeHistory{window: 4 * time.Second}
+	for _, pts := range []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second} {
+		h.add(pts)
+	}
+
+	// the keyframe at 0 left the window
+	require.Equal(t, []time.Duration{2 * time.Second, 4 * time.Second, 6 * time.Second}, h.pts)
+
+	kf, ok := h.lastAtOrBefore(5 * time.Second)
+	require.True(t, ok)
+	require.Equal(t, 4*time.Second, kf)
+	kf, ok = h.lastAtOrBefore(4 * time.Second)
+	require.True(t, ok)
+	require.Equal(t, 4*time.Second, kf)
+	_, ok = h.lastAtOrBefore(time.Second)
+	require.False(t, ok)
+}
+
+func TestGatedStart(t *testing.T) {
+	gst.Init(nil)
+
+	// the async sink can't complete the change to playing while the pre-roll queue is blocked
+	pipeline, err := gst.NewPipelineFromString(
+		"videotestsrc is-live=true ! queue name=video" + builder.PreRollQueueSuffix + " ! fakesink async=true",
+	)
+	require.NoError(t, err)
+	elements, err := pipeline.GetElementsRecursive()
+	require.NoError(t, err)
+
+	c := &Controller{
+		PipelineConfig: &config.PipelineConfig{
+			Info: &livekit.EgressInfo{Status: livekit.EgressStatus_EGRESS_STARTING},
+		},
+		callbacks:      &gstreamer.Callbacks{},
+		ioClient:       &fakeIOClient{},
+		eos:            core.NewFuse(),
+		stopped:        core.NewFuse(),
+		recording:      core.NewFuse(),
+		markStart:      core.NewFuse(),
+		preRollFlowing: core.NewFuse(),
+	}
+	c.AwaitMarkStart = true
+	c.PreRoll = time.Second
+	c.callbacks.SetRunningTime(func() time.Duration {
+		clock := pipeline.GetClock()
+		if clock == nil {
+			return 0
+		}
+		return time.Duration(clock.GetTime() - pipeline.GetBaseTime())
+	})
+
+	c.blockPreRollQueues(elements)
+	require.Len(t, c.preRoll, 1)
+	go c.awaitRecordingStart(nil)
+
+	require.NoError(t, pipeline.SetState(gst.StatePlaying))
+	defer func() {
+		_ = pipeline.SetState(gst.StateNull)
+	}()
+
+	select {
+	case <-c.preRollFlowing.Watch():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no media reached the pre-roll queue")
+	}
+	time.Sleep(500 * time.Millisecond)
+	require.False(t, c.recording.IsBroken())
+	require.NotEqual(t, gst.StatePlaying, pipeline.GetCurrentState())
+
+	// the mark releases the queue, and the pipeline then completes the change to playing
+	require.NoError(t, c.MarkStart(context.Background()))
+	select {
+	case <-c.recording.Watch():
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording did not start")
+	}
+	ret, state := pipeline.GetState(gst.StatePlaying, gst.ClockTime(5*time.Second))
+	require.Equal(t, gst.StateChangeSuccess, ret)
+	require.Equal(t, gst.StatePlaying, state)
+	require.Equal(t, livekit.EgressStatus_EGRESS_ACTIVE, c.Info.Status)
+	require.ErrorIs(t, c.MarkStart(context.Background()), errors.ErrRecordingStarted)
+}
+
+func TestSetErrorOnce(t *testing.T) {
+	c := &Controller{
+		PipelineConfig: &config.PipelineConfig{Info: &livekit.EgressInfo{}},
+		ioClient:       &fakeIOClient{},
+	}
+
+	// watchdogs and callbacks race to fail the egress, and exactly one error is recorded
+	var wg sync.WaitGroup
+	recorded := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		err := errors.ErrEncoderStalled(fmt.Sprintf("encoder_%d", i), time.Second)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c.setErrorOnce(err) {
+				recorded <- err
+			}
+			c.updateEgress(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(recorded)
+
+	require.Len(t, recorded, 1)
+	err := <-recorded
+	require.Equal(t, err.Error(), c.errorMessage())
+	require.Equal(t, errors.GetErrorCode(err), c.ErrorCode())
+}
+
+func TestEndWithError(t *testing.T) {
+	gst.Init(nil)
+	p, err := gstreamer.NewPipeline("pipeline", 0, &gstreamer.Callbacks{GstReady: make(chan struct{})})
+	require.NoError(t, err)
+
+	ioClient := &fakeIOClient{}
+	c := &Controller{
+		PipelineConfig: &config.PipelineConfig{
+			Info: &livekit.EgressInfo{Status: livekit.EgressStatus_EGRESS_ACTIVE},
+		},
+		p:         p,
+		ioClient:  ioClient,
+		eos:       core.NewFuse(),
+		recording: core.NewFuse(),
+	}
+	c.recording.Break()
+
+	// outputs are finalized, and the update sent with EOS already reports the failure
+	stalled := errors.ErrDiskStalled("/tmp", time.Second)
+	c.endWithError(context.Background(), stalled)
+	defer c.stopEOSTimer()
+
+	require.True(t, c.eos.IsBroken())
+	require.Equal(t, 1, ioClient.updates)
+	require.Equal(t, livekit.EgressStatus_EGRESS_FAILED, ioClient.last.Status)
+	require.Equal(t, stalled.Error(), ioClient.last.Error)
+}
+
+func TestTooManyDiscontinuities(t *testing.T) {
+	gst.Init(nil)
+	p, err := gstreamer.NewPipeline("pipeline", 0, &gstreamer.Callbacks{GstReady: make(chan struct{})})
+	require.NoError(t, err)
+
+	segments := &config.SegmentConfig{SegmentsInfo: &livekit.SegmentsInfo{}}
+	ioClient := &fakeIOClient{}
+	c := &Controller{
+		PipelineConfig: &config.PipelineConfig{
+			BaseConfig: config.BaseConfig{MaxDiscontinuities: 1},
+			Info:       &livekit.EgressInfo{Status: livekit.EgressStatus_EGRESS_ACTIVE},
+			Outputs:    map[types.EgressType][]config.OutputConfig{types.EgressTypeSegments: {segments}},
+		},
+		p:         p,
+		ioClient:  ioClient,
+		eos:       core.NewFuse(),
+		recording: core.NewFuse(),
+		sinks: map[types.EgressType][]sink.Sink{
+			types.EgressTypeSegments: {&sink.SegmentSink{SegmentConfig: segments}},
+		},
+	}
+	c.recording.Break()
+
+	c.onReconnected()
+	require.False(t, c.eos.IsBroken())
+	require.Equal(t, int32(1), c.GetOutputStats()[string(types.EgressTypeSegments)].Discontinuities)
+
+	// the playlist is finalized, and the update sent with EOS already reports the failure
+	c.onReconnected()
+	defer c.stopEOSTimer()
+
+	require.True(t, c.eos.IsBroken())
+	require.Equal(t, 1, ioClient.updates)
+	require.Equal(t, livekit.EgressStatus_EGRESS_FAILED, ioClient.last.Status)
+	require.Equal(t, errors.ErrTooManyDiscontinuities(2).Error(), ioClient.last.Error)
+	require.Equal(t, int32(2), c.GetOutputStats()[string(types.EgressTypeSegments)].Discontinuities)
+}
+
+func TestForceStop(t *testing.T) {
+	gst.Init(nil)
+	newController := func() *Controller {
+		p, err := gstreamer.NewPipeline("pipeline", 0, &gstreamer.Callbacks{GstReady: make(chan struct{})})
+		require.NoError(t, err)
+		return &Controller{
+			PipelineConfig: &config.PipelineConfig{Info: &livekit.EgressInfo{}},
+			p:              p,
+		}
+	}
+
+	// operators are told the output may be truncated
+	c := newController()
+	c.ForceStop(errors.ErrForcedShutdown)
+	require.Equal(t, errors.ErrForcedShutdown.Error(), c.errorMessage())
+	require.Equal(t, errors.GetErrorCode(errors.ErrForcedShutdown), c.ErrorCode())
+
+	// an earlier failure is kept
+	c = newController()
+	c.setError(errors.ErrNoContent)
+	c.ForceStop(errors.ErrForcedShutdown)
+	require.Equal(t, errors.ErrNoContent.Error(), c.errorMessage())
+}
+
+func TestFlushMuxers(t *testing.T) {
+	gst.Init(nil)
+
+	filename := path.Join(t.TempDir(), "out.mp4")
+	pipeline, err := gst.NewPipelineFromString(fmt.Sprintf(
+		"audiotestsrc is-live=true ! audio/x-raw,format=S16LE,rate=48000,channels=2 ! queue name=wedged ! qtmux ! filesink location=%s",
+		filename,
+	))
+	require.NoError(t, err)
+	elements, err := pipeline.GetElementsRecursive()
+	require.NoError(t, err)
+	wedged, err := pipeline.GetElementByName("wedged")
+	require.NoError(t, err)
+
+	require.NoError(t, pipeline.SetState(gst.StatePlaying))
+	defer func() {
+		_ = pipeline.SetState(gst.StateNull)
+	}()
+	time.Sleep(time.Second)
+
+	// nothing upstream of the muxer passes EOS on anymore
+	wedged.GetStaticPad("src").AddProbe(gst.PadProbeTypeBlockDownstream, func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+		return gst.PadProbeOK
+	})
+	pipeline.SendEvent(gst.NewEOSEvent())
+
+	// the muxer still finalizes the file
+	flushMuxers(elements, 5*time.Second)
+	require.NoError(t, pipeline.SetState(gst.StateNull))
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.True(t, bytes.Contains(b, []byte("moov")))
+}
+
+func TestDiskFull(t *testing.T) {
+	newController := func() *Controller {
+		c := &Controller{
+			PipelineConfig: &config.PipelineConfig{Info: &livekit.EgressInfo{}},
+			diskFull:       core.NewFuse(),
+		}
+		c.MinFreeDisk = 100
+		return c
+	}
+
+	// recorded by the monitor, and set when the egress is closed
+	c := newController()
+	go c.onDiskFull("/tmp", 10)
+	<-c.diskFull.Watch()
+	c.applyDiskFull()
+	require.Equal(t, errors.ErrDiskFull("/tmp", 10, 100).Error(), c.Info.Error)
+
+	// an earlier error is kept
+	c = newController()
+	c.setError(errors.ErrNoContent)
+	c.onDiskFull("/tmp", 10)
+	c.applyDiskFull()
+	require.Equal(t, errors.ErrNoContent.Error(), c.Info.Error)
+
+	c = newController()
+	c.applyDiskFull()
+	require.Empty(t, c.Info.Error)
+}
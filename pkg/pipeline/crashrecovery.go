@@ -0,0 +1,149 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// saveRecoveryState writes the closed chunks of a rotating file output, or the pending segments of a segment output,
+// to the handler tmp dir, so that the service can still upload them if the handler crashes
+func (c *Controller) saveRecoveryState() {
+	if !c.CrashRecovery {
+		return
+	}
+	fileSink := c.getFileSink()
+	segmentSink := c.getSegmentSink()
+	if fileSink == nil && segmentSink == nil {
+		return
+	}
+
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	// read under the lock, so an older state never replaces a newer one
+	var state *config.RecoveryState
+	if fileSink != nil {
+		state = fileSink.RecoveryState()
+	} else {
+		state = segmentSink.RecoveryState()
+	}
+	if state == nil {
+		return
+	}
+	state.Request = c.SealedRequest
+	if err := config.WriteRecoveryState(c.TmpDir, state); err != nil {
+		logger.Warnw("failed to write recovery state", err)
+	}
+}
+
+// removeRecoveryState is called once the outputs are finalized, since there is nothing left to recover
+func (c *Controller) removeRecoveryState() {
+	if !c.CrashRecovery {
+		return
+	}
+
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if err := config.RemoveRecoveryState(c.TmpDir); err != nil {
+		logger.Warnw("failed to remove recovery state", err)
+	}
+}
+
+// RecoverEgress uploads the closed file chunks or pending segments listed in the recovery state of a crashed handler,
+// found in p.TmpDir. It returns false if there is nothing to recover. Otherwise, info lists the outputs in storage and fails
+// as partially recovered. Recording does not resume, and the chunk or segment being written during the crash is lost
+func RecoverEgress(p *config.PipelineConfig, info *livekit.EgressInfo) (bool, error) {
+	state, err := config.ReadRecoveryState(p.TmpDir)
+	if err != nil || state == nil {
+		return false, err
+	}
+	if state.Segments != nil {
+		return recoverSegments(p, info, state)
+	}
+	if len(state.Chunks) == 0 {
+		return false, nil
+	}
+	o := p.GetFileConfig()
+	if o == nil {
+		return false, errors.ErrInvalidInput("file output")
+	}
+
+	logger.Infow("recovering egress", "egressID", state.EgressID, "chunks", len(state.Chunks))
+	results, lost, err := sink.RecoverChunks(p, o, state)
+	if err != nil {
+		return false, err
+	}
+
+	// the first file result totals the chunks, followed by each chunk
+	total := &livekit.FileInfo{
+		Filename: state.StorageFilepath,
+	}
+	for i, result := range results {
+		if i == 0 {
+			total.StartedAt = result.StartedAt
+		}
+		total.EndedAt = result.EndedAt
+		total.Duration += result.Duration
+		total.Size += result.Size
+		total.Location = result.Location
+	}
+	info.FileResults = append([]*livekit.FileInfo{total}, results...)
+	if _, ok := info.Result.(*livekit.EgressInfo_File); ok {
+		info.Result = &livekit.EgressInfo_File{File: total}
+	}
+
+	setRecovered(p, info, errors.ErrPartiallyRecovered(len(results), lost, "file chunks"))
+	return true, nil
+}
+
+func recoverSegments(p *config.PipelineConfig, info *livekit.EgressInfo, state *config.RecoveryState) (bool, error) {
+	o := p.GetSegmentConfig()
+	if o == nil {
+		return false, errors.ErrInvalidInput("segment output")
+	}
+
+	logger.Infow("recovering egress", "egressID", state.EgressID, "segments", len(state.Segments.Pending))
+	recovered, lost, err := sink.RecoverSegments(p, o, state)
+	if err != nil {
+		return false, err
+	}
+
+	info.SegmentResults = []*livekit.SegmentsInfo{o.SegmentsInfo}
+	if _, ok := info.Result.(*livekit.EgressInfo_Segments); ok {
+		info.Result = &livekit.EgressInfo_Segments{Segments: o.SegmentsInfo}
+	}
+	setRecovered(p, info, errors.ErrPartiallyRecovered(recovered, lost, "segments"))
+	return true, nil
+}
+
+func setRecovered(p *config.PipelineConfig, info *livekit.EgressInfo, err error) {
+	now := time.Now().UnixNano()
+	info.UpdatedAt = now
+	info.EndedAt = now
+	info.Status = livekit.EgressStatus_EGRESS_FAILED
+	info.Error = err.Error()
+
+	if err = config.RemoveRecoveryState(p.TmpDir); err != nil {
+		logger.Warnw("failed to remove recovery state", err)
+	}
+}
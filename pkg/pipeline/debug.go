@@ -25,6 +25,7 @@ import (
 
 	"github.com/go-gst/go-gst/gst"
 
+	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/types"
@@ -36,8 +37,66 @@ func (c *Controller) GetGstPipelineDebugDot() string {
 	return c.p.DebugBinToDotData(gst.DebugGraphShowAll)
 }
 
+// Transitioning returns true while the pipeline is changing state
+func (c *Controller) Transitioning() bool {
+	return c.p.Transitioning()
+}
+
+type dotCache struct {
+	mu         sync.Mutex
+	inflight   *dotCall
+	dot        string
+	generation uint64
+	expires    time.Time
+}
+
+type dotCall struct {
+	done chan struct{}
+	dot  string
+}
+
+// GetCachedPipelineDot shares one dot generation between concurrent requests, and reuses it for
+// Debug.DotCacheTTL unless the egress status or tracks have changed since it was generated
+func (c *Controller) GetCachedPipelineDot() string {
+	generation := c.dotGeneration.Load()
+
+	c.dot.mu.Lock()
+	if c.dot.generation == generation && time.Now().Before(c.dot.expires) {
+		dot := c.dot.dot
+		c.dot.mu.Unlock()
+		return dot
+	}
+	if call := c.dot.inflight; call != nil {
+		c.dot.mu.Unlock()
+		<-call.done
+		return call.dot
+	}
+	call := &dotCall{done: make(chan struct{})}
+	c.dot.inflight = call
+	c.dot.mu.Unlock()
+
+	call.dot = c.GetGstPipelineDebugDot()
+
+	c.dot.mu.Lock()
+	c.dot.inflight = nil
+	if c.Debug.DotCacheTTL > 0 {
+		c.dot.dot = call.dot
+		c.dot.generation = generation
+		c.dot.expires = time.Now().Add(c.Debug.DotCacheTTL)
+	}
+	c.dot.mu.Unlock()
+	close(call.done)
+
+	return call.dot
+}
+
+// invalidateDot stops cached dots from being reused after a pipeline change
+func (c *Controller) invalidateDot() {
+	c.dotGeneration.Inc()
+}
+
 func (c *Controller) uploadDebugFiles() {
-	u, err := uploader.New(c.Debug.ToUploadConfig(), "", c.monitor)
+	u, err := uploader.New(c.Debug.ToUploadConfig(), nil, "", config.UploadRetryConfig{}, c.MultipartUpload, c.HostOverrides, c.UploadMetadata(), nil, c.monitor)
 	if err != nil {
 		logger.Errorw("failed to create uploader", err)
 		return
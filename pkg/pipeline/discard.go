@@ -0,0 +1,95 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/tracer"
+)
+
+const stopReasonDiscarded = "discarded"
+
+type discardSink interface {
+	Discard()
+}
+
+// Discard stops the egress without uploading its outputs. Pending uploads are skipped, multipart uploads
+// in progress are aborted, local files are deleted, and the egress ends as aborted.
+// Segments, images and file chunks uploaded before the request are left in storage
+func (c *Controller) Discard(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Pipeline.Discard")
+	defer span.End()
+
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.uploading.IsBroken() {
+		// too late, the outputs are already being uploaded
+		return errors.ErrEgressEnding
+	}
+
+	c.discarded.Once(func() {
+		logger.Infow("discarding egress outputs", "stopReason", stopReasonDiscarded)
+
+		for _, si := range c.sinks {
+			for _, s := range si {
+				if d, ok := s.(discardSink); ok {
+					d.Discard()
+				}
+			}
+		}
+
+		ending := c.eos.IsBroken()
+		c.setStatus(livekit.EgressStatus_EGRESS_ABORTED)
+		c.Info.UpdatedAt = time.Now().UnixNano()
+		if ending {
+			// there is no need to wait for the outputs to be finalized
+			c.stopEOSTimer()
+			go c.p.Stop()
+		} else {
+			c.sendEOS(ctx)
+		}
+	})
+	return nil
+}
+
+// startUploads returns false if the outputs have been discarded. Otherwise, it prevents them from being
+// discarded while they are uploaded
+func (c *Controller) startUploads() bool {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.discarded.IsBroken() {
+		return false
+	}
+	c.uploading.Break()
+	return true
+}
+
+// closeDiscardedSinks waits for sink workers to stop. Discarded sinks close without uploading
+func (c *Controller) closeDiscardedSinks() {
+	for _, si := range c.sinks {
+		for _, s := range si {
+			if err := s.Close(); err != nil {
+				logger.Warnw("failed to close discarded sink", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/protocol/logger"
+)
+
+// checks allowed for closed chunks and segments to be uploaded and deleted before the egress is finalized
+const diskReclaimChecks = 3
+
+// startDiskSpaceMonitor keeps MinFreeDisk bytes free in the local output directories. Below the threshold,
+// open file chunks and segments are closed early, so they are uploaded and removed like any other completed chunk.
+// If that does not free enough space, EOS is sent while the muxers still have room to finalize their outputs
+func (c *Controller) startDiskSpaceMonitor(ctx context.Context) {
+	dirs := c.getLocalDirs()
+	if c.MinFreeDisk <= 0 || len(dirs) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(diskWatchdogInterval)
+		defer ticker.Stop()
+
+		reclaiming := 0
+		for {
+			select {
+			case <-c.closed.Watch():
+				return
+			case <-c.eos.Watch():
+				return
+			case <-ticker.C:
+				dir, free, low := c.lowDiskSpace(dirs)
+				if !low {
+					if reclaiming > 0 {
+						logger.Infow("disk space reclaimed", "checks", reclaiming)
+						reclaiming = 0
+					}
+					continue
+				}
+
+				if reclaiming == 0 && c.splitOutputs() {
+					logger.Warnw("low disk space, closing open chunks", nil, "dir", dir, "free", free, "minFree", c.MinFreeDisk)
+					reclaiming++
+					continue
+				}
+				if reclaiming > 0 && reclaiming < diskReclaimChecks {
+					reclaiming++
+					continue
+				}
+
+				logger.Warnw("disk full, finalizing outputs", nil, "dir", dir, "free", free, "minFree", c.MinFreeDisk)
+				c.onDiskFull(dir, free)
+				c.SendEOS(ctx)
+				return
+			}
+		}
+	}()
+}
+
+// onDiskFull records the disk full error. Info is only written by the pipeline, so the error is set by
+// applyDiskFull once the outputs have been finalized
+func (c *Controller) onDiskFull(dir string, free int64) {
+	c.diskFull.Once(func() {
+		c.diskFullErr = errors.ErrDiskFull(dir, free, c.MinFreeDisk)
+	})
+}
+
+// applyDiskFull fails the egress with the disk full error, unless it already failed
+func (c *Controller) applyDiskFull() {
+	if c.diskFull.IsBroken() {
+		c.setErrorOnce(c.diskFullErr)
+	}
+}
+
+// lowDiskSpace returns the first directory with less than MinFreeDisk bytes available
+func (c *Controller) lowDiskSpace(dirs []string) (string, int64, bool) {
+	for _, dir := range dirs {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(dir, &stat); err != nil {
+			logger.Debugw("could not read disk space", "dir", dir, "error", err)
+			continue
+		}
+		if free := int64(stat.Bavail) * int64(stat.Bsize); free < c.MinFreeDisk {
+			return dir, free, true
+		}
+	}
+	return "", 0, false
+}
+
+// splitOutputs asks each splitmuxsink to close its current file at the next keyframe.
+// It returns false when no output can be split, leaving nothing to reclaim
+func (c *Controller) splitOutputs() bool {
+	var names []string
+	if o := c.GetFileConfig(); o != nil && o.Rotates() {
+		names = append(names, builder.FileSplitMuxSinkName)
+	}
+	if c.GetSegmentConfig() != nil {
+		names = append(names, builder.SegmentSplitMuxSinkName)
+	}
+
+	split := false
+	for _, name := range names {
+		sink, err := c.p.GetElementByName(name)
+		if err != nil {
+			continue
+		}
+		if _, err = sink.Emit("split-now"); err != nil {
+			logger.Warnw("could not split output", err, "sink", name)
+			continue
+		}
+		split = true
+	}
+	return split
+}
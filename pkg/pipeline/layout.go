@@ -0,0 +1,99 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/tracer"
+)
+
+// layoutSource is a source which can navigate to a new page, implemented by the web source
+type layoutSource interface {
+	UpdateLayout(p *config.PipelineConfig) error
+}
+
+// UpdateLayout switches a room composite egress to a new layout or template url, or a web egress to a new url.
+// Chrome navigates to the new page while the encoders and outputs keep running
+func (c *Controller) UpdateLayout(ctx context.Context, layout, webUrl string) error {
+	ctx, span := tracer.Start(ctx, "Pipeline.UpdateLayout")
+	defer span.End()
+
+	src, ok := c.src.(layoutSource)
+	if !ok {
+		return errors.ErrNotSupported("layout updates for sdk egress")
+	}
+	if layout == "" && webUrl == "" {
+		return errors.ErrInvalidInput("layout")
+	}
+	if webUrl != "" {
+		if u, err := url.Parse(webUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.ErrInvalidUrl(webUrl, "must be http or https")
+		}
+	}
+
+	c.layoutMu.Lock()
+	defer c.layoutMu.Unlock()
+
+	if c.Status() != livekit.EgressStatus_EGRESS_ACTIVE || c.eos.IsBroken() {
+		return errors.ErrEgressNotActive
+	}
+
+	prevLayout, prevBaseUrl, prevWebUrl := c.Layout, c.BaseUrl, c.WebUrl
+	switch c.RequestType {
+	case types.RequestTypeRoomComposite:
+		if layout != "" {
+			c.Layout = layout
+		}
+		if webUrl != "" {
+			c.BaseUrl = webUrl
+		}
+	case types.RequestTypeWeb:
+		if layout != "" {
+			return errors.ErrNotSupported("layouts for web egress")
+		}
+		c.WebUrl = webUrl
+	}
+
+	if err := src.UpdateLayout(c.PipelineConfig); err != nil {
+		// chrome is left on the failed page, so navigate back to the previous one
+		c.Layout, c.BaseUrl, c.WebUrl = prevLayout, prevBaseUrl, prevWebUrl
+		if restoreErr := src.UpdateLayout(c.PipelineConfig); restoreErr != nil {
+			logger.Errorw("failed to restore previous layout", restoreErr)
+		}
+		return err
+	}
+
+	switch req := c.Info.Request.(type) {
+	case *livekit.EgressInfo_RoomComposite:
+		req.RoomComposite.Layout = c.Layout
+		if webUrl != "" {
+			req.RoomComposite.CustomBaseUrl = webUrl
+		}
+	case *livekit.EgressInfo_Web:
+		req.Web.Url = c.WebUrl
+	}
+
+	c.Info.UpdatedAt = time.Now().UnixNano()
+	c.updateEgress(ctx)
+	return nil
+}
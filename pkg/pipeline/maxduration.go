@@ -0,0 +1,51 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+const stopReasonMaxDuration = "max_duration"
+
+// Started is closed once the pipeline is playing and the egress has started
+func (c *Controller) Started() <-chan struct{} {
+	return c.playing.Watch()
+}
+
+// OnMaxDuration ends the egress gracefully, reporting it as limit reached rather than complete.
+// It does nothing once EOS has been sent, so a stop that arrived first is reported as requested
+func (c *Controller) OnMaxDuration(ctx context.Context) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.eos.IsBroken() {
+		return
+	}
+
+	c.maxDuration.Once(func() {
+		logger.Infow("max duration reached, stopping egress", "maxDuration", c.MaxDuration, "stopReason", stopReasonMaxDuration)
+
+		switch c.Info.Status {
+		case livekit.EgressStatus_EGRESS_STARTING,
+			livekit.EgressStatus_EGRESS_ACTIVE:
+			c.setStatus(livekit.EgressStatus_EGRESS_LIMIT_REACHED)
+		}
+		c.sendEOS(ctx)
+	})
+}
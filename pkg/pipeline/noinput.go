@@ -0,0 +1,55 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/logger"
+)
+
+const stopReasonNoInput = "no_input"
+
+// startNoInputTimer ends the egress as no input received, without uploading, if no participant media arrives
+// within NoInputTimeout. Sdk sources start on the first track packet and web templates on their start signal.
+// Black video and silence rendered by a template only count with placeholder_input
+func (c *Controller) startNoInputTimer() {
+	if c.NoInputTimeout <= 0 {
+		return
+	}
+
+	var input <-chan struct{} = c.src.StartRecording()
+	if c.PlaceholderCountsAsInput() {
+		input = c.stats.mediaReceived()
+	}
+	if input == nil {
+		return
+	}
+
+	go func() {
+		select {
+		case <-input:
+		case <-c.eos.Watch():
+		case <-c.stopped.Watch():
+		case <-time.After(c.NoInputTimeout):
+			c.noInput.Once(func() {
+				logger.Infow("no input received, stopping egress", "timeout", c.NoInputTimeout, "stopReason", stopReasonNoInput)
+				c.noOutput.Break()
+				c.OnError(errors.ErrNoInputReceived(c.NoInputTimeout))
+			})
+		}
+	}()
+}
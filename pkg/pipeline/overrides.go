@@ -0,0 +1,81 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"github.com/go-gst/go-glib/glib"
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/protocol/logger"
+)
+
+// applyElementOverrides sets the configured properties on elements matching by factory name.
+// Every override must match at least one element, and every property must be writable after construction
+func (c *Controller) applyElementOverrides(p *gstreamer.Pipeline) error {
+	if len(c.ElementOverrides) == 0 {
+		return nil
+	}
+
+	elements, err := p.GetElements()
+	if err != nil {
+		return err
+	}
+
+	matched := make(map[string]bool)
+	for _, e := range elements {
+		factory := e.GetFactory().GetName()
+		properties, ok := c.ElementOverrides[factory]
+		if !ok {
+			continue
+		}
+		matched[factory] = true
+		for property, value := range properties {
+			if err = setElementProperty(e, factory, property, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for factory := range c.ElementOverrides {
+		if !matched[factory] {
+			return errors.ErrInvalidElementOverride(factory, "element not found")
+		}
+	}
+	return nil
+}
+
+func setElementProperty(e *gst.Element, key, property, value string) error {
+	var flags glib.ParameterFlags
+	found := false
+	for _, spec := range e.Class().ListProperties() {
+		if spec.Name() == property {
+			flags, found = spec.Flags(), true
+		}
+		spec.Unref()
+	}
+	switch {
+	case !found:
+		return errors.ErrInvalidElementOverride(key, "unknown property "+property)
+	case flags&glib.ParameterWritable == 0, flags&glib.ParameterConstructOnly != 0:
+		return errors.ErrInvalidElementOverride(key, "property "+property+" is not settable")
+	}
+
+	// values were checked against the property type when the config was parsed
+	logger.Debugw("applying element override", "element", e.GetName(), "property", property, "value", value)
+	e.SetArg(property, value)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// Pause halts output without tearing down the pipeline. The encoders and muxers keep their state,
+// so the same file, playlist or stream continues once resumed
+func (c *Controller) Pause(ctx context.Context) error {
+	return c.setPaused(ctx, true)
+}
+
+// Resume continues output after Pause
+func (c *Controller) Resume(ctx context.Context) error {
+	return c.setPaused(ctx, false)
+}
+
+// Paused returns true while output is halted
+func (c *Controller) Paused() bool {
+	return c.paused.Load()
+}
+
+func (c *Controller) setPaused(ctx context.Context, paused bool) error {
+	if c.SourceType != types.SourceTypeWeb {
+		// track writers would queue media in their app sources while paused
+		return errors.ErrNotSupported("pausing sdk egress")
+	}
+
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.Status() != livekit.EgressStatus_EGRESS_ACTIVE || c.eos.IsBroken() {
+		return errors.ErrEgressNotActive
+	}
+	if c.paused.Load() == paused {
+		return nil
+	}
+
+	if err := c.p.SetPaused(paused); err != nil {
+		return err
+	}
+	c.paused.Store(paused)
+	c.invalidateDot()
+
+	if paused {
+		logger.Infow("egress paused")
+	} else {
+		// no media was expected while paused
+		c.flowExpectedAt.Store(time.Now().UnixNano())
+		logger.Infow("egress resumed")
+	}
+
+	// the egress status has no paused state, the update carries the time of the change
+	c.Info.UpdatedAt = time.Now().UnixNano()
+	c.updateEgress(ctx)
+	return nil
+}
+
+// resumeForEOS resumes a paused pipeline so that EOS can flow through to the muxers.
+// It runs after EOS has been sent, so a concurrent Pause or Resume is rejected
+func (c *Controller) resumeForEOS() {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if !c.paused.Load() {
+		return
+	}
+	if err := c.p.SetPaused(false); err != nil {
+		logger.Errorw("failed to resume pipeline for EOS", err)
+		return
+	}
+	c.paused.Store(false)
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// RequestStop ends the egress like SendEOS, after recording for PostRoll more. The egress reports ending
+// from the request, and a second request during the post-roll ends it immediately
+func (c *Controller) RequestStop(ctx context.Context) {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.PostRoll <= 0 || c.Status() != livekit.EgressStatus_EGRESS_ACTIVE || c.paused.Load() || c.eos.IsBroken() {
+		c.sendEOS(ctx)
+		return
+	}
+
+	logger.Infow("stop requested, recording post-roll", "postRoll", c.PostRoll)
+	c.Info.UpdatedAt = time.Now().UnixNano()
+	c.setStatus(livekit.EgressStatus_EGRESS_ENDING)
+	c.updateEgress(ctx)
+
+	time.AfterFunc(c.PostRoll, func() {
+		c.SendEOS(context.Background())
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/protocol/logger"
+)
+
+// preRollQueue is the output of a pre-roll queue, blocked until recording starts
+type preRollQueue struct {
+	pad   *gst.Pad
+	probe uint64
+	video bool
+
+	// video only, the keyframes entering the queue
+	sinkPad   *gst.Pad
+	keyframes *keyframeHistory
+	kfProbe   uint64
+}
+
+// keyframeHistory holds the timestamps of the keyframes within the pre-roll window
+type keyframeHistory struct {
+	mu     sync.Mutex
+	window time.Duration
+	pts    []time.Duration
+}
+
+func (h *keyframeHistory) add(pts time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// older keyframes have been dropped by the leaky queue
+	i := 0
+	for i < len(h.pts) && h.pts[i] < pts-h.window {
+		i++
+	}
+	h.pts = append(h.pts[i:], pts)
+}
+
+// lastAtOrBefore returns the latest keyframe at or before cutoff
+func (h *keyframeHistory) lastAtOrBefore(cutoff time.Duration) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.pts) - 1; i >= 0; i-- {
+		if h.pts[i] <= cutoff {
+			return h.pts[i], true
+		}
+	}
+	return 0, false
+}
+
+// MarkStart starts recording an egress requested with await_mark_start. Outputs begin with the
+// pre-roll held before the mark
+func (c *Controller) MarkStart(_ context.Context) error {
+	if !c.AwaitMarkStart {
+		return errors.ErrNotAwaitingMarkStart
+	}
+
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.recording.IsBroken() {
+		return errors.ErrRecordingStarted
+	}
+	if c.eos.IsBroken() {
+		return errors.ErrEgressEnding
+	}
+
+	c.markStart.Break()
+	return nil
+}
+
+// blockPreRoll blocks the output of each pre-roll queue. Media keeps flowing in from the time inputs
+// are connected, with the oldest dropped beyond the pre-roll window
+func (c *Controller) blockPreRoll(p *gstreamer.Pipeline) error {
+	if !c.StartGated() {
+		c.recording.Break()
+		return nil
+	}
+
+	elements, err := p.GetElements()
+	if err != nil {
+		return err
+	}
+	c.blockPreRollQueues(elements)
+	return nil
+}
+
+// blockPreRollQueues blocks the pre-roll queues within elements, and breaks preRollFlowing once media reaches any of them
+func (c *Controller) blockPreRollQueues(elements []*gst.Element) {
+	for _, e := range elements {
+		name := e.GetName()
+		if !strings.HasSuffix(name, builder.PreRollQueueSuffix) {
+			continue
+		}
+		pad := e.GetStaticPad("src")
+		probe := pad.AddProbe(gst.PadProbeTypeBlockDownstream, func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+			return gst.PadProbeOK
+		})
+		q := &preRollQueue{
+			pad:   pad,
+			probe: probe,
+			video: strings.HasPrefix(name, "video"),
+		}
+		if q.video {
+			q.keyframes = &keyframeHistory{window: c.PreRollWindow()}
+			q.sinkPad = e.GetStaticPad("sink")
+			q.kfProbe = q.sinkPad.AddProbe(gst.PadProbeTypeBuffer, q.trackKeyframes)
+		}
+		e.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+			c.preRollFlowing.Break()
+			return gst.PadProbeRemove
+		})
+		c.preRoll = append(c.preRoll, q)
+	}
+}
+
+// awaitRecordingStart starts recording once media reaches the pre-roll queues, at the web start signal if
+// there is one, followed by MarkStart with await_mark_start. It can't wait for the pipeline to play, since
+// async sinks only complete the change to playing once the queues are released and their first buffer arrives
+func (c *Controller) awaitRecordingStart(start chan struct{}) {
+	signals := []<-chan struct{}{c.preRollFlowing.Watch()}
+	if start != nil {
+		signals = append(signals, start)
+	}
+	if c.AwaitMarkStart {
+		signals = append(signals, c.markStart.Watch())
+	}
+	for _, signal := range signals {
+		select {
+		case <-c.stopped.Watch():
+			return
+		case <-signal:
+		}
+	}
+
+	c.startRecording()
+}
+
+func (q *preRollQueue) trackKeyframes(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+	buffer := info.GetBuffer()
+	if buffer == nil || buffer.HasFlags(gst.BufferFlagDeltaUnit) {
+		return gst.PadProbeOK
+	}
+	if pts := buffer.PresentationTimestamp().AsDuration(); pts != nil {
+		q.keyframes.add(*pts)
+	}
+	return gst.PadProbeOK
+}
+
+// startRecording releases the pre-roll queues. Video starts at the last keyframe at or before the
+// pre-roll, and audio and the egress start time are aligned to it
+func (c *Controller) startRecording() {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if c.eos.IsBroken() {
+		return
+	}
+
+	c.recording.Once(func() {
+		runningTime := c.callbacks.RunningTime()
+		start := runningTime - c.PreRoll
+		cutoff := start
+		for _, q := range c.preRoll {
+			if !q.video {
+				continue
+			}
+			q.sinkPad.RemoveProbe(q.kfProbe)
+			// without a held keyframe, video starts at the next one
+			if kf, ok := q.keyframes.lastAtOrBefore(cutoff); ok {
+				start = min(start, kf)
+			}
+		}
+		start = max(start, 0)
+
+		for _, q := range c.preRoll {
+			q.pad.AddProbe(gst.PadProbeTypeBuffer, dropBeforePreRoll(start, q.video))
+			q.pad.RemoveProbe(q.probe)
+		}
+
+		if fileSink := c.getFileSink(); fileSink != nil {
+			fileSink.SetRecordingStart(start)
+		}
+
+		// less than the pre-roll is held when media started flowing more recently
+		preRoll := runningTime - start
+		logger.Infow("recording started", "preRoll", preRoll)
+		c.updateStartTime(time.Now().Add(-preRoll).UnixNano())
+	})
+}
+
+// dropBeforePreRoll drops buffers before the recording start, and video until its first keyframe, then removes itself
+func dropBeforePreRoll(cutoff time.Duration, video bool) gst.PadProbeCallback {
+	return func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		buffer := info.GetBuffer()
+		if buffer == nil {
+			return gst.PadProbeOK
+		}
+		if pts := buffer.PresentationTimestamp().AsDuration(); pts != nil && *pts < cutoff {
+			return gst.PadProbeDrop
+		}
+		if video && buffer.HasFlags(gst.BufferFlagDeltaUnit) {
+			return gst.PadProbeDrop
+		}
+		return gst.PadProbeRemove
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/logger"
+)
+
+const streamReconnectPollInterval = time.Second
+
+// reconnectStream stops a dropped stream and restarts it with exponential backoff, while other outputs keep running.
+// It returns false if the stream should be removed instead, because it never connected or has run out of attempts
+func (c *Controller) reconnectStream(name string, streamErr error) bool {
+	if c.StreamReconnect.MaxAttempts < 0 {
+		return false
+	}
+
+	url, err := c.streamBin.GetStreamUrl(name)
+	if err != nil {
+		return false
+	}
+	redacted, _ := config.RedactStreamUrl(url)
+
+	attempt, connected, err := c.streamBin.DisconnectStream(name)
+	if err != nil {
+		logger.Errorw("failed to disconnect stream", err, "url", redacted)
+		return false
+	}
+	if !connected {
+		// unable to connect, probably a bad stream key or url
+		return false
+	}
+	if attempt > c.StreamReconnect.MaxAttempts {
+		logger.Warnw("stream failed permanently", streamErr, "url", redacted, "attempts", attempt-1)
+		return false
+	}
+	if attempt == 1 {
+		logger.Warnw("stream disconnected", streamErr, "url", redacted)
+		c.setStreamError(url, streamErr.Error())
+	}
+
+	delay := c.StreamReconnect.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay = min(delay*2, c.StreamReconnect.MaxDelay)
+	}
+	logger.Infow("reconnecting stream", "url", redacted, "attempt", attempt, "delay", delay)
+
+	time.AfterFunc(delay, func() {
+		if c.eos.IsBroken() {
+			return
+		}
+		if err := c.streamBin.ReconnectStream(name); err != nil {
+			// removed while waiting
+			logger.Warnw("failed to reconnect stream", err, "url", redacted)
+			return
+		}
+		c.watchReconnect(name, url, attempt)
+	})
+	return true
+}
+
+// watchReconnect reports the stream as up once the server acknowledges data. A failed attempt
+// is reported as another error by the sink, which starts the next attempt
+func (c *Controller) watchReconnect(name, url string, attempt int) {
+	ticker := time.NewTicker(streamReconnectPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.eos.Watch():
+			return
+		case <-ticker.C:
+			reconnected, current := c.streamBin.StreamReconnected(name, attempt)
+			if !current {
+				return
+			}
+			if reconnected {
+				redacted, _ := config.RedactStreamUrl(url)
+				logger.Infow("stream reconnected", "url", redacted, "attempts", attempt)
+				c.setStreamError(url, "")
+				return
+			}
+		}
+	}
+}
+
+// setStreamError reports a stream as down while it reconnects, or clears the error once it is back up.
+// The stream stays active until it runs out of attempts
+func (c *Controller) setStreamError(url, streamErr string) {
+	c.mu.Lock()
+	streamInfo := c.GetStreamConfig().StreamInfo[url]
+	if streamInfo == nil {
+		c.mu.Unlock()
+		return
+	}
+	streamInfo.Error = streamErr
+	c.mu.Unlock()
+
+	c.Info.UpdatedAt = time.Now().UnixNano()
+	c.updateEgress(context.Background())
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/pipeline/source"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// depayloaders and decoders inside a track's bin, whose errors are usually caused by corrupt
+// media around a publisher rejoining
+var recoverableElements = map[string]lksdk.TrackKind{
+	"GstRtpH264Depay": lksdk.TrackKindVideo,
+	"GstRtpVP8Depay":  lksdk.TrackKindVideo,
+	"GstRtpVP9Depay":  lksdk.TrackKindVideo,
+	"avdec_h264":      lksdk.TrackKindVideo,
+	"GstVP8Dec":       lksdk.TrackKindVideo,
+	"GstVP9Dec":       lksdk.TrackKindVideo,
+	"GstRTPOpusDepay": lksdk.TrackKindAudio,
+	"GstOpusDec":      lksdk.TrackKindAudio,
+}
+
+// the bins holding the element that posted an error, and the element's type and name:
+// gstvpxdec.c(621): gst_vpx_dec_handle_frame (): /GstPipeline:pipeline/GstBin:video/GstBin:TR_abc/GstVP8Dec:vp8dec0:\nFailed to decode frame
+var trackElementRegExp = regexp.MustCompile("/GstPipeline:pipeline((?:/GstBin:[^/:]+)+)/([^/:]+):[^/:\n]+(?::\n|:?$)")
+
+// parseTrackError returns the track whose bin holds the element that posted an error, and the kind of media
+// the element handles. ok is false unless the error came from a recoverable element within a track's bin
+func parseTrackError(debug string) (trackID, element string, kind lksdk.TrackKind, ok bool) {
+	match := trackElementRegExp.FindStringSubmatch(debug)
+	if match == nil {
+		return "", "", "", false
+	}
+	element = match[2]
+	if kind, ok = recoverableElements[element]; !ok {
+		return "", element, "", false
+	}
+
+	// the innermost track bin, since elements may be nested in bins of their own
+	bins := strings.Split(strings.TrimPrefix(match[1], "/GstBin:"), "/GstBin:")
+	for i := len(bins) - 1; i >= 0; i-- {
+		if strings.HasPrefix(bins[i], utils.TrackPrefix) {
+			return bins[i], element, kind, true
+		}
+	}
+	return "", element, "", false
+}
+
+// recoverTrack rebuilds the bin of a track whose decoding elements failed, up to ElementRecovery.MaxAttempts
+// times per track. It returns false if the error should fail the egress
+func (c *Controller) recoverTrack(gErr *gst.GError) bool {
+	if c.ElementRecovery.MaxAttempts < 0 || c.eos.IsBroken() {
+		return false
+	}
+	src, ok := c.src.(*source.SDKSource)
+	if !ok {
+		return false
+	}
+
+	trackID, element, kind, ok := parseTrackError(gErr.DebugString())
+	if !ok || (kind == lksdk.TrackKindVideo && !c.VideoDecoding) {
+		// passthrough video has no selector to hold the output while the bin is replaced
+		return false
+	}
+
+	attempt, ok := c.nextRecovery(trackID)
+	if !ok {
+		logger.Warnw("element recovery failed permanently", gErr, "trackID", trackID, "attempts", attempt-1)
+		return false
+	}
+
+	logger.Warnw("recovering track", gErr, "trackID", trackID, "element", element, "attempt", attempt)
+	if err := src.ResetTrack(trackID); err != nil {
+		logger.Errorw("failed to recover track", err, "trackID", trackID)
+		return false
+	}
+
+	c.Info.UpdatedAt = time.Now().UnixNano()
+	c.updateEgress(context.Background())
+	return true
+}
+
+// nextRecovery counts a recovery of the track, returning the attempt and whether it is within ElementRecovery.MaxAttempts
+func (c *Controller) nextRecovery(trackID string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.recoveries == nil {
+		c.recoveries = make(map[string]int)
+	}
+	c.recoveries[trackID]++
+	attempt := c.recoveries[trackID]
+	return attempt, attempt <= c.ElementRecovery.MaxAttempts
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+func TestParseTrackError(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		debug   string
+		trackID string
+		element string
+		kind    lksdk.TrackKind
+		ok      bool
+	}{
+		{
+			name:    "vp8 decoder",
+			debug:   "../ext/vpx/gstvpxdec.c(621): gst_vpx_dec_handle_frame (): /GstPipeline:pipeline/GstBin:video/GstBin:TR_VCabc123/GstVP8Dec:vp8dec0:\nFailed to decode frame",
+			trackID: "TR_VCabc123",
+			element: "GstVP8Dec",
+			kind:    lksdk.TrackKindVideo,
+			ok:      true,
+		},
+		{
+			name:    "h264 depayloader",
+			debug:   "../gst/rtp/gstrtph264depay.c(1290): gst_rtp_h264_depay_process (): /GstPipeline:pipeline/GstBin:video/GstBin:TR_VCabc123/GstRtpH264Depay:rtph264depay0:\nNAL unit type 26 not supported yet",
+			trackID: "TR_VCabc123",
+			element: "GstRtpH264Depay",
+			kind:    lksdk.TrackKindVideo,
+			ok:      true,
+		},
+		{
+			name:    "libav decoder",
+			debug:   "../ext/libav/gstavviddec.c(2071): gst_ffmpegviddec_handle_frame (): /GstPipeline:pipeline/GstBin:video/GstBin:TR_VCabc123/avdec_h264:avdec_h264-0:\nFailed to send data for decoding",
+			trackID: "TR_VCabc123",
+			element: "avdec_h264",
+			kind:    lksdk.TrackKindVideo,
+			ok:      true,
+		},
+		{
+			name:    "opus decoder without a message",
+			debug:   "../ext/opus/gstopusdec.c(702): opus_dec_chain_parse_data (): /GstPipeline:pipeline/GstBin:audio/GstBin:TR_AMxyz789/GstOpusDec:opusdec0",
+			trackID: "TR_AMxyz789",
+			element: "GstOpusDec",
+			kind:    lksdk.TrackKindAudio,
+			ok:      true,
+		},
+		{
+			name:    "nested bin within a track",
+			debug:   "../ext/vpx/gstvpxdec.c(621): gst_vpx_dec_handle_frame (): /GstPipeline:pipeline/GstBin:video/GstBin:TR_VCabc123/GstBin:decoder/GstVP9Dec:vp9dec0:\nFailed to decode frame",
+			trackID: "TR_VCabc123",
+			element: "GstVP9Dec",
+			kind:    lksdk.TrackKindVideo,
+			ok:      true,
+		},
+		{
+			name:    "decoder outside a track",
+			debug:   "../ext/vpx/gstvpxdec.c(621): gst_vpx_dec_handle_frame (): /GstPipeline:pipeline/GstBin:video/GstVP8Dec:vp8dec0:\nFailed to decode frame",
+			element: "GstVP8Dec",
+		},
+		{
+			name:    "unrecoverable element in a track",
+			debug:   "../libs/gst/app/gstappsrc.c(2918): gst_app_src_push_internal (): /GstPipeline:pipeline/GstBin:video/GstBin:TR_VCabc123/GstAppSrc:app_TR_VCabc123:\nstreaming stopped, reason not-negotiated (-4)",
+			element: "GstAppSrc",
+		},
+		{
+			name:    "stream sink",
+			debug:   "../gst/rtmp2/gstrtmp2sink.c(1180): error_callback (): /GstPipeline:pipeline/GstBin:stream/GstBin:abc123/GstRtmp2Sink:rtmp2sink_abc123:\nConnection error",
+			element: "GstRtmp2Sink",
+		},
+		{
+			name:  "pipeline element",
+			debug: "../plugins/elements/gstqueue.c(990): gst_queue_handle_sink_event (): /GstPipeline:pipeline/GstQueue:queue0:\nInternal data stream error",
+		},
+		{
+			name:  "unparseable",
+			debug: "GStreamer error: clock problem.",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trackID, element, kind, ok := parseTrackError(test.debug)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.trackID, trackID)
+			require.Equal(t, test.element, element)
+			require.Equal(t, test.kind, kind)
+		})
+	}
+}
+
+func TestNextRecovery(t *testing.T) {
+	c := &Controller{PipelineConfig: &config.PipelineConfig{}}
+	c.ElementRecovery.MaxAttempts = 2
+
+	// the cap applies to each track separately
+	for attempt := 1; attempt <= 2; attempt++ {
+		n, ok := c.nextRecovery("TR_VCabc123")
+		require.True(t, ok)
+		require.Equal(t, attempt, n)
+	}
+	n, ok := c.nextRecovery("TR_VCabc123")
+	require.False(t, ok)
+	require.Equal(t, 3, n)
+
+	n, ok = c.nextRecovery("TR_AMxyz789")
+	require.True(t, ok)
+	require.Equal(t, 1, n)
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const segmentUpdateTimeout = time.Second * 5
+
+// segmentUpdate is posted to the segment_updates endpoint for each uploaded segment
+type segmentUpdate struct {
+	EgressID   string  `json:"egress_id"`
+	Playlist   string  `json:"playlist"`
+	Filename   string  `json:"filename"`
+	Sequence   uint64  `json:"sequence"`
+	Duration   float64 `json:"duration"`    // seconds
+	UploadedAt int64   `json:"uploaded_at"` // unix nanoseconds
+}
+
+// onSegmentUploaded queues a notification without waiting, dropping it if earlier notifications are still being sent
+func (c *Controller) onSegmentUploaded(filename string, sequence uint64, duration time.Duration, uploadedAt time.Time) {
+	update := &segmentUpdate{
+		EgressID:   c.Info.EgressId,
+		Filename:   filename,
+		Sequence:   sequence,
+		Duration:   duration.Seconds(),
+		UploadedAt: uploadedAt.UnixNano(),
+	}
+	if o := c.GetSegmentConfig(); o != nil {
+		update.Playlist = o.SegmentsInfo.PlaylistName
+	}
+
+	select {
+	case c.segmentUpdates <- update:
+	default:
+		logger.Warnw("segment update queue full, dropping update", nil, "filename", filename, "sequence", sequence)
+	}
+}
+
+// startSegmentUpdates sends queued notifications until the egress is closed.
+// Each one sends the egress info, with the latest segment totals, to the io service, and posts the segment to the endpoint if configured.
+func (c *Controller) startSegmentUpdates(ctx context.Context) {
+	if c.segmentUpdates == nil {
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case <-c.closed.Watch():
+				return
+			case update := <-c.segmentUpdates:
+				if c.SegmentUpdates.Endpoint != "" {
+					if err := postSegmentUpdate(ctx, c.SegmentUpdates.Endpoint, update); err != nil {
+						logger.Warnw("failed to post segment update", err, "filename", update.Filename)
+					}
+				}
+				if !c.closed.IsBroken() {
+					updateCtx, cancel := context.WithTimeout(ctx, segmentUpdateTimeout)
+					c.Info.UpdatedAt = time.Now().UnixNano()
+					c.updateEgress(updateCtx)
+					cancel()
+				}
+			}
+		}
+	}()
+}
+
+func postSegmentUpdate(ctx context.Context, endpoint string, update *segmentUpdate) error {
+	b, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, segmentUpdateTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("segment update endpoint returned %s", res.Status)
+	}
+	return nil
+}
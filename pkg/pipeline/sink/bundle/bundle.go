@@ -0,0 +1,117 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+// Part is a local file stored in the bundle under Name
+type Part struct {
+	LocalFilepath string
+	Name          string
+}
+
+// Write packages parts into a tar or zip archive, in order
+func Write(filepath string, format types.BundleFormat, parts []Part) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case types.BundleFormatTar:
+		err = writeTar(f, parts)
+	case types.BundleFormatZip:
+		err = writeZip(f, parts)
+	default:
+		err = fmt.Errorf("invalid bundle format %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeTar(w io.Writer, parts []Part) error {
+	tw := tar.NewWriter(w)
+	for _, part := range parts {
+		err := addPart(part, func(info os.FileInfo) (io.Writer, error) {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return nil, err
+			}
+			header.Name = part.Name
+			return tw, tw.WriteHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeZip(w io.Writer, parts []Part) error {
+	zw := zip.NewWriter(w)
+	for _, part := range parts {
+		err := addPart(part, func(info os.FileInfo) (io.Writer, error) {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return nil, err
+			}
+			header.Name = part.Name
+			// media is already compressed
+			header.Method = zip.Store
+			return zw.CreateHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addPart(part Part, create func(os.FileInfo) (io.Writer, error)) error {
+	f, err := os.Open(part.LocalFilepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	w, err := create(info)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func OutputType(format types.BundleFormat) types.OutputType {
+	if format == types.BundleFormatZip {
+		return types.OutputTypeZip
+	}
+	return types.OutputTypeTar
+}
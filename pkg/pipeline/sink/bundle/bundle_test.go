@@ -0,0 +1,66 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	parts := []Part{
+		{LocalFilepath: path.Join(dir, "local.mp4"), Name: "room.mp4"},
+		{LocalFilepath: path.Join(dir, "local.mp4.json"), Name: "room.mp4.json"},
+	}
+	require.NoError(t, os.WriteFile(parts[0].LocalFilepath, []byte("media"), 0644))
+	require.NoError(t, os.WriteFile(parts[1].LocalFilepath, []byte("{}"), 0644))
+
+	tarPath := path.Join(dir, "room.tar")
+	require.NoError(t, Write(tarPath, types.BundleFormatTar, parts))
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for _, expected := range []struct{ name, content string }{{"room.mp4", "media"}, {"room.mp4.json", "{}"}} {
+		header, err := tr.Next()
+		require.NoError(t, err)
+		require.Equal(t, expected.name, header.Name)
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		require.Equal(t, expected.content, string(b))
+	}
+	_, err = tr.Next()
+	require.Equal(t, io.EOF, err)
+
+	zipPath := path.Join(dir, "room.zip")
+	require.NoError(t, Write(zipPath, types.BundleFormatZip, parts))
+	zr, err := zip.OpenReader(zipPath)
+	require.NoError(t, err)
+	defer zr.Close()
+	require.Len(t, zr.File, 2)
+	require.Equal(t, "room.mp4", zr.File[0].Name)
+	require.Equal(t, "room.mp4.json", zr.File[1].Name)
+
+	require.Error(t, Write(path.Join(dir, "room.rar"), "rar", parts))
+}
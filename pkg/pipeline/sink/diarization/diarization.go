@@ -0,0 +1,133 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diarization
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Interval is a span of the recording in which a participant was an active speaker
+type Interval struct {
+	Identity string `json:"identity"`
+	Start    int64  `json:"start"`   // nanoseconds from the start of the recording
+	End      int64  `json:"end"`     // nanoseconds from the start of the recording
+	Overlap  bool   `json:"overlap"` // another participant was speaking during part of the interval
+}
+
+type Timeline struct {
+	Intervals []Interval `json:"intervals"`
+}
+
+type span struct {
+	identity   string
+	start, end int64
+}
+
+// Tracker records speaking intervals from active speaker updates while the egress is running
+type Tracker struct {
+	mu       sync.Mutex
+	speaking map[string]int64
+	spans    []span
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		speaking: make(map[string]int64),
+	}
+}
+
+// Update takes the full set of active speakers at a unix nanosecond time.
+// Participants missing from the set stop speaking, and new ones start.
+func (t *Tracker) Update(identities []string, at int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	active := make(map[string]struct{}, len(identities))
+	for _, identity := range identities {
+		active[identity] = struct{}{}
+		if _, ok := t.speaking[identity]; !ok {
+			t.speaking[identity] = at
+		}
+	}
+	for identity, start := range t.speaking {
+		if _, ok := active[identity]; !ok {
+			t.spans = append(t.spans, span{identity: identity, start: start, end: at})
+			delete(t.speaking, identity)
+		}
+	}
+}
+
+// Timeline returns intervals clipped to startedAt and endedAt, relative to startedAt.
+// Intervals still open are closed at endedAt, and a participant's intervals separated
+// by less than mergeGap are joined.
+func (t *Tracker) Timeline(startedAt, endedAt int64, mergeGap time.Duration) *Timeline {
+	t.mu.Lock()
+	spans := make([]span, len(t.spans), len(t.spans)+len(t.speaking))
+	copy(spans, t.spans)
+	for identity, start := range t.speaking {
+		spans = append(spans, span{identity: identity, start: start, end: endedAt})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].identity < spans[j].identity
+	})
+
+	intervals := make([]Interval, 0, len(spans))
+	last := make(map[string]int)
+	for _, s := range spans {
+		start, end := max(s.start, startedAt), min(s.end, endedAt)
+		if start >= end {
+			continue
+		}
+
+		if i, ok := last[s.identity]; ok && start-(intervals[i].End+startedAt) < int64(mergeGap) {
+			intervals[i].End = max(intervals[i].End, end-startedAt)
+			continue
+		}
+		last[s.identity] = len(intervals)
+		intervals = append(intervals, Interval{
+			Identity: s.identity,
+			Start:    start - startedAt,
+			End:      end - startedAt,
+		})
+	}
+
+	for i := range intervals {
+		for j := i + 1; j < len(intervals) && intervals[j].Start < intervals[i].End; j++ {
+			if intervals[j].Identity != intervals[i].Identity {
+				intervals[i].Overlap = true
+				intervals[j].Overlap = true
+			}
+		}
+	}
+
+	return &Timeline{Intervals: intervals}
+}
+
+func (t *Timeline) Write(filepath string) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath, b, 0644)
+}
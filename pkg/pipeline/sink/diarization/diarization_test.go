@@ -0,0 +1,43 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diarization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	startedAt := int64(time.Hour)
+	at := func(d time.Duration) int64 { return startedAt + int64(d) }
+
+	tracker := NewTracker()
+	tracker.Update([]string{"alice"}, at(-time.Second))
+	tracker.Update([]string{"alice", "bob"}, at(2*time.Second))
+	tracker.Update([]string{"bob"}, at(3*time.Second))
+	tracker.Update(nil, at(4*time.Second))
+	tracker.Update([]string{"bob"}, at(4*time.Second+200*time.Millisecond))
+	tracker.Update(nil, at(5*time.Second))
+	tracker.Update([]string{"alice"}, at(7*time.Second))
+
+	timeline := tracker.Timeline(startedAt, at(8*time.Second), 500*time.Millisecond)
+	require.Equal(t, []Interval{
+		{Identity: "alice", Start: 0, End: int64(3 * time.Second), Overlap: true},
+		{Identity: "bob", Start: int64(2 * time.Second), End: int64(5 * time.Second), Overlap: true},
+		{Identity: "alice", Start: int64(7 * time.Second), End: int64(8 * time.Second)},
+	}, timeline.Intervals)
+}
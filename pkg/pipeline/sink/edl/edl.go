@@ -0,0 +1,98 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package edl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Marker is a notable moment in the recording
+type Marker struct {
+	Time    time.Duration // pipeline running time when the event was received
+	Label   string
+	Comment string
+}
+
+// List collects markers while the egress is running
+type List struct {
+	mu      sync.Mutex
+	markers []Marker
+}
+
+func (l *List) Add(m Marker) {
+	l.mu.Lock()
+	l.markers = append(l.markers, m)
+	l.mu.Unlock()
+}
+
+// Write creates a CMX 3600 edl with a single frame event for each marker between the start and end running times.
+// Timecodes are relative to start, rounded down to the frame the event was received in.
+func (l *List) Write(filepath, title, clipName string, start, end time.Duration, framerate int32) error {
+	if framerate <= 0 {
+		return fmt.Errorf("invalid framerate %d", framerate)
+	}
+
+	l.mu.Lock()
+	markers := make([]Marker, len(l.markers))
+	copy(markers, l.markers)
+	l.mu.Unlock()
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].Time < markers[j].Time })
+
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	_, _ = fmt.Fprintf(w, "TITLE: %s\nFCM: NON-DROP FRAME\n\n", title)
+
+	event := 0
+	for _, m := range markers {
+		if m.Time < start || m.Time >= end {
+			continue
+		}
+		event++
+
+		frame := int64(m.Time-start) * int64(framerate) / int64(time.Second)
+		in, out := timecode(frame, framerate), timecode(frame+1, framerate)
+		_, _ = fmt.Fprintf(w, "%03d  AX       V     C        %s %s %s %s\n", event, in, out, in, out)
+		_, _ = fmt.Fprintf(w, "* FROM CLIP NAME: %s\n", clipName)
+		if m.Comment != "" {
+			_, _ = fmt.Fprintf(w, "* COMMENT: %s: %s\n\n", m.Label, sanitize(m.Comment))
+		} else {
+			_, _ = fmt.Fprintf(w, "* COMMENT: %s\n\n", m.Label)
+		}
+	}
+
+	return w.Flush()
+}
+
+func timecode(frame int64, framerate int32) string {
+	fps := int64(framerate)
+	seconds := frame / fps
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60, frame%fps)
+}
+
+// sanitize keeps comments on a single line
+func sanitize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
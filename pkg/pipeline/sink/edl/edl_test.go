@@ -0,0 +1,46 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package edl
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	start := time.Second * 5
+	l := &List{}
+	l.Add(Marker{Time: start + 90*time.Second + 500*time.Millisecond, Label: "Screen share", Comment: "bob"})
+	l.Add(Marker{Time: start + time.Second + 110*time.Millisecond, Label: "Speaker", Comment: "alice"})
+	l.Add(Marker{Time: start - time.Second, Label: "Speaker", Comment: "before start"})
+	l.Add(Marker{Time: start + 2*time.Minute, Label: "Highlight", Comment: "after end"})
+
+	filepath := path.Join(t.TempDir(), "test.edl")
+	require.NoError(t, l.Write(filepath, "room", "room.mp4", start, start+2*time.Minute, 30))
+
+	b, err := os.ReadFile(filepath)
+	require.NoError(t, err)
+	require.Equal(t, "TITLE: room\nFCM: NON-DROP FRAME\n\n"+
+		"001  AX       V     C        00:00:01:03 00:00:01:04 00:00:01:03 00:00:01:04\n"+
+		"* FROM CLIP NAME: room.mp4\n"+
+		"* COMMENT: Speaker: alice\n\n"+
+		"002  AX       V     C        00:01:30:15 00:01:30:16 00:01:30:15 00:01:30:16\n"+
+		"* FROM CLIP NAME: room.mp4\n"+
+		"* COMMENT: Screen share: bob\n\n", string(b))
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	KeySize = 16
+
+	publishTimeout = time.Second * 10
+)
+
+// Key is an AES-128 segment key, published before any segment encrypted with it
+type Key struct {
+	Filename string // relative to the playlist
+	URI      string // written to EXT-X-KEY tags
+	key      []byte
+}
+
+func NewKey(filename, uri string) (*Key, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Filename: filename,
+		URI:      uri,
+		key:      key,
+	}, nil
+}
+
+// Write saves the key in the raw 16 byte format players expect from a key uri
+func (k *Key) Write(filepath string) error {
+	return os.WriteFile(filepath, k.key, 0600)
+}
+
+type publishRequest struct {
+	EgressID string `json:"egress_id"`
+	URI      string `json:"uri"`
+	Key      []byte `json:"key"` // base64 encoded
+}
+
+// Publish posts the key to a key server, which must serve it at the key uri
+func (k *Key) Publish(endpoint, egressID string) error {
+	b, err := json.Marshal(&publishRequest{
+		EgressID: egressID,
+		URI:      k.URI,
+		Key:      k.key,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("key endpoint returned %s", res.Status)
+	}
+	return nil
+}
+
+// EncryptFile encrypts a segment in place with AES-128-CBC and PKCS7 padding.
+// The IV is the segment's media sequence number, as no IV attribute is written to the playlist.
+func (k *Key) EncryptFile(filepath string, sequence uint64) error {
+	b, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return err
+	}
+
+	padding := aes.BlockSize - len(b)%aes.BlockSize
+	b = append(b, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	cipher.NewCBCEncrypter(block, IV(sequence)).CryptBlocks(b, b)
+	return os.WriteFile(filepath, b, 0644)
+}
+
+// IV returns the 128-bit big-endian representation of a media sequence number
+func IV(sequence uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], sequence)
+	return iv
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptFile(t *testing.T) {
+	k, err := NewKey("playlist_00000.key", "playlist_00000.key")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	keyPath := path.Join(dir, k.Filename)
+	require.NoError(t, k.Write(keyPath))
+	key, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+	require.Len(t, key, KeySize)
+
+	segment := make([]byte, 188*7)
+	for i := range segment {
+		segment[i] = byte(i)
+	}
+	segmentPath := path.Join(dir, "playlist_00003.ts")
+	require.NoError(t, os.WriteFile(segmentPath, segment, 0644))
+	require.NoError(t, k.EncryptFile(segmentPath, 3))
+
+	encrypted, err := os.ReadFile(segmentPath)
+	require.NoError(t, err)
+	require.Len(t, encrypted, len(segment)+aes.BlockSize-len(segment)%aes.BlockSize)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, IV(3)).CryptBlocks(decrypted, encrypted)
+
+	padding := int(decrypted[len(decrypted)-1])
+	require.Equal(t, segment, decrypted[:len(decrypted)-padding])
+}
+
+func TestUploadEncryption(t *testing.T) {
+	k, err := NewUploadKey(bytes.Repeat([]byte{7}, UploadKeySize))
+	require.NoError(t, err)
+	_, err = NewUploadKey(make([]byte, KeySize))
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	for _, size := range []int{0, 100, UploadChunkSize, UploadChunkSize*2 + 1} {
+		plaintext := make([]byte, size)
+		for i := range plaintext {
+			plaintext[i] = byte(i)
+		}
+		src := path.Join(dir, "recording.mp4")
+		dst := path.Join(dir, "recording.mp4.enc")
+		require.NoError(t, os.WriteFile(src, plaintext, 0644))
+
+		sealed, err := k.EncryptFile(src, dst)
+		require.NoError(t, err)
+		encrypted, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		chunks := size/UploadChunkSize + 1
+		if size > 0 && size%UploadChunkSize == 0 {
+			chunks--
+		}
+		require.Len(t, encrypted, size+chunks*tagSize)
+		require.Equal(t, encrypted[len(encrypted)-tagSize:], sealed.Tag)
+
+		metadata := k.Metadata(sealed)
+		iv, err := base64.StdEncoding.DecodeString(metadata[MetadataIV])
+		require.NoError(t, err)
+
+		decrypted := &bytes.Buffer{}
+		require.NoError(t, k.Decrypt(decrypted, bytes.NewReader(encrypted), iv))
+		require.True(t, bytes.Equal(plaintext, decrypted.Bytes()))
+
+		if size > UploadChunkSize {
+			// dropping the final chunk is detected
+			truncated := encrypted[:UploadChunkSize+tagSize]
+			require.Error(t, k.Decrypt(&bytes.Buffer{}, bytes.NewReader(truncated), iv))
+		}
+	}
+}
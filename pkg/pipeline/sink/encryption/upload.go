@@ -0,0 +1,275 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+const (
+	UploadKeySize   = 32
+	UploadChunkSize = 64 * 1024
+	UploadAlgorithm = "AES-256-GCM-STREAM"
+
+	noncePrefixSize = 7
+	tagSize         = 16
+
+	// object metadata keys, without separators other than underscores so that every storage provider accepts them
+	MetadataAlgorithm  = "encryption"
+	MetadataIV         = "encryption_iv"
+	MetadataTag        = "encryption_tag"
+	MetadataChunkSize  = "encryption_chunk_size"
+	MetadataKeyID      = "encryption_key_id"
+	MetadataWrappedKey = "encryption_wrapped_key"
+)
+
+var errTruncated = errors.New("encrypted file is truncated")
+
+// UploadKey is an AES-256 data key used for every file and segment upload of an egress.
+// Files are split into chunks, each sealed with its own auth tag, so that they can be encrypted and
+// decrypted without holding them in memory. The nonce of each chunk is the file's random IV, followed by
+// the chunk index and a flag marking the final chunk, which makes truncation and reordering detectable.
+type UploadKey struct {
+	KeyID      string // kms key id, or a fingerprint of a customer supplied key
+	WrappedKey []byte // data key encrypted by kms, nil for customer supplied keys
+	aead       cipher.AEAD
+}
+
+// UploadEncryption describes how uploaded objects were encrypted. It is written to the manifest, and
+// along with the IV in each object's metadata, is enough to decrypt the outputs given the key.
+type UploadEncryption struct {
+	Algorithm  string `json:"algorithm"`
+	ChunkSize  int    `json:"chunk_size"`
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key,omitempty"` // base64 encoded
+}
+
+// Sealed holds the per file values needed for decryption
+type Sealed struct {
+	IV  []byte
+	Tag []byte // auth tag of the final chunk
+}
+
+// NewUploadKey uses a customer supplied 256-bit key
+func NewUploadKey(key []byte) (*UploadKey, error) {
+	if len(key) != UploadKeySize {
+		return nil, errors.New("upload encryption key must be 32 bytes")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := sha256.Sum256(key)
+	return &UploadKey{
+		KeyID: "sha256:" + hex.EncodeToString(fingerprint[:8]),
+		aead:  aead,
+	}, nil
+}
+
+// NewKMSUploadKey generates a data key with aws kms. Only the wrapped key is recorded, which kms can
+// decrypt later for anyone with access to the kms key.
+func NewKMSUploadKey(keyID, region string) (*UploadKey, error) {
+	awsConfig := aws.NewConfig()
+	if region != "" {
+		awsConfig.Region = aws.String(region)
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := kms.New(sess).GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(res.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UploadKey{
+		KeyID:      aws.StringValue(res.KeyId),
+		WrappedKey: res.CiphertextBlob,
+		aead:       aead,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k *UploadKey) Info() *UploadEncryption {
+	return &UploadEncryption{
+		Algorithm:  UploadAlgorithm,
+		ChunkSize:  UploadChunkSize,
+		KeyID:      k.KeyID,
+		WrappedKey: k.WrappedKey,
+	}
+}
+
+// Metadata returns the object metadata for an encrypted file
+func (k *UploadKey) Metadata(s *Sealed) map[string]string {
+	metadata := map[string]string{
+		MetadataAlgorithm: UploadAlgorithm,
+		MetadataIV:        base64.StdEncoding.EncodeToString(s.IV),
+		MetadataTag:       base64.StdEncoding.EncodeToString(s.Tag),
+		MetadataChunkSize: strconv.Itoa(UploadChunkSize),
+		MetadataKeyID:     k.KeyID,
+	}
+	if k.WrappedKey != nil {
+		metadata[MetadataWrappedKey] = base64.StdEncoding.EncodeToString(k.WrappedKey)
+	}
+	return metadata
+}
+
+// EncryptFile writes an encrypted copy of src to dst, reading one chunk at a time
+func (k *UploadKey) EncryptFile(src, dst string) (*Sealed, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := k.Encrypt(out, in)
+	if err == nil {
+		err = out.Close()
+	} else {
+		_ = out.Close()
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return nil, err
+	}
+	return sealed, nil
+}
+
+func (k *UploadKey) Encrypt(w io.Writer, r io.Reader) (*Sealed, error) {
+	iv := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(r, UploadChunkSize)
+	buf := make([]byte, UploadChunkSize, UploadChunkSize+tagSize)
+	nonce := make([]byte, k.aead.NonceSize())
+	var tag []byte
+	for i := uint32(0); ; i++ {
+		n, last, err := readChunk(br, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		sealed := k.aead.Seal(buf[:0], chunkNonce(nonce, iv, i, last), buf[:n], nil)
+		if _, err = w.Write(sealed); err != nil {
+			return nil, err
+		}
+		if last {
+			tag = append(tag, sealed[len(sealed)-tagSize:]...)
+			break
+		}
+		buf = buf[:UploadChunkSize]
+	}
+
+	return &Sealed{IV: iv, Tag: tag}, nil
+}
+
+// Decrypt reverses Encrypt, given the IV from the object metadata
+func (k *UploadKey) Decrypt(w io.Writer, r io.Reader, iv []byte) error {
+	if len(iv) != noncePrefixSize {
+		return errors.New("invalid encryption iv")
+	}
+
+	br := bufio.NewReaderSize(r, UploadChunkSize+tagSize)
+	buf := make([]byte, UploadChunkSize+tagSize)
+	nonce := make([]byte, k.aead.NonceSize())
+	for i := uint32(0); ; i++ {
+		n, last, err := readChunk(br, buf)
+		if err != nil {
+			return err
+		}
+		if n < tagSize {
+			return errTruncated
+		}
+
+		plaintext, err := k.aead.Open(buf[:0], chunkNonce(nonce, iv, i, last), buf[:n], nil)
+		if err != nil {
+			if !last {
+				return err
+			}
+			// the final chunk flag only matches if the file ends here
+			return errTruncated
+		}
+		if _, err = w.Write(plaintext); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// readChunk fills buf, reporting whether the chunk is the end of the input
+func readChunk(r *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	switch err {
+	case nil:
+		if _, err = r.Peek(1); err == io.EOF {
+			return n, true, nil
+		}
+		return n, false, err
+	case io.EOF, io.ErrUnexpectedEOF:
+		return n, true, nil
+	default:
+		return 0, false, err
+	}
+}
+
+func chunkNonce(nonce, iv []byte, index uint32, last bool) []byte {
+	copy(nonce, iv)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	nonce[len(nonce)-1] = 0
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
@@ -18,44 +18,158 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
+
+	"go.uber.org/atomic"
 
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/sink/diarization"
+	"github.com/livekit/egress/pkg/pipeline/sink/edl"
+	"github.com/livekit/egress/pkg/pipeline/sink/index"
+	"github.com/livekit/egress/pkg/pipeline/sink/timecode"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/pipeline/sink/waveform"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/logger"
 )
 
+const (
+	waveformWidth  = 1800
+	waveformHeight = 280
+)
+
 type FileSink struct {
 	uploader.Uploader
 
 	conf *config.PipelineConfig
 	*config.FileConfig
+	callbacks *gstreamer.Callbacks
+
+	levels   *waveform.Levels
+	markers  *edl.List
+	speakers *diarization.Tracker
+	bundler  *bundleUploader
+	rotation *fileRotation
+	trickle  *fileTrickle
+
+	discarded      atomic.Bool
+	recordingStart atomic.Duration // running time the output starts at, later than 0 with a pre-roll
 }
 
-func newFileSink(u uploader.Uploader, conf *config.PipelineConfig, o *config.FileConfig) *FileSink {
-	return &FileSink{
+func newFileSink(u uploader.Uploader, conf *config.PipelineConfig, o *config.FileConfig, callbacks *gstreamer.Callbacks) *FileSink {
+	s := &FileSink{
 		Uploader:   u,
 		conf:       conf,
 		FileConfig: o,
+		callbacks:  callbacks,
+	}
+
+	if o.Rotates() {
+		s.rotation = newFileRotation()
+	}
+
+	if conf.Bundle.Format != "" {
+		s.bundler = &bundleUploader{
+			Uploader:  u,
+			keepParts: conf.Bundle.KeepParts,
+		}
+		s.Uploader = s.bundler
+	}
+
+	if conf.EDL.Enabled && conf.SourceType == types.SourceTypeSDK {
+		s.markers = &edl.List{}
+		callbacks.AddOnRoomEvent(func(event types.RoomEvent, description string) {
+			if label, ok := conf.EDL.Label(event); ok {
+				s.markers.Add(edl.Marker{
+					Time:    callbacks.RunningTime(),
+					Label:   label,
+					Comment: description,
+				})
+			}
+		})
+	}
+
+	if conf.Diarization.Enabled && conf.SourceType == types.SourceTypeSDK {
+		s.speakers = diarization.NewTracker()
+		callbacks.AddOnSpeakersChanged(s.speakers.Update)
 	}
+
+	if conf.Waveform && conf.AudioEnabled && !conf.VideoEnabled {
+		sampleRate := int32(48000)
+		if conf.AudioOutCodec == types.MimeTypeAAC {
+			sampleRate = conf.AudioFrequency
+		}
+		s.levels = waveform.NewLevels(sampleRate, 2)
+	}
+
+	return s
+}
+
+// Levels returns the waveform accumulator, or nil when no waveform is being recorded
+func (s *FileSink) Levels() *waveform.Levels {
+	return s.levels
+}
+
+// SetRecordingStart sets the running time of the first media in the output
+func (s *FileSink) SetRecordingStart(runningTime time.Duration) {
+	s.recordingStart.Store(runningTime)
 }
 
 func (s *FileSink) Start() error {
+	if s.rotation != nil {
+		s.rotation.start(s.uploadChunks)
+	} else if s.Trickle {
+		s.startTrickle()
+	}
 	return nil
 }
 
 func (s *FileSink) Close() error {
-	location, size, err := s.Upload(s.LocalFilepath, s.StorageFilepath, s.OutputType, false, "file")
-	if err != nil {
+	if s.discarded.Load() {
+		if s.rotation != nil {
+			s.rotation.wait()
+		} else if s.trickle != nil {
+			s.trickle.discard()
+		}
+		return nil
+	}
+
+	if s.rotation != nil {
+		// chunks are uploaded as they close, including the partial chunk flushed by EOS
+		s.rotation.wait()
+	} else if err := s.uploadFile(); err != nil {
 		return err
 	}
 
-	s.FileInfo.Location = location
-	s.FileInfo.Size = size
+	if s.conf.Timecodes.Format != "" {
+		if err := s.uploadTimecodes(); err != nil {
+			return err
+		}
+	}
+
+	if s.markers != nil {
+		if err := s.uploadEDL(); err != nil {
+			return err
+		}
+	}
+
+	if s.speakers != nil {
+		if err := s.uploadSpeakers(); err != nil {
+			return err
+		}
+	}
+
+	if s.levels != nil {
+		if err := s.uploadWaveform(); err != nil {
+			return err
+		}
+	}
 
 	if !s.DisableManifest {
 		manifestLocalPath := fmt.Sprintf("%s.json", s.LocalFilepath)
 		manifestStoragePath := fmt.Sprintf("%s.json", s.StorageFilepath)
-		if err = uploadManifest(s.conf, s.Uploader, manifestLocalPath, manifestStoragePath); err != nil {
+		if err := uploadManifest(s.conf, s.Uploader, manifestLocalPath, manifestStoragePath); err != nil {
 			return err
 		}
 	}
@@ -63,12 +177,162 @@ func (s *FileSink) Close() error {
 	return nil
 }
 
+func (s *FileSink) uploadFile() error {
+	var location string
+	var size int64
+	uploaded := false
+	if s.trickle != nil {
+		location, size, uploaded = s.trickle.finish(s.LocalFilepath)
+	}
+	if !uploaded {
+		var err error
+		if location, size, err = s.Upload(s.LocalFilepath, s.StorageFilepath, s.OutputType, false, "file"); err != nil {
+			return err
+		}
+	}
+
+	s.FileInfo.Location = s.reportedLocation(s.StorageFilepath, location)
+	s.FileInfo.Size = size
+
+	// fragmented mp4 keeps its sample tables in moof boxes, which the index doesn't read
+	if s.conf.KeyframeIndex && s.conf.VideoEnabled && !(s.Trickle && s.OutputType == types.OutputTypeMP4) {
+		return s.uploadIndex(s.LocalFilepath, s.StorageFilepath)
+	}
+	return nil
+}
+
+// reportedLocation returns the location reported in the egress info, signed when configured
+func (s *FileSink) reportedLocation(storageFilepath, location string) string {
+	if s.conf.SignedURLExpiry > 0 && s.bundler == nil {
+		// the signed url is only reported in the egress info, never logged
+		if signed, err := s.SignURL(storageFilepath, s.conf.SignedURLExpiry); err != nil {
+			logger.Warnw("could not sign file location", err)
+		} else {
+			return signed
+		}
+	}
+	return location
+}
+
+func (s *FileSink) uploadIndex(localFilepath, storageFilepath string) error {
+	idx, err := index.Generate(localFilepath, s.OutputType)
+	if err != nil {
+		// the recording itself is still valid
+		logger.Warnw("failed to generate keyframe index", err)
+		return nil
+	}
+
+	indexLocalPath := fmt.Sprintf("%s.index.json", localFilepath)
+	indexStoragePath := fmt.Sprintf("%s.index.json", storageFilepath)
+	if err = idx.Write(indexLocalPath); err != nil {
+		return err
+	}
+
+	logger.Debugw("uploading keyframe index", "keyframes", len(idx.Keyframes))
+	_, _, err = s.Upload(indexLocalPath, indexStoragePath, types.OutputTypeJSON, false, "index")
+	return err
+}
+
+func (s *FileSink) uploadTimecodes() error {
+	var framerate int32
+	if s.conf.VideoEnabled {
+		framerate = s.conf.Framerate
+	}
+
+	format := s.conf.Timecodes.Format
+	timecodeLocalPath := fmt.Sprintf("%s.%s", s.LocalFilepath, format)
+	timecodeStoragePath := fmt.Sprintf("%s.%s", s.StorageFilepath, format)
+	err := timecode.Write(timecodeLocalPath, format, time.Duration(s.FileInfo.Duration), s.conf.Timecodes.Interval, framerate)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.Upload(timecodeLocalPath, timecodeStoragePath, timecode.OutputType(format), false, "timecode")
+	return err
+}
+
+func (s *FileSink) uploadEDL() error {
+	edlLocalPath := fmt.Sprintf("%s.edl", s.LocalFilepath)
+	edlStoragePath := fmt.Sprintf("%s.edl", s.StorageFilepath)
+	start := s.recordingStart.Load()
+	end := start + time.Duration(s.FileInfo.EndedAt-s.FileInfo.StartedAt)
+	err := s.markers.Write(edlLocalPath, s.conf.Info.RoomName, path.Base(s.StorageFilepath),
+		start, end, s.conf.Framerate,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = s.Upload(edlLocalPath, edlStoragePath, types.OutputTypeEDL, false, "edl")
+	return err
+}
+
+func (s *FileSink) uploadSpeakers() error {
+	speakersLocalPath := fmt.Sprintf("%s.speakers.json", s.LocalFilepath)
+	speakersStoragePath := fmt.Sprintf("%s.speakers.json", s.StorageFilepath)
+	timeline := s.speakers.Timeline(s.FileInfo.StartedAt, s.FileInfo.EndedAt, s.conf.Diarization.MergeGap)
+	if err := timeline.Write(speakersLocalPath); err != nil {
+		return err
+	}
+
+	logger.Debugw("uploading speaker timeline", "intervals", len(timeline.Intervals))
+	_, _, err := s.Upload(speakersLocalPath, speakersStoragePath, types.OutputTypeJSON, false, "speakers")
+	return err
+}
+
+func (s *FileSink) uploadWaveform() error {
+	waveformLocalPath := fmt.Sprintf("%s.waveform.png", s.LocalFilepath)
+	waveformStoragePath := fmt.Sprintf("%s.waveform.png", s.StorageFilepath)
+	if err := s.levels.WritePNG(waveformLocalPath, waveformWidth, waveformHeight); err != nil {
+		return err
+	}
+
+	location, size, err := s.Upload(waveformLocalPath, waveformStoragePath, types.OutputTypePNG, false, "waveform")
+	if err != nil {
+		return err
+	}
+
+	if s.bundler != nil {
+		// reported as part of the bundle
+		return nil
+	}
+
+	// reported in the manifest, since file results are recordings
+	s.Waveform = &config.FileArtifact{
+		Filename: waveformStoragePath,
+		Location: location,
+		Size:     size,
+	}
+	return nil
+}
+
+// Discard skips any uploads not yet started. The trickle upload is aborted once the sink is closed or cleaned up
+func (s *FileSink) Discard() {
+	s.discarded.Store(true)
+}
+
 func (s *FileSink) Cleanup() {
+	if s.rotation != nil {
+		// the sink is not closed when the egress fails, so the chunk uploads must finish before any removal
+		s.rotation.wait()
+	} else if s.trickle != nil {
+		// the sink is not closed when the egress fails, leaving the upload running
+		s.trickle.discard()
+	}
+
 	if s.LocalFilepath == s.StorageFilepath {
 		return
 	}
 
 	dir, _ := path.Split(s.LocalFilepath)
+	if !s.discarded.Load() && retainLocalFiles(s.conf, s.Uploader, dir) {
+		if s.FileInfo.Location == "" && s.rotation == nil {
+			// the recording itself was not uploaded
+			s.FileInfo.Location = s.LocalFilepath
+		}
+		return
+	}
+
 	if dir != "" {
 		logger.Debugw("removing temporary directory", "path", dir)
 		if err := os.RemoveAll(dir); err != nil {
@@ -0,0 +1,122 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"go.uber.org/atomic"
+
+	"github.com/livekit/egress/pkg/pipeline/sink/bundle"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// bundleUploader collects the recording and its sidecars as bundle parts, only uploading them individually
+// when parts are kept. Uploads after the bundle is written, such as the recording summary, pass through
+type bundleUploader struct {
+	uploader.Uploader
+
+	keepParts bool
+	uploaded  atomic.Bool
+
+	mu    sync.Mutex
+	parts []bundle.Part
+	done  bool
+}
+
+func (u *bundleUploader) Upload(localFilepath, storageFilepath string, outputType types.OutputType, deleteAfterUpload bool, fileType string) (string, int64, error) {
+	u.mu.Lock()
+	if u.done {
+		u.mu.Unlock()
+		return u.Uploader.Upload(localFilepath, storageFilepath, outputType, deleteAfterUpload, fileType)
+	}
+	u.parts = append(u.parts, bundle.Part{
+		LocalFilepath: localFilepath,
+		Name:          path.Base(storageFilepath),
+	})
+	u.mu.Unlock()
+
+	if u.keepParts {
+		// the local file is still needed for the bundle
+		return u.Uploader.Upload(localFilepath, storageFilepath, outputType, false, fileType)
+	}
+
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+	return "", stat.Size(), nil
+}
+
+// Failed also covers parts which are only staged locally until the bundle is uploaded, so that they are kept
+// when the bundle could not be written, or the egress ended before it was
+func (u *bundleUploader) Failed() bool {
+	return u.staged() || u.Uploader.Failed()
+}
+
+func (u *bundleUploader) staged() bool {
+	if u.keepParts || u.uploaded.Load() {
+		return false
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.parts) > 0
+}
+
+// UploadBundle packages the recording and every sidecar uploaded with it into a single archive,
+// which replaces the recording as the file result
+func (s *FileSink) UploadBundle() error {
+	if s.bundler == nil {
+		return nil
+	}
+
+	s.bundler.mu.Lock()
+	s.bundler.done = true
+	parts := s.bundler.parts
+	s.bundler.mu.Unlock()
+
+	format := s.conf.Bundle.Format
+	bundleLocalPath := fmt.Sprintf("%s.%s", strings.TrimSuffix(s.LocalFilepath, path.Ext(s.LocalFilepath)), format)
+	bundleStoragePath := fmt.Sprintf("%s.%s", strings.TrimSuffix(s.StorageFilepath, path.Ext(s.StorageFilepath)), format)
+	if err := bundle.Write(bundleLocalPath, format, parts); err != nil {
+		return err
+	}
+
+	location, size, err := s.bundler.Uploader.Upload(bundleLocalPath, bundleStoragePath, bundle.OutputType(format), false, "bundle")
+	if err != nil {
+		return err
+	}
+	s.bundler.uploaded.Store(true)
+	if s.conf.SignedURLExpiry > 0 {
+		if signed, err := s.SignURL(bundleStoragePath, s.conf.SignedURLExpiry); err != nil {
+			logger.Warnw("could not sign bundle location", err)
+		} else {
+			location = signed
+		}
+	}
+
+	logger.Debugw("uploaded bundle", "parts", len(parts), "size", size)
+	s.FileInfo.Filename = bundleStoragePath
+	s.FileInfo.Location = location
+	s.FileInfo.Size = size
+	return nil
+}
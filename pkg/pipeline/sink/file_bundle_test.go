@@ -0,0 +1,63 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestBundleStagedParts(t *testing.T) {
+	dir := t.TempDir()
+	localFilepath := path.Join(dir, "recording.mp4")
+	require.NoError(t, os.WriteFile(localFilepath, []byte("recording"), 0644))
+
+	u, err := uploader.New(nil, nil, "", config.UploadRetryConfig{}, config.MultipartUploadConfig{}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	conf := &config.PipelineConfig{}
+	conf.Bundle.Format = types.BundleFormatTar
+	conf.LocalFileCleanup = types.LocalFileCleanupRetainOnFailure
+	s := newFileSink(u, conf, &config.FileConfig{
+		FileInfo:        &livekit.FileInfo{},
+		LocalFilepath:   localFilepath,
+		StorageFilepath: "recording.mp4",
+		OutputType:      types.OutputTypeMP4,
+	}, nil)
+
+	require.False(t, s.Failed())
+
+	// the recording is only staged, as if Run returned before the bundle was uploaded
+	_, size, err := s.Upload(localFilepath, "recording.mp4", types.OutputTypeMP4, false, "file")
+	require.NoError(t, err)
+	require.Equal(t, int64(len("recording")), size)
+	require.True(t, s.Failed())
+	require.True(t, retainLocalFiles(conf, s.Uploader, dir))
+
+	s.Cleanup()
+	require.FileExists(t, localFilepath)
+
+	require.NoError(t, s.UploadBundle())
+	require.False(t, s.Failed())
+	require.FileExists(t, path.Join(dir, "recording.tar"))
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// RecoverChunks uploads the chunks in state that were closed but not uploaded before the handler crashed.
+// It returns the file result of every chunk in storage, in order, and the number of chunks that could not be uploaded
+func RecoverChunks(p *config.PipelineConfig, o *config.FileConfig, state *config.RecoveryState) ([]*livekit.FileInfo, int, error) {
+	u, err := newRecoveryUploader(p, o.UploadConfig, state.EgressID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []*livekit.FileInfo
+	var offset int64
+	lost := 0
+	for _, chunk := range state.Chunks {
+		if !chunk.Uploaded {
+			location, size, err := u.Upload(chunk.LocalFilepath, chunk.Filename, state.OutputType, true, "file")
+			if err != nil {
+				logger.Warnw("failed to recover file chunk", err, "egressID", state.EgressID, "location", chunk.LocalFilepath)
+				lost++
+				continue
+			}
+			logger.Infow("file chunk recovered", "egressID", state.EgressID, "filename", chunk.Filename, "size", size)
+			if p.SignedURLExpiry > 0 {
+				if signed, err := u.SignURL(chunk.Filename, p.SignedURLExpiry); err != nil {
+					logger.Warnw("could not sign file location", err)
+				} else {
+					location = signed
+				}
+			}
+			chunk.Location = location
+			chunk.Size = size
+		}
+
+		chunk.Offset = offset
+		offset += chunk.Size
+		results = append(results, &livekit.FileInfo{
+			Filename:  chunk.Filename,
+			StartedAt: chunk.StartedAt,
+			EndedAt:   chunk.EndedAt,
+			Duration:  chunk.Duration,
+			Size:      chunk.Size,
+			Location:  chunk.Location,
+		})
+	}
+	return results, lost, nil
+}
+
+// RecoverSegments uploads the segments in state that were closed but not added to the playlist before the handler crashed,
+// then finalizes and uploads the playlist. The live playlist is not recovered.
+// It updates o.SegmentsInfo and returns the number of segments in the playlist, and the number that could not be uploaded
+func RecoverSegments(p *config.PipelineConfig, o *config.SegmentConfig, state *config.RecoveryState) (int, int, error) {
+	u, err := newRecoveryUploader(p, o.UploadConfig, state.EgressID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	segments := state.Segments
+	playlistLocalPath := path.Join(segments.LocalDir, segments.PlaylistFilename)
+	listed, err := readPlaylistEntries(playlistLocalPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	playlist, err := m3u8.ResumeEventPlaylistWriter(playlistLocalPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lost := 0
+	gap := false
+	for _, segment := range segments.Pending {
+		if slices.Contains(listed, segment.Filename) {
+			// added to the playlist after the state was written
+			continue
+		}
+
+		localPath := path.Join(segments.LocalDir, segment.Filename)
+		storagePath := path.Join(segments.StorageDir, segment.Filename)
+		if _, _, err = u.Upload(localPath, storagePath, state.OutputType, true, "segment"); err != nil {
+			logger.Warnw("failed to recover segment", err, "egressID", state.EgressID, "location", localPath)
+			lost++
+			gap = true
+			continue
+		}
+		logger.Infow("segment recovered", "egressID", state.EgressID, "filename", segment.Filename)
+
+		if segment.Discontinuity || gap {
+			if err = playlist.AppendDiscontinuity(); err != nil {
+				return 0, 0, err
+			}
+			gap = false
+		}
+		duration := float64(segment.Duration) / float64(time.Second)
+		if err = playlist.Append(time.Unix(0, segment.StartedAt), duration, segment.Filename); err != nil {
+			return 0, 0, err
+		}
+		listed = append(listed, segment.Filename)
+	}
+	if err = playlist.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+	for _, filename := range listed {
+		if stat, err := os.Stat(path.Join(segments.LocalDir, filename)); err == nil {
+			size += stat.Size()
+		}
+	}
+	o.SegmentsInfo.SegmentCount = int64(len(listed))
+	o.SegmentsInfo.Size = size
+	o.SegmentsInfo.PlaylistName = path.Join(segments.StorageDir, segments.PlaylistFilename)
+	o.SegmentsInfo.PlaylistLocation, _, err = u.Upload(playlistLocalPath, o.SegmentsInfo.PlaylistName, o.OutputType, false, "playlist")
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(listed), lost, nil
+}
+
+func newRecoveryUploader(p *config.PipelineConfig, conf config.UploadConfig, egressID string) (uploader.Uploader, error) {
+	key, err := newUploadKey(p)
+	if err != nil {
+		return nil, err
+	}
+	monitor := stats.NewHandlerMonitor(p.NodeID, p.ClusterID, egressID)
+	return uploader.New(conf, p.ToFallbackUploadConfig(), p.BackupStorage, p.UploadRetry, p.MultipartUpload, p.HostOverrides, p.UploadMetadata(), key, monitor)
+}
+
+// readPlaylistEntries returns the segment filenames listed in a playlist
+func readPlaylistEntries(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
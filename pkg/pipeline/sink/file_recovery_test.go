@@ -0,0 +1,83 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestRecoverSegments(t *testing.T) {
+	dir := t.TempDir()
+	playlistPath := path.Join(dir, "playlist.m3u8")
+	start := time.Unix(1700000000, 0)
+
+	playlist, err := m3u8.NewEventPlaylistWriter(playlistPath, 6, false)
+	require.NoError(t, err)
+	require.NoError(t, playlist.Append(start, 6, "seg_00000.ts"))
+	for _, filename := range []string{"seg_00000.ts", "seg_00001.ts", "seg_00003.ts"} {
+		require.NoError(t, os.WriteFile(path.Join(dir, filename), []byte("segment"), 0644))
+	}
+
+	state := &config.RecoveryState{
+		EgressID:   "EG_test",
+		OutputType: types.OutputTypeTS,
+		Segments: &config.RecoverySegments{
+			LocalDir:         dir,
+			StorageDir:       "recordings",
+			PlaylistFilename: "playlist.m3u8",
+			Pending: []*config.RecoverySegment{
+				// listed after the state was written
+				{Filename: "seg_00000.ts", StartedAt: start.UnixNano(), Duration: int64(6 * time.Second)},
+				{Filename: "seg_00001.ts", StartedAt: start.Add(6 * time.Second).UnixNano(), Duration: int64(6 * time.Second)},
+				// never written
+				{Filename: "seg_00002.ts", StartedAt: start.Add(12 * time.Second).UnixNano(), Duration: int64(6 * time.Second)},
+				{Filename: "seg_00003.ts", StartedAt: start.Add(18 * time.Second).UnixNano(), Duration: int64(6 * time.Second)},
+			},
+		},
+	}
+	o := &config.SegmentConfig{
+		SegmentsInfo: &livekit.SegmentsInfo{},
+		OutputType:   types.OutputTypeHLS,
+	}
+
+	recovered, lost, err := RecoverSegments(&config.PipelineConfig{}, o, state)
+	require.NoError(t, err)
+	require.Equal(t, 3, recovered)
+	require.Equal(t, 1, lost)
+	require.Equal(t, int64(3), o.SegmentsInfo.SegmentCount)
+	require.Equal(t, int64(3*len("segment")), o.SegmentsInfo.Size)
+	require.Equal(t, "recordings/playlist.m3u8", o.SegmentsInfo.PlaylistName)
+	require.Equal(t, playlistPath, o.SegmentsInfo.PlaylistLocation)
+
+	b, err := os.ReadFile(playlistPath)
+	require.NoError(t, err)
+	content := string(b)
+	require.Equal(t, 1, strings.Count(content, "seg_00000.ts"))
+	require.NotContains(t, content, "seg_00002.ts")
+	require.Less(t, strings.Index(content, "seg_00001.ts"), strings.Index(content, "#EXT-X-DISCONTINUITY"))
+	require.Less(t, strings.Index(content, "#EXT-X-DISCONTINUITY"), strings.Index(content, "seg_00003.ts"))
+	require.True(t, strings.HasSuffix(content, "#EXT-X-ENDLIST\n"))
+}
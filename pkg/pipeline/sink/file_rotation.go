@@ -0,0 +1,238 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/frostbyte73/core"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// fileRotation tracks the chunks of a file output split by splitmuxsink
+type fileRotation struct {
+	mu      sync.Mutex
+	open    map[string]openChunk
+	closed  chan closedChunk
+	started bool // guarded by mu
+	closing bool // closed is closed, guarded by mu
+	done    core.Fuse
+
+	// every closed chunk, kept for the recovery state
+	recovery []*config.RecoveryChunk
+}
+
+type openChunk struct {
+	startedAt   int64
+	runningTime uint64
+}
+
+type closedChunk struct {
+	localFilepath string
+	startedAt     int64
+	endedAt       int64
+	duration      time.Duration
+	recovery      *config.RecoveryChunk
+}
+
+func newFileRotation() *fileRotation {
+	return &fileRotation{
+		open:   make(map[string]openChunk),
+		closed: make(chan closedChunk, maxPendingUploads),
+		done:   core.NewFuse(),
+	}
+}
+
+func (r *fileRotation) start(upload func()) {
+	r.mu.Lock()
+	r.started = true
+	r.mu.Unlock()
+	go upload()
+}
+
+// wait blocks until every closed chunk has been uploaded. It is called by both Close and Cleanup
+func (r *fileRotation) wait() {
+	r.mu.Lock()
+	if !r.closing {
+		r.closing = true
+		close(r.closed)
+		if !r.started {
+			r.done.Break()
+		}
+	}
+	r.mu.Unlock()
+	<-r.done.Watch()
+}
+
+func (s *FileSink) ChunkOpened(filepath string, runningTime uint64) {
+	s.rotation.mu.Lock()
+	s.rotation.open[filepath] = openChunk{
+		startedAt:   time.Now().UnixNano(),
+		runningTime: runningTime,
+	}
+	s.rotation.mu.Unlock()
+}
+
+// ChunkClosed queues the chunk for upload. It is called from the bus, so it never waits for the uploader
+func (s *FileSink) ChunkClosed(filepath string, runningTime uint64) error {
+	s.rotation.mu.Lock()
+	defer s.rotation.mu.Unlock()
+
+	chunk, ok := s.rotation.open[filepath]
+	delete(s.rotation.open, filepath)
+	if !ok {
+		logger.Warnw("closed unknown file chunk", nil, "location", filepath)
+		return nil
+	}
+	if s.rotation.closing {
+		logger.Warnw("file chunk closed after the sink", nil, "location", filepath)
+		return nil
+	}
+
+	closed := closedChunk{
+		localFilepath: filepath,
+		startedAt:     chunk.startedAt,
+		endedAt:       time.Now().UnixNano(),
+		duration:      time.Duration(runningTime - chunk.runningTime),
+	}
+	closed.recovery = s.newRecoveryChunk(closed)
+	s.rotation.recovery = append(s.rotation.recovery, closed.recovery)
+
+	select {
+	case s.rotation.closed <- closed:
+		return nil
+	default:
+		err := errors.New("file chunk upload job queue is full")
+		logger.Infow("failed to upload file chunk", "error", err)
+		return errors.ErrUploadFailed(filepath, err)
+	}
+}
+
+// newRecoveryChunk must be called with the rotation lock held
+func (s *FileSink) newRecoveryChunk(chunk closedChunk) *config.RecoveryChunk {
+	c := &config.RecoveryChunk{
+		FileChunk: config.FileChunk{
+			Filename:  path.Join(path.Dir(s.StorageFilepath), path.Base(chunk.localFilepath)),
+			StartedAt: chunk.startedAt,
+			EndedAt:   chunk.endedAt,
+		},
+		LocalFilepath: chunk.localFilepath,
+		Duration:      int64(chunk.duration),
+	}
+	if stat, err := os.Stat(chunk.localFilepath); err == nil {
+		c.Size = stat.Size()
+	}
+	if n := len(s.rotation.recovery); n > 0 {
+		prev := s.rotation.recovery[n-1]
+		c.Offset = prev.Offset + prev.Size
+	}
+	return c
+}
+
+// RecoveryState lists the chunks closed so far, so that they can be uploaded if the handler crashes.
+// It returns nil if the output does not rotate
+func (s *FileSink) RecoveryState() *config.RecoveryState {
+	if s.rotation == nil {
+		return nil
+	}
+
+	s.rotation.mu.Lock()
+	defer s.rotation.mu.Unlock()
+
+	state := &config.RecoveryState{
+		EgressID:        s.conf.Info.EgressId,
+		OutputType:      s.OutputType,
+		StorageFilepath: s.StorageFilepath,
+		Chunks:          make([]*config.RecoveryChunk, 0, len(s.rotation.recovery)),
+	}
+	for _, c := range s.rotation.recovery {
+		chunk := *c
+		state.Chunks = append(state.Chunks, &chunk)
+	}
+	return state
+}
+
+// uploadChunks uploads chunks in order, sending an update after each one
+func (s *FileSink) uploadChunks() {
+	defer s.rotation.done.Break()
+
+	for chunk := range s.rotation.closed {
+		if s.discarded.Load() {
+			continue
+		}
+		if err := s.uploadChunk(chunk); err != nil {
+			s.callbacks.OnError(err)
+			continue
+		}
+		s.callbacks.OnOutputUpdated()
+	}
+}
+
+func (s *FileSink) uploadChunk(chunk closedChunk) error {
+	storageFilepath := path.Join(path.Dir(s.StorageFilepath), path.Base(chunk.localFilepath))
+
+	if s.conf.KeyframeIndex && s.conf.VideoEnabled {
+		if err := s.uploadIndex(chunk.localFilepath, storageFilepath); err != nil {
+			return err
+		}
+	}
+
+	location, size, err := s.Upload(chunk.localFilepath, storageFilepath, s.OutputType, true, "file")
+	if err != nil {
+		reportRetained(s.conf, s.callbacks, chunk.localFilepath, storageFilepath)
+		return err
+	}
+	location = s.reportedLocation(storageFilepath, location)
+
+	// the first file result totals the chunks, followed by each chunk
+	c := &config.FileChunk{
+		Filename:  storageFilepath,
+		Location:  location,
+		Size:      size,
+		Offset:    s.FileInfo.Size,
+		StartedAt: chunk.startedAt,
+		EndedAt:   chunk.endedAt,
+	}
+	s.Chunks = append(s.Chunks, c)
+	s.rotation.mu.Lock()
+	chunk.recovery.FileChunk = *c
+	chunk.recovery.Uploaded = true
+	s.rotation.mu.Unlock()
+	// the total has no single location, each chunk result reports its own
+	s.FileInfo.Size += size
+	appendFileResult(s.conf, &livekit.FileInfo{
+		Filename:  storageFilepath,
+		StartedAt: chunk.startedAt,
+		EndedAt:   chunk.endedAt,
+		Duration:  int64(chunk.duration),
+		Size:      size,
+		Location:  location,
+	})
+
+	logger.Infow("file chunk uploaded",
+		"filename", storageFilepath,
+		"size", size,
+		"offset", c.Offset,
+		"duration", chunk.duration,
+	)
+	return nil
+}
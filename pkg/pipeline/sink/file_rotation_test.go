@@ -0,0 +1,52 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestFileRotationQueue(t *testing.T) {
+	s := &FileSink{
+		conf:       &config.PipelineConfig{Info: &livekit.EgressInfo{}},
+		FileConfig: &config.FileConfig{StorageFilepath: "recordings/recording_00000.mp4"},
+		rotation:   newFileRotation(),
+	}
+
+	// without an uploader running, a full queue fails the chunk instead of blocking the bus
+	for i := 0; i <= maxPendingUploads; i++ {
+		filepath := fmt.Sprintf("recording_%05d.mp4", i)
+		s.ChunkOpened(filepath, uint64(i))
+		err := s.ChunkClosed(filepath, uint64(i+1))
+		if i < maxPendingUploads {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+		}
+	}
+	require.Len(t, s.RecoveryState().Chunks, maxPendingUploads+1)
+
+	// cleanup after close doesn't wait on an uploader that never started, and later chunks are ignored
+	s.rotation.wait()
+	s.rotation.wait()
+	s.ChunkOpened("late.mp4", 0)
+	require.NoError(t, s.ChunkClosed("late.mp4", 1))
+}
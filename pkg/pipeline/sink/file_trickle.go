@@ -0,0 +1,170 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/frostbyte73/core"
+
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	defaultTricklePartSize = 16 * 1024 * 1024
+	tricklePollInterval    = time.Second
+)
+
+// fileTrickle uploads a file output in parts as the muxer writes it, leaving only the last part for EOS
+type fileTrickle struct {
+	upload uploader.TrickleUpload
+	buf    []byte
+	offset int64 // bytes uploaded so far
+	failed bool  // set once the trickle upload is aborted
+	closed bool  // set once the trickle upload is completed or aborted
+	stop   core.Fuse
+	done   core.Fuse
+}
+
+func (s *FileSink) startTrickle() {
+	upload, err := s.StartTrickle(s.StorageFilepath, s.OutputType)
+	if err != nil {
+		logger.Warnw("failed to start trickle upload, uploading once finished", err)
+		return
+	}
+	if upload == nil {
+		return
+	}
+
+	partSize := int64(defaultTricklePartSize)
+	if s.conf.MultipartUpload.PartSize > 0 {
+		partSize = s.conf.MultipartUpload.PartSize
+	}
+	s.trickle = &fileTrickle{
+		upload: upload,
+		buf:    make([]byte, partSize),
+		stop:   core.NewFuse(),
+		done:   core.NewFuse(),
+	}
+	go s.trickle.run(s.LocalFilepath)
+}
+
+func (t *fileTrickle) run(localFilepath string) {
+	defer t.done.Break()
+
+	ticker := time.NewTicker(tricklePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop.Watch():
+			return
+		case <-ticker.C:
+			if err := t.uploadParts(localFilepath); err != nil {
+				t.abort(err)
+				return
+			}
+		}
+	}
+}
+
+// uploadParts uploads every full part written since the last call. At least one byte is held back,
+// so the last part is always uploaded by finish
+func (t *fileTrickle) uploadParts(localFilepath string) error {
+	f, err := os.Open(localFilepath)
+	if os.IsNotExist(err) {
+		// nothing has been written yet
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	for stat.Size()-t.offset > int64(len(t.buf)) {
+		if _, err = f.ReadAt(t.buf, t.offset); err != nil {
+			return err
+		}
+		if err = t.upload.UploadPart(t.buf); err != nil {
+			return err
+		}
+		t.offset += int64(len(t.buf))
+	}
+	return nil
+}
+
+// finish uploads the rest of the finished file and commits the upload. If it returns false, the trickle
+// upload has been aborted and the file still needs to be uploaded
+func (t *fileTrickle) finish(localFilepath string) (string, int64, bool) {
+	t.stop.Break()
+	<-t.done.Watch()
+	if t.failed {
+		return "", 0, false
+	}
+
+	if err := t.uploadParts(localFilepath); err != nil {
+		t.abort(err)
+		return "", 0, false
+	}
+
+	f, err := os.Open(localFilepath)
+	if err != nil {
+		t.abort(err)
+		return "", 0, false
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	rest, err := io.ReadAll(io.NewSectionReader(f, t.offset, int64(len(t.buf))))
+	if err != nil {
+		t.abort(err)
+		return "", 0, false
+	}
+
+	location, size, err := t.upload.Complete(rest)
+	if err != nil {
+		t.abort(err)
+		return "", 0, false
+	}
+	t.closed = true
+	return location, size, true
+}
+
+// discard stops uploading parts and aborts the upload unless it was completed, so that no parts are left in storage.
+// It is called when the egress is discarded, and on cleanup in case the sink was never closed
+func (t *fileTrickle) discard() {
+	t.stop.Break()
+	<-t.done.Watch()
+	if !t.closed {
+		logger.Debugw("aborting trickle upload", "uploaded", t.offset)
+		t.upload.Abort()
+		t.failed = true
+		t.closed = true
+	}
+}
+
+func (t *fileTrickle) abort(err error) {
+	logger.Warnw("trickle upload failed, uploading once finished", err, "uploaded", t.offset)
+	t.upload.Abort()
+	t.failed = true
+	t.closed = true
+}
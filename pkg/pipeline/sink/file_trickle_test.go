@@ -0,0 +1,124 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/frostbyte73/core"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/protocol/livekit"
+)
+
+type fakeTrickleUpload struct {
+	mu        sync.Mutex
+	parts     []string
+	completed bool
+	aborted   bool
+}
+
+func (f *fakeTrickleUpload) UploadPart(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.parts = append(f.parts, string(data))
+	return nil
+}
+
+func (f *fakeTrickleUpload) Complete(data []byte) (string, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.parts = append(f.parts, string(data))
+	f.completed = true
+	size := 0
+	for _, part := range f.parts {
+		size += len(part)
+	}
+	return "remote/recording.mp4", int64(size), nil
+}
+
+func (f *fakeTrickleUpload) Abort() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = true
+}
+
+func newTestTrickle(upload *fakeTrickleUpload, partSize int) *fileTrickle {
+	return &fileTrickle{
+		upload: upload,
+		buf:    make([]byte, partSize),
+		stop:   core.NewFuse(),
+		done:   core.NewFuse(),
+	}
+}
+
+func TestFileTrickle(t *testing.T) {
+	localFilepath := path.Join(t.TempDir(), "recording.mp4")
+	upload := &fakeTrickleUpload{}
+	trickle := newTestTrickle(upload, 4)
+
+	// nothing has been written yet
+	require.NoError(t, trickle.uploadParts(localFilepath))
+	require.Empty(t, upload.parts)
+
+	// full parts are uploaded, holding back at least one byte
+	require.NoError(t, os.WriteFile(localFilepath, []byte("abcdefgh"), 0644))
+	require.NoError(t, trickle.uploadParts(localFilepath))
+	require.Equal(t, []string{"abcd"}, upload.parts)
+
+	require.NoError(t, os.WriteFile(localFilepath, []byte("abcdefghij"), 0644))
+	go trickle.run(localFilepath)
+	location, size, ok := trickle.finish(localFilepath)
+	require.True(t, ok)
+	require.Equal(t, "remote/recording.mp4", location)
+	require.Equal(t, int64(10), size)
+	require.Equal(t, []string{"abcd", "efgh", "ij"}, upload.parts)
+	require.True(t, upload.completed)
+
+	// a completed upload is not aborted on cleanup
+	trickle.discard()
+	require.False(t, upload.aborted)
+}
+
+func TestFileTrickleCleanup(t *testing.T) {
+	dir := t.TempDir()
+	u, err := uploader.New(nil, nil, "", config.UploadRetryConfig{}, config.MultipartUploadConfig{}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	upload := &fakeTrickleUpload{}
+	s := &FileSink{
+		Uploader: u,
+		conf:     &config.PipelineConfig{},
+		FileConfig: &config.FileConfig{
+			FileInfo:        &livekit.FileInfo{},
+			LocalFilepath:   path.Join(dir, "recording.mp4"),
+			StorageFilepath: "recording.mp4",
+		},
+		trickle: newTestTrickle(upload, 4),
+	}
+	go s.trickle.run(s.LocalFilepath)
+
+	// the sink is never closed when the egress fails
+	s.Cleanup()
+	require.True(t, s.trickle.done.IsBroken())
+	require.True(t, upload.aborted)
+	require.False(t, upload.completed)
+	require.NoDirExists(t, dir)
+}
@@ -22,6 +22,8 @@ import (
 	"time"
 
 	"github.com/frostbyte73/core"
+	"go.uber.org/atomic"
+
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/gstreamer"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
@@ -45,6 +47,7 @@ type ImageSink struct {
 	manifest      *ImageManifest
 	createdImages chan *imageUpdate
 	done          core.Fuse
+	discarded     atomic.Bool
 }
 
 type imageUpdate struct {
@@ -88,6 +91,9 @@ func (s *ImageSink) Start() error {
 }
 
 func (s *ImageSink) handleNewImage(update *imageUpdate) error {
+	if s.discarded.Load() {
+		return nil
+	}
 	s.ImagesInfo.ImageCount++
 
 	filename := update.filename
@@ -163,11 +169,20 @@ func (s *ImageSink) Close() error {
 	return nil
 }
 
+// Discard skips image uploads not yet started
+func (s *ImageSink) Discard() {
+	s.discarded.Store(true)
+}
+
 func (s *ImageSink) Cleanup() {
 	if s.LocalDir == s.StorageDir {
 		return
 	}
 
+	if !s.discarded.Load() && retainLocalFiles(s.conf, s.Uploader, s.LocalDir) {
+		return
+	}
+
 	if s.LocalDir != "" {
 		logger.Debugw("removing temporary directory", "path", s.LocalDir)
 		if err := os.RemoveAll(s.LocalDir); err != nil {
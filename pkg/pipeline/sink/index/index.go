@@ -0,0 +1,71 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+// Keyframe maps a video keyframe to its position in the file
+type Keyframe struct {
+	PTS    int64 `json:"pts"`    // presentation timestamp in nanoseconds
+	Offset int64 `json:"offset"` // byte offset of the sample (mp4, ivf) or block element (webm)
+}
+
+type Index struct {
+	OutputType types.OutputType `json:"output_type"`
+	Keyframes  []Keyframe       `json:"keyframes"`
+}
+
+// Generate reads a finalized file and returns the position of every video keyframe
+func Generate(filepath string, outputType types.OutputType) (*Index, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keyframes []Keyframe
+	switch outputType {
+	case types.OutputTypeMP4:
+		keyframes, err = readMP4(f)
+	case types.OutputTypeWebM:
+		keyframes, err = readWebM(f)
+	case types.OutputTypeIVF:
+		keyframes, err = readIVF(f)
+	default:
+		return nil, fmt.Errorf("keyframe index not supported for %s", outputType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{
+		OutputType: outputType,
+		Keyframes:  keyframes,
+	}, nil
+}
+
+func (i *Index) Write(filepath string) error {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath, b, 0644)
+}
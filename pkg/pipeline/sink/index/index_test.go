@@ -0,0 +1,130 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMP4(t *testing.T) {
+	u32 := func(values ...uint32) []byte {
+		b := make([]byte, 4*len(values))
+		for i, v := range values {
+			binary.BigEndian.PutUint32(b[i*4:], v)
+		}
+		return b
+	}
+	box := func(boxType string, payload ...[]byte) []byte {
+		data := bytes.Join(payload, nil)
+		return append(append(u32(uint32(len(data)+8)), boxType...), data...)
+	}
+
+	ftyp := box("ftyp", []byte("isom"), u32(0))
+	mdat := box("mdat", make([]byte, 300))
+	dataOffset := uint32(len(ftyp) + 8)
+
+	// 4 samples in 2 chunks, keyframes at samples 1 and 3
+	stbl := box("stbl",
+		box("stts", u32(0, 1, 4, 3000)),
+		box("stss", u32(0, 2, 1, 3)),
+		box("stsc", u32(0, 1, 1, 2, 1)),
+		box("stsz", u32(0, 0, 4, 100, 50, 50, 100)),
+		box("stco", u32(0, 2, dataOffset, dataOffset+150)),
+	)
+	moov := box("moov",
+		box("mvhd", u32(0, 0, 0, 1000, 0)),
+		box("trak", box("mdia",
+			box("mdhd", u32(0, 0, 0, 90000, 0)),
+			box("hdlr", u32(0, 0), []byte("vide")),
+			box("minf", stbl),
+		)),
+	)
+
+	keyframes, err := readMP4(bytes.NewReader(bytes.Join([][]byte{ftyp, mdat, moov}, nil)))
+	require.NoError(t, err)
+	require.Equal(t, []Keyframe{
+		{PTS: 0, Offset: int64(dataOffset)},
+		{PTS: 66666666, Offset: int64(dataOffset + 150)},
+	}, keyframes)
+}
+
+func TestReadWebM(t *testing.T) {
+	el := func(id uint64, payload ...[]byte) []byte {
+		data := bytes.Join(payload, nil)
+		var idBytes []byte
+		for shift := 24; shift >= 0; shift -= 8 {
+			if b := byte(id >> shift); b != 0 || len(idBytes) > 0 {
+				idBytes = append(idBytes, b)
+			}
+		}
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(data)))
+		size[0] = 0x01
+		return bytes.Join([][]byte{idBytes, size, data}, nil)
+	}
+	block := func(relative int16, flags byte) []byte {
+		b := []byte{0x81, 0, 0, flags, 0xAA, 0xBB}
+		binary.BigEndian.PutUint16(b[1:3], uint16(relative))
+		return b
+	}
+
+	header := el(idEBML, []byte{0x42, 0x82, 0x84}, []byte("webm"))
+	tracks := el(idTracks, el(idTrackEntry, el(idTrackNumber, []byte{1}), el(idTrackType, []byte{1})))
+	info := el(idInfo, el(idTimecodeScale, []byte{0x0F, 0x42, 0x40}))
+	timecode := el(idTimecode, []byte{0x03, 0xE8})
+	key := el(idSimpleBlock, block(0, 0x80))
+	delta := el(idSimpleBlock, block(33, 0))
+	group := el(idBlockGroup, el(idBlock, block(66, 0)))
+	cluster := el(idCluster, timecode, key, delta, group)
+	segment := el(idSegment, info, tracks, cluster)
+
+	// element headers are 12 bytes (4 byte id, 8 byte size)
+	keyOffset := int64(len(header) + 12 + len(info) + len(tracks) + 12 + len(timecode))
+	keyframes, err := readWebM(bytes.NewReader(append(header, segment...)))
+	require.NoError(t, err)
+	require.Equal(t, []Keyframe{
+		{PTS: 1000000000, Offset: keyOffset},
+		{PTS: 1066000000, Offset: keyOffset + int64(len(key)+len(delta))},
+	}, keyframes)
+}
+
+func TestReadIVF(t *testing.T) {
+	header := make([]byte, ivfFileHeaderSize)
+	copy(header, "DKIF")
+	binary.LittleEndian.PutUint16(header[6:], ivfFileHeaderSize)
+	copy(header[8:], "VP80")
+	binary.LittleEndian.PutUint32(header[16:], 30)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+
+	frame := func(ts uint64, tag byte, size int) []byte {
+		b := make([]byte, ivfFrameHeaderSize+size)
+		binary.LittleEndian.PutUint32(b[0:], uint32(size))
+		binary.LittleEndian.PutUint64(b[4:], ts)
+		b[12] = tag
+		return b
+	}
+
+	file := bytes.Join([][]byte{header, frame(0, 0x00, 20), frame(1, 0x01, 10), frame(2, 0x00, 20)}, nil)
+	keyframes, err := readIVF(bytes.NewReader(file))
+	require.NoError(t, err)
+	require.Equal(t, []Keyframe{
+		{PTS: 0, Offset: 32},
+		{PTS: 66666666, Offset: 32 + 32 + 22},
+	}, keyframes)
+}
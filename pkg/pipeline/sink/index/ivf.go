@@ -0,0 +1,107 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	ivfFileHeaderSize  = 32
+	ivfFrameHeaderSize = 12
+)
+
+var errInvalidIVF = errors.New("invalid ivf")
+
+// readIVF walks the frame headers, checking the vp8 or vp9 frame type of each frame
+func readIVF(r io.ReadSeeker) ([]Keyframe, error) {
+	header := make([]byte, ivfFileHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errInvalidIVF
+	}
+	if string(header[:4]) != "DKIF" {
+		return nil, errInvalidIVF
+	}
+
+	headerSize := int64(binary.LittleEndian.Uint16(header[6:8]))
+	fourcc := string(header[8:12])
+	rate := int64(binary.LittleEndian.Uint32(header[16:20]))
+	scale := int64(binary.LittleEndian.Uint32(header[20:24]))
+	if rate == 0 || scale == 0 {
+		return nil, errInvalidIVF
+	}
+
+	var isKeyframe func(byte) bool
+	switch fourcc {
+	case "VP80":
+		// frame tag bit 0 is 0 for key frames
+		isKeyframe = func(b byte) bool { return b&0x01 == 0 }
+	case "VP90":
+		isKeyframe = isVP9Keyframe
+	default:
+		return nil, errors.New("unsupported ivf codec " + fourcc)
+	}
+
+	var keyframes []Keyframe
+	offset := headerSize
+	frameHeader := make([]byte, ivfFrameHeaderSize+1)
+	for {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		n, err := io.ReadFull(r, frameHeader)
+		if err == io.EOF {
+			return keyframes, nil
+		} else if err != nil && n < ivfFrameHeaderSize+1 {
+			// truncated final frame
+			return keyframes, nil
+		}
+
+		size := int64(binary.LittleEndian.Uint32(frameHeader[0:4]))
+		ts := int64(binary.LittleEndian.Uint64(frameHeader[4:12]))
+		if size > 0 && isKeyframe(frameHeader[12]) {
+			// timestamps are in units of scale/rate seconds
+			t := ts * scale
+			keyframes = append(keyframes, Keyframe{
+				PTS:    t/rate*1e9 + t%rate*1e9/rate,
+				Offset: offset,
+			})
+		}
+		offset += ivfFrameHeaderSize + size
+	}
+}
+
+// isVP9Keyframe reads frame_type from the first byte of the uncompressed header
+func isVP9Keyframe(b byte) bool {
+	if b>>6 != 0x02 {
+		// missing frame marker
+		return false
+	}
+	profile := (b>>5)&0x01 | (b>>3)&0x02
+	bit := 4
+	if profile == 3 {
+		// reserved zero bit
+		bit++
+	}
+
+	// show_existing_frame, followed by frame_type (0 for key frames)
+	if (b>>(7-bit))&0x01 == 1 {
+		return false
+	}
+	bit++
+	return (b>>(7-bit))&0x01 == 0
+}
@@ -0,0 +1,382 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errInvalidMP4 = errors.New("invalid mp4")
+
+// readMP4 finds the moov box and computes keyframe offsets from the first video track's sample tables
+func readMP4(r io.ReadSeeker) ([]Keyframe, error) {
+	moov, err := readTopLevelBox(r, "moov")
+	if err != nil {
+		return nil, err
+	}
+
+	mvhd := findBox(moov, "mvhd")
+	if len(mvhd) < 20 {
+		return nil, errInvalidMP4
+	}
+	movieTimescale := fullBoxTimescale(mvhd)
+
+	for _, trak := range findBoxes(moov, "trak") {
+		hdlr := findBox(trak, "mdia", "hdlr")
+		if len(hdlr) < 12 || string(hdlr[8:12]) != "vide" {
+			continue
+		}
+		return readTrak(trak, movieTimescale)
+	}
+
+	return nil, errors.New("no video track found")
+}
+
+func readTopLevelBox(r io.ReadSeeker, boxType string) ([]byte, error) {
+	var offset int64
+	header := make([]byte, 16)
+	for {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("moov not found")
+			}
+			return nil, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// box extends to the end of the file
+			if string(header[4:8]) != boxType {
+				return nil, errors.New("moov not found")
+			}
+			b, err := io.ReadAll(r)
+			return b, err
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return nil, errInvalidMP4
+		}
+
+		if string(header[4:8]) == boxType {
+			b := make([]byte, size-headerSize)
+			_, err := io.ReadFull(r, b)
+			return b, err
+		}
+		offset += size
+	}
+}
+
+// findBoxes returns the payloads of all direct children of the given type
+func findBoxes(data []byte, boxType string) [][]byte {
+	var boxes [][]byte
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		headerSize := uint64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				break
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			break
+		}
+		if string(data[4:8]) == boxType {
+			boxes = append(boxes, data[headerSize:size])
+		}
+		data = data[size:]
+	}
+	return boxes
+}
+
+// findBox follows a path of box types, returning the first match
+func findBox(data []byte, path ...string) []byte {
+	for _, boxType := range path {
+		boxes := findBoxes(data, boxType)
+		if len(boxes) == 0 {
+			return nil
+		}
+		data = boxes[0]
+	}
+	return data
+}
+
+// fullBoxTimescale reads the timescale from an mvhd or mdhd payload
+func fullBoxTimescale(b []byte) uint32 {
+	if b[0] == 1 {
+		if len(b) < 24 {
+			return 0
+		}
+		return binary.BigEndian.Uint32(b[20:24])
+	}
+	return binary.BigEndian.Uint32(b[12:16])
+}
+
+func readTrak(trak []byte, movieTimescale uint32) ([]Keyframe, error) {
+	mdhd := findBox(trak, "mdia", "mdhd")
+	if len(mdhd) < 20 {
+		return nil, errInvalidMP4
+	}
+	timescale := fullBoxTimescale(mdhd)
+	if timescale == 0 {
+		return nil, errInvalidMP4
+	}
+
+	stbl := findBox(trak, "mdia", "minf", "stbl")
+	if stbl == nil {
+		return nil, errInvalidMP4
+	}
+
+	sizes, err := readSampleSizes(findBox(stbl, "stsz"))
+	if err != nil {
+		return nil, err
+	}
+	offsets, err := readSampleOffsets(stbl, sizes)
+	if err != nil {
+		return nil, err
+	}
+	dts, err := readDecodeTimes(findBox(stbl, "stts"), len(sizes))
+	if err != nil {
+		return nil, err
+	}
+	ctts, err := readCompositionOffsets(findBox(stbl, "ctts"), len(sizes))
+	if err != nil {
+		return nil, err
+	}
+	shift := readEditShift(findBox(trak, "edts", "elst"), movieTimescale, timescale)
+
+	sync, err := readSyncSamples(findBox(stbl, "stss"), len(sizes))
+	if err != nil {
+		return nil, err
+	}
+
+	keyframes := make([]Keyframe, 0, len(sync))
+	for _, i := range sync {
+		pts := int64(dts[i]) + ctts[i] + shift
+		keyframes = append(keyframes, Keyframe{
+			PTS:    pts/int64(timescale)*1e9 + pts%int64(timescale)*1e9/int64(timescale),
+			Offset: offsets[i],
+		})
+	}
+	return keyframes, nil
+}
+
+func readCount(b []byte, entrySize int) (int, error) {
+	if len(b) < 8 {
+		return 0, errInvalidMP4
+	}
+	count := int(binary.BigEndian.Uint32(b[4:8]))
+	if count < 0 || len(b)-8 < count*entrySize {
+		return 0, errInvalidMP4
+	}
+	return count, nil
+}
+
+func readSampleSizes(stsz []byte) ([]uint32, error) {
+	if len(stsz) < 12 {
+		return nil, errInvalidMP4
+	}
+	sampleSize := binary.BigEndian.Uint32(stsz[4:8])
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if sampleSize == 0 && len(stsz)-12 < count*4 {
+		return nil, errInvalidMP4
+	}
+
+	sizes := make([]uint32, count)
+	for i := range sizes {
+		if sampleSize != 0 {
+			sizes[i] = sampleSize
+		} else {
+			sizes[i] = binary.BigEndian.Uint32(stsz[12+i*4:])
+		}
+	}
+	return sizes, nil
+}
+
+func readSampleOffsets(stbl []byte, sizes []uint32) ([]int64, error) {
+	var chunkOffsets []int64
+	if stco := findBox(stbl, "stco"); stco != nil {
+		count, err := readCount(stco, 4)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(stco[8+i*4:])))
+		}
+	} else if co64 := findBox(stbl, "co64"); co64 != nil {
+		count, err := readCount(co64, 8)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(co64[8+i*8:])))
+		}
+	} else {
+		return nil, errInvalidMP4
+	}
+
+	stsc := findBox(stbl, "stsc")
+	count, err := readCount(stsc, 12)
+	if err != nil {
+		return nil, err
+	}
+	sampleCount := len(sizes)
+	offsets := make([]int64, 0, sampleCount)
+	for i := 0; i < count; i++ {
+		entry := stsc[8+i*12:]
+		firstChunk := int(binary.BigEndian.Uint32(entry[0:4]))
+		samplesPerChunk := int(binary.BigEndian.Uint32(entry[4:8]))
+		lastChunk := len(chunkOffsets)
+		if i+1 < count {
+			lastChunk = int(binary.BigEndian.Uint32(stsc[8+(i+1)*12:])) - 1
+		}
+		if firstChunk < 1 || lastChunk > len(chunkOffsets) {
+			return nil, errInvalidMP4
+		}
+
+		for chunk := firstChunk; chunk <= lastChunk; chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for j := 0; j < samplesPerChunk && len(offsets) < sampleCount; j++ {
+				offsets = append(offsets, offset)
+				offset += int64(sizes[len(offsets)-1])
+			}
+		}
+	}
+	if len(offsets) != sampleCount {
+		return nil, errInvalidMP4
+	}
+	return offsets, nil
+}
+
+func readDecodeTimes(stts []byte, sampleCount int) ([]uint64, error) {
+	count, err := readCount(stts, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	dts := make([]uint64, 0, sampleCount)
+	var t uint64
+	for i := 0; i < count; i++ {
+		n := int(binary.BigEndian.Uint32(stts[8+i*8:]))
+		delta := uint64(binary.BigEndian.Uint32(stts[12+i*8:]))
+		for j := 0; j < n && len(dts) < sampleCount; j++ {
+			dts = append(dts, t)
+			t += delta
+		}
+	}
+	if len(dts) < sampleCount {
+		return nil, errInvalidMP4
+	}
+	return dts, nil
+}
+
+func readCompositionOffsets(ctts []byte, sampleCount int) ([]int64, error) {
+	offsets := make([]int64, sampleCount)
+	if ctts == nil {
+		return offsets, nil
+	}
+
+	count, err := readCount(ctts, 8)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	for e := 0; e < count; e++ {
+		n := int(binary.BigEndian.Uint32(ctts[8+e*8:]))
+		offset := int64(int32(binary.BigEndian.Uint32(ctts[12+e*8:])))
+		for j := 0; j < n && i < sampleCount; j++ {
+			offsets[i] = offset
+			i++
+		}
+	}
+	return offsets, nil
+}
+
+// readEditShift converts the first edit list entries to a presentation time shift in the track timescale
+func readEditShift(elst []byte, movieTimescale, timescale uint32) int64 {
+	if len(elst) < 8 || movieTimescale == 0 {
+		return 0
+	}
+
+	entrySize := 12
+	if elst[0] == 1 {
+		entrySize = 20
+	}
+	count, err := readCount(elst, entrySize)
+	if err != nil {
+		return 0
+	}
+
+	var shift int64
+	for i := 0; i < count; i++ {
+		entry := elst[8+i*entrySize:]
+		var duration, mediaTime int64
+		if entrySize == 20 {
+			duration = int64(binary.BigEndian.Uint64(entry[0:8]))
+			mediaTime = int64(binary.BigEndian.Uint64(entry[8:16]))
+		} else {
+			duration = int64(binary.BigEndian.Uint32(entry[0:4]))
+			mediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:8])))
+		}
+
+		if mediaTime == -1 {
+			// empty edit delays the track
+			shift += duration * int64(timescale) / int64(movieTimescale)
+			continue
+		}
+		return shift - mediaTime
+	}
+	return shift
+}
+
+// readSyncSamples returns zero-based keyframe sample indexes. Without stss, every sample is a keyframe
+func readSyncSamples(stss []byte, sampleCount int) ([]int, error) {
+	if stss == nil {
+		sync := make([]int, sampleCount)
+		for i := range sync {
+			sync[i] = i
+		}
+		return sync, nil
+	}
+
+	count, err := readCount(stss, 4)
+	if err != nil {
+		return nil, err
+	}
+	sync := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		sample := int(binary.BigEndian.Uint32(stss[8+i*4:]))
+		if sample < 1 || sample > sampleCount {
+			return nil, errInvalidMP4
+		}
+		sync = append(sync, sample-1)
+	}
+	return sync, nil
+}
@@ -0,0 +1,400 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	idEBML           = 0x1A45DFA3
+	idSegment        = 0x18538067
+	idInfo           = 0x1549A966
+	idTimecodeScale  = 0x2AD7B1
+	idTracks         = 0x1654AE6B
+	idTrackEntry     = 0xAE
+	idTrackNumber    = 0xD7
+	idTrackType      = 0x83
+	idCluster        = 0x1F43B675
+	idTimecode       = 0xE7
+	idSimpleBlock    = 0xA3
+	idBlockGroup     = 0xA0
+	idBlock          = 0xA1
+	idReferenceBlock = 0xFB
+
+	trackTypeVideo       = 1
+	defaultTimecodeScale = 1000000
+	keyframeFlag         = 0x80
+)
+
+var errInvalidWebM = errors.New("invalid webm")
+
+// level 1 elements end a cluster of unknown size
+var segmentChildren = map[uint64]bool{
+	idInfo:     true,
+	idTracks:   true,
+	idCluster:  true,
+	0x114D9B74: true, // SeekHead
+	0x1C53BB6B: true, // Cues
+	0x1254C367: true, // Tags
+	0x1043A770: true, // Chapters
+	0x1941A469: true, // Attachments
+}
+
+type element struct {
+	id      uint64
+	offset  int64 // offset of the element id
+	data    int64 // offset of the element payload
+	size    int64
+	unknown bool
+}
+
+type webmReader struct {
+	r      io.ReadSeeker
+	offset int64
+	buf    [8]byte
+
+	timecodeScale uint64
+	videoTrack    uint64
+	keyframes     []Keyframe
+}
+
+func readWebM(r io.ReadSeeker) ([]Keyframe, error) {
+	w := &webmReader{
+		r:             r,
+		timecodeScale: defaultTimecodeScale,
+	}
+
+	for {
+		el, err := w.readElement()
+		if err == io.EOF {
+			return w.keyframes, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch el.id {
+		case idSegment:
+			if err = w.readSegment(el); err != nil {
+				return nil, err
+			}
+			return w.keyframes, nil
+		default:
+			if err = w.skip(el); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (w *webmReader) readSegment(segment *element) error {
+	for segment.unknown || w.offset < segment.data+segment.size {
+		el, err := w.readElement()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch el.id {
+		case idInfo:
+			b, err := w.readPayload(el)
+			if err != nil {
+				return err
+			}
+			if scale, ok := findUint(b, idTimecodeScale); ok {
+				w.timecodeScale = scale
+			}
+
+		case idTracks:
+			b, err := w.readPayload(el)
+			if err != nil {
+				return err
+			}
+			w.readTracks(b)
+
+		case idCluster:
+			if err = w.readCluster(el); err != nil {
+				return err
+			}
+
+		default:
+			if err = w.skip(el); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *webmReader) readTracks(b []byte) {
+	for _, entry := range findChildren(b, idTrackEntry) {
+		trackType, _ := findUint(entry, idTrackType)
+		if trackType != trackTypeVideo {
+			continue
+		}
+		if number, ok := findUint(entry, idTrackNumber); ok {
+			w.videoTrack = number
+			return
+		}
+	}
+}
+
+func (w *webmReader) readCluster(cluster *element) error {
+	var timecode uint64
+	for cluster.unknown || w.offset < cluster.data+cluster.size {
+		el, err := w.readElement()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if cluster.unknown && segmentChildren[el.id] {
+			// start of the next cluster or top level element
+			w.offset = el.offset
+			_, err = w.r.Seek(w.offset, io.SeekStart)
+			return err
+		}
+
+		switch el.id {
+		case idTimecode:
+			b, err := w.readPayload(el)
+			if err != nil {
+				return err
+			}
+			timecode = readUint(b)
+
+		case idSimpleBlock:
+			track, relative, flags, err := w.readBlockHeader(el)
+			if err != nil {
+				return err
+			}
+			if track == w.videoTrack && flags&keyframeFlag != 0 {
+				w.addKeyframe(timecode, relative, el.offset)
+			}
+
+		case idBlockGroup:
+			if err = w.readBlockGroup(el, timecode); err != nil {
+				return err
+			}
+
+		default:
+			if err = w.skip(el); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// a block group is a keyframe when it has no reference blocks
+func (w *webmReader) readBlockGroup(group *element, timecode uint64) error {
+	var track uint64
+	var relative int16
+	hasBlock := false
+	hasReference := false
+
+	for w.offset < group.data+group.size {
+		el, err := w.readElement()
+		if err != nil {
+			return err
+		}
+
+		switch el.id {
+		case idBlock:
+			track, relative, _, err = w.readBlockHeader(el)
+			if err != nil {
+				return err
+			}
+			hasBlock = true
+		case idReferenceBlock:
+			hasReference = true
+			if err = w.skip(el); err != nil {
+				return err
+			}
+		default:
+			if err = w.skip(el); err != nil {
+				return err
+			}
+		}
+	}
+
+	if hasBlock && !hasReference && track == w.videoTrack {
+		w.addKeyframe(timecode, relative, group.offset)
+	}
+	return nil
+}
+
+func (w *webmReader) addKeyframe(clusterTimecode uint64, relative int16, offset int64) {
+	w.keyframes = append(w.keyframes, Keyframe{
+		PTS:    (int64(clusterTimecode) + int64(relative)) * int64(w.timecodeScale),
+		Offset: offset,
+	})
+}
+
+// readBlockHeader reads the track number, relative timecode and flags, then skips the frame data
+func (w *webmReader) readBlockHeader(el *element) (uint64, int16, byte, error) {
+	track, _, _, err := w.readVint(false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if _, err = io.ReadFull(w.r, w.buf[:3]); err != nil {
+		return 0, 0, 0, err
+	}
+	w.offset += 3
+
+	relative := int16(binary.BigEndian.Uint16(w.buf[:2]))
+	flags := w.buf[2]
+	return track, relative, flags, w.skip(el)
+}
+
+func (w *webmReader) readElement() (*element, error) {
+	offset := w.offset
+	id, _, _, err := w.readVint(true)
+	if err != nil {
+		return nil, err
+	}
+	size, _, unknown, err := w.readVint(false)
+	if err == io.EOF {
+		return nil, errInvalidWebM
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &element{
+		id:      id,
+		offset:  offset,
+		data:    w.offset,
+		size:    int64(size),
+		unknown: unknown,
+	}, nil
+}
+
+// readVint reads an EBML variable length integer, keeping the length marker for element ids
+func (w *webmReader) readVint(keepMarker bool) (uint64, int, bool, error) {
+	if _, err := io.ReadFull(w.r, w.buf[:1]); err != nil {
+		return 0, 0, false, err
+	}
+
+	first := w.buf[0]
+	length := 1
+	for mask := byte(0x80); length <= 8 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, false, errInvalidWebM
+	}
+	if length > 1 {
+		if _, err := io.ReadFull(w.r, w.buf[1:length]); err != nil {
+			return 0, 0, false, errInvalidWebM
+		}
+	}
+	w.offset += int64(length)
+
+	value := uint64(first)
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64(w.buf[i])
+		allOnes = allOnes && w.buf[i] == 0xFF
+	}
+
+	return value, length, !keepMarker && allOnes, nil
+}
+
+func (w *webmReader) readPayload(el *element) ([]byte, error) {
+	if el.unknown {
+		return nil, errInvalidWebM
+	}
+	b := make([]byte, el.size)
+	if _, err := io.ReadFull(w.r, b); err != nil {
+		return nil, err
+	}
+	w.offset = el.data + el.size
+	return b, nil
+}
+
+func (w *webmReader) skip(el *element) error {
+	if el.unknown {
+		return errInvalidWebM
+	}
+	w.offset = el.data + el.size
+	_, err := w.r.Seek(w.offset, io.SeekStart)
+	return err
+}
+
+// findChildren returns the payloads of direct children of an in-memory master element
+func findChildren(b []byte, id uint64) [][]byte {
+	var children [][]byte
+	for len(b) > 0 {
+		childID, n := parseVint(b, true)
+		if n == 0 {
+			break
+		}
+		size, m := parseVint(b[n:], false)
+		if m == 0 || uint64(len(b)-n-m) < size {
+			break
+		}
+		start := n + m
+		if childID == id {
+			children = append(children, b[start:start+int(size)])
+		}
+		b = b[start+int(size):]
+	}
+	return children
+}
+
+func findUint(b []byte, id uint64) (uint64, bool) {
+	children := findChildren(b, id)
+	if len(children) == 0 {
+		return 0, false
+	}
+	return readUint(children[0]), true
+}
+
+func parseVint(b []byte, keepMarker bool) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(b) < length {
+		return 0, 0
+	}
+
+	value := uint64(b[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	for i := 1; i < length; i++ {
+		value = value<<8 | uint64(b[i])
+	}
+	return value, length
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -31,14 +31,22 @@ const (
 	PlaylistTypeEvent PlaylistType = "EVENT"
 )
 
+const (
+	discontinuityTag = "#EXT-X-DISCONTINUITY\n"
+	keyTagFormat     = "#EXT-X-KEY:METHOD=AES-128,URI=\"%s\"\n"
+)
+
 type PlaylistWriter interface {
 	Append(dateTime time.Time, duration float64, filename string) error
+	AppendDiscontinuity() error
+	AppendKey(uri string) error
 	Close() error
 }
 
 type basePlaylistWriter struct {
-	filename       string
-	targetDuration int
+	filename            string
+	targetDuration      int
+	independentSegments bool
 }
 
 type eventPlaylistWriter struct {
@@ -48,13 +56,23 @@ type eventPlaylistWriter struct {
 type livePlaylistWriter struct {
 	basePlaylistWriter
 
-	windowSize int
-	mediaSeq   int
+	windowSize       int
+	mediaSeq         int
+	discontinuitySeq int
+	discontinuity    bool
+	keyTag           string
+	keyChanged       bool
 
 	livePlaylistHeader   string
 	livePlaylistSegments *list.List
 }
 
+type liveSegment struct {
+	entry     string
+	keyTag    string // key in effect for the segment
+	hasKeyTag bool   // entry starts a new key
+}
+
 func (p *basePlaylistWriter) createHeader(plType PlaylistType) string {
 	var sb strings.Builder
 	sb.WriteString("#EXTM3U\n")
@@ -64,6 +82,9 @@ func (p *basePlaylistWriter) createHeader(plType PlaylistType) string {
 	}
 	sb.WriteString("#EXT-X-ALLOW-CACHE:NO\n")
 	sb.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", p.targetDuration))
+	if p.independentSegments {
+		sb.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	}
 	if plType != PlaylistTypeLive {
 		sb.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
 	}
@@ -85,11 +106,14 @@ func (p *basePlaylistWriter) createSegmentEntry(dateTime time.Time, duration flo
 	return sb.String()
 }
 
-func NewEventPlaylistWriter(filename string, targetDuration int) (PlaylistWriter, error) {
+// NewEventPlaylistWriter creates an event playlist. independentSegments should be set when every
+// segment can be decoded on its own, such as audio-only segments
+func NewEventPlaylistWriter(filename string, targetDuration int, independentSegments bool) (PlaylistWriter, error) {
 	p := &eventPlaylistWriter{
 		basePlaylistWriter: basePlaylistWriter{
-			filename:       filename,
-			targetDuration: targetDuration,
+			filename:            filename,
+			targetDuration:      targetDuration,
+			independentSegments: independentSegments,
 		},
 	}
 
@@ -107,6 +131,19 @@ func NewEventPlaylistWriter(filename string, targetDuration int) (PlaylistWriter
 	return p, nil
 }
 
+// ResumeEventPlaylistWriter appends to an event playlist written before, such as one left behind by a crashed handler
+func ResumeEventPlaylistWriter(filename string) (PlaylistWriter, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+
+	return &eventPlaylistWriter{
+		basePlaylistWriter: basePlaylistWriter{
+			filename: filename,
+		},
+	}, nil
+}
+
 func (p *eventPlaylistWriter) Append(dateTime time.Time, duration float64, filename string) error {
 	f, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_APPEND, fs.ModeAppend)
 	if err != nil {
@@ -118,6 +155,29 @@ func (p *eventPlaylistWriter) Append(dateTime time.Time, duration float64, filen
 	return err
 }
 
+func (p *eventPlaylistWriter) AppendDiscontinuity() error {
+	f, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_APPEND, fs.ModeAppend)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(discontinuityTag)
+	return err
+}
+
+// AppendKey applies an AES-128 key to the segments that follow, with the media sequence number as the IV
+func (p *eventPlaylistWriter) AppendKey(uri string) error {
+	f, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_APPEND, fs.ModeAppend)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(fmt.Sprintf(keyTagFormat, uri))
+	return err
+}
+
 // Close sliding playlist and make them fixed.
 func (p *eventPlaylistWriter) Close() error {
 	f, err := os.OpenFile(p.filename, os.O_WRONLY|os.O_APPEND, fs.ModeAppend)
@@ -130,11 +190,12 @@ func (p *eventPlaylistWriter) Close() error {
 	return err
 }
 
-func NewLivePlaylistWriter(filename string, targetDuration int, windowSize int) (PlaylistWriter, error) {
+func NewLivePlaylistWriter(filename string, targetDuration int, windowSize int, independentSegments bool) (PlaylistWriter, error) {
 	p := &livePlaylistWriter{
 		basePlaylistWriter: basePlaylistWriter{
-			filename:       filename,
-			targetDuration: targetDuration,
+			filename:            filename,
+			targetDuration:      targetDuration,
+			independentSegments: independentSegments,
 		},
 		windowSize:           windowSize,
 		livePlaylistSegments: list.New(),
@@ -152,11 +213,26 @@ func (p *livePlaylistWriter) Append(dateTime time.Time, duration float64, filena
 	}
 	defer f.Close()
 
-	segmentStr := p.createSegmentEntry(dateTime, duration, filename)
-	p.livePlaylistSegments.PushBack(segmentStr)
+	segment := liveSegment{
+		entry:  p.createSegmentEntry(dateTime, duration, filename),
+		keyTag: p.keyTag,
+	}
+	if p.keyChanged {
+		segment.entry = p.keyTag + segment.entry
+		segment.hasKeyTag = true
+		p.keyChanged = false
+	}
+	if p.discontinuity {
+		segment.entry = discontinuityTag + segment.entry
+		p.discontinuity = false
+	}
+	p.livePlaylistSegments.PushBack(segment)
 
 	for p.livePlaylistSegments.Len() > p.windowSize {
-		p.livePlaylistSegments.Remove(p.livePlaylistSegments.Front())
+		front := p.livePlaylistSegments.Remove(p.livePlaylistSegments.Front()).(liveSegment)
+		if strings.HasPrefix(front.entry, discontinuityTag) {
+			p.discontinuitySeq++
+		}
 		p.mediaSeq++
 	}
 
@@ -164,6 +240,19 @@ func (p *livePlaylistWriter) Append(dateTime time.Time, duration float64, filena
 	return err
 }
 
+// AppendDiscontinuity tags the next appended segment
+func (p *livePlaylistWriter) AppendDiscontinuity() error {
+	p.discontinuity = true
+	return nil
+}
+
+// AppendKey tags the next appended segment with a new key
+func (p *livePlaylistWriter) AppendKey(uri string) error {
+	p.keyTag = fmt.Sprintf(keyTagFormat, uri)
+	p.keyChanged = true
+	return nil
+}
+
 func (p *livePlaylistWriter) Close() error {
 	f, err := os.Create(p.filename)
 	if err != nil {
@@ -184,9 +273,16 @@ func (p *livePlaylistWriter) generatePlaylist() string {
 	var sb strings.Builder
 	sb.WriteString(p.livePlaylistHeader)
 	sb.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", p.mediaSeq))
+	if p.discontinuitySeq > 0 {
+		sb.WriteString(fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", p.discontinuitySeq))
+	}
 	for elem := p.livePlaylistSegments.Front(); elem != nil; elem = elem.Next() {
-		segmentStr := elem.Value.(string)
-		sb.WriteString(segmentStr)
+		segment := elem.Value.(liveSegment)
+		if elem == p.livePlaylistSegments.Front() && segment.keyTag != "" && !segment.hasKeyTag {
+			// the tag that started this key has left the window
+			sb.WriteString(segment.keyTag)
+		}
+		sb.WriteString(segment.entry)
 	}
 
 	return sb.String()
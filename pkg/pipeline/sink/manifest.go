@@ -19,12 +19,14 @@ import (
 	"os"
 
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/encryption"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/types"
 )
 
 type Manifest struct {
 	EgressID          string `json:"egress_id,omitempty"`
+	CorrelationID     string `json:"correlation_id,omitempty"`
 	RoomID            string `json:"room_id,omitempty"`
 	RoomName          string `json:"room_name,omitempty"`
 	Url               string `json:"url,omitempty"`
@@ -37,6 +39,11 @@ type Manifest struct {
 	AudioTrackID      string `json:"audio_track_id,omitempty"`
 	VideoTrackID      string `json:"video_track_id,omitempty"`
 	SegmentCount      int64  `json:"segment_count,omitempty"`
+
+	Chunks     []*config.FileChunk          `json:"chunks,omitempty"`     // rotated file outputs
+	Waveform   *config.FileArtifact         `json:"waveform,omitempty"`   // waveform png of an audio only file output
+	Encryption *encryption.UploadEncryption `json:"encryption,omitempty"` // set when outputs were encrypted before upload
+	Uploads    []*uploader.UploadResult     `json:"uploads,omitempty"`    // files not stored by the primary destination
 }
 
 func uploadManifest(p *config.PipelineConfig, u uploader.Uploader, localFilepath, storageFilepath string) error {
@@ -45,7 +52,7 @@ func uploadManifest(p *config.PipelineConfig, u uploader.Uploader, localFilepath
 		return err
 	}
 
-	b, err := getManifest(p)
+	b, err := getManifest(p, u.Encryption(), u.Results())
 	if err != nil {
 		return err
 	}
@@ -60,12 +67,18 @@ func uploadManifest(p *config.PipelineConfig, u uploader.Uploader, localFilepath
 	return err
 }
 
-func getManifest(p *config.PipelineConfig) ([]byte, error) {
+func getManifest(p *config.PipelineConfig, enc *encryption.UploadEncryption, uploads []*uploader.UploadResult) ([]byte, error) {
 	manifest := initManifest(p)
+	manifest.Encryption = enc
+	manifest.Uploads = uploads
 
 	if o := p.GetSegmentConfig(); o != nil {
 		manifest.SegmentCount = o.SegmentsInfo.SegmentCount
 	}
+	if o := p.GetFileConfig(); o != nil {
+		manifest.Chunks = o.Chunks
+		manifest.Waveform = o.Waveform
+	}
 
 	return json.Marshal(manifest)
 }
@@ -73,6 +86,7 @@ func getManifest(p *config.PipelineConfig) ([]byte, error) {
 func initManifest(p *config.PipelineConfig) Manifest {
 	return Manifest{
 		EgressID:          p.Info.EgressId,
+		CorrelationID:     p.CorrelationID,
 		RoomID:            p.Info.RoomId,
 		RoomName:          p.Info.RoomName,
 		Url:               p.WebUrl,
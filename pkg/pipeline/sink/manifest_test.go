@@ -0,0 +1,56 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestManifest(t *testing.T) {
+	o := &config.FileConfig{
+		Waveform: &config.FileArtifact{
+			Filename: "recording.ogg.waveform.png",
+			Location: "https://bucket.s3.amazonaws.com/recording.ogg.waveform.png",
+			Size:     2048,
+		},
+	}
+	p := &config.PipelineConfig{
+		Info:    &livekit.EgressInfo{EgressId: "EG_abc123"},
+		Outputs: map[types.EgressType][]config.OutputConfig{types.EgressTypeFile: {o}},
+	}
+
+	uploads := []*uploader.UploadResult{{
+		Filename:    "recording.ogg",
+		Destination: "fallback",
+		Errors:      []string{"AccessDenied: access denied"},
+	}}
+
+	b, err := getManifest(p, nil, uploads)
+	require.NoError(t, err)
+
+	manifest := &Manifest{}
+	require.NoError(t, json.Unmarshal(b, manifest))
+	require.Equal(t, "EG_abc123", manifest.EgressID)
+	require.Equal(t, o.Waveform, manifest.Waveform)
+	require.Equal(t, uploads, manifest.Uploads)
+}
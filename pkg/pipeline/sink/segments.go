@@ -23,10 +23,12 @@ import (
 	"time"
 
 	"github.com/frostbyte73/core"
+	"go.uber.org/atomic"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/sink/encryption"
 	"github.com/livekit/egress/pkg/pipeline/sink/m3u8"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/stats"
@@ -58,22 +60,32 @@ type SegmentSink struct {
 	outputType            types.OutputType
 	startRunningTime      uint64
 	openSegmentsStartTime map[string]uint64
+	discontinuity         bool
+	discontinuities       map[string]struct{}
+	pending               []*config.RecoverySegment // closed, not yet in the playlist. Only kept for crash recovery
+
+	key      *segmentKey
+	sequence uint64
 
 	closedSegments  chan SegmentUpdate
 	playlistUpdates chan SegmentUpdate
 	throttle        core.Throttle
 	done            core.Fuse
+	discarded       atomic.Bool
 }
 
 type SegmentUpdate struct {
 	endTime        uint64
 	filename       string
+	sequence       uint64
+	keyURI         string // set on the first segment encrypted with a new key
 	uploadComplete chan struct{}
+	uploadedAt     *time.Time // set before uploadComplete is closed, left zero if the upload failed
 }
 
 func newSegmentSink(u uploader.Uploader, p *config.PipelineConfig, o *config.SegmentConfig, callbacks *gstreamer.Callbacks, monitor *stats.HandlerMonitor) (*SegmentSink, error) {
 	playlistName := path.Join(o.LocalDir, o.PlaylistFilename)
-	playlist, err := m3u8.NewEventPlaylistWriter(playlistName, o.SegmentDuration)
+	playlist, err := m3u8.NewEventPlaylistWriter(playlistName, o.SegmentDuration, o.AudioOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +93,7 @@ func newSegmentSink(u uploader.Uploader, p *config.PipelineConfig, o *config.Seg
 	var livePlaylist m3u8.PlaylistWriter
 	if o.LivePlaylistFilename != "" {
 		playlistName = path.Join(o.LocalDir, o.LivePlaylistFilename)
-		livePlaylist, err = m3u8.NewLivePlaylistWriter(playlistName, o.SegmentDuration, defaultLivePlaylistWindow)
+		livePlaylist, err = m3u8.NewLivePlaylistWriter(playlistName, o.SegmentDuration, defaultLivePlaylistWindow, o.AudioOnly)
 		if err != nil {
 			return nil, err
 		}
@@ -101,6 +113,7 @@ func newSegmentSink(u uploader.Uploader, p *config.PipelineConfig, o *config.Seg
 		livePlaylist:          livePlaylist,
 		outputType:            outputType,
 		openSegmentsStartTime: make(map[string]uint64),
+		discontinuities:       make(map[string]struct{}),
 		closedSegments:        make(chan SegmentUpdate, maxPendingUploads),
 		playlistUpdates:       make(chan SegmentUpdate, maxPendingUploads),
 		throttle:              core.NewThrottle(time.Second * 2),
@@ -142,6 +155,27 @@ func (s *SegmentSink) Start() error {
 }
 
 func (s *SegmentSink) handleClosedSegment(update SegmentUpdate) {
+	if s.discarded.Load() {
+		return
+	}
+
+	var key *segmentKey
+	sequence := s.sequence
+	if s.conf.HLSEncryption.Enabled {
+		if sequence%uint64(s.conf.HLSEncryption.RotationInterval) == 0 {
+			var err error
+			if key, err = s.newKey(); err != nil {
+				s.callbacks.OnError(err)
+				return
+			}
+			s.key = key
+			update.keyURI = key.URI
+		}
+		key = s.key
+	}
+	update.sequence = sequence
+	s.sequence++
+
 	// keep playlist updates in order
 	s.playlistUpdates <- update
 
@@ -152,8 +186,28 @@ func (s *SegmentSink) handleClosedSegment(update SegmentUpdate) {
 	go func() {
 		defer close(update.uploadComplete)
 
+		if key != nil {
+			if update.keyURI != "" {
+				// the key is available before any playlist references it
+				s.publishKey(key)
+			}
+			if err := key.EncryptFile(segmentLocalPath, sequence); err != nil {
+				s.callbacks.OnError(errors.ErrUploadFailed(update.filename, err))
+				return
+			}
+			// segments encrypted with an unpublished key are never added to the playlist
+			<-key.published.Watch()
+			if key.err != nil {
+				if update.keyURI != "" {
+					s.callbacks.OnError(key.err)
+				}
+				return
+			}
+		}
+
 		_, size, err := s.Upload(segmentLocalPath, segmentStoragePath, s.outputType, true, "segment")
 		if err != nil {
+			reportRetained(s.conf, s.callbacks, segmentLocalPath, segmentStoragePath)
 			s.callbacks.OnError(err)
 			return
 		}
@@ -163,10 +217,68 @@ func (s *SegmentSink) handleClosedSegment(update SegmentUpdate) {
 		s.SegmentsInfo.SegmentCount++
 		s.SegmentsInfo.Size += size
 		s.infoLock.Unlock()
+
+		*update.uploadedAt = time.Now()
 	}()
 }
 
+// Progress returns the bytes and segments uploaded so far
+func (s *SegmentSink) Progress() (size int64, count int64) {
+	s.infoLock.Lock()
+	defer s.infoLock.Unlock()
+
+	return s.SegmentsInfo.Size, s.SegmentsInfo.SegmentCount
+}
+
+// segmentKey is the key for rotation_interval segments, usable once it has been published or uploaded
+type segmentKey struct {
+	*encryption.Key
+	published core.Fuse
+	err       error // set before published is broken
+}
+
+// newKey creates the key for the next rotation_interval segments. It is published by the upload worker
+func (s *SegmentSink) newKey() (*segmentKey, error) {
+	o := s.conf.HLSEncryption
+	filename := fmt.Sprintf("%s_%05d.key", s.SegmentPrefix, s.sequence/uint64(o.RotationInterval))
+	key, err := encryption.NewKey(filename, o.KeyURI+filename)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentKey{
+		Key:       key,
+		published: core.NewFuse(),
+	}, nil
+}
+
+// publishKey publishes or uploads the key, then marks it usable
+func (s *SegmentSink) publishKey(key *segmentKey) {
+	defer key.published.Break()
+
+	o := s.conf.HLSEncryption
+	var err error
+	if o.KeyEndpoint != "" {
+		err = key.Publish(o.KeyEndpoint, s.conf.Info.EgressId)
+	} else {
+		keyLocalPath := path.Join(s.LocalDir, key.Filename)
+		keyStoragePath := path.Join(s.StorageDir, key.Filename)
+		if err = key.Write(keyLocalPath); err == nil {
+			_, _, err = s.Upload(keyLocalPath, keyStoragePath, types.OutputTypeBlob, false, "key")
+		}
+	}
+	if err != nil {
+		key.err = errors.ErrUploadFailed(key.Filename, err)
+		return
+	}
+	logger.Debugw("published segment key", "key", key.Filename)
+}
+
 func (s *SegmentSink) handlePlaylistUpdates(update SegmentUpdate) error {
+	if s.discarded.Load() {
+		<-update.uploadComplete
+		return nil
+	}
+
 	s.segmentLock.Lock()
 	t, ok := s.openSegmentsStartTime[update.filename]
 	if !ok {
@@ -174,15 +286,33 @@ func (s *SegmentSink) handlePlaylistUpdates(update SegmentUpdate) error {
 		return fmt.Errorf("no open segment with the name %s", update.filename)
 	}
 	delete(s.openSegmentsStartTime, update.filename)
+	_, discontinuity := s.discontinuities[update.filename]
+	delete(s.discontinuities, update.filename)
 	s.segmentLock.Unlock()
 
-	duration := float64(time.Duration(update.endTime-t)) / float64(time.Second)
+	segmentDuration := time.Duration(update.endTime - t)
+	duration := float64(segmentDuration) / float64(time.Second)
 	segmentStartTime := s.startTime.Add(time.Duration(t - s.startRunningTime))
 
 	// do not update playlist until upload is complete
 	<-update.uploadComplete
+	if !update.uploadedAt.IsZero() {
+		s.callbacks.OnSegmentUploaded(update.filename, update.sequence, segmentDuration, *update.uploadedAt)
+	}
 
 	s.playlistLock.Lock()
+	if discontinuity {
+		if err := s.appendDiscontinuity(); err != nil {
+			s.playlistLock.Unlock()
+			return err
+		}
+	}
+	if update.keyURI != "" {
+		if err := s.appendKey(update.keyURI); err != nil {
+			s.playlistLock.Unlock()
+			return err
+		}
+	}
 	if err := s.playlist.Append(segmentStartTime, duration, update.filename); err != nil {
 		s.playlistLock.Unlock()
 		return err
@@ -194,9 +324,14 @@ func (s *SegmentSink) handlePlaylistUpdates(update SegmentUpdate) error {
 		}
 	}
 	s.playlistLock.Unlock()
+	s.removePending(update.filename)
 
 	// throttle playlist uploads
 	s.throttle(func() {
+		if s.discarded.Load() {
+			return
+		}
+
 		s.playlistLock.Lock()
 		defer s.playlistLock.Unlock()
 
@@ -213,6 +348,34 @@ func (s *SegmentSink) handlePlaylistUpdates(update SegmentUpdate) error {
 	return nil
 }
 
+func (s *SegmentSink) appendDiscontinuity() error {
+	if err := s.playlist.AppendDiscontinuity(); err != nil {
+		return err
+	}
+	if s.livePlaylist != nil {
+		return s.livePlaylist.AppendDiscontinuity()
+	}
+	return nil
+}
+
+func (s *SegmentSink) appendKey(uri string) error {
+	if err := s.playlist.AppendKey(uri); err != nil {
+		return err
+	}
+	if s.livePlaylist != nil {
+		return s.livePlaylist.AppendKey(uri)
+	}
+	return nil
+}
+
+// Discontinuity marks the next segment as following a source discontinuity
+func (s *SegmentSink) Discontinuity() {
+	s.segmentLock.Lock()
+	defer s.segmentLock.Unlock()
+
+	s.discontinuity = true
+}
+
 func (s *SegmentSink) UpdateStartDate(t time.Time) {
 	s.segmentLock.Lock()
 	defer s.segmentLock.Unlock()
@@ -240,6 +403,10 @@ func (s *SegmentSink) FragmentOpened(filepath string, startTime uint64) error {
 	}
 
 	s.openSegmentsStartTime[filename] = startTime
+	if s.discontinuity {
+		s.discontinuities[filename] = struct{}{}
+		s.discontinuity = false
+	}
 	return nil
 }
 
@@ -249,12 +416,16 @@ func (s *SegmentSink) FragmentClosed(filepath string, endTime uint64) error {
 	}
 
 	filename := filepath[len(s.LocalDir):]
+	if s.conf.CrashRecovery {
+		s.addPending(filename, endTime)
+	}
 
 	select {
 	case s.closedSegments <- SegmentUpdate{
 		filename:       filename,
 		endTime:        endTime,
 		uploadComplete: make(chan struct{}),
+		uploadedAt:     &time.Time{},
 	}:
 		return nil
 
@@ -265,10 +436,70 @@ func (s *SegmentSink) FragmentClosed(filepath string, endTime uint64) error {
 	}
 }
 
+func (s *SegmentSink) addPending(filename string, endTime uint64) {
+	s.segmentLock.Lock()
+	defer s.segmentLock.Unlock()
+
+	t, ok := s.openSegmentsStartTime[filename]
+	if !ok {
+		return
+	}
+	_, discontinuity := s.discontinuities[filename]
+	s.pending = append(s.pending, &config.RecoverySegment{
+		Filename:      filename,
+		StartedAt:     s.startTime.Add(time.Duration(t - s.startRunningTime)).UnixNano(),
+		Duration:      int64(endTime - t),
+		Discontinuity: discontinuity,
+	})
+}
+
+func (s *SegmentSink) removePending(filename string) {
+	s.segmentLock.Lock()
+	defer s.segmentLock.Unlock()
+
+	for i, segment := range s.pending {
+		if segment.Filename == filename {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// RecoveryState lists the segments closed but not yet in the playlist, so that they can be uploaded and the playlist
+// finalized if the handler crashes. It returns nil with hls encryption, since the keys are not kept
+func (s *SegmentSink) RecoveryState() *config.RecoveryState {
+	if s.conf.HLSEncryption.Enabled {
+		return nil
+	}
+
+	s.segmentLock.Lock()
+	defer s.segmentLock.Unlock()
+
+	state := &config.RecoveryState{
+		EgressID:   s.conf.Info.EgressId,
+		OutputType: s.outputType,
+		Segments: &config.RecoverySegments{
+			LocalDir:             s.LocalDir,
+			StorageDir:           s.StorageDir,
+			PlaylistFilename:     s.PlaylistFilename,
+			LivePlaylistFilename: s.LivePlaylistFilename,
+			Pending:              make([]*config.RecoverySegment, 0, len(s.pending)),
+		},
+	}
+	for _, p := range s.pending {
+		segment := *p
+		state.Segments.Pending = append(state.Segments.Pending, &segment)
+	}
+	return state
+}
+
 func (s *SegmentSink) Close() error {
 	// wait for pending jobs to finish
 	close(s.closedSegments)
 	<-s.done.Watch()
+	if s.discarded.Load() {
+		return nil
+	}
 
 	s.playlistLock.Lock()
 	defer s.playlistLock.Unlock()
@@ -302,11 +533,23 @@ func (s *SegmentSink) Close() error {
 	return nil
 }
 
+// Discard skips segment and playlist uploads not yet started
+func (s *SegmentSink) Discard() {
+	s.discarded.Store(true)
+}
+
 func (s *SegmentSink) Cleanup() {
 	if s.LocalDir == s.StorageDir {
 		return
 	}
 
+	if !s.discarded.Load() && retainLocalFiles(s.conf, s.Uploader, s.LocalDir) {
+		if s.SegmentsInfo.PlaylistLocation == "" {
+			s.SegmentsInfo.PlaylistLocation = path.Join(s.LocalDir, s.PlaylistFilename)
+		}
+		return
+	}
+
 	if s.LocalDir != "" {
 		logger.Debugw("removing temporary directory", "path", s.LocalDir)
 		if err := os.RemoveAll(s.LocalDir); err != nil {
@@ -15,13 +15,29 @@
 package sink
 
 import (
+	"os"
+	"sync"
+
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/sink/encryption"
 	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
 	"github.com/livekit/egress/pkg/stats"
 	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
 )
 
+// fileResultsMu guards appends to the egress info's file results, made by chunk and segment upload workers
+var fileResultsMu sync.Mutex
+
+func appendFileResult(p *config.PipelineConfig, result *livekit.FileInfo) {
+	fileResultsMu.Lock()
+	defer fileResultsMu.Unlock()
+	p.Info.FileResults = append(p.Info.FileResults, result)
+}
+
 type Sink interface {
 	Start() error
 	Close() error
@@ -29,6 +45,11 @@ type Sink interface {
 }
 
 func CreateSinks(p *config.PipelineConfig, callbacks *gstreamer.Callbacks, monitor *stats.HandlerMonitor) (map[types.EgressType][]Sink, error) {
+	key, err := newUploadKey(p)
+	if err != nil {
+		return nil, err
+	}
+
 	sinks := make(map[types.EgressType][]Sink)
 	for egressType, c := range p.Outputs {
 		if len(c) == 0 {
@@ -41,17 +62,17 @@ func CreateSinks(p *config.PipelineConfig, callbacks *gstreamer.Callbacks, monit
 		case types.EgressTypeFile:
 			o := c[0].(*config.FileConfig)
 
-			u, err := uploader.New(o.UploadConfig, p.BackupStorage, monitor)
+			u, err := uploader.New(o.UploadConfig, p.ToFallbackUploadConfig(), p.BackupStorage, p.UploadRetry, p.MultipartUpload, p.HostOverrides, p.UploadMetadata(), key, monitor)
 			if err != nil {
 				return nil, err
 			}
 
-			s = newFileSink(u, p, o)
+			s = newFileSink(u, p, o, callbacks)
 
 		case types.EgressTypeSegments:
 			o := c[0].(*config.SegmentConfig)
 
-			u, err := uploader.New(o.UploadConfig, p.BackupStorage, monitor)
+			u, err := uploader.New(o.UploadConfig, p.ToFallbackUploadConfig(), p.BackupStorage, p.UploadRetry, p.MultipartUpload, p.HostOverrides, p.UploadMetadata(), key, monitor)
 			if err != nil {
 				return nil, err
 			}
@@ -75,7 +96,7 @@ func CreateSinks(p *config.PipelineConfig, callbacks *gstreamer.Callbacks, monit
 			for _, ci := range c {
 				o := ci.(*config.ImageConfig)
 
-				u, err := uploader.New(o.UploadConfig, p.BackupStorage, monitor)
+				u, err := uploader.New(o.UploadConfig, p.ToFallbackUploadConfig(), p.BackupStorage, p.UploadRetry, p.MultipartUpload, p.HostOverrides, p.UploadMetadata(), nil, monitor)
 				if err != nil {
 					return nil, err
 				}
@@ -94,3 +115,62 @@ func CreateSinks(p *config.PipelineConfig, callbacks *gstreamer.Callbacks, monit
 
 	return sinks, nil
 }
+
+// newUploadKey creates the data key shared by file and segment uploads, when upload encryption is enabled
+func newUploadKey(p *config.PipelineConfig) (*encryption.UploadKey, error) {
+	if !p.UploadEncryption.Enabled || (p.GetFileConfig() == nil && p.GetSegmentConfig() == nil) {
+		return nil, nil
+	}
+
+	if p.UploadEncryption.KMSKeyID != "" {
+		key, err := encryption.NewKMSUploadKey(p.UploadEncryption.KMSKeyID, p.UploadEncryption.KMSRegion)
+		if err != nil {
+			return nil, errors.ErrUploadEncryptionFailed(err)
+		}
+		return key, nil
+	}
+
+	b, err := p.UploadEncryption.DecodeKey()
+	if err != nil {
+		return nil, errors.ErrUploadEncryptionFailed(err)
+	}
+	key, err := encryption.NewUploadKey(b)
+	if err != nil {
+		return nil, errors.ErrUploadEncryptionFailed(err)
+	}
+	return key, nil
+}
+
+// retainLocalFiles returns true if local files should be kept for manual recovery after a failed upload
+func retainLocalFiles(p *config.PipelineConfig, u uploader.Uploader, localPath string) bool {
+	if !u.Failed() {
+		return false
+	}
+	if p.LocalFileCleanup == types.LocalFileCleanupForceDelete {
+		logger.Warnw("upload failed, deleting local files", nil, "path", localPath)
+		return false
+	}
+
+	logger.Warnw("upload failed, retaining local files", nil, "path", localPath)
+	return true
+}
+
+// reportRetained lists a file that could not be uploaded in the file results, with its local path as the location,
+// and sends an update so that it can be recovered before the egress ends
+func reportRetained(p *config.PipelineConfig, callbacks *gstreamer.Callbacks, localFilepath, storageFilepath string) {
+	if p.LocalFileCleanup == types.LocalFileCleanupForceDelete {
+		return
+	}
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return
+	}
+
+	logger.Warnw("upload failed, retaining local file", nil, "path", localFilepath)
+	appendFileResult(p, &livekit.FileInfo{
+		Filename: storageFilepath,
+		Size:     stat.Size(),
+		Location: localFilepath,
+	})
+	callbacks.OnOutputUpdated()
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+)
+
+// Summary is the post-mortem report for a single egress, produced whether or not it succeeded
+type Summary struct {
+	EgressID         string         `json:"egress_id"`
+	Status           string         `json:"status"`
+	Error            string         `json:"error,omitempty"`
+	ErrorCode        string         `json:"error_code,omitempty"`
+	StopReason       string         `json:"stop_reason,omitempty"` // stop_signal when the io service requested the stop, max_duration when max_duration was reached
+	StartedAt        int64          `json:"started_at,omitempty"`
+	EndedAt          int64          `json:"ended_at,omitempty"`
+	MediaDuration    int64          `json:"media_duration"` // nanoseconds from the first encoded buffer to the end of the recording
+	EncodedBytes     uint64         `json:"encoded_bytes"`
+	OutputBytes      int64          `json:"output_bytes"` // uploaded file and segment bytes
+	AvgBitrate       uint64         `json:"avg_bitrate"`  // bits per second over the media duration
+	PeakBitrate      uint64         `json:"peak_bitrate"` // highest bitrate over any one second interval
+	VideoFrames      uint64         `json:"video_frames"`
+	DroppedFrames    uint64         `json:"dropped_frames"`
+	Reconnects       int32          `json:"reconnects"`
+	Discontinuities  int32          `json:"discontinuities"` // discontinuities added to the playlist by source reconnects, segment egress only
+	Width            int32          `json:"width,omitempty"`
+	Height           int32          `json:"height,omitempty"`            // effective output resolution, after any cap to the source
+	VideoEncoder     string         `json:"video_encoder,omitempty"`     // h264 encoder, such as nvh264enc or x264enc
+	Participants     int            `json:"participants,omitempty"`      // participants with recorded tracks, sdk egress only
+	DisconnectReason string         `json:"disconnect_reason,omitempty"` // why the room connection ended, such as kicked or room_closed, sdk egress only
+	Uploads          SummaryUploads `json:"uploads"`
+}
+
+type SummaryUploads struct {
+	Count     int   `json:"count"`
+	Failures  int   `json:"failures"`
+	TotalTime int64 `json:"total_time_ms"`
+	MaxTime   int64 `json:"max_time_ms"`
+}
+
+// UploadSummary uploads the summary alongside the recording
+func (s *FileSink) UploadSummary(summary *Summary) error {
+	return uploadSummary(s.Uploader, summary,
+		fmt.Sprintf("%s.summary.json", s.LocalFilepath),
+		fmt.Sprintf("%s.summary.json", s.StorageFilepath),
+	)
+}
+
+// UploadSummary uploads the summary alongside the playlist
+func (s *SegmentSink) UploadSummary(summary *Summary) error {
+	return uploadSummary(s.Uploader, summary,
+		fmt.Sprintf("%s.summary.json", path.Join(s.LocalDir, s.PlaylistFilename)),
+		fmt.Sprintf("%s.summary.json", path.Join(s.StorageDir, s.PlaylistFilename)),
+	)
+}
+
+func uploadSummary(u uploader.Uploader, summary *Summary, localFilepath, storageFilepath string) error {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(localFilepath, b, 0644); err != nil {
+		return err
+	}
+
+	_, _, err = u.Upload(localFilepath, storageFilepath, types.OutputTypeJSON, false, "summary")
+	return err
+}
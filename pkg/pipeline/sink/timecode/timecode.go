@@ -0,0 +1,83 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timecode
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+// Write creates a subtitle file with one cue per interval, each showing the media running time.
+// Video timecodes are HH:MM:SS:FF at the output framerate, audio only timecodes are HH:MM:SS.mmm
+func Write(filepath string, format types.TimecodeFormat, duration, interval time.Duration, framerate int32) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid timecode interval %s", interval)
+	}
+
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if format == types.TimecodeFormatVTT {
+		_, _ = w.WriteString("WEBVTT\n\n")
+	}
+
+	for i, start := 1, time.Duration(0); start < duration; i, start = i+1, start+interval {
+		end := min(start+interval, duration)
+		if format == types.TimecodeFormatSRT {
+			_, _ = fmt.Fprintf(w, "%d\n", i)
+		}
+		_, _ = fmt.Fprintf(w, "%s --> %s\n%s\n\n",
+			cueTime(start, format), cueTime(end, format), Timecode(start, framerate),
+		)
+	}
+
+	return w.Flush()
+}
+
+// Timecode formats d as HH:MM:SS:FF, or HH:MM:SS.mmm when framerate is 0
+func Timecode(d time.Duration, framerate int32) string {
+	h, m, s := d/time.Hour, d/time.Minute%60, d/time.Second%60
+	if framerate <= 0 {
+		return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, d/time.Millisecond%1000)
+	}
+	frame := (d % time.Second) * time.Duration(framerate) / time.Second
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", h, m, s, frame)
+}
+
+// cueTime uses a comma before milliseconds for srt and a period for vtt
+func cueTime(d time.Duration, format types.TimecodeFormat) string {
+	sep := "."
+	if format == types.TimecodeFormatSRT {
+		sep = ","
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		d/time.Hour, d/time.Minute%60, d/time.Second%60, sep, d/time.Millisecond%1000,
+	)
+}
+
+func OutputType(format types.TimecodeFormat) types.OutputType {
+	if format == types.TimecodeFormatSRT {
+		return types.OutputTypeSRT
+	}
+	return types.OutputTypeVTT
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timecode
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestTimecode(t *testing.T) {
+	require.Equal(t, "01:02:03:15", Timecode(time.Hour+2*time.Minute+3*time.Second+500*time.Millisecond, 30))
+	require.Equal(t, "00:00:59.250", Timecode(59250*time.Millisecond, 0))
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	srt := path.Join(dir, "test.srt")
+	require.NoError(t, Write(srt, types.TimecodeFormatSRT, 2500*time.Millisecond, time.Second, 25))
+	b, err := os.ReadFile(srt)
+	require.NoError(t, err)
+	require.Equal(t, "1\n00:00:00,000 --> 00:00:01,000\n00:00:00:00\n\n"+
+		"2\n00:00:01,000 --> 00:00:02,000\n00:00:01:00\n\n"+
+		"3\n00:00:02,000 --> 00:00:02,500\n00:00:02:00\n\n", string(b))
+
+	vtt := path.Join(dir, "test.vtt")
+	require.NoError(t, Write(vtt, types.TimecodeFormatVTT, time.Second, time.Second, 0))
+	b, err = os.ReadFile(vtt)
+	require.NoError(t, err)
+	require.Equal(t, "WEBVTT\n\n00:00:00.000 --> 00:00:01.000\n00:00:00.000\n\n", string(b))
+}
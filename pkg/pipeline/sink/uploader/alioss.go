@@ -16,31 +16,49 @@ package uploader
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 
+	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 )
 
 type AliOSSUploader struct {
-	conf *livekit.AliOSSUpload
+	conf       *livekit.AliOSSUpload
+	options    []oss.ClientOption
+	putOptions []oss.Option
 }
 
-func newAliOSSUploader(conf *livekit.AliOSSUpload) (uploader, error) {
-	return &AliOSSUploader{
+func newAliOSSUploader(conf *livekit.AliOSSUpload, hosts config.HostOverrides, metadata map[string]string) (uploader, error) {
+	u := &AliOSSUploader{
 		conf: conf,
-	}, nil
+	}
+	for k, v := range metadata {
+		u.putOptions = append(u.putOptions, oss.Meta(k, v))
+	}
+
+	if len(hosts) > 0 {
+		// the oss client dials directly by default, which would bypass the overrides
+		u.options = append(u.options, oss.HTTPClient(&http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		}))
+	}
+
+	return u, nil
 }
 
-func (u *AliOSSUploader) upload(localFilePath, requestedPath string, _ types.OutputType) (string, int64, error) {
+func (u *AliOSSUploader) upload(localFilePath, requestedPath string, _ types.OutputType, objectMetadata map[string]string) (string, int64, error) {
 	stat, err := os.Stat(localFilePath)
 	if err != nil {
 		return "", 0, wrap("AliOSS", err)
 	}
 
-	client, err := oss.New(u.conf.Endpoint, u.conf.AccessKey, u.conf.Secret)
+	client, err := oss.New(u.conf.Endpoint, u.conf.AccessKey, u.conf.Secret, u.options...)
 	if err != nil {
 		return "", 0, wrap("AliOSS", err)
 	}
@@ -50,10 +68,55 @@ func (u *AliOSSUploader) upload(localFilePath, requestedPath string, _ types.Out
 		return "", 0, wrap("AliOSS", err)
 	}
 
-	err = bucket.PutObjectFromFile(requestedPath, localFilePath)
+	options := append([]oss.Option{}, u.putOptions...)
+	for k, v := range objectMetadata {
+		options = append(options, oss.Meta(k, v))
+	}
+
+	err = bucket.PutObjectFromFile(requestedPath, localFilePath, options...)
 	if err != nil {
 		return "", 0, wrap("AliOSS", err)
 	}
 
+	err = verifyStored("AliOSS", stat.Size(), func() (int64, error) {
+		meta, err := bucket.GetObjectDetailedMeta(requestedPath)
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(meta.Get(oss.HTTPHeaderContentLength), 10, 64)
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
 	return fmt.Sprintf("https://%s.%s/%s", u.conf.Bucket, u.conf.Endpoint, requestedPath), stat.Size(), nil
 }
+
+func (u *AliOSSUploader) check() error {
+	client, err := oss.New(u.conf.Endpoint, u.conf.AccessKey, u.conf.Secret, u.options...)
+	if err != nil {
+		return wrapCheck("AliOSS", err)
+	}
+	if _, err = client.GetBucketInfo(u.conf.Bucket); err != nil {
+		return wrapCheck("AliOSS", err)
+	}
+	return nil
+}
+
+func (u *AliOSSUploader) sign(requestedPath string, expiry time.Duration) (string, error) {
+	client, err := oss.New(u.conf.Endpoint, u.conf.AccessKey, u.conf.Secret, u.options...)
+	if err != nil {
+		return "", wrap("AliOSS", err)
+	}
+
+	bucket, err := client.Bucket(u.conf.Bucket)
+	if err != nil {
+		return "", wrap("AliOSS", err)
+	}
+
+	signed, err := bucket.SignURL(requestedPath, oss.HTTPGet, int64(expiry.Seconds()))
+	if err != nil {
+		return "", wrap("AliOSS", err)
+	}
+	return signed, nil
+}
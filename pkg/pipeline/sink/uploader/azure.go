@@ -15,13 +15,20 @@
 package uploader
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"math"
+	"net/http"
 	"net/url"
 	"os"
+	"time"
 
+	"github.com/Azure/azure-pipeline-go/pipeline"
 	"github.com/Azure/azure-storage-blob-go/azblob"
 
+	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 )
@@ -29,38 +36,80 @@ import (
 type AzureUploader struct {
 	conf      *livekit.AzureBlobUpload
 	container string
+	sender    pipeline.Factory
+	metadata  azblob.Metadata
+
+	blockSize   int64
+	parallelism uint16
 }
 
-func newAzureUploader(conf *livekit.AzureBlobUpload) (uploader, error) {
-	return &AzureUploader{
+func newAzureUploader(conf *livekit.AzureBlobUpload, parts config.MultipartUploadConfig, hosts config.HostOverrides, metadata map[string]string) (uploader, error) {
+	u := &AzureUploader{
 		conf:      conf,
 		container: fmt.Sprintf("https://%s.blob.core.windows.net/%s", conf.AccountName, conf.ContainerName),
-	}, nil
+		metadata:  metadata,
+
+		blockSize:   4 * 1024 * 1024,
+		parallelism: 16,
+	}
+	if parts.PartSize > 0 {
+		u.blockSize = min(parts.PartSize, azblob.BlockBlobMaxStageBlockBytes)
+	}
+	if parts.Concurrency > 0 {
+		u.parallelism = uint16(min(parts.Concurrency, math.MaxUint16))
+	}
+
+	if len(hosts) > 0 {
+		// azblob uses its own transport by default, which would bypass the overrides
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = 100
+		client := &http.Client{Transport: transport}
+		u.sender = pipeline.FactoryFunc(func(_ pipeline.Policy, _ *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+				r, err := client.Do(request.WithContext(ctx))
+				if err != nil {
+					err = pipeline.NewError(err, "HTTP request failed")
+				}
+				return pipeline.NewHTTPResponse(r), err
+			}
+		})
+	}
+
+	return u, nil
 }
 
-func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, error) {
+func (u *AzureUploader) containerURL() (*azblob.ContainerURL, error) {
 	credential, err := azblob.NewSharedKeyCredential(
 		u.conf.AccountName,
 		u.conf.AccountKey,
 	)
 	if err != nil {
-		return "", 0, wrap("Azure", err)
+		return nil, err
 	}
 
 	azUrl, err := url.Parse(u.container)
 	if err != nil {
-		return "", 0, wrap("Azure", err)
+		return nil, err
 	}
 
-	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
+	p := azblob.NewPipeline(credential, azblob.PipelineOptions{
 		Retry: azblob.RetryOptions{
 			Policy:        azblob.RetryPolicyExponential,
 			MaxTries:      maxRetries,
 			RetryDelay:    minDelay,
 			MaxRetryDelay: maxDelay,
 		},
+		HTTPSender: u.sender,
 	})
-	containerURL := azblob.NewContainerURL(*azUrl, pipeline)
+	containerURL := azblob.NewContainerURL(*azUrl, p)
+	return &containerURL, nil
+}
+
+func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, objectMetadata map[string]string) (string, int64, error) {
+	containerURL, err := u.containerURL()
+	if err != nil {
+		return "", 0, wrap("Azure", err)
+	}
 	blobURL := containerURL.NewBlockBlobURL(storageFilepath)
 
 	file, err := os.Open(localFilepath)
@@ -80,12 +129,111 @@ func (u *AzureUploader) upload(localFilepath, storageFilepath string, outputType
 	// it calls PutBlock/PutBlockList for files larger than 256 MBs and PutBlob for smaller files
 	_, err = azblob.UploadFileToBlockBlob(context.Background(), file, blobURL, azblob.UploadToBlockBlobOptions{
 		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: string(outputType)},
-		BlockSize:       4 * 1024 * 1024,
-		Parallelism:     16,
+		Metadata:        mergeMetadata(u.metadata, objectMetadata),
+		BlockSize:       u.blockSize,
+		Parallelism:     u.parallelism,
 	})
 	if err != nil {
 		return "", 0, wrap("Azure", err)
 	}
 
+	if err = verifyBlobSize(blobURL, stat.Size()); err != nil {
+		return "", 0, err
+	}
+
 	return fmt.Sprintf("%s/%s", u.container, storageFilepath), stat.Size(), nil
 }
+
+func verifyBlobSize(blobURL azblob.BlockBlobURL, size int64) error {
+	return verifyStored("Azure", size, func() (int64, error) {
+		props, err := blobURL.GetProperties(context.Background(), azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+		if err != nil {
+			return 0, err
+		}
+		return props.ContentLength(), nil
+	})
+}
+
+// azureMultipart stages each part as a block, then commits the block list
+type azureMultipart struct {
+	blobURL  azblob.BlockBlobURL
+	location string
+	headers  azblob.BlobHTTPHeaders
+	metadata azblob.Metadata
+	blockIDs []string
+}
+
+func (u *AzureUploader) startMultipart(storageFilepath string, outputType types.OutputType, objectMetadata map[string]string) (multipartUpload, error) {
+	containerURL, err := u.containerURL()
+	if err != nil {
+		return nil, wrap("Azure", err)
+	}
+
+	return &azureMultipart{
+		blobURL:  containerURL.NewBlockBlobURL(storageFilepath),
+		location: fmt.Sprintf("%s/%s", u.container, storageFilepath),
+		headers:  azblob.BlobHTTPHeaders{ContentType: string(outputType)},
+		metadata: mergeMetadata(u.metadata, objectMetadata),
+	}, nil
+}
+
+func (m *azureMultipart) uploadPart(data []byte) error {
+	// block ids must all have the same length
+	blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", len(m.blockIDs))))
+	if _, err := m.blobURL.StageBlock(context.Background(), blockID, bytes.NewReader(data),
+		azblob.LeaseAccessConditions{}, nil, azblob.ClientProvidedKeyOptions{},
+	); err != nil {
+		return wrap("Azure", err)
+	}
+	m.blockIDs = append(m.blockIDs, blockID)
+	return nil
+}
+
+func (m *azureMultipart) complete(size int64) (string, error) {
+	if _, err := m.blobURL.CommitBlockList(context.Background(), m.blockIDs, m.headers, m.metadata,
+		azblob.BlobAccessConditions{}, azblob.AccessTierNone, nil, azblob.ClientProvidedKeyOptions{}, azblob.ImmutabilityPolicyOptions{},
+	); err != nil {
+		return "", wrap("Azure", err)
+	}
+	if err := verifyBlobSize(m.blobURL, size); err != nil {
+		return "", err
+	}
+	return m.location, nil
+}
+
+// abort leaves the staged blocks uncommitted, and azure discards uncommitted blocks after a week
+func (m *azureMultipart) abort() {}
+
+func (u *AzureUploader) check() error {
+	containerURL, err := u.containerURL()
+	if err != nil {
+		return wrapCheck("Azure", err)
+	}
+	if _, err = containerURL.GetProperties(context.Background(), azblob.LeaseAccessConditions{}); err != nil {
+		return wrapCheck("Azure", err)
+	}
+	return nil
+}
+
+func (u *AzureUploader) sign(storageFilepath string, expiry time.Duration) (string, error) {
+	credential, err := azblob.NewSharedKeyCredential(
+		u.conf.AccountName,
+		u.conf.AccountKey,
+	)
+	if err != nil {
+		return "", wrap("Azure", err)
+	}
+
+	sas, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPS,
+		ExpiryTime:    time.Now().Add(expiry),
+		ContainerName: u.conf.ContainerName,
+		BlobName:      storageFilepath,
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(credential)
+	if err != nil {
+		return "", wrap("Azure", err)
+	}
+
+	return fmt.Sprintf("%s/%s?%s", u.container, storageFilepath, sas.Encode()), nil
+}
@@ -16,9 +16,12 @@ package uploader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
@@ -26,18 +29,27 @@ import (
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
+	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
 )
 
+// compose accepts at most 32 source objects
+const maxComposeSources = 32
+
 type GCPUploader struct {
-	conf   *livekit.GCPUpload
-	client *storage.Client
+	conf     *livekit.GCPUpload
+	client   *storage.Client
+	metadata map[string]string
+	parts    config.MultipartUploadConfig
 }
 
-func newGCPUploader(conf *livekit.GCPUpload) (uploader, error) {
+func newGCPUploader(conf *livekit.GCPUpload, parts config.MultipartUploadConfig, metadata map[string]string) (uploader, error) {
 	u := &GCPUploader{
-		conf: conf,
+		conf:     conf,
+		metadata: metadata,
+		parts:    parts,
 	}
 
 	var err error
@@ -53,7 +65,7 @@ func newGCPUploader(conf *livekit.GCPUpload) (uploader, error) {
 	return u, nil
 }
 
-func (u *GCPUploader) upload(localFilepath, storageFilepath string, _ types.OutputType) (string, int64, error) {
+func (u *GCPUploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, objectMetadata map[string]string) (string, int64, error) {
 	file, err := os.Open(localFilepath)
 	if err != nil {
 		return "", 0, wrap("GCP", err)
@@ -67,34 +79,229 @@ func (u *GCPUploader) upload(localFilepath, storageFilepath string, _ types.Outp
 		return "", 0, wrap("GCP", err)
 	}
 
-	// In case where the total amount of data to upload is larger than googleapi.DefaultUploadChunkSize, each upload request will have a timeout of
-	// ChunkRetryDeadline, which is 32s by default. If the request payload is smaller than googleapi.DefaultUploadChunkSize, use a context deadline
-	// to apply the same timeout
-	var ctx context.Context
-	if stat.Size() <= googleapi.DefaultUploadChunkSize {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(context.Background(), time.Second*32)
-		defer cancel()
+	partSize := int64(googleapi.DefaultUploadChunkSize)
+	if u.parts.PartSize > 0 {
+		partSize = u.parts.PartSize
+	}
+
+	obj := u.retryer(u.client.Bucket(u.conf.Bucket).Object(storageFilepath))
+	metadata := mergeMetadata(u.metadata, objectMetadata)
+	if u.parts.Concurrency > 1 && stat.Size() > partSize {
+		err = u.uploadParts(file, stat.Size(), partSize, obj, outputType, metadata)
 	} else {
-		ctx = context.Background()
+		err = u.uploadFile(file, stat.Size(), partSize, obj, metadata)
+	}
+	if err != nil {
+		return "", 0, wrap("GCP", err)
 	}
 
-	wc := u.client.Bucket(u.conf.Bucket).Object(storageFilepath).Retryer(
+	if err = u.verify(obj, stat.Size()); err != nil {
+		return "", 0, err
+	}
+
+	return u.location(storageFilepath), stat.Size(), nil
+}
+
+func (u *GCPUploader) verify(obj *storage.ObjectHandle, size int64) error {
+	return verifyStored("GCP", size, func() (int64, error) {
+		attrs, err := obj.Attrs(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		return attrs.Size, nil
+	})
+}
+
+func (u *GCPUploader) location(storageFilepath string) string {
+	return fmt.Sprintf("https://%s.storage.googleapis.com/%s", u.conf.Bucket, storageFilepath)
+}
+
+func (u *GCPUploader) retryer(obj *storage.ObjectHandle) *storage.ObjectHandle {
+	return obj.Retryer(
 		storage.WithBackoff(gax.Backoff{
 			Initial:    minDelay,
 			Max:        maxDelay,
 			Multiplier: 2,
 		}),
 		storage.WithPolicy(storage.RetryAlways),
-	).NewWriter(ctx)
+	)
+}
 
-	if _, err = io.Copy(wc, file); err != nil {
-		return "", 0, wrap("GCP", err)
+// uploadFile writes the file to obj with a single resumable upload, sending chunkSize bytes per request
+func (u *GCPUploader) uploadFile(r io.Reader, size, chunkSize int64, obj *storage.ObjectHandle, metadata map[string]string) error {
+	// In case where the total amount of data to upload is larger than the chunk size, each upload request will have a timeout of
+	// ChunkRetryDeadline, which is 32s by default. If the request payload is smaller than the chunk size, use a context deadline
+	// to apply the same timeout. Cancelling the context aborts the upload if the copy fails
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if size <= chunkSize {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second*32)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
 	}
+	defer cancel()
 
-	if err = wc.Close(); err != nil {
-		return "", 0, wrap("GCP", err)
+	return u.uploadStream(ctx, r, chunkSize, obj, metadata)
+}
+
+// uploadStream writes r to obj, sending chunkSize bytes per request. Cancelling ctx aborts the upload
+func (u *GCPUploader) uploadStream(ctx context.Context, r io.Reader, chunkSize int64, obj *storage.ObjectHandle, metadata map[string]string) error {
+	wc := obj.NewWriter(ctx)
+	wc.ChunkSize = int(chunkSize)
+	wc.Metadata = metadata
+
+	if _, err := io.Copy(wc, r); err != nil {
+		return err
+	}
+	return wc.Close()
+}
+
+// uploadParts writes each part of the file to a temporary object, concurrency parts at a time, then composes them into obj.
+// The temporary objects are deleted whether or not the upload succeeds, and obj is only written by the final compose
+func (u *GCPUploader) uploadParts(file *os.File, size, partSize int64, obj *storage.ObjectHandle, outputType types.OutputType, metadata map[string]string) error {
+	bucket := u.client.Bucket(u.conf.Bucket)
+	count := int((size + partSize - 1) / partSize)
+	parts := make([]*storage.ObjectHandle, count)
+	for i := range parts {
+		parts[i] = u.retryer(bucket.Object(fmt.Sprintf("%s.part%d", obj.ObjectName(), i)))
 	}
+	intermediate := u.retryer(bucket.Object(obj.ObjectName() + ".compose"))
+	defer func() {
+		for _, part := range append(parts, intermediate) {
+			if err := part.Delete(context.Background()); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				logger.Warnw("failed to delete upload part", err, "object", part.ObjectName())
+			}
+		}
+	}()
+
+	// parts are as large as part_size, so they are only bounded by cancellation, which stops the remaining
+	// parts as soon as one fails
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	return fmt.Sprintf("https://%s.storage.googleapis.com/%s", u.conf.Bucket, storageFilepath), stat.Size(), nil
+	var wg sync.WaitGroup
+	var uploadErr error
+	var once sync.Once
+	sem := make(chan struct{}, u.parts.Concurrency)
+	for i, part := range parts {
+		offset := int64(i) * partSize
+		section := io.NewSectionReader(file, offset, min(partSize, size-offset))
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(part *storage.ObjectHandle) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := u.uploadStream(ctx, section, partSize, part, nil); err != nil {
+				once.Do(func() {
+					uploadErr = err
+					cancel()
+				})
+			}
+		}(part)
+	}
+	wg.Wait()
+	if uploadErr != nil {
+		return uploadErr
+	}
+
+	// larger files are composed in batches, each one appending to an intermediate object
+	composed := false
+	for i := 0; i < count; {
+		var sources []*storage.ObjectHandle
+		if composed {
+			sources = append(sources, intermediate)
+		}
+		n := min(maxComposeSources-len(sources), count-i)
+		sources = append(sources, parts[i:i+n]...)
+		i += n
+
+		dst := intermediate
+		if i == count {
+			dst = obj
+		}
+		composer := dst.ComposerFrom(sources...)
+		if dst == obj {
+			composer.ContentType = string(outputType)
+			composer.Metadata = metadata
+		}
+		if _, err := composer.Run(context.Background()); err != nil {
+			return err
+		}
+		composed = true
+	}
+
+	return nil
+}
+
+// gcpMultipart streams parts into a single resumable upload, which is only finalized by complete
+type gcpMultipart struct {
+	*GCPUploader
+
+	obj    *storage.ObjectHandle
+	wc     *storage.Writer
+	cancel context.CancelFunc
+}
+
+func (u *GCPUploader) startMultipart(storageFilepath string, _ types.OutputType, objectMetadata map[string]string) (multipartUpload, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &gcpMultipart{
+		GCPUploader: u,
+		obj:         u.retryer(u.client.Bucket(u.conf.Bucket).Object(storageFilepath)),
+		cancel:      cancel,
+	}
+	m.wc = m.obj.NewWriter(ctx)
+	if u.parts.PartSize > 0 {
+		m.wc.ChunkSize = int(u.parts.PartSize)
+	}
+	m.wc.Metadata = mergeMetadata(u.metadata, objectMetadata)
+
+	return m, nil
+}
+
+func (m *gcpMultipart) uploadPart(data []byte) error {
+	if _, err := m.wc.Write(data); err != nil {
+		return wrap("GCP", err)
+	}
+	return nil
+}
+
+func (m *gcpMultipart) complete(size int64) (string, error) {
+	defer m.cancel()
+	if err := m.wc.Close(); err != nil {
+		return "", wrap("GCP", err)
+	}
+	if err := m.verify(m.obj, size); err != nil {
+		return "", err
+	}
+	return m.location(m.obj.ObjectName()), nil
+}
+
+// abort cancels the resumable upload, leaving no object behind
+func (m *gcpMultipart) abort() {
+	m.cancel()
+}
+
+func (u *GCPUploader) check() error {
+	if _, err := u.client.Bucket(u.conf.Bucket).Attrs(context.Background()); err != nil {
+		return wrapCheck("GCP", err)
+	}
+	return nil
+}
+
+func (u *GCPUploader) sign(storageFilepath string, expiry time.Duration) (string, error) {
+	signed, err := u.client.Bucket(u.conf.Bucket).SignedURL(storageFilepath, &storage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(expiry),
+		Scheme:  storage.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", wrap("GCP", err)
+	}
+	return signed, nil
 }
@@ -0,0 +1,484 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+// objectStore holds the objects and in progress uploads of a fake storage server
+type objectStore struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	pending  map[string]map[string][]byte // in progress uploads by id, with their parts
+	rejected map[string]bool              // objects which can't be uploaded
+	uploads  int                          // upload requests received
+	composes int                          // compose requests received
+}
+
+func newObjectStore() *objectStore {
+	return &objectStore{
+		objects:  make(map[string][]byte),
+		pending:  make(map[string]map[string][]byte),
+		rejected: make(map[string]bool),
+	}
+}
+
+func (s *objectStore) object(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[name]
+	return data, ok
+}
+
+func (s *objectStore) pendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+func (s *objectStore) serveSize(w http.ResponseWriter, name string) {
+	data, ok := s.object(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// s3Handler implements the multipart upload calls of the s3 api, with path style urls
+func (s *objectStore) s3Handler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload%d", len(s.pending)+1)
+		s.pending[id] = make(map[string][]byte)
+		_, _ = fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, key, id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.pending[query.Get("uploadId")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		parts[query.Get("partNumber")] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag%s"`, query.Get("partNumber")))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := s.pending[query.Get("uploadId")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var completed struct {
+			Parts []struct {
+				PartNumber string
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &completed); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for _, part := range completed.Parts {
+			data = append(data, parts[part.PartNumber]...)
+		}
+		s.objects[key] = data
+		delete(s.pending, query.Get("uploadId"))
+		_, _ = fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key></CompleteMultipartUploadResult>`, key)
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.pending, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodHead:
+		s.mu.Unlock()
+		s.serveSize(w, key)
+		s.mu.Lock()
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// azureHandler implements staging and committing blocks of a block blob
+func (s *objectStore) azureHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/container/")
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		if s.pending[name] == nil {
+			s.pending[name] = make(map[string][]byte)
+		}
+		s.pending[name][query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var list struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.Unmarshal(body, &list); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for _, id := range list.Latest {
+			block, ok := s.pending[name][id]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data = append(data, block...)
+		}
+		s.objects[name] = data
+		delete(s.pending, name)
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == http.MethodHead:
+		s.mu.Unlock()
+		s.serveSize(w, name)
+		s.mu.Lock()
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+type gcsObject struct {
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+	Size   string `json:"size"`
+}
+
+// gcsHandler implements the json api calls used for uploads: multipart and resumable uploads, object metadata,
+// deletes and compose
+func (s *objectStore) gcsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	writeObject := func(name string) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&gcsObject{Bucket: "bucket", Name: name, Size: strconv.Itoa(len(s.objects[name]))})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/") && query.Get("uploadType") == "multipart":
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.uploads++
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		var attrs gcsObject
+		for i := 0; ; i++ {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			if i == 0 {
+				_ = json.Unmarshal(data, &attrs)
+			} else if s.rejected[attrs.Name] {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			} else {
+				s.objects[attrs.Name] = data
+			}
+		}
+		writeObject(attrs.Name)
+
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/") && query.Get("uploadType") == "resumable":
+		var attrs gcsObject
+		_ = json.Unmarshal(body, &attrs)
+		s.pending[attrs.Name] = map[string][]byte{"": nil}
+		w.Header().Set("Location", fmt.Sprintf("http://%s/resumable?name=%s", r.Host, attrs.Name))
+
+	case r.URL.Path == "/resumable":
+		name := query.Get("name")
+		upload, ok := s.pending[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		upload[""] = append(upload[""], body...)
+		if strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+			// the client asks for incomplete chunks to be acknowledged with a 200 and an override header
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(upload[""])-1))
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			return
+		}
+		s.objects[name] = upload[""]
+		delete(s.pending, name)
+		writeObject(name)
+
+	case strings.HasSuffix(r.URL.Path, "/compose"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"), "/compose")
+		var req struct {
+			SourceObjects []struct {
+				Name string `json:"name"`
+			} `json:"sourceObjects"`
+		}
+		_ = json.Unmarshal(body, &req)
+		if len(req.SourceObjects) > maxComposeSources {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var data []byte
+		for _, src := range req.SourceObjects {
+			data = append(data, s.objects[src.Name]...)
+		}
+		s.objects[name] = data
+		s.composes++
+		writeObject(name)
+
+	case strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")
+		if _, ok := s.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeObject(name)
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (s *objectStore) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newTestS3Uploader(t *testing.T, store *objectStore) *S3Uploader {
+	server := httptest.NewServer(http.HandlerFunc(store.s3Handler))
+	t.Cleanup(server.Close)
+
+	u, err := newS3Uploader(&config.EgressS3Upload{S3Upload: &livekit.S3Upload{
+		AccessKey:      "key",
+		Secret:         "secret",
+		Region:         "us-east-1",
+		Endpoint:       server.URL,
+		Bucket:         "bucket",
+		ForcePathStyle: true,
+	}}, config.MultipartUploadConfig{}, nil)
+	require.NoError(t, err)
+	return u.(*S3Uploader)
+}
+
+func newTestAzureUploader(t *testing.T, store *objectStore) *AzureUploader {
+	server := httptest.NewServer(http.HandlerFunc(store.azureHandler))
+	t.Cleanup(server.Close)
+
+	return &AzureUploader{
+		conf: &livekit.AzureBlobUpload{
+			AccountName:   "account",
+			AccountKey:    base64.StdEncoding.EncodeToString([]byte("key")),
+			ContainerName: "container",
+		},
+		container: server.URL + "/container",
+	}
+}
+
+func newTestGCPUploader(t *testing.T, store *objectStore, parts config.MultipartUploadConfig) *GCPUploader {
+	server := httptest.NewServer(http.HandlerFunc(store.gcsHandler))
+	t.Cleanup(server.Close)
+
+	client, err := storage.NewClient(context.Background(),
+		option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithoutAuthentication(),
+	)
+	require.NoError(t, err)
+	return &GCPUploader{
+		conf:   &livekit.GCPUpload{Bucket: "bucket"},
+		client: client,
+		parts:  parts,
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	first := bytes.Repeat([]byte("a"), 256*1024)
+	second := bytes.Repeat([]byte("b"), 256*1024)
+	last := []byte("c")
+
+	for _, test := range []struct {
+		name     string
+		uploader func(*testing.T, *objectStore) multipartUploader
+	}{
+		{"S3", func(t *testing.T, store *objectStore) multipartUploader { return newTestS3Uploader(t, store) }},
+		{"Azure", func(t *testing.T, store *objectStore) multipartUploader { return newTestAzureUploader(t, store) }},
+		{"GCP", func(t *testing.T, store *objectStore) multipartUploader {
+			return newTestGCPUploader(t, store, config.MultipartUploadConfig{PartSize: 256 * 1024})
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := newObjectStore()
+			u := test.uploader(t, store)
+
+			m, err := u.startMultipart("recording.mp4", types.OutputTypeMP4, nil)
+			require.NoError(t, err)
+			for _, part := range [][]byte{first, second, last} {
+				require.NoError(t, m.uploadPart(part))
+			}
+			location, err := m.complete(int64(len(first) + len(second) + len(last)))
+			require.NoError(t, err)
+			require.True(t, strings.HasSuffix(location, "recording.mp4"), location)
+
+			data, ok := store.object("recording.mp4")
+			require.True(t, ok)
+			require.Equal(t, append(append(append([]byte{}, first...), second...), last...), data)
+			require.Zero(t, store.pendingUploads())
+		})
+	}
+}
+
+func TestMultipartAbort(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		uploader func(*testing.T, *objectStore) multipartUploader
+	}{
+		{"S3", func(t *testing.T, store *objectStore) multipartUploader { return newTestS3Uploader(t, store) }},
+		{"GCP", func(t *testing.T, store *objectStore) multipartUploader {
+			return newTestGCPUploader(t, store, config.MultipartUploadConfig{PartSize: 256 * 1024})
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := newObjectStore()
+			u := test.uploader(t, store)
+
+			m, err := u.startMultipart("recording.mp4", types.OutputTypeMP4, nil)
+			require.NoError(t, err)
+			require.NoError(t, m.uploadPart(bytes.Repeat([]byte("a"), 256*1024)))
+			m.abort()
+
+			_, ok := store.object("recording.mp4")
+			require.False(t, ok)
+			if test.name == "S3" {
+				// no parts are left to be billed
+				require.Zero(t, store.pendingUploads())
+			}
+		})
+	}
+}
+
+func TestGCPUploadParts(t *testing.T) {
+	const partSize = 4
+
+	for _, test := range []struct {
+		name     string
+		parts    int
+		composes int
+	}{
+		{"SingleCompose", 3, 1},
+		// more parts than a compose accepts are appended to an intermediate object in batches
+		{"Batched", maxComposeSources + 9, 2},
+		{"ExactBatches", 2*maxComposeSources - 1, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := newObjectStore()
+			u := newTestGCPUploader(t, store, config.MultipartUploadConfig{PartSize: partSize, Concurrency: 4})
+
+			data := make([]byte, test.parts*partSize-1)
+			for i := range data {
+				data[i] = byte('a' + i%26)
+			}
+			localFilepath := path.Join(t.TempDir(), "recording.mp4")
+			require.NoError(t, os.WriteFile(localFilepath, data, 0644))
+
+			location, size, err := u.upload(localFilepath, "recording.mp4", types.OutputTypeMP4, nil)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(data)), size)
+			require.Equal(t, u.location("recording.mp4"), location)
+
+			stored, ok := store.object("recording.mp4")
+			require.True(t, ok)
+			require.Equal(t, data, stored)
+			require.Equal(t, test.parts, store.uploads)
+			require.Equal(t, test.composes, store.composes)
+
+			// part and intermediate objects are deleted
+			require.Equal(t, []string{"recording.mp4"}, store.names())
+		})
+	}
+}
+
+func TestGCPUploadPartsFailure(t *testing.T) {
+	store := newObjectStore()
+	store.rejected["recording.mp4.part1"] = true
+	u := newTestGCPUploader(t, store, config.MultipartUploadConfig{PartSize: 4, Concurrency: 1})
+
+	localFilepath := path.Join(t.TempDir(), "recording.mp4")
+	require.NoError(t, os.WriteFile(localFilepath, bytes.Repeat([]byte("a"), 40), 0644))
+	file, err := os.Open(localFilepath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	// parts are uploaded one at a time, so the failure is seen before the third part would start
+	obj := u.client.Bucket("bucket").Object("recording.mp4")
+	require.Error(t, u.uploadParts(file, 40, 4, obj, types.OutputTypeMP4, nil))
+
+	// no parts are started after the failure, nothing is composed, and uploaded parts are deleted
+	require.Equal(t, 2, store.uploads)
+	require.Zero(t, store.composes)
+	require.Empty(t, store.names())
+}
@@ -15,10 +15,12 @@
 package uploader
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
@@ -59,9 +61,10 @@ type S3Uploader struct {
 	metadata           map[string]*string
 	tagging            *string
 	contentDisposition *string
+	parts              config.MultipartUploadConfig
 }
 
-func newS3Uploader(conf *config.EgressS3Upload) (uploader, error) {
+func newS3Uploader(conf *config.EgressS3Upload, parts config.MultipartUploadConfig, metadata map[string]string) (uploader, error) {
 	awsConfig := &aws.Config{
 		Retryer: &CustomRetryer{
 			DefaultRetryer: client.DefaultRetryer{
@@ -93,6 +96,7 @@ func newS3Uploader(conf *config.EgressS3Upload) (uploader, error) {
 	u := &S3Uploader{
 		awsConfig: awsConfig,
 		bucket:    aws.String(conf.Bucket),
+		parts:     parts,
 	}
 
 	if u.awsConfig.Region == nil {
@@ -112,18 +116,20 @@ func newS3Uploader(conf *config.EgressS3Upload) (uploader, error) {
 		if err != nil {
 			logger.Errorw("failed to parse proxy URL -- proxy not set", err, "proxy", conf.Proxy)
 		} else {
-			proxyTransport := &http.Transport{
-				Proxy: http.ProxyURL(proxyURL),
-			}
+			proxyTransport := http.DefaultTransport.(*http.Transport).Clone()
+			proxyTransport.Proxy = http.ProxyURL(proxyURL)
 			u.awsConfig.HTTPClient = &http.Client{Transport: proxyTransport}
 		}
 	}
 
-	if len(conf.Metadata) > 0 {
-		u.metadata = make(map[string]*string, len(conf.Metadata))
+	if len(conf.Metadata)+len(metadata) > 0 {
+		u.metadata = make(map[string]*string, len(conf.Metadata)+len(metadata))
+		for k, v := range metadata {
+			u.metadata[k] = aws.String(v)
+		}
+		// request metadata takes precedence
 		for k, v := range conf.Metadata {
-			v := v
-			u.metadata[k] = &v
+			u.metadata[k] = aws.String(v)
 		}
 	}
 
@@ -166,7 +172,7 @@ func (u *S3Uploader) getBucketLocation() (string, error) {
 	return *resp.LocationConstraint, nil
 }
 
-func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType types.OutputType) (string, int64, error) {
+func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType types.OutputType, objectMetadata map[string]string) (string, int64, error) {
 	sess, err := session.NewSession(u.awsConfig)
 	if err != nil {
 		return "", 0, wrap("S3", err)
@@ -185,12 +191,22 @@ func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType ty
 		return "", 0, wrap("S3", err)
 	}
 
-	_, err = s3manager.NewUploader(sess).Upload(&s3manager.UploadInput{
+	// files larger than a part are sent as a multipart upload, which is aborted if any part fails
+	// so that no incomplete upload is left in the bucket
+	_, err = s3manager.NewUploader(sess, func(m *s3manager.Uploader) {
+		if u.parts.PartSize > 0 {
+			m.PartSize = u.parts.PartSize
+		}
+		if u.parts.Concurrency > 0 {
+			m.Concurrency = u.parts.Concurrency
+		}
+		m.LeavePartsOnError = false
+	}).Upload(&s3manager.UploadInput{
 		Body:               file,
 		Bucket:             u.bucket,
 		ContentType:        aws.String(string(outputType)),
 		Key:                aws.String(storageFilepath),
-		Metadata:           u.metadata,
+		Metadata:           u.objectMetadata(objectMetadata),
 		Tagging:            u.tagging,
 		ContentDisposition: u.contentDisposition,
 	})
@@ -198,5 +214,155 @@ func (u *S3Uploader) upload(localFilepath, storageFilepath string, outputType ty
 		return "", 0, wrap("S3", err)
 	}
 
-	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", *u.bucket, storageFilepath), stat.Size(), nil
+	if err = u.verify(s3.New(sess), storageFilepath, stat.Size()); err != nil {
+		return "", 0, err
+	}
+
+	return u.location(storageFilepath), stat.Size(), nil
+}
+
+func (u *S3Uploader) objectMetadata(objectMetadata map[string]string) map[string]*string {
+	if len(objectMetadata) == 0 {
+		return u.metadata
+	}
+	metadata := make(map[string]*string, len(u.metadata)+len(objectMetadata))
+	for k, v := range u.metadata {
+		metadata[k] = v
+	}
+	for k, v := range objectMetadata {
+		metadata[k] = aws.String(v)
+	}
+	return metadata
+}
+
+func (u *S3Uploader) verify(svc *s3.S3, storageFilepath string, size int64) error {
+	return verifyStored("S3", size, func() (int64, error) {
+		head, err := svc.HeadObject(&s3.HeadObjectInput{
+			Bucket: u.bucket,
+			Key:    aws.String(storageFilepath),
+		})
+		if err != nil {
+			return 0, err
+		}
+		return aws.Int64Value(head.ContentLength), nil
+	})
+}
+
+func (u *S3Uploader) location(storageFilepath string) string {
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", *u.bucket, storageFilepath)
+}
+
+type s3Multipart struct {
+	*S3Uploader
+
+	svc      *s3.S3
+	key      *string
+	uploadID *string
+	parts    []*s3.CompletedPart
+}
+
+func (u *S3Uploader) startMultipart(storageFilepath string, outputType types.OutputType, objectMetadata map[string]string) (multipartUpload, error) {
+	sess, err := session.NewSession(u.awsConfig)
+	if err != nil {
+		return nil, wrap("S3", err)
+	}
+
+	m := &s3Multipart{
+		S3Uploader: u,
+		svc:        s3.New(sess),
+		key:        aws.String(storageFilepath),
+	}
+	out, err := m.svc.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:             u.bucket,
+		ContentType:        aws.String(string(outputType)),
+		Key:                m.key,
+		Metadata:           u.objectMetadata(objectMetadata),
+		Tagging:            u.tagging,
+		ContentDisposition: u.contentDisposition,
+	})
+	if err != nil {
+		return nil, wrap("S3", err)
+	}
+	m.uploadID = out.UploadId
+
+	return m, nil
+}
+
+func (m *s3Multipart) uploadPart(data []byte) error {
+	partNumber := aws.Int64(int64(len(m.parts) + 1))
+	out, err := m.svc.UploadPart(&s3.UploadPartInput{
+		Body:       bytes.NewReader(data),
+		Bucket:     m.bucket,
+		Key:        m.key,
+		PartNumber: partNumber,
+		UploadId:   m.uploadID,
+	})
+	if err != nil {
+		return wrap("S3", err)
+	}
+
+	m.parts = append(m.parts, &s3.CompletedPart{
+		ETag:       out.ETag,
+		PartNumber: partNumber,
+	})
+	return nil
+}
+
+func (m *s3Multipart) complete(size int64) (string, error) {
+	if _, err := m.svc.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          m.bucket,
+		Key:             m.key,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: m.parts},
+		UploadId:        m.uploadID,
+	}); err != nil {
+		return "", wrap("S3", err)
+	}
+
+	if err := m.verify(m.svc, *m.key, size); err != nil {
+		return "", err
+	}
+	return m.location(*m.key), nil
+}
+
+func (m *s3Multipart) abort() {
+	if _, err := m.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   m.bucket,
+		Key:      m.key,
+		UploadId: m.uploadID,
+	}); err != nil {
+		logger.Warnw("failed to abort multipart upload", err, "key", *m.key)
+	}
+}
+
+func (u *S3Uploader) check() error {
+	sess, err := session.NewSession(u.awsConfig)
+	if err != nil {
+		return wrapCheck("S3", err)
+	}
+	if _, err = s3.New(sess).HeadBucket(&s3.HeadBucketInput{Bucket: u.bucket}); err != nil {
+		if getStatusCode(err) == http.StatusForbidden {
+			// HeadBucket requires s3:ListBucket, which write-only credentials don't have
+			logger.Debugw("bucket unverified, credentials cannot list it", "provider", "S3")
+			return nil
+		}
+		return wrapCheck("S3", err)
+	}
+	return nil
+}
+
+func (u *S3Uploader) sign(storageFilepath string, expiry time.Duration) (string, error) {
+	sess, err := session.NewSession(u.awsConfig)
+	if err != nil {
+		return "", wrap("S3", err)
+	}
+
+	req, _ := s3.New(sess).GetObjectRequest(&s3.GetObjectInput{
+		Bucket: u.bucket,
+		Key:    aws.String(storageFilepath),
+	})
+	signed, err := req.Presign(expiry)
+	if err != nil {
+		return "", wrap("S3", err)
+	}
+	return signed, nil
 }
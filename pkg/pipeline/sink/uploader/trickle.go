@@ -0,0 +1,109 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"time"
+
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+// TrickleUpload uploads a file in parts while it is still being written
+type TrickleUpload interface {
+	// UploadPart appends the next part of the file. Every part other than the last must be at least 5MiB
+	UploadPart([]byte) error
+	// Complete uploads the last part and commits the file, returning its location and size
+	Complete([]byte) (string, int64, error)
+	// Abort discards any parts already uploaded
+	Abort()
+}
+
+// multipartUploader is implemented by storage providers that can upload a file incrementally
+type multipartUploader interface {
+	startMultipart(string, types.OutputType, map[string]string) (multipartUpload, error)
+}
+
+type multipartUpload interface {
+	uploadPart([]byte) error
+	// complete commits the upload and verifies its size
+	complete(int64) (string, error)
+	abort()
+}
+
+// StartTrickle starts an incremental upload to the primary destination, returning nil if its storage provider
+// can't upload incrementally. Retries, fallback storage and backups only apply to Upload, so a failed
+// trickle upload should be aborted and the finished file uploaded with Upload instead.
+func (u *remoteUploader) StartTrickle(storageFilepath string, outputType types.OutputType) (TrickleUpload, error) {
+	m, ok := u.uploader.(multipartUploader)
+	if !ok || u.key != nil {
+		return nil, nil
+	}
+
+	upload, err := m.startMultipart(storageFilepath, outputType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &trickleUpload{
+		upload:          upload,
+		monitor:         u.monitor,
+		storageFilepath: storageFilepath,
+		start:           time.Now(),
+	}, nil
+}
+
+func (u *localUploader) StartTrickle(_ string, _ types.OutputType) (TrickleUpload, error) {
+	return nil, nil
+}
+
+type trickleUpload struct {
+	upload          multipartUpload
+	monitor         *stats.HandlerMonitor
+	storageFilepath string
+	start           time.Time
+	size            int64
+}
+
+func (t *trickleUpload) UploadPart(data []byte) error {
+	if err := t.upload.uploadPart(data); err != nil {
+		return err
+	}
+	t.size += int64(len(data))
+	return nil
+}
+
+func (t *trickleUpload) Complete(data []byte) (string, int64, error) {
+	if err := t.UploadPart(data); err != nil {
+		return "", 0, err
+	}
+
+	location, err := t.upload.complete(t.size)
+	elapsed := time.Since(t.start)
+	if err != nil {
+		t.monitor.IncUploadCountFailure("file", float64(elapsed.Milliseconds()))
+		return "", 0, err
+	}
+
+	t.monitor.IncUploadCountSuccess("file", float64(elapsed.Milliseconds()))
+	t.monitor.AddUploadedBytes(t.size)
+	logger.Debugw("trickle upload complete", "location", location, "size", t.size, "time", elapsed.String())
+	return location, t.size, nil
+}
+
+func (t *trickleUpload) Abort() {
+	t.upload.abort()
+}
@@ -16,13 +16,22 @@ package uploader
 
 import (
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"path"
+	"sync"
 	"time"
 
-	"github.com/pkg/errors"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"go.uber.org/atomic"
+	"google.golang.org/api/googleapi"
 
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink/encryption"
 	"github.com/livekit/egress/pkg/stats"
 	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
@@ -33,93 +42,274 @@ const (
 	maxRetries = 5
 	minDelay   = time.Millisecond * 100
 	maxDelay   = time.Second * 5
+
+	// manifests hold what is needed to decrypt the other outputs, and are uploaded unencrypted
+	manifestFileType = "manifest"
 )
 
 type Uploader interface {
 	Upload(string, string, types.OutputType, bool, string) (string, int64, error)
+	// Failed returns true if any upload could not be confirmed, leaving its local file in place
+	Failed() bool
+	// SignURL returns a time-limited download url for an uploaded file
+	SignURL(string, time.Duration) (string, error)
+	// Encryption describes how uploads are encrypted, or returns nil if they are not
+	Encryption() *encryption.UploadEncryption
+	// StartTrickle starts uploading a file that is still being written, or returns nil if it can only be uploaded once finished
+	StartTrickle(string, types.OutputType) (TrickleUpload, error)
+	// Results returns the outcome of every upload that could not be stored by the primary destination
+	Results() []*UploadResult
+}
+
+// UploadResult records where a file went after its upload to the primary destination failed
+type UploadResult struct {
+	Filename    string   `json:"filename"`
+	Destination string   `json:"destination,omitempty"` // fallback or backup, empty if the file could not be stored
+	Errors      []string `json:"errors"`                // the error from each destination that failed, in order
 }
 
 type uploader interface {
-	upload(string, string, types.OutputType) (string, int64, error)
+	upload(string, string, types.OutputType, map[string]string) (string, int64, error)
+	sign(string, time.Duration) (string, error)
+	check() error
 }
 
-func New(conf config.UploadConfig, backup string, monitor *stats.HandlerMonitor) (Uploader, error) {
-	var u uploader
-	var err error
+var errNotSignable = errors.New("file is not in remote storage")
 
-	switch c := conf.(type) {
-	case *config.EgressS3Upload:
-		u, err = newS3Uploader(c)
-	case *livekit.S3Upload:
-		u, err = newS3Uploader(&config.EgressS3Upload{S3Upload: c})
-	case *livekit.GCPUpload:
-		u, err = newGCPUploader(c)
-	case *livekit.AzureBlobUpload:
-		u, err = newAzureUploader(c)
-	case *livekit.AliOSSUpload:
-		u, err = newAliOSSUploader(c)
-	default:
-		return &localUploader{}, nil
-	}
+// New creates an uploader for conf. If uploads to conf fail after retrying, the file is uploaded to
+// fallback instead, and if that fails too, it is moved to the backup directory.
+// Metadata is attached to every uploaded object. If key is set, files other than manifests are encrypted
+// before being uploaded, and the values needed to decrypt each one are added to its object metadata.
+// Parts sets the part size and number of parallel part uploads for s3, gcp and azure.
+func New(
+	conf, fallback config.UploadConfig,
+	backup string,
+	retry config.UploadRetryConfig,
+	parts config.MultipartUploadConfig,
+	hosts config.HostOverrides,
+	metadata map[string]string,
+	key *encryption.UploadKey,
+	monitor *stats.HandlerMonitor,
+) (Uploader, error) {
+	u, err := newUploader(conf, parts, hosts, metadata)
 	if err != nil {
 		return nil, err
 	}
+	if u == nil {
+		return &localUploader{}, nil
+	}
 
 	remote := &remoteUploader{
 		uploader: u,
 		backup:   backup,
+		retry:    retry,
+		key:      key,
 		monitor:  monitor,
 	}
 
+	if remote.fallback, err = newUploader(fallback, parts, hosts, metadata); err != nil {
+		return nil, err
+	}
+
 	return remote, nil
 }
 
+// Check verifies that the bucket or container in conf exists and accepts its credentials, without uploading anything
+func Check(conf config.UploadConfig, hosts config.HostOverrides) error {
+	u, err := newUploader(conf, config.MultipartUploadConfig{}, hosts, nil)
+	if err != nil || u == nil {
+		return err
+	}
+	return u.check()
+}
+
+// S3 and GCP clients are built from http.DefaultTransport, which the handler configures with any host overrides
+func newUploader(conf config.UploadConfig, parts config.MultipartUploadConfig, hosts config.HostOverrides, metadata map[string]string) (uploader, error) {
+	switch c := conf.(type) {
+	case *config.EgressS3Upload:
+		return newS3Uploader(c, parts, metadata)
+	case *livekit.S3Upload:
+		return newS3Uploader(&config.EgressS3Upload{S3Upload: c}, parts, metadata)
+	case *livekit.GCPUpload:
+		return newGCPUploader(c, parts, metadata)
+	case *livekit.AzureBlobUpload:
+		return newAzureUploader(c, parts, hosts, metadata)
+	case *livekit.AliOSSUpload:
+		return newAliOSSUploader(c, hosts, metadata)
+	default:
+		return nil, nil
+	}
+}
+
 type remoteUploader struct {
 	uploader
 
-	backup  string
-	monitor *stats.HandlerMonitor
+	fallback uploader
+	backup   string
+	retry    config.UploadRetryConfig
+	key      *encryption.UploadKey
+	monitor  *stats.HandlerMonitor
+	failed   atomic.Bool
+
+	mu         sync.Mutex
+	redirected map[string]uploader // files not stored by the primary uploader, nil when moved to backup
+	results    []*UploadResult
 }
 
 func (u *remoteUploader) Upload(localFilepath, storageFilepath string, outputType types.OutputType, deleteAfterUpload bool, fileType string) (string, int64, error) {
-	start := time.Now()
-	location, size, err := u.upload(localFilepath, storageFilepath, outputType)
-	elapsed := time.Since(start)
-	logger.Debugw("upload complete", "fileType", fileType, "time", elapsed.String())
+	uploadFilepath := localFilepath
+	var objectMetadata map[string]string
+	if u.key != nil && fileType != manifestFileType {
+		// the plaintext never leaves the local directory, so a backup copy is left unencrypted
+		uploadFilepath = localFilepath + ".enc"
+		sealed, err := u.key.EncryptFile(localFilepath, uploadFilepath)
+		if err != nil {
+			u.failed.Store(true)
+			return "", 0, errors.ErrUploadEncryptionFailed(err)
+		}
+		defer func() {
+			_ = os.Remove(uploadFilepath)
+		}()
+		objectMetadata = u.key.Metadata(sealed)
+	}
 
-	// success
+	location, size, err := u.attempt(u.uploader, "primary", uploadFilepath, storageFilepath, outputType, objectMetadata, fileType)
 	if err == nil {
-		u.monitor.IncUploadCountSuccess(fileType, float64(elapsed.Milliseconds()))
 		if deleteAfterUpload {
 			_ = os.Remove(localFilepath)
 		}
-
 		return location, size, nil
 	}
 
-	// failure
-	u.monitor.IncUploadCountFailure(fileType, float64(elapsed.Milliseconds()))
+	result := &UploadResult{Filename: storageFilepath}
+	defer u.addResult(result)
+	result.Errors = append(result.Errors, err.Error())
+
+	if u.fallback != nil {
+		if location, size, err = u.attempt(u.fallback, "fallback", uploadFilepath, storageFilepath, outputType, objectMetadata, fileType); err == nil {
+			result.Destination = "fallback"
+			u.redirect(storageFilepath, u.fallback)
+			if deleteAfterUpload {
+				_ = os.Remove(localFilepath)
+			}
+			return location, size, nil
+		}
+		result.Errors = append(result.Errors, err.Error())
+	}
+
 	if u.backup != "" {
-		stat, err := os.Stat(localFilepath)
-		if err != nil {
-			return "", 0, err
+		if location, size, err = u.moveToBackup(localFilepath, storageFilepath); err == nil {
+			result.Destination = "backup"
+			u.monitor.IncBackupStorageWrites(string(outputType))
+			u.redirect(storageFilepath, nil)
+			return location, size, nil
 		}
+		result.Errors = append(result.Errors, err.Error())
+	}
 
-		backupDir := path.Join(u.backup, path.Dir(storageFilepath))
-		backupFileName := path.Base(storageFilepath)
-		if err = os.MkdirAll(backupDir, 0755); err != nil {
-			return "", 0, err
+	u.failed.Store(true)
+	return "", 0, err
+}
+
+func (u *remoteUploader) moveToBackup(localFilepath, storageFilepath string) (string, int64, error) {
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	backupDir := path.Join(u.backup, path.Dir(storageFilepath))
+	backupFileName := path.Base(storageFilepath)
+	if err = os.MkdirAll(backupDir, 0755); err != nil {
+		return "", 0, err
+	}
+	backupFilepath := path.Join(backupDir, backupFileName)
+	if err = os.Rename(localFilepath, backupFilepath); err != nil {
+		return "", 0, err
+	}
+
+	return backupFilepath, stat.Size(), nil
+}
+
+func (u *remoteUploader) Failed() bool {
+	return u.failed.Load()
+}
+
+func (u *remoteUploader) Results() []*UploadResult {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return append([]*UploadResult(nil), u.results...)
+}
+
+func (u *remoteUploader) addResult(result *UploadResult) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.results = append(u.results, result)
+}
+
+func (u *remoteUploader) SignURL(storageFilepath string, expiry time.Duration) (string, error) {
+	u.mu.Lock()
+	up, redirected := u.redirected[storageFilepath]
+	u.mu.Unlock()
+
+	if !redirected {
+		up = u.uploader
+	} else if up == nil {
+		return "", errNotSignable
+	}
+	return up.sign(storageFilepath, expiry)
+}
+
+func (u *remoteUploader) Encryption() *encryption.UploadEncryption {
+	if u.key == nil {
+		return nil
+	}
+	return u.key.Info()
+}
+
+func (u *remoteUploader) redirect(storageFilepath string, up uploader) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.redirected == nil {
+		u.redirected = make(map[string]uploader)
+	}
+	u.redirected[storageFilepath] = up
+}
+
+// attempt uploads to a single destination. The storage client retries each request internally,
+// and transient failures are retried again with exponential backoff, up to retry.MaxAttempts
+func (u *remoteUploader) attempt(
+	up uploader,
+	destination, localFilepath, storageFilepath string,
+	outputType types.OutputType,
+	objectMetadata map[string]string,
+	fileType string,
+) (string, int64, error) {
+	delay := u.retry.BaseDelay
+	for i := 1; ; i++ {
+		start := time.Now()
+		location, size, err := up.upload(localFilepath, storageFilepath, outputType, objectMetadata)
+		elapsed := time.Since(start)
+
+		if err == nil {
+			u.monitor.IncUploadCountSuccess(fileType, float64(elapsed.Milliseconds()))
+			u.monitor.AddUploadedBytes(size)
+			logger.Debugw("upload complete", "fileType", fileType, "destination", destination, "location", location, "time", elapsed.String())
+			return location, size, nil
 		}
-		backupFilepath := path.Join(backupDir, backupFileName)
-		if err = os.Rename(localFilepath, backupFilepath); err != nil {
+
+		if i >= u.retry.MaxAttempts || !isRetryable(err) {
+			u.monitor.IncUploadCountFailure(fileType, float64(elapsed.Milliseconds()))
+			logger.Warnw("upload failed", err, "fileType", fileType, "destination", destination, "time", elapsed.String(), "attempts", i)
 			return "", 0, err
 		}
-		u.monitor.IncBackupStorageWrites(string(outputType))
 
-		return backupFilepath, stat.Size(), nil
+		logger.Infow("upload failed, retrying", "error", err, "fileType", fileType, "destination", destination, "attempt", i, "delay", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, u.retry.MaxDelay)
 	}
-
-	return "", 0, err
 }
 
 type localUploader struct{}
@@ -133,6 +323,112 @@ func (u *localUploader) Upload(localFilepath, _ string, _ types.OutputType, _ bo
 	return localFilepath, stat.Size(), nil
 }
 
+func (u *localUploader) Failed() bool {
+	return false
+}
+
+func (u *localUploader) Results() []*UploadResult {
+	return nil
+}
+
+func (u *localUploader) SignURL(_ string, _ time.Duration) (string, error) {
+	return "", errNotSignable
+}
+
+func (u *localUploader) Encryption() *encryption.UploadEncryption {
+	return nil
+}
+
+// mergeMetadata adds per object metadata to the metadata attached to every object
+func mergeMetadata(metadata, objectMetadata map[string]string) map[string]string {
+	if len(objectMetadata) == 0 {
+		return metadata
+	}
+	merged := make(map[string]string, len(metadata)+len(objectMetadata))
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for k, v := range objectMetadata {
+		merged[k] = v
+	}
+	return merged
+}
+
+// verifyStored reads back the stored object size and compares it against the local file, so that local files are
+// only deleted once the upload is confirmed. Write-only credentials can't read the object back, so a forbidden
+// read leaves the upload unverified instead of failing it
+func verifyStored(name string, local int64, stored func() (int64, error)) error {
+	size, err := stored()
+	if err != nil {
+		if getStatusCode(err) == http.StatusForbidden {
+			logger.Debugw("upload unverified, stored object cannot be read", "provider", name)
+			return nil
+		}
+		return wrap(name, err)
+	}
+	return verifySize(name, local, size)
+}
+
+func verifySize(name string, local, stored int64) error {
+	if local != stored {
+		return wrap(name, fmt.Errorf("stored size %d does not match local size %d", stored, local))
+	}
+	return nil
+}
+
 func wrap(name string, err error) error {
-	return errors.Wrap(err, fmt.Sprintf("%s upload failed", name))
+	if isAuthFailure(err) {
+		return errors.ErrUploadAuthFailed(name, err)
+	}
+	return errors.ErrUploadFailed(name, err)
+}
+
+func wrapCheck(name string, err error) error {
+	return fmt.Errorf("%s storage check failed: %w", name, err)
+}
+
+// isAuthFailure returns true if the storage provider rejected the credentials, which retrying will not fix
+func isAuthFailure(err error) bool {
+	statusCode := getStatusCode(err)
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+// isRetryable returns true for timeouts, connection errors, throttling, and server errors
+func isRetryable(err error) bool {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		// the local file could not be read
+		return false
+	}
+
+	switch statusCode := getStatusCode(err); {
+	case statusCode == 0:
+		// no response
+		return true
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooManyRequests:
+		return true
+	default:
+		return statusCode >= http.StatusInternalServerError
+	}
+}
+
+// getStatusCode returns the http status of a storage provider error, or 0 if there was no response
+func getStatusCode(err error) int {
+	var awsErr awserr.RequestFailure
+	var gcpErr *googleapi.Error
+	var azureErr azblob.StorageError
+	var ossErr oss.ServiceError
+	switch {
+	case errors.As(err, &awsErr):
+		return awsErr.StatusCode()
+	case errors.As(err, &gcpErr):
+		return gcpErr.Code
+	case errors.As(err, &azureErr):
+		if res := azureErr.Response(); res != nil {
+			return res.StatusCode
+		}
+	case errors.As(err, &ossErr):
+		return ossErr.StatusCode
+	}
+	return 0
 }
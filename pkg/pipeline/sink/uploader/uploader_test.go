@@ -0,0 +1,204 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uploader
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type fakeUploader struct {
+	name    string
+	err     error
+	uploads int
+}
+
+func (f *fakeUploader) upload(localFilepath, storageFilepath string, _ types.OutputType, _ map[string]string) (string, int64, error) {
+	f.uploads++
+	if f.err != nil {
+		return "", 0, f.err
+	}
+	stat, err := os.Stat(localFilepath)
+	if err != nil {
+		return "", 0, err
+	}
+	return f.name + "/" + storageFilepath, stat.Size(), nil
+}
+
+func (f *fakeUploader) sign(storageFilepath string, _ time.Duration) (string, error) {
+	return f.name + "/" + storageFilepath + "?signed", nil
+}
+
+func (f *fakeUploader) check() error {
+	return nil
+}
+
+func TestUploadFailover(t *testing.T) {
+	errPrimary := errors.New("primary unavailable")
+	errFallback := errors.New("fallback unavailable")
+
+	for _, test := range []struct {
+		name        string
+		primaryErr  error
+		fallback    bool
+		fallbackErr error
+		backup      bool
+		location    string
+		signed      string
+		result      *UploadResult
+		failed      bool
+	}{
+		{
+			name:     "Primary",
+			fallback: true,
+			backup:   true,
+			location: "primary/recording.mp4",
+			signed:   "primary/recording.mp4?signed",
+		},
+		{
+			name:       "Fallback",
+			primaryErr: errPrimary,
+			fallback:   true,
+			backup:     true,
+			location:   "fallback/recording.mp4",
+			signed:     "fallback/recording.mp4?signed",
+			result: &UploadResult{
+				Filename:    "recording.mp4",
+				Destination: "fallback",
+				Errors:      []string{errPrimary.Error()},
+			},
+		},
+		{
+			name:        "Backup",
+			primaryErr:  errPrimary,
+			fallback:    true,
+			fallbackErr: errFallback,
+			backup:      true,
+			location:    "backup/recording.mp4",
+			result: &UploadResult{
+				Filename:    "recording.mp4",
+				Destination: "backup",
+				Errors:      []string{errPrimary.Error(), errFallback.Error()},
+			},
+		},
+		{
+			name:       "BackupWithoutFallback",
+			primaryErr: errPrimary,
+			backup:     true,
+			location:   "backup/recording.mp4",
+			result: &UploadResult{
+				Filename:    "recording.mp4",
+				Destination: "backup",
+				Errors:      []string{errPrimary.Error()},
+			},
+		},
+		{
+			name:        "Failed",
+			primaryErr:  errPrimary,
+			fallback:    true,
+			fallbackErr: errFallback,
+			result: &UploadResult{
+				Filename: "recording.mp4",
+				Errors:   []string{errPrimary.Error(), errFallback.Error()},
+			},
+			failed: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			localFilepath := path.Join(dir, "local.mp4")
+			require.NoError(t, os.WriteFile(localFilepath, []byte("recording"), 0644))
+
+			primary := &fakeUploader{name: "primary", err: test.primaryErr}
+			fallback := &fakeUploader{name: "fallback", err: test.fallbackErr}
+			u := &remoteUploader{
+				uploader: primary,
+				retry:    config.UploadRetryConfig{MaxAttempts: 1},
+				monitor:  stats.NewHandlerMonitor("node", "cluster", "EG_"+test.name),
+			}
+			if test.fallback {
+				u.fallback = fallback
+			}
+			if test.backup {
+				u.backup = path.Join(dir, "backup")
+			}
+
+			location, size, err := u.Upload(localFilepath, "recording.mp4", types.OutputTypeMP4, true, "file")
+			if test.failed {
+				require.ErrorIs(t, err, test.fallbackErr)
+				require.FileExists(t, localFilepath)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, int64(len("recording")), size)
+				require.NoFileExists(t, localFilepath)
+				if test.result != nil && test.result.Destination == "backup" {
+					require.Equal(t, path.Join(u.backup, "recording.mp4"), location)
+					require.FileExists(t, location)
+				} else {
+					require.Equal(t, test.location, location)
+				}
+			}
+			require.Equal(t, test.failed, u.Failed())
+
+			require.Equal(t, 1, primary.uploads)
+			if test.fallback && test.primaryErr != nil {
+				require.Equal(t, 1, fallback.uploads)
+			} else {
+				require.Zero(t, fallback.uploads)
+			}
+
+			if test.result == nil {
+				require.Empty(t, u.Results())
+			} else {
+				require.Equal(t, []*UploadResult{test.result}, u.Results())
+			}
+
+			signed, err := u.SignURL("recording.mp4", time.Minute)
+			if test.signed != "" {
+				require.NoError(t, err)
+				require.Equal(t, test.signed, signed)
+			} else if !test.failed {
+				require.ErrorIs(t, err, errNotSignable)
+			}
+		})
+	}
+}
+
+func TestVerifyStored(t *testing.T) {
+	stored := func(size int64, err error) func() (int64, error) {
+		return func() (int64, error) { return size, err }
+	}
+
+	require.NoError(t, verifyStored("S3", 9, stored(9, nil)))
+	require.Error(t, verifyStored("S3", 9, stored(4, nil)))
+
+	// write-only credentials can't read the object back
+	forbidden := awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), http.StatusForbidden, "")
+	require.NoError(t, verifyStored("S3", 9, stored(0, forbidden)))
+
+	notFound := awserr.NewRequestFailure(awserr.New("NotFound", "not found", nil), http.StatusNotFound, "")
+	require.Error(t, verifyStored("S3", 9, stored(0, notFound)))
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package waveform
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"sync"
+)
+
+const (
+	levelsPerSecond = 10
+	maxLevels       = 1 << 16
+	floorDB         = -60.0
+)
+
+var palette = color.Palette{
+	color.Transparent,
+	color.RGBA{R: 0x1f, G: 0x8c, B: 0xf9, A: 0xff},
+}
+
+// Levels accumulates peak levels from interleaved S16LE audio
+type Levels struct {
+	mu       sync.Mutex
+	interval int // samples per level
+	count    int
+	peak     float64
+	levels   []float64
+}
+
+func NewLevels(sampleRate, channels int32) *Levels {
+	return &Levels{
+		interval: int(sampleRate*channels) / levelsPerSecond,
+	}
+}
+
+func (l *Levels) Write(samples []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := 0; i+1 < len(samples); i += 2 {
+		v := math.Abs(float64(int16(binary.LittleEndian.Uint16(samples[i:])))) / math.MaxInt16
+		if v > l.peak {
+			l.peak = v
+		}
+		l.count++
+		if l.count == l.interval {
+			l.appendLevel()
+		}
+	}
+}
+
+func (l *Levels) appendLevel() {
+	l.levels = append(l.levels, l.peak)
+	l.peak = 0
+	l.count = 0
+
+	if len(l.levels) == maxLevels {
+		// halve the resolution to keep memory bounded for long recordings
+		for i := 0; i < maxLevels/2; i++ {
+			l.levels[i] = math.Max(l.levels[2*i], l.levels[2*i+1])
+		}
+		l.levels = l.levels[:maxLevels/2]
+		l.interval *= 2
+	}
+}
+
+// Render draws the waveform over the full duration, one column per bucket of levels
+func (l *Levels) Render(width, height int) *image.Paletted {
+	l.mu.Lock()
+	levels := append([]float64{}, l.levels...)
+	if l.count > 0 {
+		levels = append(levels, l.peak)
+	}
+	l.mu.Unlock()
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	if len(levels) == 0 {
+		return img
+	}
+
+	mid := height / 2
+	for x := 0; x < width; x++ {
+		start := x * len(levels) / width
+		end := (x + 1) * len(levels) / width
+		if end <= start {
+			end = start + 1
+		}
+
+		var peak float64
+		for _, level := range levels[start:end] {
+			peak = math.Max(peak, level)
+		}
+
+		// silence is drawn as a flat center line
+		half := int(scale(peak) * float64(mid))
+		for y := mid - half; y <= mid+half && y < height; y++ {
+			img.SetColorIndex(x, y, 1)
+		}
+	}
+
+	return img
+}
+
+func (l *Levels) WritePNG(filepath string, width, height int) error {
+	f, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return png.Encode(f, l.Render(width, height))
+}
+
+// scale maps a linear peak to [0, 1] on a decibel scale, so quiet speech remains visible
+func scale(peak float64) float64 {
+	if peak <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(peak)
+	if db <= floorDB {
+		return 0
+	}
+	return math.Min(1, (db-floorDB)/-floorDB)
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package waveform
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevels(t *testing.T) {
+	l := NewLevels(100, 1)
+
+	samples := make([]byte, 2*10)
+	binary.LittleEndian.PutUint16(samples[4:], uint16(16384))
+	l.Write(samples)
+	l.Write(make([]byte, 2*10))
+	require.Len(t, l.levels, 2)
+	require.InDelta(t, 0.5, l.levels[0], 0.001)
+	require.Zero(t, l.levels[1])
+
+	img := l.Render(4, 21)
+	require.Equal(t, uint8(1), img.ColorIndexAt(0, 10))
+	require.Equal(t, uint8(1), img.ColorIndexAt(0, 3))
+	// silent sections are a single center line
+	require.Equal(t, uint8(1), img.ColorIndexAt(3, 10))
+	require.Equal(t, uint8(0), img.ColorIndexAt(3, 9))
+}
+
+func TestLevelsDownsample(t *testing.T) {
+	l := NewLevels(10, 1)
+	samples := make([]byte, 2)
+	for i := 0; i < maxLevels; i++ {
+		binary.LittleEndian.PutUint16(samples, uint16(i%2))
+		l.Write(samples)
+	}
+	require.Len(t, l.levels, maxLevels/2)
+	require.Equal(t, 2, l.interval)
+	require.InDelta(t, 1.0/32767, l.levels[0], 1e-9)
+}
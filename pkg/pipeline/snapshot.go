@@ -0,0 +1,101 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-gst/go-gst/gst"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/pipeline/snapshot"
+	"github.com/livekit/egress/pkg/types"
+)
+
+type snapshotResult struct {
+	frame *snapshot.Frame
+	err   error
+}
+
+// GetSnapshot copies the next decoded frame and encodes it. The probe only copies the buffer,
+// so a slow encode never holds up the pipeline. Returns ErrSnapshotTimeout if no frame arrives before ctx is done
+func (c *Controller) GetSnapshot(ctx context.Context, width, height int, outputType types.OutputType) ([]byte, error) {
+	if !c.VideoEnabled || !c.VideoDecoding {
+		return nil, errors.ErrNoDecodedVideo
+	}
+
+	tee, err := c.p.GetElementByName(builder.RawVideoTeeName)
+	if err != nil {
+		return nil, errors.ErrNoDecodedVideo
+	}
+
+	res := make(chan *snapshotResult, 1)
+	pad := tee.GetStaticPad("sink")
+	id := pad.AddProbe(gst.PadProbeTypeBuffer, func(pad *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		buffer := info.GetBuffer()
+		if buffer == nil {
+			return gst.PadProbeOK
+		}
+
+		frame, err := copyFrame(pad, buffer)
+		res <- &snapshotResult{frame: frame, err: err}
+		return gst.PadProbeRemove
+	})
+
+	select {
+	case r := <-res:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return snapshot.Encode(r.frame, width, height, outputType)
+
+	case <-ctx.Done():
+		select {
+		case <-res:
+			// removed itself
+		default:
+			pad.RemoveProbe(id)
+		}
+		return nil, errors.ErrSnapshotTimeout
+	}
+}
+
+func copyFrame(pad *gst.Pad, buffer *gst.Buffer) (*snapshot.Frame, error) {
+	caps := pad.GetCurrentCaps()
+	if caps == nil {
+		return nil, errors.ErrNoDecodedVideo
+	}
+	s := caps.GetStructureAt(0)
+	if s == nil {
+		return nil, errors.ErrNoDecodedVideo
+	}
+
+	format, _ := s.GetValue("format")
+	if format != "I420" {
+		return nil, errors.ErrNotSupported(fmt.Sprintf("snapshot of %v video", format))
+	}
+	width, _ := s.GetValue("width")
+	height, _ := s.GetValue("height")
+	w, _ := width.(int)
+	h, _ := height.(int)
+
+	return &snapshot.Frame{
+		Data:   buffer.Bytes(),
+		Width:  w,
+		Height: h,
+	}, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+// MaxDimension bounds the width and height of a snapshot, larger requests are scaled down to fit
+const MaxDimension = 4096
+
+// Frame is a copy of a raw I420 video frame
+type Frame struct {
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// Encode converts the frame to a jpeg or png, scaling it when width or height are set.
+// A missing dimension is derived from the frame's aspect ratio
+func Encode(f *Frame, width, height int, outputType types.OutputType) ([]byte, error) {
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("invalid snapshot size %dx%d", width, height)
+	}
+	img, err := f.image()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case width == 0 && height == 0:
+		width, height = f.Width, f.Height
+	case width == 0:
+		width = max(1, height*f.Width/f.Height)
+	case height == 0:
+		height = max(1, width*f.Height/f.Width)
+	}
+	if width > MaxDimension || height > MaxDimension {
+		scale := min(float64(MaxDimension)/float64(width), float64(MaxDimension)/float64(height))
+		width = max(1, int(float64(width)*scale))
+		height = max(1, int(float64(height)*scale))
+	}
+
+	var out image.Image = img
+	if width != f.Width || height != f.Height {
+		out = scale(img, width, height)
+	}
+
+	buf := &bytes.Buffer{}
+	switch outputType {
+	case types.OutputTypeJPEG:
+		err = jpeg.Encode(buf, out, nil)
+	case types.OutputTypePNG:
+		err = png.Encode(buf, out)
+	default:
+		err = fmt.Errorf("unsupported snapshot type %s", outputType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// image wraps the frame using gstreamer's default I420 layout, with rows aligned to 4 bytes
+func (f *Frame) image() (*image.YCbCr, error) {
+	if f.Width <= 0 || f.Height <= 0 {
+		return nil, fmt.Errorf("invalid frame size %dx%d", f.Width, f.Height)
+	}
+
+	yStride := roundUp4(f.Width)
+	cStride := roundUp4(roundUp2(f.Width) / 2)
+	ySize := yStride * roundUp2(f.Height)
+	cSize := cStride * roundUp2(f.Height) / 2
+	if len(f.Data) < ySize+2*cSize {
+		return nil, fmt.Errorf("frame too small for %dx%d I420", f.Width, f.Height)
+	}
+
+	return &image.YCbCr{
+		Y:              f.Data[:ySize],
+		Cb:             f.Data[ySize : ySize+cSize],
+		Cr:             f.Data[ySize+cSize : ySize+2*cSize],
+		YStride:        yStride,
+		CStride:        cStride,
+		SubsampleRatio: image.YCbCrSubsampleRatio420,
+		Rect:           image.Rect(0, 0, f.Width, f.Height),
+	}, nil
+}
+
+// scale resizes using nearest neighbor sampling, which is enough for previews
+func scale(src *image.YCbCr, width, height int) *image.YCbCr {
+	dst := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < height; y++ {
+		sy := y * srcH / height
+		for x := 0; x < width; x++ {
+			sx := x * srcW / width
+			dst.Y[dst.YOffset(x, y)] = src.Y[src.YOffset(sx, sy)]
+			if x%2 == 0 && y%2 == 0 {
+				c := dst.COffset(x, y)
+				sc := src.COffset(sx, sy)
+				dst.Cb[c] = src.Cb[sc]
+				dst.Cr[c] = src.Cr[sc]
+			}
+		}
+	}
+	return dst
+}
+
+func roundUp2(n int) int {
+	return (n + 1) &^ 1
+}
+
+func roundUp4(n int) int {
+	return (n + 3) &^ 3
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package snapshot
+
+import (
+	"bytes"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestEncode(t *testing.T) {
+	// 6 pixels wide, so the luma rows are padded to 8 bytes and chroma rows to 4
+	f := &Frame{Data: make([]byte, 8*4+2*4*2), Width: 6, Height: 4}
+	for i := range f.Data {
+		f.Data[i] = 128
+	}
+
+	b, err := Encode(f, 0, 0, types.OutputTypePNG)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, 6, img.Bounds().Dx())
+	require.Equal(t, 4, img.Bounds().Dy())
+
+	// height follows the aspect ratio
+	b, err = Encode(f, 12, 0, types.OutputTypeJPEG)
+	require.NoError(t, err)
+	img, err = jpeg.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, 12, img.Bounds().Dx())
+	require.Equal(t, 8, img.Bounds().Dy())
+
+	// scaled down to fit MaxDimension, keeping the requested aspect ratio
+	b, err = Encode(f, MaxDimension*2, MaxDimension, types.OutputTypePNG)
+	require.NoError(t, err)
+	img, err = png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, MaxDimension, img.Bounds().Dx())
+	require.Equal(t, MaxDimension/2, img.Bounds().Dy())
+
+	_, err = Encode(f, -1, 0, types.OutputTypePNG)
+	require.Error(t, err)
+	_, err = Encode(&Frame{Data: make([]byte, 10), Width: 6, Height: 4}, 0, 0, types.OutputTypePNG)
+	require.Error(t, err)
+	_, err = Encode(f, 0, 0, types.OutputTypeMP4)
+	require.Error(t, err)
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"sync"
+	"time"
+
+	"github.com/frostbyte73/core"
+
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// followsSpeaker is true for participant egress recording whichever participant is the active speaker
+func (s *SDKSource) followsSpeaker() bool {
+	return s.RequestType == types.RequestTypeParticipant && s.FollowSpeaker.Enabled
+}
+
+func (s *SDKSource) followedIdentity() string {
+	return s.follower.followedIdentity()
+}
+
+// speakerFollower tracks which participant is followed, switching to a new speaker once they have been
+// the loudest for the hold time
+type speakerFollower struct {
+	holdTime  time.Duration
+	afterFunc func(time.Duration, func()) func() bool // schedules a switch, returning its cancel func. Replaced in tests
+	subscribe func(identity string)                   // subscribes to the tracks of a newly followed speaker
+	release   func(identity string)                   // unsubscribes from the tracks of a previous speaker
+	closed    core.Fuse
+
+	mu              sync.Mutex
+	followed        string
+	previousSpeaker string // recorded until the followed speaker's tracks are added
+	candidate       string
+	cancel          func() bool
+}
+
+func newSpeakerFollower(identity string, holdTime time.Duration, closed core.Fuse, subscribe, release func(string)) *speakerFollower {
+	return &speakerFollower{
+		holdTime: holdTime,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+		subscribe: subscribe,
+		release:   release,
+		closed:    closed,
+		followed:  identity,
+	}
+}
+
+func (f *speakerFollower) followedIdentity() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.followed
+}
+
+// onActiveSpeaker restarts the hold timer whenever the loudest speaker changes. Silence keeps the
+// followed speaker, but cancels a pending switch
+func (f *speakerFollower) onActiveSpeaker(identity string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if identity == f.candidate {
+		return
+	}
+	if f.cancel != nil {
+		f.cancel()
+		f.cancel = nil
+	}
+	f.candidate = ""
+	if identity == "" || identity == f.followed {
+		return
+	}
+
+	f.candidate = identity
+	f.cancel = f.afterFunc(f.holdTime, func() {
+		f.switchSpeaker(identity)
+	})
+}
+
+// switchSpeaker subscribes to the new speaker's tracks. The previous speaker's tracks are recorded until
+// the new tracks are added, so the selector and mixer never fall back to their test sources
+func (f *speakerFollower) switchSpeaker(identity string) {
+	if f.closed.IsBroken() {
+		return
+	}
+
+	f.mu.Lock()
+	if f.candidate != identity {
+		f.mu.Unlock()
+		return
+	}
+	f.candidate = ""
+	f.cancel = nil
+
+	previous := f.followed
+	stale := f.previousSpeaker
+	f.followed = identity
+	if stale == identity {
+		// switched back before the last speaker's tracks were added, so the requested tracks are still recorded
+		stale = previous
+		f.previousSpeaker = ""
+	} else {
+		f.previousSpeaker = previous
+	}
+	f.mu.Unlock()
+
+	logger.Infow("following active speaker", "identity", identity, "previous", previous)
+	if stale != "" {
+		f.release(stale)
+	}
+	f.subscribe(identity)
+}
+
+// trackAdded returns the previous speaker to release once the last track needed from the followed speaker
+// has been added, or an empty string if the previous speaker is still needed
+func (f *speakerFollower) trackAdded(identity string, last bool) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous := f.previousSpeaker
+	if previous == "" || identity != f.followed || !last {
+		return ""
+	}
+	f.previousSpeaker = ""
+	return previous
+}
+
+// addFollowSpeakerCallback switches to the loudest speaker once they have held the floor for the hold time
+func (s *SDKSource) addFollowSpeakerCallback(cb *lksdk.RoomCallback) {
+	onActiveSpeakersChanged := cb.OnActiveSpeakersChanged
+	cb.OnActiveSpeakersChanged = func(speakers []lksdk.Participant) {
+		if onActiveSpeakersChanged != nil {
+			onActiveSpeakersChanged(speakers)
+		}
+
+		var identity string
+		if len(speakers) > 0 {
+			identity = speakers[0].Identity()
+		}
+		s.follower.onActiveSpeaker(identity)
+	}
+}
+
+// onSpeakerTrackAdded releases the previous speaker once the followed speaker's video has been added,
+// or their audio if they have no camera
+func (s *SDKSource) onSpeakerTrackAdded(rp *lksdk.RemoteParticipant, video bool) {
+	if !s.followsSpeaker() {
+		return
+	}
+
+	if previous := s.follower.trackAdded(rp.Identity(), video || !hasCamera(rp)); previous != "" {
+		go s.releaseSpeaker(previous)
+	}
+}
+
+// subscribeSpeaker subscribes to the tracks of a newly followed speaker
+func (s *SDKSource) subscribeSpeaker(identity string) {
+	rp := s.findParticipant(identity)
+	if rp == nil {
+		return
+	}
+	for _, track := range rp.Tracks() {
+		if pub, ok := track.(*lksdk.RemoteTrackPublication); ok {
+			s.onTrackPublished(pub, rp)
+		}
+	}
+}
+
+func (s *SDKSource) releaseSpeaker(identity string) {
+	rp := s.findParticipant(identity)
+	if rp == nil {
+		return
+	}
+
+	for _, track := range rp.Tracks() {
+		pub, ok := track.(*lksdk.RemoteTrackPublication)
+		if !ok || !pub.IsSubscribed() {
+			continue
+		}
+		logger.Infow("unsubscribing from track", "trackID", pub.SID())
+		if err := pub.SetSubscribed(false); err != nil {
+			logger.Warnw("failed to unsubscribe from track", err, "trackID", pub.SID())
+		}
+		s.onTrackFinished(pub.SID())
+	}
+}
+
+func (s *SDKSource) findParticipant(identity string) *lksdk.RemoteParticipant {
+	for _, rp := range s.room.GetParticipants() {
+		if rp.Identity() == identity {
+			return rp
+		}
+	}
+	return nil
+}
+
+func hasCamera(rp *lksdk.RemoteParticipant) bool {
+	for _, track := range rp.Tracks() {
+		if track.Kind() == lksdk.TrackKindVideo && track.Source() == livekit.TrackSource_CAMERA {
+			return true
+		}
+	}
+	return false
+}
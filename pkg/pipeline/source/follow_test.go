@@ -0,0 +1,188 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/types"
+)
+
+const holdTime = time.Second * 2
+
+// manualClock holds scheduled switches until the test fires them
+type manualClock struct {
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	d       time.Duration
+	f       func()
+	stopped bool
+}
+
+func (c *manualClock) afterFunc(d time.Duration, f func()) func() bool {
+	t := &manualTimer{d: d, f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		stopped := !t.stopped
+		t.stopped = true
+		return stopped
+	}
+}
+
+// expire runs every switch whose hold time has passed and has not been cancelled
+func (c *manualClock) expire() {
+	timers := c.timers
+	c.timers = nil
+	for _, t := range timers {
+		if !t.stopped {
+			t.stopped = true
+			t.f()
+		}
+	}
+}
+
+type speakerTracks struct {
+	subscribed []string
+	released   []string
+}
+
+func newTestFollower(identity string) (*speakerFollower, *manualClock, *speakerTracks) {
+	clock := &manualClock{}
+	tracks := &speakerTracks{}
+	f := newSpeakerFollower(identity, holdTime, core.NewFuse(),
+		func(identity string) { tracks.subscribed = append(tracks.subscribed, identity) },
+		func(identity string) { tracks.released = append(tracks.released, identity) },
+	)
+	f.afterFunc = clock.afterFunc
+	return f, clock, tracks
+}
+
+func TestFollowSpeakerHold(t *testing.T) {
+	f, clock, tracks := newTestFollower("alice")
+
+	// bob stops being the loudest before the hold expires
+	f.onActiveSpeaker("bob")
+	require.Len(t, clock.timers, 1)
+	require.Equal(t, holdTime, clock.timers[0].d)
+	f.onActiveSpeaker("carol")
+	require.True(t, clock.timers[0].stopped)
+
+	// silence cancels carol's switch too
+	f.onActiveSpeaker("")
+	clock.expire()
+	require.Equal(t, "alice", f.followedIdentity())
+	require.Empty(t, tracks.subscribed)
+	require.Empty(t, tracks.released)
+
+	// the followed speaker speaking again doesn't schedule a switch
+	f.onActiveSpeaker("alice")
+	require.Empty(t, clock.timers)
+}
+
+func TestFollowSpeakerSwitch(t *testing.T) {
+	f, clock, tracks := newTestFollower("alice")
+
+	f.onActiveSpeaker("bob")
+	f.onActiveSpeaker("bob")
+	require.Len(t, clock.timers, 1)
+	clock.expire()
+	require.Equal(t, "bob", f.followedIdentity())
+	require.Equal(t, []string{"bob"}, tracks.subscribed)
+
+	// alice is recorded until bob's last track is added
+	require.Empty(t, tracks.released)
+	require.Empty(t, f.trackAdded("alice", true))
+	require.Empty(t, f.trackAdded("bob", false))
+	require.Equal(t, "alice", f.trackAdded("bob", true))
+	require.Empty(t, f.trackAdded("bob", true))
+
+	// carol takes over once bob's tracks have been added, so there is nothing left to release
+	f.onActiveSpeaker("carol")
+	clock.expire()
+	require.Equal(t, "carol", f.followedIdentity())
+	require.Equal(t, []string{"bob", "carol"}, tracks.subscribed)
+	require.Empty(t, tracks.released)
+	require.Equal(t, "bob", f.trackAdded("carol", true))
+}
+
+func TestFollowSpeakerSwitchBack(t *testing.T) {
+	f, clock, tracks := newTestFollower("alice")
+
+	f.onActiveSpeaker("bob")
+	clock.expire()
+
+	// alice is still recorded, so bob is released as soon as she is followed again
+	f.onActiveSpeaker("alice")
+	clock.expire()
+	require.Equal(t, "alice", f.followedIdentity())
+	require.Equal(t, []string{"bob", "alice"}, tracks.subscribed)
+	require.Equal(t, []string{"bob"}, tracks.released)
+	require.Empty(t, f.trackAdded("alice", true))
+}
+
+func TestFollowSpeakerClosed(t *testing.T) {
+	f, clock, tracks := newTestFollower("alice")
+
+	f.onActiveSpeaker("bob")
+	f.closed.Break()
+	clock.expire()
+	require.Equal(t, "alice", f.followedIdentity())
+	require.Empty(t, tracks.subscribed)
+}
+
+func TestFollowedSpeakerDisconnected(t *testing.T) {
+	for _, follow := range []bool{true, false} {
+		s := &SDKSource{
+			PipelineConfig: &config.PipelineConfig{},
+			endRecording:   make(chan struct{}),
+		}
+		s.RequestType = types.RequestTypeParticipant
+		s.FollowSpeaker.Enabled = follow
+		var clock *manualClock
+		var tracks *speakerTracks
+		s.follower, clock, tracks = newTestFollower("alice")
+
+		s.onParticipantDisconnected("bob")
+		s.onParticipantDisconnected("alice")
+		if !follow {
+			require.True(t, isClosed(s.EndRecording()))
+			continue
+		}
+
+		// the recording continues until the next speaker takes over
+		require.False(t, isClosed(s.EndRecording()))
+		s.follower.onActiveSpeaker("bob")
+		clock.expire()
+		require.Equal(t, "bob", s.followedIdentity())
+		require.Equal(t, []string{"bob"}, tracks.subscribed)
+		require.False(t, isClosed(s.EndRecording()))
+	}
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
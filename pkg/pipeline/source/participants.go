@@ -0,0 +1,60 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import "time"
+
+// recordedParticipant tracks the periods during which a participant had at least one track recorded
+type recordedParticipant struct {
+	tracks int
+	since  int64
+	closed [][2]int64
+}
+
+// intervals returns the recorded periods, ending any open period at endedAt
+func (p *recordedParticipant) intervals(endedAt int64) [][2]int64 {
+	if p.tracks > 0 {
+		return append(p.closed[:len(p.closed):len(p.closed)], [2]int64{p.since, endedAt})
+	}
+	return p.closed
+}
+
+// addParticipantTrack must be called with the lock held
+func (s *SDKSource) addParticipantTrack(identity, trackID string) {
+	p := s.participants[identity]
+	if p == nil {
+		p = &recordedParticipant{}
+		s.participants[identity] = p
+	}
+	if p.tracks == 0 {
+		p.since = time.Now().UnixNano()
+	}
+	p.tracks++
+	s.trackOwners[trackID] = identity
+}
+
+// removeParticipantTrack must be called with the lock held
+func (s *SDKSource) removeParticipantTrack(trackID string) {
+	identity, ok := s.trackOwners[trackID]
+	if !ok {
+		return
+	}
+	delete(s.trackOwners, trackID)
+
+	p := s.participants[identity]
+	if p.tracks--; p.tracks == 0 {
+		p.closed = append(p.closed, [2]int64{p.since, time.Now().UnixNano()})
+	}
+}
@@ -15,7 +15,9 @@
 package source
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
@@ -25,7 +27,9 @@ import (
 	"github.com/frostbyte73/core"
 	"github.com/go-gst/go-gst/gst"
 	"github.com/go-gst/go-gst/gst/app"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/pion/webrtc/v3"
+	"github.com/twitchtv/twirp"
 	"go.uber.org/atomic"
 
 	"github.com/livekit/egress/pkg/config"
@@ -41,7 +45,13 @@ import (
 )
 
 const (
-	subscriptionTimeout = time.Second * 30
+	defaultSubscriptionTimeout = time.Second * 30
+	identityCheckTimeout       = time.Second * 5
+	disconnectLookupTimeout    = time.Second * 5
+	maxHighlightLength         = 64
+
+	// the pinned sdk does not pass data packet topics, so highlights carry theirs in the payload
+	highlightTopic = "lk.egress.highlight"
 )
 
 type SDKSource struct {
@@ -56,9 +66,16 @@ type SDKSource struct {
 	filenameReplacements map[string]string
 	errors               chan error
 
-	writers map[string]*sdk.AppWriter
-	active  atomic.Int32
-	closed  core.Fuse
+	writers      map[string]*sdk.AppWriter
+	participants map[string]*recordedParticipant
+	trackOwners  map[string]string
+	active       atomic.Int32
+	closed       core.Fuse
+
+	reconnecting     atomic.Bool
+	disconnectReason types.DisconnectReason
+
+	follower *speakerFollower
 
 	startRecording chan struct{}
 	endRecording   chan struct{}
@@ -78,10 +95,13 @@ func NewSDKSource(ctx context.Context, p *config.PipelineConfig, callbacks *gstr
 		initialized:          core.NewFuse(),
 		filenameReplacements: make(map[string]string),
 		writers:              make(map[string]*sdk.AppWriter),
+		participants:         make(map[string]*recordedParticipant),
+		trackOwners:          make(map[string]string),
 		closed:               core.NewFuse(),
 		startRecording:       startRecording,
 		endRecording:         make(chan struct{}),
 	}
+	s.follower = newSpeakerFollower(p.Identity, p.FollowSpeaker.HoldTime, s.closed, s.subscribeSpeaker, s.releaseSpeaker)
 
 	if err := s.joinRoom(); err != nil {
 		return nil, err
@@ -116,6 +136,38 @@ func (s *SDKSource) GetEndedAt() int64 {
 	return s.sync.GetEndedAt()
 }
 
+// ParticipantCount returns the number of participants whose tracks have been recorded
+func (s *SDKSource) ParticipantCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.participants)
+}
+
+// ParticipantDuration returns the total time each participant had tracks recorded, between the start and end of the recording
+func (s *SDKSource) ParticipantDuration() time.Duration {
+	startedAt, endedAt := s.GetStartedAt(), s.GetEndedAt()
+	if startedAt == 0 {
+		return 0
+	}
+	if endedAt == 0 {
+		endedAt = time.Now().UnixNano()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for _, p := range s.participants {
+		for _, interval := range p.intervals(endedAt) {
+			if start, end := max(interval[0], startedAt), min(interval[1], endedAt); end > start {
+				total += end - start
+			}
+		}
+	}
+	return time.Duration(total)
+}
+
 func (s *SDKSource) CloseWriters() {
 	s.closed.Once(func() {
 		s.sync.End()
@@ -138,7 +190,53 @@ func (s *SDKSource) StreamStopped(trackID string) {
 	s.onTrackFinished(trackID)
 }
 
+// ResetTrack rebuilds a track's bin around a new app source. The writer keeps running, so the track
+// keeps its place in the a/v sync and only the media pushed while the bin is replaced is lost
+func (s *SDKSource) ResetTrack(trackID string) error {
+	s.mu.RLock()
+	writer := s.writers[trackID]
+	s.mu.RUnlock()
+	if writer == nil {
+		return errors.ErrTrackNotFound(trackID)
+	}
+
+	src, err := gst.NewElementWithName("appsrc", fmt.Sprintf("app_%s", writer.TrackID()))
+	if err != nil {
+		return errors.ErrGstPipelineError(err)
+	}
+
+	ts := writer.TrackSource()
+	s.callbacks.OnTrackRemoved(trackID)
+	ts.AppSrc = app.SrcFromElement(src)
+	writer.SetSource(ts.AppSrc)
+	s.callbacks.OnTrackAdded(ts)
+	return nil
+}
+
+// DisconnectReason returns why the room connection ended, or an empty reason while still connected
+func (s *SDKSource) DisconnectReason() types.DisconnectReason {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.disconnectReason
+}
+
+// DisconnectError returns an error if the room connection was lost before the egress was stopped
+func (s *SDKSource) DisconnectError() error {
+	s.mu.RLock()
+	reason := s.disconnectReason
+	s.mu.RUnlock()
+
+	switch reason {
+	case "", types.DisconnectReasonClientInitiated:
+		return nil
+	default:
+		return errors.ErrRoomDisconnected(string(reason))
+	}
+}
+
 func (s *SDKSource) Close() {
+	s.setDisconnectReason(types.DisconnectReasonClientInitiated)
 	s.room.Disconnect()
 }
 
@@ -154,14 +252,34 @@ func (s *SDKSource) joinRoom() error {
 		},
 		OnReconnecting: s.onReconnecting,
 		OnReconnected:  s.onReconnected,
-		OnDisconnected: s.onDisconnected,
+		OnDisconnected: func() {
+			s.onDisconnected(s.serverDisconnectReason())
+		},
 	}
 	if s.RequestType == types.RequestTypeParticipant {
 		cb.ParticipantCallback.OnTrackPublished = s.onTrackPublished
-		cb.OnParticipantDisconnected = s.onParticipantDisconnected
+		cb.OnParticipantDisconnected = func(rp *lksdk.RemoteParticipant) {
+			s.onParticipantDisconnected(rp.Identity())
+		}
+	}
+	if s.Diarization.Enabled {
+		s.addSpeakerCallback(cb)
+	}
+	if s.ChatSubtitles.Enabled {
+		s.addChatCallback(cb)
+	}
+	if s.EDL.Enabled {
+		s.addRoomEventCallbacks(cb)
+	}
+	if s.followsSpeaker() {
+		s.addFollowSpeakerCallback(cb)
 	}
 
-	logger.Debugw("connecting to room")
+	if err := s.checkIdentity(); err != nil {
+		return err
+	}
+
+	logger.Debugw("connecting to room", "identity", s.EgressIdentity)
 	s.room = lksdk.CreateRoom(cb)
 	if err := s.room.JoinWithToken(s.WsUrl, s.Token, lksdk.WithAutoSubscribe(false)); err != nil {
 		return err
@@ -180,6 +298,9 @@ func (s *SDKSource) joinRoom() error {
 		tracks := make(map[string]struct{})
 		if s.AudioEnabled {
 			tracks[s.AudioTrackID] = struct{}{}
+			for _, t := range s.AudioTracks {
+				tracks[t.TrackID] = struct{}{}
+			}
 		}
 		if s.VideoEnabled {
 			tracks[s.VideoTrackID] = struct{}{}
@@ -194,6 +315,10 @@ func (s *SDKSource) joinRoom() error {
 		return err
 	}
 
+	if err = s.handleMissingVideo(); err != nil {
+		return err
+	}
+
 	if err = s.UpdateInfoFromSDK(fileIdentifier, s.filenameReplacements, w, h); err != nil {
 		logger.Errorw("could not update file params", err)
 		return err
@@ -202,6 +327,30 @@ func (s *SDKSource) joinRoom() error {
 	return nil
 }
 
+// checkIdentity fails instead of joining with a configured identity that is already in the room,
+// which would disconnect the existing participant
+func (s *SDKSource) checkIdentity() error {
+	if s.EgressParticipant.Identity == "" || s.EgressIdentity == "" {
+		// egress ids are unique, and request tokens carry their own identity
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), identityCheckTimeout)
+	defer cancel()
+
+	client := lksdk.NewRoomServiceClient(s.WsUrl, s.ApiKey, s.ApiSecret)
+	_, err := client.GetParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     s.Info.RoomName,
+		Identity: s.EgressIdentity,
+	})
+	if err == nil {
+		return errors.ErrIdentityConflict(s.EgressIdentity)
+	}
+
+	logger.Debugw("egress identity available", "identity", s.EgressIdentity, "lookup", err)
+	return nil
+}
+
 func (s *SDKSource) awaitParticipant(identity string) (uint32, uint32, error) {
 	s.errors = make(chan error, 2)
 
@@ -210,9 +359,19 @@ func (s *SDKSource) awaitParticipant(identity string) (uint32, uint32, error) {
 		return 0, 0, err
 	}
 
+	// without no_input_timeout, wait for the participant to publish for as long as it takes
+	var deadline <-chan time.Time
+	if s.NoInputTimeout > 0 {
+		deadline = time.After(s.NoInputTimeout)
+	}
 	for trackCount := 0; trackCount == 0 || trackCount < len(rp.Tracks()); trackCount++ {
-		if err = <-s.errors; err != nil {
-			return 0, 0, err
+		select {
+		case err = <-s.errors:
+			if err != nil {
+				return 0, 0, err
+			}
+		case <-deadline:
+			return 0, 0, s.subscriptionTimedOut(errors.ErrSubscriptionFailed)
 		}
 	}
 
@@ -230,7 +389,7 @@ func (s *SDKSource) awaitParticipant(identity string) (uint32, uint32, error) {
 }
 
 func (s *SDKSource) getParticipant(identity string) (*lksdk.RemoteParticipant, error) {
-	deadline := time.Now().Add(subscriptionTimeout)
+	deadline := time.Now().Add(s.subscriptionTimeout())
 	for time.Now().Before(deadline) {
 		for _, p := range s.room.GetParticipants() {
 			if p.Identity() == identity {
@@ -239,17 +398,41 @@ func (s *SDKSource) getParticipant(identity string) (*lksdk.RemoteParticipant, e
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
-	return nil, errors.ErrParticipantNotFound(identity)
+	return nil, s.subscriptionTimedOut(errors.ErrParticipantNotFound(identity))
+}
+
+// subscriptionTimeout is how long to wait for the participant or tracks. With no_input_timeout,
+// nothing published within that timeout means no input was received
+func (s *SDKSource) subscriptionTimeout() time.Duration {
+	if s.NoInputTimeout > 0 {
+		return s.NoInputTimeout
+	}
+	return defaultSubscriptionTimeout
+}
+
+func (s *SDKSource) subscriptionTimedOut(err error) error {
+	if s.NoInputTimeout > 0 {
+		logger.Infow("no input received, stopping egress", "timeout", s.NoInputTimeout, "reason", err)
+		return errors.ErrNoInputReceived(s.NoInputTimeout)
+	}
+	return err
 }
 
 func (s *SDKSource) awaitTracks(expecting map[string]struct{}) (uint32, uint32, error) {
 	trackCount := len(expecting)
 	s.errors = make(chan error, trackCount)
 
-	deadline := time.After(subscriptionTimeout)
+	deadline := time.After(s.subscriptionTimeout())
 	tracks, err := s.subscribeToTracks(expecting, deadline)
 	if err != nil {
-		return 0, 0, err
+		if !s.videoTrackMissing(expecting) {
+			return 0, 0, err
+		}
+
+		// continue with the audio track, handleMissingVideo decides what to do with the video
+		logger.Infow("video track not found", "trackID", s.VideoTrackID)
+		trackCount--
+		deadline = time.After(s.subscriptionTimeout())
 	}
 
 	for i := 0; i < trackCount; i++ {
@@ -259,7 +442,7 @@ func (s *SDKSource) awaitTracks(expecting map[string]struct{}) (uint32, uint32,
 				return 0, 0, err
 			}
 		case <-deadline:
-			return 0, 0, errors.ErrSubscriptionFailed
+			return 0, 0, s.subscriptionTimedOut(errors.ErrSubscriptionFailed)
 		}
 	}
 
@@ -282,7 +465,7 @@ func (s *SDKSource) subscribeToTracks(expecting map[string]struct{}, deadline <-
 		select {
 		case <-deadline:
 			for trackID := range expecting {
-				return nil, errors.ErrTrackNotFound(trackID)
+				return tracks, s.subscriptionTimedOut(errors.ErrTrackNotFound(trackID))
 			}
 		default:
 			for _, p := range s.room.GetParticipants() {
@@ -307,6 +490,54 @@ func (s *SDKSource) subscribeToTracks(expecting map[string]struct{}, deadline <-
 	}
 }
 
+// a missing track composite video track is only tolerated when the audio track was found
+func (s *SDKSource) videoTrackMissing(missing map[string]struct{}) bool {
+	if s.RequestType != types.RequestTypeTrackComposite || s.MissingVideo == types.MissingVideoFail || !s.AudioEnabled {
+		return false
+	}
+	_, ok := missing[s.VideoTrackID]
+	return ok && len(missing) == 1
+}
+
+// applies the missing_video behavior when video was requested but no video track was subscribed.
+// The decision is made once, when the egress joins: with audio_only, a participant egress whose participant
+// has no camera published at that point records audio only, even if a camera is published later
+func (s *SDKSource) handleMissingVideo() error {
+	if s.RequestType == types.RequestTypeTrack || !s.VideoEnabled || s.VideoTrack != nil {
+		return nil
+	}
+
+	behavior := s.MissingVideo
+	if behavior == types.MissingVideoAudioOnly && len(s.GetImageConfigs()) > 0 {
+		logger.Warnw("image outputs require video", nil, "missingVideo", behavior)
+		behavior = types.MissingVideoPlaceholder
+	}
+	logger.Infow("no video track published", "missingVideo", behavior)
+
+	switch behavior {
+	case types.MissingVideoFail:
+		return errors.ErrNoVideoTrack
+
+	case types.MissingVideoAudioOnly:
+		s.VideoEnabled = false
+		s.VideoDecoding = false
+		s.VideoEncoding = false
+		s.VideoOutCodec = ""
+		if req := s.Info.GetTrackComposite(); req != nil {
+			// report the output as audio only
+			req.VideoTrackId = ""
+		}
+	}
+
+	return nil
+}
+
+// videoDropped is true once the egress has started audio only because of missing_video: audio_only.
+// The pipeline has no video branch, so video tracks published afterwards are not subscribed
+func (s *SDKSource) videoDropped() bool {
+	return s.initialized.IsBroken() && s.MissingVideo == types.MissingVideoAudioOnly && !s.VideoEnabled
+}
+
 func (s *SDKSource) subscribe(track lksdk.TrackPublication) error {
 	if pub, ok := track.(*lksdk.RemoteTrackPublication); ok {
 		if pub.IsSubscribed() {
@@ -367,10 +598,16 @@ func (s *SDKSource) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Remo
 
 		s.mu.Lock()
 		s.writers[ts.TrackID] = writer
+		s.addParticipantTrack(rp.Identity(), ts.TrackID)
 		s.mu.Unlock()
 
 		if s.initialized.IsBroken() {
 			s.callbacks.OnTrackAdded(ts)
+			s.onSpeakerTrackAdded(rp, false)
+		} else if s.AudioTrackSources != nil && ts.TrackID != s.AudioTrackID {
+			s.mu.Lock()
+			s.AudioTrackSources[ts.TrackID] = ts
+			s.mu.Unlock()
 		} else {
 			s.AudioTrack = ts
 		}
@@ -381,7 +618,7 @@ func (s *SDKSource) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Remo
 		if s.VideoOutCodec == "" {
 			s.VideoOutCodec = ts.MimeType
 		}
-		if s.VideoInCodec != s.VideoOutCodec {
+		if s.VideoInCodec != s.VideoOutCodec || s.duplicateFrames() {
 			s.VideoDecoding = true
 			if len(s.GetEncodedOutputs()) > 0 {
 				s.VideoEncoding = true
@@ -396,10 +633,12 @@ func (s *SDKSource) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Remo
 
 		s.mu.Lock()
 		s.writers[ts.TrackID] = writer
+		s.addParticipantTrack(rp.Identity(), ts.TrackID)
 		s.mu.Unlock()
 
 		if s.initialized.IsBroken() {
 			s.callbacks.OnTrackAdded(ts)
+			s.onSpeakerTrackAdded(rp, true)
 		} else {
 			s.VideoTrack = ts
 		}
@@ -443,6 +682,11 @@ func (s *SDKSource) onTrackSubscribed(track *webrtc.TrackRemote, pub *lksdk.Remo
 	}
 }
 
+// passthrough tracks need to be transcoded for frames to be duplicated
+func (s *SDKSource) duplicateFrames() bool {
+	return s.DuplicateFrames && s.VideoOutCodec == types.MimeTypeH264 && len(s.GetEncodedOutputs()) > 0
+}
+
 func (s *SDKSource) createWriter(
 	track *webrtc.TrackRemote,
 	pub lksdk.TrackPublication,
@@ -473,7 +717,11 @@ func (s *SDKSource) createWriter(
 }
 
 func (s *SDKSource) onTrackPublished(pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
-	if rp.Identity() != s.Identity {
+	if rp.Identity() != s.followedIdentity() {
+		return
+	}
+	if pub.Kind() == lksdk.TrackKindVideo && s.videoDropped() {
+		logger.Infow("ignoring participant track", "reason", "audio only")
 		return
 	}
 
@@ -489,6 +737,100 @@ func (s *SDKSource) onTrackPublished(pub *lksdk.RemoteTrackPublication, rp *lksd
 	}
 }
 
+// addSpeakerCallback reports the full set of active speakers for diarization
+func (s *SDKSource) addSpeakerCallback(cb *lksdk.RoomCallback) {
+	cb.OnActiveSpeakersChanged = func(speakers []lksdk.Participant) {
+		identities := make([]string, 0, len(speakers))
+		for _, speaker := range speakers {
+			identities = append(identities, speaker.Identity())
+		}
+		s.callbacks.OnSpeakersChanged(identities, time.Now().UnixNano())
+	}
+}
+
+type chatMessage struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// addChatCallback reports chat messages, sent as json data packets by the client sdks
+func (s *SDKSource) addChatCallback(cb *lksdk.RoomCallback) {
+	cb.ParticipantCallback.OnDataReceived = func(data []byte, rp *lksdk.RemoteParticipant) {
+		msg := &chatMessage{}
+		if err := json.Unmarshal(data, msg); err != nil || msg.Message == "" {
+			return
+		}
+
+		sender := rp.Name()
+		if sender == "" {
+			sender = rp.Identity()
+		}
+		s.callbacks.OnChatMessage(sender, msg.Message)
+	}
+}
+
+type highlightMessage struct {
+	Topic   string `json:"topic"`
+	Comment string `json:"comment"`
+}
+
+// parseHighlight returns the comment of a highlight data packet, truncated to maxHighlightLength
+func parseHighlight(data []byte) (string, bool) {
+	msg := &highlightMessage{}
+	if err := json.Unmarshal(data, msg); err != nil || msg.Topic != highlightTopic {
+		return "", false
+	}
+
+	comment := []byte(msg.Comment)
+	if len(comment) > maxHighlightLength {
+		comment = comment[:maxHighlightLength]
+	}
+	return string(bytes.ToValidUTF8(comment, nil)), true
+}
+
+// addRoomEventCallbacks reports speaker changes, screen shares and data messages for edit decision lists
+func (s *SDKSource) addRoomEventCallbacks(cb *lksdk.RoomCallback) {
+	var lastSpeaker string
+	onActiveSpeakersChanged := cb.OnActiveSpeakersChanged
+	cb.OnActiveSpeakersChanged = func(speakers []lksdk.Participant) {
+		if onActiveSpeakersChanged != nil {
+			onActiveSpeakersChanged(speakers)
+		}
+		if len(speakers) == 0 || speakers[0].Identity() == lastSpeaker {
+			return
+		}
+		lastSpeaker = speakers[0].Identity()
+		s.callbacks.OnRoomEvent(types.RoomEventActiveSpeaker, lastSpeaker)
+	}
+
+	onTrackPublished := cb.ParticipantCallback.OnTrackPublished
+	cb.ParticipantCallback.OnTrackPublished = func(pub *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+		if pub.Source() == livekit.TrackSource_SCREEN_SHARE {
+			s.callbacks.OnRoomEvent(types.RoomEventScreenShare, rp.Identity())
+		}
+		if onTrackPublished != nil {
+			onTrackPublished(pub, rp)
+		}
+	}
+
+	onDataReceived := cb.ParticipantCallback.OnDataReceived
+	cb.ParticipantCallback.OnDataReceived = func(data []byte, rp *lksdk.RemoteParticipant) {
+		if onDataReceived != nil {
+			onDataReceived(data, rp)
+		}
+		comment, ok := parseHighlight(data)
+		if !ok {
+			return
+		}
+		description := rp.Identity()
+		if comment != "" {
+			description = fmt.Sprintf("%s %s", description, comment)
+		}
+		s.callbacks.OnRoomEvent(types.RoomEventHighlight, description)
+	}
+}
+
 func (s *SDKSource) onTrackMuted(pub lksdk.TrackPublication, _ lksdk.Participant) {
 	s.mu.Lock()
 	writer := s.writers[pub.SID()]
@@ -518,6 +860,7 @@ func (s *SDKSource) onTrackFinished(trackID string) {
 	s.mu.Lock()
 	writer := s.writers[trackID]
 	delete(s.writers, trackID)
+	s.removeParticipantTrack(trackID)
 	s.mu.Unlock()
 
 	if writer != nil {
@@ -532,14 +875,23 @@ func (s *SDKSource) onTrackFinished(trackID string) {
 	}
 }
 
-func (s *SDKSource) onParticipantDisconnected(rp *lksdk.RemoteParticipant) {
-	if rp.Identity() == s.Identity {
-		logger.Debugw("participant disconnected")
-		s.finished()
+func (s *SDKSource) onParticipantDisconnected(identity string) {
+	if identity != s.followedIdentity() {
+		return
+	}
+	if s.followsSpeaker() {
+		// keep recording until the next speaker takes over
+		logger.Debugw("followed speaker disconnected", "identity", identity)
+		return
 	}
+
+	logger.Debugw("participant disconnected")
+	s.finished()
 }
 
 func (s *SDKSource) onReconnecting() {
+	s.reconnecting.Store(true)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -549,19 +901,94 @@ func (s *SDKSource) onReconnecting() {
 }
 
 func (s *SDKSource) onReconnected() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.reconnecting.Store(false)
 
+	s.mu.RLock()
 	for _, writer := range s.writers {
 		writer.SetTrackDisconnected(false)
 	}
+	s.mu.RUnlock()
+
+	s.callbacks.OnReconnected()
 }
 
-func (s *SDKSource) onDisconnected() {
-	logger.Warnw("disconnected from room", nil)
+func (s *SDKSource) onDisconnected(leaveReason livekit.DisconnectReason) {
+	reason := types.GetDisconnectReason(leaveReason)
+	if reason == types.DisconnectReasonUnknown && s.reconnecting.Load() {
+		// without a reason from the server, infer it from the connection state
+		if tokenExpired(s.Token) {
+			reason = types.DisconnectReasonTokenExpired
+		} else {
+			reason = types.DisconnectReasonNetwork
+		}
+	}
+	s.setDisconnectReason(reason)
+
+	logger.Warnw("disconnected from room", nil, "reason", reason)
 	s.finished()
 }
 
+// serverDisconnectReason infers why the server disconnected the egress, since the pinned sdk does not pass
+// the leave request's reason to OnDisconnected. A deleted room means it was closed, and a room without the
+// egress participant means it was removed
+func (s *SDKSource) serverDisconnectReason() livekit.DisconnectReason {
+	if s.DisconnectReason() != "" {
+		// stopped by the egress
+		return livekit.DisconnectReason_UNKNOWN_REASON
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), disconnectLookupTimeout)
+	defer cancel()
+
+	client := lksdk.NewRoomServiceClient(s.WsUrl, s.ApiKey, s.ApiSecret)
+	rooms, err := client.ListRooms(ctx, &livekit.ListRoomsRequest{Names: []string{s.Info.RoomName}})
+	if err != nil {
+		logger.Debugw("failed to look up room after disconnect", err)
+		return livekit.DisconnectReason_UNKNOWN_REASON
+	}
+	if len(rooms.Rooms) == 0 {
+		return livekit.DisconnectReason_ROOM_DELETED
+	}
+
+	_, err = client.GetParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     s.Info.RoomName,
+		Identity: s.EgressIdentity,
+	})
+	return participantLookupReason(err)
+}
+
+// participantLookupReason maps the egress participant lookup made after a disconnect to a leave reason
+func participantLookupReason(err error) livekit.DisconnectReason {
+	var twirpErr twirp.Error
+	if errors.As(err, &twirpErr) && twirpErr.Code() == twirp.NotFound {
+		return livekit.DisconnectReason_PARTICIPANT_REMOVED
+	}
+	// still in the room, or unknown
+	return livekit.DisconnectReason_UNKNOWN_REASON
+}
+
+func (s *SDKSource) setDisconnectReason(reason types.DisconnectReason) {
+	s.mu.Lock()
+	if s.disconnectReason == "" {
+		s.disconnectReason = reason
+	}
+	s.mu.Unlock()
+}
+
+func tokenExpired(token string) bool {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return false
+	}
+
+	claims := jwt.Claims{}
+	if err = tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return false
+	}
+
+	return claims.Expiry != nil && claims.Expiry.Time().Before(time.Now())
+}
+
 func (s *SDKSource) finished() {
 	select {
 	case <-s.endRecording:
@@ -60,7 +60,8 @@ type AppWriter struct {
 	pub       lksdk.TrackPublication
 	track     *webrtc.TrackRemote
 	codec     types.MimeType
-	src       *app.Source
+	ts        *config.TrackSource
+	src       atomic.Pointer[app.Source]
 	startTime time.Time
 
 	buffer     *jitter.Buffer
@@ -98,7 +99,7 @@ func NewAppWriter(
 		track:             track,
 		pub:               pub,
 		codec:             ts.MimeType,
-		src:               ts.AppSrc,
+		ts:                ts,
 		callbacks:         callbacks,
 		sync:              sync,
 		TrackSynchronizer: sync.AddTrack(track, rp.Identity()),
@@ -107,6 +108,7 @@ func NewAppWriter(
 		endStream:         core.NewFuse(),
 		finished:          core.NewFuse(),
 	}
+	w.src.Store(ts.AppSrc)
 
 	if logFilename != "" {
 		f, err := os.Create(logFilename)
@@ -158,6 +160,18 @@ func (w *AppWriter) TrackID() string {
 	return w.track.ID()
 }
 
+func (w *AppWriter) TrackSource() *config.TrackSource {
+	return w.ts
+}
+
+// SetSource moves the writer to a new app source, requesting a keyframe so the rebuilt decoder can start
+func (w *AppWriter) SetSource(src *app.Source) {
+	w.src.Store(src)
+	if w.sendPLI != nil {
+		w.sendPLI()
+	}
+}
+
 func (w *AppWriter) Play() {
 	w.playing.Break()
 	if w.pub.IsMuted() || w.disconnected.Load() {
@@ -229,7 +243,7 @@ func (w *AppWriter) run() {
 	// clean up
 	_ = w.pushSamples()
 	if w.playing.IsBroken() {
-		if flow := w.src.EndStream(); flow != gst.FlowOK && flow != gst.FlowFlushing {
+		if flow := w.src.Load().EndStream(); flow != gst.FlowOK && flow != gst.FlowFlushing {
 			w.logger.Errorw("unexpected flow return", nil, "flowReturn", flow.String())
 		}
 	}
@@ -374,7 +388,7 @@ func (w *AppWriter) pushPacket(pkt *rtp.Packet, pts time.Duration) error {
 
 	b := gst.NewBufferFromBytes(p)
 	b.SetPresentationTimestamp(gst.ClockTime(uint64(pts)))
-	if flow := w.src.PushBuffer(b); flow != gst.FlowOK {
+	if flow := w.src.Load().PushBuffer(b); flow != gst.FlowOK {
 		w.logger.Infow("unexpected flow return", "flow", flow)
 	}
 
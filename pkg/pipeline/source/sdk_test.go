@@ -0,0 +1,148 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/stretchr/testify/require"
+	"github.com/twitchtv/twirp"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+)
+
+func TestOnDisconnected(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		leaveReason  livekit.DisconnectReason
+		reconnecting bool
+		expected     types.DisconnectReason
+		failed       bool
+	}{
+		{name: "removed", leaveReason: livekit.DisconnectReason_PARTICIPANT_REMOVED, expected: types.DisconnectReasonKicked, failed: true},
+		{name: "room deleted", leaveReason: livekit.DisconnectReason_ROOM_DELETED, expected: types.DisconnectReasonRoomClosed, failed: true},
+		{name: "duplicate identity", leaveReason: livekit.DisconnectReason_DUPLICATE_IDENTITY, expected: types.DisconnectReasonDuplicateIdentity, failed: true},
+		{name: "no reason", leaveReason: livekit.DisconnectReason_UNKNOWN_REASON, expected: types.DisconnectReasonUnknown, failed: true},
+		{name: "lost while reconnecting", leaveReason: livekit.DisconnectReason_UNKNOWN_REASON, reconnecting: true, expected: types.DisconnectReasonNetwork, failed: true},
+		{name: "server reason wins", leaveReason: livekit.DisconnectReason_PARTICIPANT_REMOVED, reconnecting: true, expected: types.DisconnectReasonKicked, failed: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := &SDKSource{
+				PipelineConfig: &config.PipelineConfig{},
+				endRecording:   make(chan struct{}),
+			}
+			s.reconnecting.Store(test.reconnecting)
+
+			s.onDisconnected(test.leaveReason)
+			require.Equal(t, test.expected, s.DisconnectReason())
+			if test.failed {
+				require.EqualError(t, s.DisconnectError(), "disconnected from room: "+string(test.expected))
+			} else {
+				require.NoError(t, s.DisconnectError())
+			}
+
+			// the recording ends, and a later stop doesn't replace the reason
+			<-s.EndRecording()
+			s.setDisconnectReason(types.DisconnectReasonClientInitiated)
+			require.Equal(t, test.expected, s.disconnectReason)
+		})
+	}
+}
+
+func TestParticipantLookupReason(t *testing.T) {
+	require.Equal(t, livekit.DisconnectReason_PARTICIPANT_REMOVED, participantLookupReason(twirp.NotFoundError("participant not found")))
+	require.Equal(t, livekit.DisconnectReason_UNKNOWN_REASON, participantLookupReason(nil))
+	require.Equal(t, livekit.DisconnectReason_UNKNOWN_REASON, participantLookupReason(twirp.NewError(twirp.Unavailable, "unavailable")))
+	require.Equal(t, livekit.DisconnectReason_UNKNOWN_REASON, participantLookupReason(errors.New("connection refused")))
+}
+
+func TestStoppedBeforeDisconnect(t *testing.T) {
+	s := &SDKSource{PipelineConfig: &config.PipelineConfig{}}
+	s.setDisconnectReason(types.DisconnectReasonClientInitiated)
+
+	// no lookup once the egress has disconnected itself
+	require.Equal(t, livekit.DisconnectReason_UNKNOWN_REASON, s.serverDisconnectReason())
+	require.NoError(t, s.DisconnectError())
+}
+
+func TestMissingVideoAudioOnly(t *testing.T) {
+	newSource := func(behavior types.MissingVideoBehavior) *SDKSource {
+		return &SDKSource{
+			PipelineConfig: &config.PipelineConfig{
+				BaseConfig:  config.BaseConfig{MissingVideo: behavior},
+				RequestType: types.RequestTypeParticipant,
+				Info:        &livekit.EgressInfo{},
+				AudioConfig: config.AudioConfig{AudioEnabled: true},
+				VideoConfig: config.VideoConfig{VideoEnabled: true, VideoDecoding: true, VideoEncoding: true},
+			},
+			initialized: core.NewFuse(),
+		}
+	}
+
+	// no camera when the participant egress joins, so it records audio only
+	s := newSource(types.MissingVideoAudioOnly)
+	require.NoError(t, s.handleMissingVideo())
+	require.False(t, s.VideoEnabled)
+	require.False(t, s.VideoEncoding)
+	require.False(t, s.videoDropped())
+
+	// and keeps recording audio only once started, ignoring a camera published later
+	s.initialized.Break()
+	require.True(t, s.videoDropped())
+
+	// a placeholder keeps video enabled, so a camera published later is recorded
+	s = newSource(types.MissingVideoPlaceholder)
+	require.NoError(t, s.handleMissingVideo())
+	s.initialized.Break()
+	require.True(t, s.VideoEnabled)
+	require.False(t, s.videoDropped())
+
+	s = newSource(types.MissingVideoFail)
+	require.ErrorIs(t, s.handleMissingVideo(), errors.ErrNoVideoTrack)
+}
+
+func TestSubscriptionTimeout(t *testing.T) {
+	s := &SDKSource{PipelineConfig: &config.PipelineConfig{}}
+	require.Equal(t, defaultSubscriptionTimeout, s.subscriptionTimeout())
+	require.Equal(t, errors.ErrSubscriptionFailed, s.subscriptionTimedOut(errors.ErrSubscriptionFailed))
+
+	// nobody publishing within no_input_timeout is no input, not a subscription failure
+	s.NoInputTimeout = time.Second * 5
+	require.Equal(t, time.Second*5, s.subscriptionTimeout())
+	require.EqualError(t, s.subscriptionTimedOut(errors.ErrParticipantNotFound("participant")), errors.ErrNoInputReceived(time.Second*5).Error())
+}
+
+func TestParseHighlight(t *testing.T) {
+	comment, ok := parseHighlight([]byte(`{"topic":"lk.egress.highlight","comment":"goal"}`))
+	require.True(t, ok)
+	require.Equal(t, "goal", comment)
+
+	// a multi-byte rune cut by the limit is dropped
+	comment, ok = parseHighlight([]byte(`{"topic":"lk.egress.highlight","comment":"` + strings.Repeat("a", maxHighlightLength-1) + `é"}`))
+	require.True(t, ok)
+	require.Equal(t, strings.Repeat("a", maxHighlightLength-1), comment)
+
+	// chat messages and other data packets are not highlights
+	_, ok = parseHighlight([]byte(`{"id":"1","message":"hello"}`))
+	require.False(t, ok)
+	_, ok = parseHighlight([]byte("goal"))
+	require.False(t, ok)
+}
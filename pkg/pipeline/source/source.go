@@ -35,7 +35,7 @@ func New(ctx context.Context, p *config.PipelineConfig, callbacks *gstreamer.Cal
 	switch p.RequestType {
 	case types.RequestTypeRoomComposite,
 		types.RequestTypeWeb:
-		return NewWebSource(ctx, p)
+		return NewWebSource(ctx, p, callbacks)
 
 	case types.RequestTypeParticipant,
 		types.RequestTypeTrackComposite,
@@ -23,14 +23,18 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/chromedp/cdproto/runtime"
 	"github.com/chromedp/chromedp"
+	"go.uber.org/atomic"
 
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/gstreamer"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/tracer"
 )
@@ -38,12 +42,16 @@ import (
 const (
 	startRecordingLog = "START_RECORDING"
 	endRecordingLog   = "END_RECORDING"
+	reconnectedLog    = "RECONNECTED"
 )
 
 type WebSource struct {
 	pulseSink    string
 	xvfb         *exec.Cmd
+	chromeCtx    context.Context
 	chromeCancel context.CancelFunc
+	navigating   atomic.Bool // the previous page may report END_RECORDING while unloading
+	callbacks    *gstreamer.Callbacks
 
 	startRecording chan struct{}
 	endRecording   chan struct{}
@@ -53,7 +61,7 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-func NewWebSource(ctx context.Context, p *config.PipelineConfig) (*WebSource, error) {
+func NewWebSource(ctx context.Context, p *config.PipelineConfig, callbacks *gstreamer.Callbacks) (*WebSource, error) {
 	ctx, span := tracer.Start(ctx, "WebInput.New")
 	defer span.End()
 
@@ -61,6 +69,7 @@ func NewWebSource(ctx context.Context, p *config.PipelineConfig) (*WebSource, er
 
 	s := &WebSource{
 		endRecording: make(chan struct{}),
+		callbacks:    callbacks,
 	}
 	if p.AwaitStartSignal {
 		s.startRecording = make(chan struct{})
@@ -78,6 +87,14 @@ func NewWebSource(ctx context.Context, p *config.PipelineConfig) (*WebSource, er
 		return nil, err
 	}
 
+	if p.Chrome.EnableGPU {
+		if err := checkGPU(p); err != nil {
+			logger.Errorw("gpu check failed", err)
+			s.Close()
+			return nil, err
+		}
+	}
+
 	if err := s.launchChrome(ctx, p, p.Insecure); err != nil {
 		logger.Warnw("failed to launch chrome", err, "display", p.Display)
 		s.Close()
@@ -87,6 +104,35 @@ func NewWebSource(ctx context.Context, p *config.PipelineConfig) (*WebSource, er
 	return s, nil
 }
 
+// checkGPU fails in require_gpu mode when no GPU device is found, otherwise it falls back
+// to software rendering with the capture framerate capped
+func checkGPU(p *config.PipelineConfig) error {
+	if gpuAvailable() {
+		logger.Infow("rendering mode", "mode", "gpu")
+		return nil
+	}
+	if p.Chrome.RequireGPU {
+		return errors.ErrGPUUnavailable
+	}
+
+	p.Chrome.EnableGPU = false
+	if maxFramerate := p.Chrome.SoftwareFramerate; maxFramerate > 0 && (p.Chrome.CaptureFramerate == 0 || p.Chrome.CaptureFramerate > maxFramerate) {
+		p.Chrome.CaptureFramerate = maxFramerate
+	}
+	logger.Warnw("no gpu found, rendering in software", nil, "captureFramerate", p.Chrome.CaptureFramerate)
+	return nil
+}
+
+// gpuAvailable checks for a DRM render node or an nvidia device
+func gpuAvailable() bool {
+	for _, pattern := range []string{"/dev/dri/renderD*", "/dev/nvidia[0-9]*"} {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *WebSource) StartRecording() chan struct{} {
 	return s.startRecording
 }
@@ -182,27 +228,22 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 	ctx, span := tracer.Start(ctx, "WebInput.launchChrome")
 	defer span.End()
 
-	webUrl := p.WebUrl
-	if webUrl == "" {
-		// build input url
-		inputUrl, err := url.Parse(p.BaseUrl)
-		if err != nil {
-			return err
-		}
-		values := inputUrl.Query()
-		values.Set("layout", p.Layout)
-		values.Set("url", p.WsUrl)
-		values.Set("token", p.Token)
-		inputUrl.RawQuery = values.Encode()
-		webUrl = inputUrl.String()
+	webUrl, err := buildWebUrl(p)
+	if err != nil {
+		return err
 	}
 
-	logger.Debugw("launching chrome", "url", webUrl, "sandbox", p.EnableChromeSandbox, "insecure", p.Insecure)
+	logger.Debugw("launching chrome",
+		"url", webUrl,
+		"sandbox", p.EnableChromeSandbox,
+		"insecure", p.Insecure,
+		"gpu", p.Chrome.EnableGPU,
+		"rasterThreads", p.Chrome.RasterThreads,
+	)
 
 	opts := []chromedp.ExecAllocatorOption{
 		chromedp.NoFirstRun,
 		chromedp.NoDefaultBrowserCheck,
-		chromedp.DisableGPU,
 
 		// puppeteer default behavior
 		chromedp.Flag("disable-infobars", true),
@@ -245,6 +286,13 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 		chromedp.Flag("no-sandbox", !p.EnableChromeSandbox),
 	}
 
+	if !p.Chrome.EnableGPU {
+		opts = append(opts, chromedp.DisableGPU)
+	}
+	if p.Chrome.RasterThreads > 0 {
+		opts = append(opts, chromedp.Flag("num-raster-threads", p.Chrome.RasterThreads))
+	}
+
 	if insecure {
 		opts = append(opts,
 			chromedp.Flag("disable-web-security", true),
@@ -278,6 +326,10 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 						}
 					}
 				case endRecordingLog:
+					if s.navigating.Load() {
+						logger.Debugw("chrome: END_RECORDING ignored during layout update")
+						continue
+					}
 					logger.Infow("chrome: END_RECORDING")
 					if s.endRecording != nil {
 						select {
@@ -287,6 +339,10 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 							close(s.endRecording)
 						}
 					}
+				case reconnectedLog:
+					// the page reconnected to the room, so media may be missing from the capture
+					logger.Infow("chrome: RECONNECTED")
+					s.callbacks.OnReconnected()
 				}
 			}
 
@@ -295,9 +351,34 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 		}
 	})
 
+	s.chromeCtx = chromeCtx
+	return s.navigate(webUrl)
+}
+
+// UpdateLayout navigates chrome to the page built from the updated config. The display keeps being
+// captured while the new page loads, so the output timeline stays continuous
+func (s *WebSource) UpdateLayout(p *config.PipelineConfig) error {
+	webUrl, err := buildWebUrl(p)
+	if err != nil {
+		return err
+	}
+
+	logger.Infow("updating layout", "layout", p.Layout, "baseUrl", p.BaseUrl, "webUrl", p.WebUrl)
+	s.navigating.Store(true)
+	defer s.navigating.Store(false)
+	return s.navigate(webUrl)
+}
+
+func (s *WebSource) navigate(webUrl string) error {
+	if err := chromedp.Run(s.chromeCtx, chromedp.Navigate(webUrl)); err != nil {
+		if isNavigationError(err) {
+			return errors.ErrTemplateUnreachable(err)
+		}
+		return err
+	}
+
 	var errString string
-	err := chromedp.Run(chromeCtx,
-		chromedp.Navigate(webUrl),
+	err := chromedp.Run(s.chromeCtx,
 		chromedp.Evaluate(`
 			if (document.querySelector('div.error')) {
 				document.querySelector('div.error').innerText;
@@ -306,10 +387,45 @@ func (s *WebSource) launchChrome(ctx context.Context, p *config.PipelineConfig,
 			}`, &errString,
 		),
 	)
-	if err == nil && errString != "" {
-		err = errors.New(errString)
+	if err != nil {
+		return err
+	}
+	if errString != "" {
+		return errors.New(errString)
+	}
+	return nil
+}
+
+// isNavigationError returns true if chrome could not load the page, as opposed to chrome itself failing
+func isNavigationError(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "page load error") ||
+		strings.Contains(msg, "net::ERR_") ||
+		strings.Contains(msg, "Cannot navigate to invalid URL")
+}
+
+// buildWebUrl returns the custom web url, or the template url for room composite requests
+func buildWebUrl(p *config.PipelineConfig) (string, error) {
+	if p.WebUrl != "" {
+		return p.WebUrl, nil
+	}
+
+	inputUrl, err := url.Parse(p.BaseUrl)
+	if err != nil {
+		return "", err
+	}
+	values := inputUrl.Query()
+	values.Set("layout", p.Layout)
+	if p.SoloFullscreen {
+		values.Set("solo", "fullscreen")
+	}
+	if p.StaleVideoTimeout > 0 {
+		values.Set("stale", strconv.FormatInt(p.StaleVideoTimeout.Milliseconds(), 10))
 	}
-	return err
+	values.Set("url", p.WsUrl)
+	values.Set("token", p.Token)
+	inputUrl.RawQuery = values.Encode()
+	return inputUrl.String(), nil
 }
 
 func logChrome(eventType string, ev interface{ MarshalJSON() ([]byte, error) }) {
@@ -0,0 +1,33 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/egress/pkg/errors"
+)
+
+func TestIsNavigationError(t *testing.T) {
+	require.True(t, isNavigationError(errors.New("page load error net::ERR_NAME_NOT_RESOLVED")))
+	require.True(t, isNavigationError(errors.New("Cannot navigate to invalid URL (-32000)")))
+
+	// chrome failing is not the template's fault
+	require.False(t, isNavigationError(context.DeadlineExceeded))
+	require.False(t, isNavigationError(errors.New("invalid context")))
+}
@@ -0,0 +1,480 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/go-gst/go-gst/gst"
+	"go.uber.org/atomic"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/gstreamer"
+	"github.com/livekit/egress/pkg/pipeline/builder"
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	encoderWatchdogInterval = time.Second
+	bitrateSampleInterval   = time.Second
+	latencySampleInterval   = time.Second
+)
+
+type pipelineStats struct {
+	encodedBytes   atomic.Uint64
+	videoFrames    atomic.Uint64
+	firstBuffer    core.Fuse
+	mediaStartedAt atomic.Int64
+	peakBitrate    atomic.Uint64
+	lastBufferAt   atomic.Int64 // unix nanoseconds of the last buffer to reach an output sink
+
+	mu          sync.Mutex
+	watched     map[uintptr]*gst.Element // elements with probes, held so their addresses aren't reused
+	encoders    []*encoderStats
+	videoRates  []*gst.Element
+	queues      []*gst.Element
+	outputBytes map[string]*atomic.Uint64 // bytes reaching file and image sinks
+}
+
+// encoderStats counts buffers into and out of a single encoder, and keeps the latest timestamp on each side
+type encoderStats struct {
+	name       string
+	video      bool
+	buffersIn  atomic.Uint64
+	buffersOut atomic.Uint64
+	ptsIn      atomic.Int64 // -1 until a timestamped buffer is seen
+	ptsOut     atomic.Int64
+}
+
+func newPipelineStats() *pipelineStats {
+	return &pipelineStats{
+		firstBuffer: core.NewFuse(),
+		watched:     make(map[uintptr]*gst.Element),
+		outputBytes: make(map[string]*atomic.Uint64),
+	}
+}
+
+// watchElements adds pad probes to encoders and keeps track of elements with readable stats. It runs again
+// whenever bins are added to a running pipeline, and only probes elements it hasn't seen before
+func (s *pipelineStats) watchElements(p *gstreamer.Pipeline) error {
+	elements, err := p.GetElements()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	watched := make(map[uintptr]*gst.Element, len(elements))
+	s.videoRates = s.videoRates[:0]
+	s.queues = s.queues[:0]
+	for _, e := range elements {
+		key := uintptr(e.Unsafe())
+		watched[key] = e
+
+		switch e.GetFactory().GetName() {
+		case "videorate":
+			s.videoRates = append(s.videoRates, e)
+		case "queue":
+			s.queues = append(s.queues, e)
+		}
+		if s.watched[key] != nil {
+			continue
+		}
+
+		switch e.GetFactory().GetName() {
+		case "x264enc", "vp9enc", "nvh264enc", "vah264enc", "vaapih264enc", "qsvh264enc":
+			s.watchEncoder(e, true)
+		case "opusenc", "faac":
+			s.watchEncoder(e, false)
+		case "filesink":
+			s.watchOutput(e, string(types.EgressTypeFile))
+		case "multifilesink":
+			s.watchOutput(e, fmt.Sprintf("%s_%s", types.EgressTypeImages, strings.TrimPrefix(e.GetName(), "multifilesink_")))
+		}
+		if isOutputSink(e) {
+			s.watchSink(e)
+		}
+	}
+	// removed elements are dropped, so their queue levels and frame drops are no longer sampled
+	s.watched = watched
+
+	return nil
+}
+
+func (s *pipelineStats) watchEncoder(e *gst.Element, video bool) {
+	es := &encoderStats{name: e.GetName(), video: video}
+	es.ptsIn.Store(-1)
+	es.ptsOut.Store(-1)
+	s.encoders = append(s.encoders, es)
+
+	e.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		es.buffersIn.Inc()
+		if buffer := info.GetBuffer(); buffer != nil {
+			storePTS(&es.ptsIn, buffer)
+		}
+		if video {
+			s.videoFrames.Inc()
+		}
+		s.firstBuffer.Once(func() {
+			s.mediaStartedAt.Store(time.Now().UnixNano())
+		})
+		return gst.PadProbeOK
+	})
+	e.GetStaticPad("src").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		es.buffersOut.Inc()
+		if buffer := info.GetBuffer(); buffer != nil {
+			s.encodedBytes.Add(uint64(buffer.GetSize()))
+			storePTS(&es.ptsOut, buffer)
+		}
+		return gst.PadProbeOK
+	})
+}
+
+func storePTS(pts *atomic.Int64, buffer *gst.Buffer) {
+	if d := buffer.PresentationTimestamp().AsDuration(); d != nil {
+		pts.Store(int64(*d))
+	}
+}
+
+func (s *pipelineStats) watchOutput(e *gst.Element, output string) {
+	written := &atomic.Uint64{}
+	s.outputBytes[output] = written
+
+	e.GetStaticPad("sink").AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, info *gst.PadProbeInfo) gst.PadProbeReturn {
+		if buffer := info.GetBuffer(); buffer != nil {
+			written.Add(uint64(buffer.GetSize()))
+		}
+		return gst.PadProbeOK
+	})
+}
+
+// isOutputSink returns true for elements terminating an output. Splitmuxsink creates its own sink when started,
+// so its input pads are watched instead
+func isOutputSink(e *gst.Element) bool {
+	switch e.GetFactory().GetName() {
+	case "fakesink":
+		return false
+	case "splitmuxsink":
+		return true
+	default:
+		return strings.Contains(e.GetFactory().GetMetadata("klass"), "Sink")
+	}
+}
+
+func (s *pipelineStats) watchSink(e *gst.Element) {
+	pads, err := e.GetSinkPads()
+	if err != nil {
+		return
+	}
+	for _, pad := range pads {
+		pad.AddProbe(gst.PadProbeTypeBuffer, func(_ *gst.Pad, _ *gst.PadProbeInfo) gst.PadProbeReturn {
+			s.lastBufferAt.Store(time.Now().UnixNano())
+			return gst.PadProbeOK
+		})
+	}
+}
+
+func (s *pipelineStats) getOutputBytes(output string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if written := s.outputBytes[output]; written != nil {
+		return written.Load()
+	}
+	return 0
+}
+
+func (s *pipelineStats) getEncoders() []*encoderStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.encoders
+}
+
+// mediaReceived is closed once the first buffer reaches any encoder
+func (s *pipelineStats) mediaReceived() <-chan struct{} {
+	return s.firstBuffer.Watch()
+}
+
+// mediaDuration returns the time between the first encoder buffer and endedAt
+func (s *pipelineStats) mediaDuration(endedAt int64) time.Duration {
+	startedAt := s.mediaStartedAt.Load()
+	if startedAt == 0 || endedAt < startedAt {
+		return 0
+	}
+	return time.Duration(endedAt - startedAt)
+}
+
+// samplePeakBitrate records the highest encoded bitrate over any one interval until done is closed
+func (s *pipelineStats) samplePeakBitrate(done <-chan struct{}) {
+	ticker := time.NewTicker(bitrateSampleInterval)
+	defer ticker.Stop()
+
+	prev, prevTime := s.encodedBytes.Load(), time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			current := s.encodedBytes.Load()
+			bitrate := uint64(float64(current-prev) * 8 / now.Sub(prevTime).Seconds())
+			if bitrate > s.peakBitrate.Load() {
+				s.peakBitrate.Store(bitrate)
+			}
+			prev, prevTime = current, now
+		}
+	}
+}
+
+func (s *pipelineStats) sample() *stats.PipelineStats {
+	res := &stats.PipelineStats{
+		EncodedBytes: s.encodedBytes.Load(),
+		VideoFrames:  s.videoFrames.Load(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, videoRate := range s.videoRates {
+		if dropped, err := videoRate.GetProperty("drop"); err == nil {
+			if d, ok := dropped.(uint64); ok {
+				res.DroppedFrames += d
+			}
+		}
+	}
+	for _, queue := range s.queues {
+		level := stats.QueueLevel{Name: queue.GetName()}
+		if buffers, err := queue.GetProperty("current-level-buffers"); err == nil {
+			if b, ok := buffers.(uint); ok {
+				level.Buffers = uint32(b)
+			}
+		}
+		if t, err := queue.GetProperty("current-level-time"); err == nil {
+			level.Time, _ = t.(uint64)
+		}
+		res.Queues = append(res.Queues, level)
+	}
+
+	var audioPTS, videoPTS int64 = -1, -1
+	for _, es := range s.encoders {
+		in, out := es.ptsIn.Load(), es.ptsOut.Load()
+		if in >= 0 && out >= 0 {
+			res.Encoders = append(res.Encoders, stats.EncoderLatency{
+				Name:    es.name,
+				Latency: time.Duration(in - out),
+			})
+		}
+		if es.video {
+			videoPTS = max(videoPTS, out)
+		} else {
+			audioPTS = max(audioPTS, out)
+		}
+	}
+	if audioPTS >= 0 && videoPTS >= 0 {
+		drift := time.Duration(videoPTS - audioPTS)
+		res.AVSyncDrift = &drift
+	}
+
+	return res
+}
+
+// rewatchElements picks up stream sinks and track bins added after the pipeline was built
+func (c *Controller) rewatchElements(p *gstreamer.Pipeline) {
+	if err := c.stats.watchElements(p); err != nil {
+		logger.Warnw("failed to watch new elements", err)
+	}
+}
+
+// sampleLatency updates the latency gauges until done is closed
+func (c *Controller) sampleLatency(done <-chan struct{}) {
+	ticker := time.NewTicker(latencySampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.monitor.UpdateLatency(c.stats.sample())
+		}
+	}
+}
+
+// GetPipelineStats returns cumulative encoder counters, current queue levels and latencies
+func (c *Controller) GetPipelineStats() *stats.PipelineStats {
+	return c.stats.sample()
+}
+
+// PipelineState returns whether the pipeline is starting, playing, paused or draining after EOS
+func (c *Controller) PipelineState() types.PipelineState {
+	switch {
+	case c.eos.IsBroken(), c.stopped.IsBroken():
+		return types.PipelineStateEOS
+	case !c.playing.IsBroken():
+		return types.PipelineStateStarting
+	case c.paused.Load():
+		return types.PipelineStatePaused
+	default:
+		return types.PipelineStatePlaying
+	}
+}
+
+// GetOutputStats returns the progress of each output, keyed by file, segments, images_<id>, or redacted stream url
+func (c *Controller) GetOutputStats() map[string]*stats.OutputStats {
+	res := make(map[string]*stats.OutputStats)
+
+	if o := c.GetFileConfig(); o != nil {
+		fileStats := &stats.OutputStats{
+			BytesWritten: c.stats.getOutputBytes(string(types.EgressTypeFile)),
+		}
+		if info, err := os.Stat(o.LocalFilepath); err == nil {
+			fileStats.FileSize = info.Size()
+		}
+		res[string(types.EgressTypeFile)] = fileStats
+	}
+
+	if c.GetSegmentConfig() != nil {
+		size, count := c.segmentProgress()
+		res[string(types.EgressTypeSegments)] = &stats.OutputStats{
+			BytesWritten:    uint64(size),
+			SegmentCount:    count,
+			Discontinuities: c.discontinuities.Load(),
+		}
+	}
+
+	for _, o := range c.GetImageConfigs() {
+		key := fmt.Sprintf("%s_%s", types.EgressTypeImages, o.Id)
+		res[key] = &stats.OutputStats{
+			BytesWritten: c.stats.getOutputBytes(key),
+			ImageCount:   o.ImagesInfo.ImageCount,
+		}
+	}
+
+	if c.streamBin != nil {
+		for url, sent := range c.streamBin.BytesSent() {
+			redacted, _ := config.RedactStreamUrl(url)
+			res[redacted] = &stats.OutputStats{BytesWritten: sent}
+		}
+	}
+
+	return res
+}
+
+// segmentProgress returns the bytes and segments uploaded, which the segment sink updates while uploading
+func (c *Controller) segmentProgress() (int64, int64) {
+	if s := c.getSegmentSink(); s != nil {
+		return s.Progress()
+	}
+	return 0, 0
+}
+
+// GetActiveOutputs returns the state of every output destination, including streams which have failed or been removed
+func (c *Controller) GetActiveOutputs() []*stats.OutputState {
+	var res []*stats.OutputState
+
+	if o := c.GetFileConfig(); o != nil {
+		written := c.stats.getOutputBytes(string(types.EgressTypeFile))
+		res = append(res, &stats.OutputState{
+			EgressType:  types.EgressTypeFile,
+			Destination: o.StorageFilepath,
+			State:       c.localOutputState(written),
+			BytesSent:   written,
+		})
+	}
+
+	if o := c.GetSegmentConfig(); o != nil {
+		size, _ := c.segmentProgress()
+		written := uint64(size)
+		res = append(res, &stats.OutputState{
+			EgressType:  types.EgressTypeSegments,
+			Destination: path.Join(o.StorageDir, o.PlaylistFilename),
+			State:       c.localOutputState(written),
+			BytesSent:   written,
+		})
+	}
+
+	for _, o := range c.GetImageConfigs() {
+		written := c.stats.getOutputBytes(fmt.Sprintf("%s_%s", types.EgressTypeImages, o.Id))
+		res = append(res, &stats.OutputState{
+			EgressType:  types.EgressTypeImages,
+			Destination: path.Join(o.StorageDir, o.ImagePrefix),
+			State:       c.localOutputState(written),
+			BytesSent:   written,
+		})
+	}
+
+	egressType := types.EgressTypeStream
+	var streamStates map[string]*builder.StreamState
+	if c.streamBin != nil {
+		streamStates = c.streamBin.StreamStates()
+	} else if len(c.Outputs[types.EgressTypeWebsocket]) > 0 {
+		egressType = types.EgressTypeWebsocket
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, info := range c.Info.StreamResults {
+		redacted, _ := config.RedactStreamUrl(info.Url)
+		output := &stats.OutputState{
+			EgressType:  egressType,
+			Destination: redacted,
+			State:       types.OutputStateStarting,
+			Error:       info.Error,
+		}
+		switch info.Status {
+		case livekit.StreamInfo_FAILED:
+			output.State = types.OutputStateFailed
+		case livekit.StreamInfo_FINISHED:
+			output.State = types.OutputStateFinished
+		case livekit.StreamInfo_ACTIVE:
+			if state := streamStates[info.Url]; state != nil {
+				output.State, output.BytesSent = state.State, state.BytesSent
+			} else if egressType == types.EgressTypeWebsocket {
+				output.State = types.OutputStateConnected
+			}
+		}
+		res = append(res, output)
+	}
+
+	return res
+}
+
+// localOutputState follows the egress status for file, segment and image outputs
+func (c *Controller) localOutputState(written uint64) types.OutputState {
+	switch c.Status() {
+	case livekit.EgressStatus_EGRESS_STARTING:
+		return types.OutputStateStarting
+	case livekit.EgressStatus_EGRESS_ACTIVE, livekit.EgressStatus_EGRESS_ENDING:
+		if written == 0 {
+			return types.OutputStateStarting
+		}
+		return types.OutputStateConnected
+	case livekit.EgressStatus_EGRESS_FAILED:
+		return types.OutputStateFailed
+	default:
+		return types.OutputStateFinished
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+const stopReasonStopSignal = "stop_signal"
+
+// updateEgress sends the current info to the io service, which can answer with a stop signal
+func (c *Controller) updateEgress(ctx context.Context) {
+	// a copy is sent, since the error can be set by another goroutine while the update is in flight
+	c.errMu.Lock()
+	info := proto.Clone(c.Info).(*livekit.EgressInfo)
+	c.errMu.Unlock()
+
+	_, err := c.ioClient.UpdateEgress(ctx, info)
+	if err == nil || !c.StopSignal.Enabled || !errors.IsStopSignal(err, c.StopSignal.Code) {
+		return
+	}
+
+	switch c.Info.Status {
+	case livekit.EgressStatus_EGRESS_STARTING,
+		livekit.EgressStatus_EGRESS_ACTIVE:
+		// handled asynchronously, since updates are also sent while sending EOS
+		go c.onStopSignal(ctx, err)
+	}
+}
+
+// onStopSignal ends the egress gracefully, reporting it as limit reached rather than complete
+func (c *Controller) onStopSignal(ctx context.Context, err error) {
+	c.stopSignal.Once(func() {
+		logger.Infow("stop requested by io service", "reason", err, "stopReason", stopReasonStopSignal)
+
+		switch c.Info.Status {
+		case livekit.EgressStatus_EGRESS_STARTING,
+			livekit.EgressStatus_EGRESS_ACTIVE:
+			c.setStatus(livekit.EgressStatus_EGRESS_LIMIT_REACHED)
+		}
+		if c.playing.IsBroken() {
+			c.SendEOS(ctx)
+		} else {
+			c.p.Stop()
+		}
+	})
+}
+
+// startStopSignalPoll sends periodic updates while active, so that a stop is picked up without waiting for a status change
+func (c *Controller) startStopSignalPoll(ctx context.Context) {
+	if !c.StopSignal.Enabled || c.StopSignal.PollInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.StopSignal.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.eos.Watch():
+				return
+			case <-c.stopped.Watch():
+				return
+			case <-ticker.C:
+				if c.Status() == livekit.EgressStatus_EGRESS_ACTIVE {
+					c.Info.UpdatedAt = time.Now().UnixNano()
+					c.updateEgress(ctx)
+				}
+			}
+		}
+	}()
+}
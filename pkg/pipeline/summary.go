@@ -0,0 +1,121 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"github.com/livekit/egress/pkg/pipeline/sink"
+	"github.com/livekit/egress/pkg/pipeline/source"
+	"github.com/livekit/protocol/logger"
+)
+
+type summaryUploader interface {
+	UploadSummary(*sink.Summary) error
+}
+
+// finalizeSummary logs the recording summary, and uploads it alongside file and segment outputs when enabled.
+// It runs once the final status is known, including for failed egresses.
+func (c *Controller) finalizeSummary() {
+	summary := c.buildSummary()
+	logger.Infow("recording summary",
+		"status", summary.Status,
+		"errorCode", summary.ErrorCode,
+		"stopReason", summary.StopReason,
+		"mediaDuration", summary.MediaDuration,
+		"encodedBytes", summary.EncodedBytes,
+		"outputBytes", summary.OutputBytes,
+		"avgBitrate", summary.AvgBitrate,
+		"peakBitrate", summary.PeakBitrate,
+		"width", summary.Width,
+		"height", summary.Height,
+		"videoEncoder", summary.VideoEncoder,
+		"droppedFrames", summary.DroppedFrames,
+		"reconnects", summary.Reconnects,
+		"discontinuities", summary.Discontinuities,
+		"participants", summary.Participants,
+		"disconnectReason", summary.DisconnectReason,
+		"uploads", summary.Uploads.Count,
+		"uploadFailures", summary.Uploads.Failures,
+	)
+
+	if !c.RecordingSummary || c.discarded.IsBroken() {
+		return
+	}
+	for _, si := range c.sinks {
+		for _, s := range si {
+			if u, ok := s.(summaryUploader); ok {
+				if err := u.UploadSummary(summary); err != nil {
+					logger.Warnw("failed to upload recording summary", err)
+				}
+			}
+		}
+	}
+}
+
+func (c *Controller) buildSummary() *sink.Summary {
+	sample := c.stats.sample()
+	uploads := c.monitor.GetUploadStats()
+	duration := c.stats.mediaDuration(c.src.GetEndedAt())
+
+	summary := &sink.Summary{
+		EgressID:         c.Info.EgressId,
+		Status:           c.Info.Status.String(),
+		Error:            c.errorMessage(),
+		ErrorCode:        string(c.ErrorCode()),
+		StartedAt:        c.Info.StartedAt,
+		EndedAt:          c.Info.EndedAt,
+		MediaDuration:    int64(duration),
+		EncodedBytes:     sample.EncodedBytes,
+		PeakBitrate:      c.stats.peakBitrate.Load(),
+		VideoFrames:      sample.VideoFrames,
+		DroppedFrames:    sample.DroppedFrames,
+		Reconnects:       c.reconnects.Load(),
+		Discontinuities:  c.discontinuities.Load(),
+		DisconnectReason: string(c.DisconnectReason()),
+		Uploads: sink.SummaryUploads{
+			Count:     uploads.Count,
+			Failures:  uploads.Failures,
+			TotalTime: uploads.TotalTime.Milliseconds(),
+			MaxTime:   uploads.MaxTime.Milliseconds(),
+		},
+	}
+	if c.noInput.IsBroken() {
+		summary.StopReason = stopReasonNoInput
+	} else if c.discarded.IsBroken() {
+		summary.StopReason = stopReasonDiscarded
+	} else if c.stopSignal.IsBroken() {
+		summary.StopReason = stopReasonStopSignal
+	} else if c.maxDuration.IsBroken() {
+		summary.StopReason = stopReasonMaxDuration
+	}
+	if c.VideoEncoding {
+		summary.Width = c.Width
+		summary.Height = c.Height
+		summary.VideoEncoder = string(c.VideoEncoder)
+	}
+	if duration > 0 {
+		summary.AvgBitrate = uint64(float64(sample.EncodedBytes) * 8 / duration.Seconds())
+	}
+	if o := c.GetFileConfig(); o != nil {
+		summary.OutputBytes += o.FileInfo.Size
+	}
+	if o := c.GetSegmentConfig(); o != nil {
+		summary.OutputBytes += o.SegmentsInfo.Size
+	}
+	if sdkSource, ok := c.src.(*source.SDKSource); ok {
+		summary.Participants = sdkSource.ParticipantCount()
+	}
+
+	return summary
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/egress/pkg/errors"
+)
+
+// tracer records are logged at trace level by the GST_TRACER category
+const tracerDebugCategory = "GST_TRACER:7"
+
+type tracerCapture struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	maxBytes  int
+	truncated bool
+}
+
+// enableTracers loads the configured tracers, which gstreamer only reads during gst.Init
+func enableTracers(tracers string) error {
+	if err := os.Setenv("GST_TRACERS", tracers); err != nil {
+		return err
+	}
+	debug := []string{tracerDebugCategory}
+	if current := os.Getenv("GST_DEBUG"); current != "" {
+		debug = append([]string{current}, debug...)
+	}
+	return os.Setenv("GST_DEBUG", strings.Join(debug, ","))
+}
+
+// captureTrace appends a tracer record to the running capture. Records are dropped when nothing is capturing
+func (c *Controller) captureTrace(record string) {
+	capture := c.tracerCapture.Load()
+	if capture == nil {
+		return
+	}
+
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	if capture.truncated || capture.buf.Len()+len(record)+1 > capture.maxBytes {
+		capture.truncated = true
+		return
+	}
+	capture.buf.WriteString(record)
+	capture.buf.WriteByte('\n')
+}
+
+// CaptureTracerLogs collects tracer records for the given duration, keeping up to maxBytes.
+// It returns the records, one per line, and whether any were dropped
+func (c *Controller) CaptureTracerLogs(ctx context.Context, duration time.Duration, maxBytes int) ([]byte, bool, error) {
+	if c.Debug.Tracers == "" {
+		return nil, false, errors.ErrTracersDisabled
+	}
+
+	capture := &tracerCapture{maxBytes: maxBytes}
+	if !c.tracerCapture.CompareAndSwap(nil, capture) {
+		return nil, false, errors.ErrTracerCaptureRunning
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+	}
+	c.tracerCapture.Store(nil)
+
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	return capture.buf.Bytes(), capture.truncated, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/pipeline/source"
+	"github.com/livekit/egress/pkg/types"
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	usagePostAttempts = 3
+	usagePostTimeout  = time.Second * 10
+	usagePostDeadline = time.Second * 20 // across all attempts
+)
+
+// usageRecord meters a single egress for billing
+type usageRecord struct {
+	EgressID           string  `json:"egress_id"`
+	RoomName           string  `json:"room_name,omitempty"`
+	Status             string  `json:"status"`
+	StartedAt          int64   `json:"started_at"`
+	EndedAt            int64   `json:"ended_at"`
+	EncodeSeconds      float64 `json:"encode_seconds"`      // from the first encoded buffer to the end of the recording
+	OutputBytes        int64   `json:"output_bytes"`        // file and segment output sizes
+	UploadBytes        int64   `json:"upload_bytes"`        // every successful upload, including manifests and side files
+	GPUSeconds         float64 `json:"gpu_seconds"`         // web egress rendered on a gpu
+	ParticipantMinutes float64 `json:"participant_minutes"` // sdk egress only, time each participant had tracks recorded
+}
+
+// finalizeUsage logs the usage record, and posts it to the usage endpoint when configured.
+// It runs once the final status is known, so partial usage is metered for failed egresses.
+func (c *Controller) finalizeUsage() {
+	usage := c.buildUsage()
+	logger.Infow("usage record",
+		"status", usage.Status,
+		"encodeSeconds", usage.EncodeSeconds,
+		"outputBytes", usage.OutputBytes,
+		"uploadBytes", usage.UploadBytes,
+		"gpuSeconds", usage.GPUSeconds,
+		"participantMinutes", usage.ParticipantMinutes,
+	)
+
+	if c.Usage.Endpoint == "" {
+		c.usagePosted.Break()
+		return
+	}
+
+	// posted in the background, so the final status isn't held up by a slow usage endpoint
+	client := newUsageClient(c.HostOverrides, c.Usage.Proxy)
+	go func() {
+		defer c.usagePosted.Break()
+
+		ctx, cancel := context.WithTimeout(context.Background(), usagePostDeadline)
+		defer cancel()
+
+		err := postUsage(ctx, client, c.Usage.Endpoint, usage)
+		for i := 1; err != nil && i < usagePostAttempts && ctx.Err() == nil; i++ {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second << i):
+				err = postUsage(ctx, client, c.Usage.Endpoint, usage)
+			}
+		}
+		if err != nil {
+			logger.Errorw("failed to post usage record", err)
+		}
+	}()
+}
+
+// UsagePosted is closed once the usage record has been posted, or has failed to within usagePostDeadline
+func (c *Controller) UsagePosted() <-chan struct{} {
+	return c.usagePosted.Watch()
+}
+
+func (c *Controller) buildUsage() *usageRecord {
+	usage := &usageRecord{
+		EgressID:    c.Info.EgressId,
+		RoomName:    c.Info.RoomName,
+		Status:      c.Info.Status.String(),
+		StartedAt:   c.Info.StartedAt,
+		EndedAt:     c.Info.EndedAt,
+		UploadBytes: c.monitor.GetUploadStats().Bytes,
+	}
+	if len(c.stats.getEncoders()) > 0 {
+		usage.EncodeSeconds = c.stats.mediaDuration(c.src.GetEndedAt()).Seconds()
+	}
+	if o := c.GetFileConfig(); o != nil {
+		usage.OutputBytes += o.FileInfo.Size
+	}
+	if o := c.GetSegmentConfig(); o != nil {
+		usage.OutputBytes += o.SegmentsInfo.Size
+	}
+	if c.SourceType == types.SourceTypeWeb && c.Chrome.EnableGPU && usage.EndedAt > usage.StartedAt {
+		usage.GPUSeconds = time.Duration(usage.EndedAt - usage.StartedAt).Seconds()
+	}
+	if sdkSource, ok := c.src.(*source.SDKSource); ok {
+		usage.ParticipantMinutes = sdkSource.ParticipantDuration().Minutes()
+	}
+
+	return usage
+}
+
+// newUsageClient dials like the uploaders, through the host overrides and an optional proxy
+func newUsageClient(hosts config.HostOverrides, proxy string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = hosts.DialContext(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			logger.Errorw("failed to parse usage proxy URL -- proxy not set", err, "proxy", proxy)
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return &http.Client{Transport: transport}
+}
+
+func postUsage(ctx context.Context, client *http.Client, endpoint string, usage *usageRecord) error {
+	b, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, usagePostTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("usage endpoint returned %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline/sink/uploader"
+	"github.com/livekit/egress/pkg/types"
+)
+
+const validateTimeout = time.Second * 5
+
+var defaultPorts = map[string]string{
+	"rtmp":  "1935",
+	"rtmps": "443",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// Validate checks what would otherwise only fail once the pipeline is running, without building it: upload
+// buckets and credentials, template or web page reachability, and stream server reachability.
+// conf should already be parsed, which covers codec and output compatibility. Every problem found is returned
+func Validate(conf *config.PipelineConfig) []error {
+	var checks []func() error
+
+	switch conf.RequestType {
+	case types.RequestTypeRoomComposite:
+		checks = append(checks, func() error { return checkPage("template", conf.BaseUrl, conf.HostOverrides) })
+	case types.RequestTypeWeb:
+		checks = append(checks, func() error { return checkPage("web page", conf.WebUrl, conf.HostOverrides) })
+	}
+
+	uploads := false
+	for _, outputs := range conf.Outputs {
+		for _, o := range outputs {
+			switch c := o.(type) {
+			case *config.FileConfig:
+				checks = append(checks, uploadCheck(c.UploadConfig, conf.HostOverrides))
+				uploads = uploads || c.UploadConfig != nil
+			case *config.SegmentConfig:
+				checks = append(checks, uploadCheck(c.UploadConfig, conf.HostOverrides))
+				uploads = uploads || c.UploadConfig != nil
+			case *config.ImageConfig:
+				checks = append(checks, uploadCheck(c.UploadConfig, conf.HostOverrides))
+				uploads = uploads || c.UploadConfig != nil
+			case *config.StreamConfig:
+				for _, u := range c.Urls {
+					if config.IsSRTUrl(u) {
+						// srt runs over udp, so there is no connection to check without starting a stream
+						continue
+					}
+					u := u
+					checks = append(checks, func() error { return checkStreamServer(u, conf.HostOverrides) })
+				}
+			}
+		}
+	}
+	if fallback := conf.ToFallbackUploadConfig(); uploads && fallback != nil {
+		checks = append(checks, func() error {
+			if err := uploader.Check(fallback, conf.HostOverrides); err != nil {
+				return fmt.Errorf("fallback storage: %w", err)
+			}
+			return nil
+		})
+	}
+
+	// checks hit the network, so they run concurrently and are reported in order
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func() error) {
+			defer wg.Done()
+			results[i] = check()
+		}(i, check)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func uploadCheck(conf config.UploadConfig, hosts config.HostOverrides) func() error {
+	return func() error {
+		return uploader.Check(conf, hosts)
+	}
+}
+
+func checkPage(name, pageUrl string, hosts config.HostOverrides) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: hosts.DialContext(&net.Dialer{Timeout: validateTimeout}),
+		},
+		Timeout: validateTimeout,
+	}
+	res, err := client.Get(pageUrl)
+	if err != nil {
+		return errors.ErrInvalidUrl(pageUrl, fmt.Sprintf("%s unreachable: %v", name, err))
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return errors.ErrInvalidUrl(pageUrl, fmt.Sprintf("%s returned %s", name, res.Status))
+	}
+	return nil
+}
+
+// checkStreamServer dials the server without starting a stream
+func checkStreamServer(rawUrl string, hosts config.HostOverrides) error {
+	redacted, _ := config.RedactStreamUrl(rawUrl)
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return errors.ErrInvalidUrl(redacted, err.Error())
+	}
+
+	host := parsed.Host
+	if parsed.Port() == "" {
+		host = net.JoinHostPort(parsed.Hostname(), defaultPorts[parsed.Scheme])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+
+	conn, err := hosts.DialContext(&net.Dialer{})(ctx, "tcp", host)
+	if err != nil {
+		return errors.ErrInvalidUrl(redacted, fmt.Sprintf("stream server unreachable: %v", err))
+	}
+	_ = conn.Close()
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/go-gst/go-glib/glib"
 	"github.com/go-gst/go-gst/gst"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/pipeline/builder"
@@ -39,6 +40,7 @@ const (
 	msgMuxer                  = ":muxer"
 
 	elementGstRtmp2Sink = "GstRtmp2Sink"
+	elementGstSRTSink   = "GstSRTSink"
 	elementGstAppSrc    = "GstAppSrc"
 	elementSplitMuxSink = "GstSplitMuxSink"
 
@@ -47,6 +49,7 @@ const (
 	msgFragmentOpened      = "splitmuxsink-fragment-opened"
 	msgFragmentClosed      = "splitmuxsink-fragment-closed"
 	msgGstMultiFileSink    = "GstMultiFileSink"
+	msgLevel               = "level"
 
 	fragmentLocation    = "location"
 	fragmentRunningTime = "running-time"
@@ -69,7 +72,19 @@ const (
 	msgAggregateSubclass = "Subclass should call gst_aggregator_selected_samples() from its aggregate implementation."
 )
 
+// isTracerRecord returns true for records logged by gst_tracer_record_log. The pinned go-gst log function
+// does not pass the debug category, so records are told apart from GST_TRACE messages, which always
+// have a source location, by the empty location the GST_TRACER category logs them with
+func isTracerRecord(level gst.DebugLevel, file, function string, line int, obj *glib.Object) bool {
+	return level == gst.LevelTrace && file == "" && function == "" && line == 0 && obj == nil
+}
+
 func (c *Controller) gstLog(level gst.DebugLevel, file, function string, line int, obj *glib.Object, message string) {
+	if isTracerRecord(level, file, function, line, obj) {
+		c.captureTrace(message)
+		return
+	}
+
 	var lvl string
 	switch level {
 	case gst.LevelNone:
@@ -102,6 +117,8 @@ func (c *Controller) gstLog(level gst.DebugLevel, file, function string, line in
 		lvl = "info"
 	case gst.LevelDebug:
 		lvl = "debug"
+	case gst.LevelTrace:
+		lvl = "trace"
 	default:
 		lvl = "log"
 	}
@@ -114,6 +131,7 @@ func (c *Controller) gstLog(level gst.DebugLevel, file, function string, line in
 	}
 	args := []interface{}{"caller", fmt.Sprintf("%s:%d", file, line)}
 	c.gstLogger.Debugw(msg, args...)
+	c.LogBuffer.Add(zapcore.DebugLevel, msg, args...)
 }
 
 func (c *Controller) messageWatch(msg *gst.Message) bool {
@@ -121,9 +139,7 @@ func (c *Controller) messageWatch(msg *gst.Message) bool {
 	switch msg.Type() {
 	case gst.MessageEOS:
 		logger.Infow("EOS received")
-		if c.eosTimer != nil {
-			c.eosTimer.Stop()
-		}
+		c.stopEOSTimer()
 		c.p.Stop()
 		return false
 	case gst.MessageWarning:
@@ -164,26 +180,22 @@ func (c *Controller) handleMessageError(gErr *gst.GError) error {
 	element, name, message := parseDebugInfo(gErr)
 
 	switch {
-	case element == elementGstRtmp2Sink:
+	case element == elementGstRtmp2Sink || element == elementGstSRTSink:
 		name = strings.Split(name, "_")[1]
 
-		if !c.eos.IsBroken() {
-			// try reconnecting
-			ok, err := c.streamBin.MaybeResetStream(name, gErr)
-			if err != nil {
-				logger.Errorw("failed to reset stream", err)
-			} else if ok {
-				return nil
-			}
+		if !c.eos.IsBroken() && c.reconnectStream(name, gErr) {
+			return nil
 		}
 
 		// remove sink
 		url, err := c.streamBin.GetStreamUrl(name)
 		if err != nil {
-			logger.Warnw("rtmp output not found", err, "url", url)
+			logger.Warnw("stream output not found", err, "url", url)
 			return err
 		}
 
+		c.controlMu.Lock()
+		defer c.controlMu.Unlock()
 		return c.removeSink(context.Background(), url, gErr)
 
 	case element == elementGstAppSrc:
@@ -194,6 +206,14 @@ func (c *Controller) handleMessageError(gErr *gst.GError) error {
 			return nil
 		}
 
+	case c.recoverTrack(gErr):
+		return nil
+
+	case c.eos.IsBroken() && c.stats.encodedBytes.Load() == 0:
+		// muxers fail to finalize outputs without any media, which is reported as no content once the pipeline stops
+		logger.Debugw("muxer failure on empty output", "element", name, "message", message)
+		return errors.ErrNoContent
+
 	case element == elementSplitMuxSink:
 		// We sometimes get GstSplitMuxSink errors if send EOS before the first media was sent to the mux
 		if message == msgMuxer {
@@ -233,7 +253,10 @@ func (c *Controller) handleMessageStateChanged(msg *gst.Message) {
 	if s == pipelineName {
 		c.playing.Once(func() {
 			logger.Infow("pipeline playing")
-			c.updateStartTime(c.src.GetStartedAt())
+			// a gated start has already set the start time when recording started
+			if c.recording.IsBroken() && !c.StartGated() {
+				c.updateStartTime(c.src.GetStartedAt())
+			}
 		})
 	} else if strings.HasPrefix(s, "app_") {
 		s = s[4:]
@@ -264,6 +287,11 @@ func (c *Controller) handleMessageElement(msg *gst.Message) error {
 				return err
 			}
 
+			if msg.Source() == builder.FileSplitMuxSinkName {
+				c.getFileSink().ChunkOpened(filepath, t)
+				return nil
+			}
+
 			if err = c.getSegmentSink().FragmentOpened(filepath, t); err != nil {
 				logger.Errorw("failed to register new segment with playlist writer", err, "location", filepath, "runningTime", t)
 				return err
@@ -278,6 +306,15 @@ func (c *Controller) handleMessageElement(msg *gst.Message) error {
 
 			logger.Debugw("fragment closed", "location", filepath, "runningTime", t)
 
+			if msg.Source() == builder.FileSplitMuxSinkName {
+				if err = c.getFileSink().ChunkClosed(filepath, t); err != nil {
+					logger.Errorw("failed to queue file chunk upload", err, "location", filepath)
+					return err
+				}
+				c.saveRecoveryState()
+				return nil
+			}
+
 			// We need to dispatch to a queue to:
 			// 1. Avoid concurrent access to the SegmentsInfo structure
 			// 2. Ensure that playlists are uploaded in the same order they are enqueued to avoid an older playlist overwriting a newer one
@@ -285,6 +322,10 @@ func (c *Controller) handleMessageElement(msg *gst.Message) error {
 				logger.Errorw("failed to end segment with playlist writer", err, "runningTime", t)
 				return err
 			}
+			c.saveRecoveryState()
+
+		case msgLevel:
+			c.updateAudioLevels(s)
 
 		case msgGstMultiFileSink:
 			location, ts, err := getImageInformationFromGstStructure(s)
@@ -363,6 +404,15 @@ func getImageInformationFromGstStructure(s *gst.Structure) (string, uint64, erro
 
 }
 
+func (c *Controller) getFileSink() *sink.FileSink {
+	s := c.sinks[types.EgressTypeFile]
+	if len(s) == 0 {
+		return nil
+	}
+
+	return s[0].(*sink.FileSink)
+}
+
 func (c *Controller) getSegmentSink() *sink.SegmentSink {
 	s := c.sinks[types.EgressTypeSegments]
 	if len(s) == 0 {
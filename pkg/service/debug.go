@@ -17,20 +17,41 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/pipeline/snapshot"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/pprof"
+	"github.com/livekit/protocol/rpc"
 	"github.com/livekit/psrpc"
 )
 
 const (
 	gstPipelineDotFileApp = "gst_pipeline"
 	pprofApp              = "pprof"
+	tracersApp            = "tracers"
+	logsApp               = "logs"
+	readinessApp          = "readiness"
+	healthApp             = "health"
+	statusApp             = "status"
+	outputsApp            = "outputs"
+	pauseApp              = "pause"
+	resumeApp             = "resume"
+	stopApp               = "stop"
+	markStartApp          = "mark_start"
+	snapshotApp           = "snapshot"
+	audioLevelsApp        = "audio_levels"
+	layoutApp             = "layout"
+	validateApp           = "validate"
 )
 
 func (s *Service) StartDebugHandlers() {
@@ -42,6 +63,20 @@ func (s *Service) StartDebugHandlers() {
 	mux := http.NewServeMux()
 	mux.HandleFunc(fmt.Sprintf("/%s/", gstPipelineDotFileApp), s.handleGstPipelineDotFile)
 	mux.HandleFunc(fmt.Sprintf("/%s/", pprofApp), s.handlePProf)
+	mux.HandleFunc(fmt.Sprintf("/%s/", tracersApp), s.handleTracers)
+	mux.HandleFunc(fmt.Sprintf("/%s/", logsApp), s.handleLogs)
+	mux.HandleFunc(fmt.Sprintf("/%s/", readinessApp), s.handleReadiness)
+	mux.HandleFunc(fmt.Sprintf("/%s/", healthApp), s.handleHealth)
+	mux.HandleFunc(fmt.Sprintf("/%s/", statusApp), s.handleStatus)
+	mux.HandleFunc(fmt.Sprintf("/%s/", outputsApp), s.handleOutputs)
+	mux.HandleFunc(fmt.Sprintf("/%s/", pauseApp), s.handlePause)
+	mux.HandleFunc(fmt.Sprintf("/%s/", resumeApp), s.handlePause)
+	mux.HandleFunc(fmt.Sprintf("/%s/", stopApp), s.handleStop)
+	mux.HandleFunc(fmt.Sprintf("/%s/", markStartApp), s.handleMarkStart)
+	mux.HandleFunc(fmt.Sprintf("/%s/", snapshotApp), s.handleSnapshot)
+	mux.HandleFunc(fmt.Sprintf("/%s/", audioLevelsApp), s.handleAudioLevels)
+	mux.HandleFunc(fmt.Sprintf("/%s/", layoutApp), s.handleLayout)
+	mux.HandleFunc(fmt.Sprintf("/%s", validateApp), s.handleValidate)
 
 	go func() {
 		addr := fmt.Sprintf(":%d", s.conf.DebugHandlerPort)
@@ -51,19 +86,26 @@ func (s *Service) StartDebugHandlers() {
 }
 
 func (s *Service) GetGstPipelineDotFile(egressID string) (string, error) {
-	c, err := s.getGRPCClient(egressID)
+	res, err := s.getGstPipelineDot(egressID, 0)
 	if err != nil {
 		return "", err
 	}
+	return res.DotFile, nil
+}
 
-	res, err := c.GetPipelineDot(context.Background(), &ipc.GstPipelineDebugDotRequest{})
+func (s *Service) getGstPipelineDot(egressID string, timeoutMs int32) (*ipc.GstPipelineDebugDotResponse, error) {
+	c, err := s.getGRPCClient(egressID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return res.DotFile, nil
+
+	return c.GetPipelineDot(context.Background(), &ipc.GstPipelineDebugDotRequest{
+		TimeoutMs: timeoutMs,
+	})
 }
 
-// URL path format is "/<application>/<egress_id>/<optional_other_params>"
+// URL path format is "/<application>/<egress_id>/<optional_other_params>?timeout_ms=<ms>".
+// X-Pipeline-Transitioning is set when the pipeline was changing state
 func (s *Service) handleGstPipelineDotFile(w http.ResponseWriter, r *http.Request) {
 	pathElements := strings.Split(r.URL.Path, "/")
 	if len(pathElements) < 3 {
@@ -72,12 +114,334 @@ func (s *Service) handleGstPipelineDotFile(w http.ResponseWriter, r *http.Reques
 	}
 
 	egressID := pathElements[2]
-	dotFile, err := s.GetGstPipelineDotFile(egressID)
+	timeoutMs, _ := strconv.Atoi(r.URL.Query().Get("timeout_ms"))
+	res, err := s.getGstPipelineDot(egressID, int32(timeoutMs))
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+	w.Header().Set("X-Pipeline-Transitioning", strconv.FormatBool(res.Transitioning))
+	_, _ = w.Write([]byte(res.DotFile))
+}
+
+// URL path format is "/<application>/<egress_id>". Responds 503 until the pipeline is producing media
+func (s *Service) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.GetReadiness(r.Context(), &ipc.ReadinessRequest{})
+	if err != nil {
+		// handler process not responsive
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if !res.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>". Responds 503 once no media has reached the output sinks for the stall threshold
+func (s *Service) handleHealth(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.GetHealth(r.Context(), &ipc.HealthRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if res.Health == string(types.HealthDegraded) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>"
+func (s *Service) handleStatus(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.GetEgressStatus(r.Context(), &ipc.EgressStatusRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>"
+func (s *Service) handleOutputs(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.GetActiveOutputs(r.Context(), &ipc.ActiveOutputsRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>?duration_ms=<ms>&max_bytes=<bytes>"
+func (s *Service) handleTracers(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	durationMs, _ := strconv.Atoi(r.URL.Query().Get("duration_ms"))
+	maxBytes, _ := strconv.Atoi(r.URL.Query().Get("max_bytes"))
+	res, err := c.GetTracerLogs(r.Context(), &ipc.TracerLogsRequest{
+		DurationMs: int32(durationMs),
+		MaxBytes:   int32(maxBytes),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain")
+	if res.Truncated {
+		w.Header().Add("X-Tracer-Logs-Truncated", "true")
+	}
+	_, _ = w.Write(res.Logs)
+}
+
+// URL path format is "/<application>/<egress_id>?level=<level>&limit=<lines>"
+func (s *Service) handleLogs(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	res, err := c.GetLogs(r.Context(), &ipc.LogsRequest{
+		Level: r.URL.Query().Get("level"),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain")
+	for _, line := range res.Lines {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", time.Unix(0, line.Timestamp).UTC().Format(time.RFC3339Nano), line.Level, line.Message)
+	}
+}
+
+// URL path format is "/<application>/<egress_id>"
+func (s *Service) handleAudioLevels(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.GetAudioLevels(r.Context(), &ipc.AudioLevelsRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>", for both pause and resume. Only POST requests change the pause state
+func (s *Service) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+
+	var res *ipc.PauseStateResponse
+	if pathElements[1] == pauseApp {
+		res, err = c.PauseEgress(r.Context(), &ipc.PauseEgressRequest{})
+	} else {
+		res, err = c.ResumeEgress(r.Context(), &ipc.ResumeEgressRequest{})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>?discard=<true|false>". Only POST requests are accepted
+func (s *Service) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	var discard bool
+	if v := r.URL.Query().Get("discard"); v != "" {
+		var err error
+		if discard, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid discard", http.StatusBadRequest)
+			return
+		}
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.Stop(r.Context(), &ipc.StopRequest{
+		Discard: discard,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>". Only POST requests are accepted
+func (s *Service) handleMarkStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.MarkStart(r.Context(), &ipc.MarkStartRequest{})
 	if err != nil {
 		http.Error(w, err.Error(), getErrorCode(err))
 		return
 	}
-	_, _ = w.Write([]byte(dotFile))
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
 }
 
 // URL path format is "/<application>/<egress_id>/<profile_name>" or "/<application>/<profile_name>" to profile the service
@@ -138,3 +502,119 @@ func getErrorCode(err error) int {
 		return http.StatusInternalServerError
 	}
 }
+
+// URL path format is "/<application>/<egress_id>?layout=<layout>&web_url=<url>". Only POST requests are accepted
+func (s *Service) handleLayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+	res, err := c.UpdateLayout(r.Context(), &ipc.UpdateLayoutRequest{
+		Layout: r.URL.Query().Get("layout"),
+		WebUrl: r.URL.Query().Get("web_url"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// URL path format is "/<application>/<egress_id>?width=<width>&height=<height>&format=<jpeg|png>"
+func (s *Service) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	pathElements := strings.Split(r.URL.Path, "/")
+	if len(pathElements) < 3 {
+		http.Error(w, "malformed url", http.StatusNotFound)
+		return
+	}
+
+	c, err := s.getGRPCClient(pathElements[2])
+	if err != nil {
+		http.Error(w, "handler not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	width, err := snapshotDimension(query.Get("width"))
+	if err != nil {
+		http.Error(w, "invalid width", http.StatusBadRequest)
+		return
+	}
+	height, err := snapshotDimension(query.Get("height"))
+	if err != nil {
+		http.Error(w, "invalid height", http.StatusBadRequest)
+		return
+	}
+	res, err := c.GetSnapshot(r.Context(), &ipc.SnapshotRequest{
+		Width:  int32(width),
+		Height: int32(height),
+		Format: query.Get("format"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), getErrorCode(err))
+		return
+	}
+
+	w.Header().Add("Content-Type", res.ContentType)
+	_, _ = w.Write(res.Image)
+}
+
+// snapshotDimension parses a width or height query value, which must be positive when set
+func snapshotDimension(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 || d > snapshot.MaxDimension {
+		return 0, errors.ErrInvalidInput("dimensions")
+	}
+	return d, nil
+}
+
+// URL path format is "/<application>", with a StartEgressRequest as the json body of a POST request
+func (s *Service) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &rpc.StartEgressRequest{}
+	if err = protojson.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := protojson.Marshal(s.ValidateEgress(r.Context(), req))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
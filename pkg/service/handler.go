@@ -15,15 +15,19 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"net"
-	"strings"
+	"net/http"
 	"time"
 
 	"github.com/frostbyte73/core"
+	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -32,6 +36,8 @@ import (
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/ipc"
 	"github.com/livekit/egress/pkg/pipeline"
+	"github.com/livekit/egress/pkg/stats"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/pprof"
@@ -40,7 +46,27 @@ import (
 	"github.com/livekit/psrpc"
 )
 
-const network = "unix"
+const (
+	// ForcedShutdownExitCode is returned by the handler process when it was forced to stop before its outputs
+	// were finalized, after sending its final update
+	ForcedShutdownExitCode = 2
+
+	defaultStatsInterval = time.Second
+	minStatsInterval     = time.Millisecond * 100
+
+	defaultDotTimeout = 2 * time.Second
+	snapshotTimeout   = 2 * time.Second
+
+	defaultTracerDuration = 5 * time.Second
+	maxTracerDuration     = time.Minute
+	defaultTracerBytes    = 4 << 20
+	maxTracerBytes        = 16 << 20
+
+	// time allowed for the pipeline to stop after a forced shutdown before exiting without it
+	forceStopTimeout = 5 * time.Second
+
+	healthCheckInterval = 5 * time.Second
+)
 
 type Handler struct {
 	ipc.UnimplementedEgressHandlerServer
@@ -50,15 +76,26 @@ type Handler struct {
 	rpcServer  rpc.EgressHandlerServer
 	ioClient   rpc.IOInfoClient
 	grpcServer *grpc.Server
+	resources  *stats.ResourceMonitor
 	kill       core.Fuse
+	forceStop  core.Fuse
+
+	killTimeout atomic.Duration
 }
 
 func NewHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.IOInfoClient) (*Handler, error) {
+	if len(conf.HostOverrides) > 0 {
+		applyHostOverrides(conf.HostOverrides)
+	}
+	conf.HandlerSecret = handlerSecretFromEnv()
+
 	h := &Handler{
 		conf:       conf,
 		ioClient:   ioClient,
-		grpcServer: grpc.NewServer(),
+		grpcServer: newIPCServer(conf.HandlerSecret),
+		resources:  stats.NewResourceMonitor(conf.NodeID, conf.ClusterID, conf.Info.EgressId),
 		kill:       core.NewFuse(),
+		forceStop:  core.NewFuse(),
 	}
 
 	rpcServer, err := rpc.NewEgressHandlerServer(h, bus)
@@ -73,10 +110,11 @@ func NewHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.
 	}
 	h.rpcServer = rpcServer
 
-	listener, err := net.Listen(network, getSocketAddress(conf.TmpDir))
+	listener, err := listenIPC(conf.IPCTransport, conf.TmpDir, ipcAddressPipe(conf.IPCTransport))
 	if err != nil {
 		return nil, errors.Fatal(err)
 	}
+	logger.Debugw("handler listening", "transport", conf.IPCTransport, "address", listener.Addr().String())
 
 	ipc.RegisterEgressHandlerServer(h.grpcServer, h)
 
@@ -91,6 +129,8 @@ func NewHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.
 	if err != nil {
 		if !errors.IsFatal(err) {
 			// user error, send update
+			code := errors.GetErrorCode(err)
+			logger.Warnw("egress failed", err, "errorCode", code, "transient", errors.IsTransient(code))
 			now := time.Now().UnixNano()
 			conf.Info.UpdatedAt = now
 			conf.Info.EndedAt = now
@@ -104,28 +144,136 @@ func NewHandler(conf *config.PipelineConfig, bus psrpc.MessageBus, ioClient rpc.
 	return h, nil
 }
 
+// applyHostOverrides routes the default http transport and websocket dialer through the overrides.
+// Uploaders build their clients from http.DefaultTransport, and rtmp urls are rewritten by the stream bin.
+func applyHostOverrides(hosts config.HostOverrides) {
+	for host, ip := range hosts {
+		logger.Infow("applying host override", "host", host, "ip", ip)
+	}
+
+	dial := hosts.DialContext(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	http.DefaultTransport.(*http.Transport).DialContext = dial
+	websocket.DefaultDialer.NetDialContext = dial
+}
+
 func (h *Handler) Run() error {
 	ctx, span := tracer.Start(context.Background(), "Handler.Run")
 	defer span.End()
 
+	h.resources.Start()
+	defer h.resources.Stop()
+
 	// start egress
 	result := make(chan *livekit.EgressInfo, 1)
 	go func() {
 		result <- h.pipeline.Run(ctx)
 	}()
 
+	healthTicker := time.NewTicker(healthCheckInterval)
+	defer healthTicker.Stop()
+
 	kill := h.kill.Watch()
+	forceStop := h.forceStop.Watch()
+	diskStalled := h.pipeline.DiskStalled()
+	started := h.pipeline.Started()
+	health := types.HealthOK
+	var drain, abandon, maxDurationReached <-chan time.Time
+	var maxDuration *time.Timer
+	defer func() {
+		if maxDuration != nil {
+			maxDuration.Stop()
+		}
+	}()
 	for {
 		select {
+		case <-started:
+			// measured from the start time reported for the outputs
+			if h.conf.MaxDuration > 0 {
+				maxDuration = time.NewTimer(h.conf.MaxDuration)
+				maxDurationReached = maxDuration.C
+			}
+			started = nil
+
+		case <-maxDurationReached:
+			h.pipeline.OnMaxDuration(ctx)
+			maxDurationReached = nil
+
+		case <-healthTicker.C:
+			// media has stopped reaching the sinks without an error or EOS
+			current, idle := h.pipeline.Health()
+			if current != health {
+				if current == types.HealthDegraded {
+					logger.Warnw("pipeline degraded, no buffers reaching output sinks", nil, "idle", idle)
+				} else {
+					logger.Infow("pipeline recovered")
+				}
+				health = current
+			}
+
+		case <-diskStalled:
+			// finalizing may block on the same disk
+			if abandon == nil {
+				abandon = time.After(h.conf.DrainTimeout)
+			}
+			diskStalled = nil
+
+		case <-abandon:
+			// pipeline is wedged, report the failure and exit without it
+			logger.Warnw("pipeline did not stop, abandoning outputs", nil)
+			now := time.Now().UnixNano()
+			info := h.pipeline.Info
+			if info.Error == "" {
+				info.Error = errors.ErrForcedShutdown.Error()
+			}
+			info.UpdatedAt = now
+			info.EndedAt = now
+			info.Status = livekit.EgressStatus_EGRESS_FAILED
+			_, _ = h.ioClient.UpdateEgress(ctx, info)
+			h.rpcServer.Shutdown()
+			h.grpcServer.Stop()
+			return errors.ErrForcedShutdown
+
 		case <-kill:
 			// kill signal received
+			if maxDuration != nil {
+				maxDuration.Stop()
+				maxDurationReached = nil
+			}
 			h.pipeline.SendEOS(ctx)
+			if timeout := h.killTimeout.Load(); timeout > 0 {
+				drain = time.After(timeout)
+			}
+			kill = nil
+
+		case <-drain:
+			logger.Warnw("drain timeout exceeded, stopping recording immediately", nil, "timeout", h.killTimeout.Load())
+			h.forceStop.Break()
+			drain = nil
+
+		case <-forceStop:
+			// drain timed out or second kill signal received
+			h.pipeline.ForceStop(errors.ErrForcedShutdown)
+			if abandon == nil {
+				abandon = time.After(forceStopTimeout)
+			}
+			forceStop = nil
 
 		case res := <-result:
 			// recording finished
+			if res.Error != "" {
+				code := h.pipeline.ErrorCode()
+				logger.Infow("egress failed", "error", res.Error, "errorCode", code, "transient", errors.IsTransient(code))
+			}
 			_, _ = h.ioClient.UpdateEgress(ctx, res)
+			<-h.pipeline.UsagePosted()
 			h.rpcServer.Shutdown()
 			h.grpcServer.Stop()
+			if h.forceStop.IsBroken() {
+				return errors.ErrForcedShutdown
+			}
 			return nil
 		}
 	}
@@ -154,11 +302,11 @@ func (h *Handler) StopEgress(ctx context.Context, _ *livekit.StopEgressRequest)
 		return nil, errors.ErrEgressNotFound
 	}
 
-	h.pipeline.SendEOS(ctx)
+	h.pipeline.RequestStop(ctx)
 	return h.pipeline.Info, nil
 }
 
-func (h *Handler) GetPipelineDot(ctx context.Context, _ *ipc.GstPipelineDebugDotRequest) (*ipc.GstPipelineDebugDotResponse, error) {
+func (h *Handler) GetPipelineDot(ctx context.Context, req *ipc.GstPipelineDebugDotRequest) (*ipc.GstPipelineDebugDotResponse, error) {
 	ctx, span := tracer.Start(ctx, "Handler.GetPipelineDot")
 	defer span.End()
 
@@ -168,16 +316,22 @@ func (h *Handler) GetPipelineDot(ctx context.Context, _ *ipc.GstPipelineDebugDot
 
 	res := make(chan string, 1)
 	go func() {
-		res <- h.pipeline.GetGstPipelineDebugDot()
+		res <- h.pipeline.GetCachedPipelineDot()
 	}()
 
+	timeout := defaultDotTimeout
+	if req.TimeoutMs > 0 {
+		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
+	}
+
 	select {
 	case r := <-res:
 		return &ipc.GstPipelineDebugDotResponse{
-			DotFile: r,
+			DotFile:       r,
+			Transitioning: h.pipeline.Transitioning(),
 		}, nil
 
-	case <-time.After(2 * time.Second):
+	case <-time.After(timeout):
 		return nil, status.New(codes.DeadlineExceeded, "timed out requesting pipeline debug info").Err()
 	}
 }
@@ -200,6 +354,71 @@ func (h *Handler) GetPProf(ctx context.Context, req *ipc.PProfRequest) (*ipc.PPr
 	}, nil
 }
 
+// GetTracerLogs collects gstreamer tracer records from the running pipeline for a bounded window
+func (h *Handler) GetTracerLogs(ctx context.Context, req *ipc.TracerLogsRequest) (*ipc.TracerLogsResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.GetTracerLogs")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+	if req.DurationMs < 0 || req.MaxBytes < 0 {
+		return nil, errors.ErrInvalidInput("tracer capture")
+	}
+
+	duration := defaultTracerDuration
+	if req.DurationMs > 0 {
+		duration = min(time.Duration(req.DurationMs)*time.Millisecond, maxTracerDuration)
+	}
+	maxBytes := defaultTracerBytes
+	if req.MaxBytes > 0 {
+		maxBytes = min(int(req.MaxBytes), maxTracerBytes)
+	}
+
+	logs, truncated, err := h.pipeline.CaptureTracerLogs(ctx, duration, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &ipc.TracerLogsResponse{
+		Logs:      logs,
+		Truncated: truncated,
+	}, nil
+}
+
+// GetLogs returns recent handler and pipeline log lines, optionally filtered by level
+func (h *Handler) GetLogs(ctx context.Context, req *ipc.LogsRequest) (*ipc.LogsResponse, error) {
+	_, span := tracer.Start(ctx, "Handler.GetLogs")
+	defer span.End()
+
+	if h.conf.LogBuffer == nil {
+		return nil, errors.ErrLogBufferDisabled
+	}
+
+	minLevel := zapcore.DebugLevel
+	if req.Level != "" {
+		var err error
+		if minLevel, err = zapcore.ParseLevel(req.Level); err != nil {
+			return nil, errors.ErrInvalidInput("level")
+		}
+	}
+	if req.Limit < 0 {
+		return nil, errors.ErrInvalidInput("limit")
+	}
+
+	entries := h.conf.LogBuffer.Entries(minLevel, int(req.Limit))
+	res := &ipc.LogsResponse{
+		Lines: make([]*ipc.LogLine, 0, len(entries)),
+	}
+	for _, e := range entries {
+		res.Lines = append(res.Lines, &ipc.LogLine{
+			Timestamp: e.Time.UnixNano(),
+			Level:     e.Level.String(),
+			Message:   e.Message,
+		})
+	}
+	return res, nil
+}
+
 // GetMetrics implement the handler-side gathering of metrics to return over IPC
 func (h *Handler) GetMetrics(ctx context.Context, req *ipc.MetricsRequest) (*ipc.MetricsResponse, error) {
 	ctx, span := tracer.Start(ctx, "Handler.GetMetrics")
@@ -210,37 +429,374 @@ func (h *Handler) GetMetrics(ctx context.Context, req *ipc.MetricsRequest) (*ipc
 		return nil, err
 	}
 
-	logger.Debugw("returning metrics from handler process", "sizeOfFamilies", len(metrics))
-	metricsAsString, cnt, err := renderMetrics(metrics)
+	// the pipeline is nil until it has been created
+	egressStatus, active := h.conf.Info.Status, false
+	if h.pipeline != nil {
+		egressStatus, active = h.pipeline.Status(), h.pipeline.Active()
+	}
+
+	logger.Debugw("returning metrics from handler process", "sizeOfFamilies", len(metrics), "status", egressStatus, "format", req.Format)
+	b, cnt, err := renderMetrics(metrics, req.Format)
 	if err != nil {
 		return &ipc.MetricsResponse{
 			Metrics: "",
+			Status:  egressStatus,
+			Active:  active,
 		}, err
 	}
-	logger.Debugw("metrics returned from handler process", "cnt", cnt, "metrics", metricsAsString)
-	return &ipc.MetricsResponse{
-		Metrics: metricsAsString,
+
+	res := &ipc.MetricsResponse{
+		Status: egressStatus,
+		Active: active,
+	}
+	if req.Format == ipc.MetricsFormat_PROTO_DELIMITED {
+		logger.Debugw("metrics returned from handler process", "cnt", cnt, "size", len(b))
+		res.MetricsData = b
+	} else {
+		logger.Debugw("metrics returned from handler process", "cnt", cnt, "metrics", string(b))
+		res.Metrics = string(b)
+	}
+	return res, nil
+}
+
+// GetEgressStatus returns the pipeline state and the progress of each output
+func (h *Handler) GetEgressStatus(ctx context.Context, _ *ipc.EgressStatusRequest) (*ipc.EgressStatusResponse, error) {
+	_, span := tracer.Start(ctx, "Handler.GetEgressStatus")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	res := &ipc.EgressStatusResponse{
+		State:            string(h.pipeline.PipelineState()),
+		Status:           h.pipeline.Status(),
+		StartedAt:        h.pipeline.Info.StartedAt,
+		Outputs:          make(map[string]*ipc.OutputStatus),
+		ErrorCode:        string(h.pipeline.ErrorCode()),
+		VideoEncoder:     string(h.pipeline.VideoEncoder),
+		DisconnectReason: string(h.pipeline.DisconnectReason()),
+	}
+	if res.StartedAt > 0 {
+		res.Elapsed = time.Now().UnixNano() - res.StartedAt
+	}
+	for output, s := range h.pipeline.GetOutputStats() {
+		res.Outputs[output] = &ipc.OutputStatus{
+			BytesWritten:    s.BytesWritten,
+			FileSize:        s.FileSize,
+			SegmentCount:    s.SegmentCount,
+			ImageCount:      s.ImageCount,
+			Discontinuities: s.Discontinuities,
+		}
+	}
+	return res, nil
+}
+
+// GetActiveOutputs returns the destination and connection state of each output
+func (h *Handler) GetActiveOutputs(ctx context.Context, _ *ipc.ActiveOutputsRequest) (*ipc.ActiveOutputsResponse, error) {
+	_, span := tracer.Start(ctx, "Handler.GetActiveOutputs")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	res := &ipc.ActiveOutputsResponse{}
+	for _, o := range h.pipeline.GetActiveOutputs() {
+		res.Outputs = append(res.Outputs, &ipc.ActiveOutput{
+			EgressType:  string(o.EgressType),
+			Destination: o.Destination,
+			State:       string(o.State),
+			BytesSent:   o.BytesSent,
+			Error:       o.Error,
+		})
+	}
+	return res, nil
+}
+
+// PauseEgress halts output until ResumeEgress, keeping the pipeline and its outputs open
+func (h *Handler) PauseEgress(ctx context.Context, _ *ipc.PauseEgressRequest) (*ipc.PauseStateResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.PauseEgress")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	if err := h.pipeline.Pause(ctx); err != nil {
+		return nil, err
+	}
+	return &ipc.PauseStateResponse{
+		Paused: h.pipeline.Paused(),
+		Info:   h.pipeline.Info,
+	}, nil
+}
+
+func (h *Handler) ResumeEgress(ctx context.Context, _ *ipc.ResumeEgressRequest) (*ipc.PauseStateResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.ResumeEgress")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	if err := h.pipeline.Resume(ctx); err != nil {
+		return nil, err
+	}
+	return &ipc.PauseStateResponse{
+		Paused: h.pipeline.Paused(),
+		Info:   h.pipeline.Info,
+	}, nil
+}
+
+// Stop ends the egress like StopEgress, or with discard set, drops its outputs instead of uploading them
+func (h *Handler) Stop(ctx context.Context, req *ipc.StopRequest) (*ipc.StopResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.Stop")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	if req.Discard {
+		if err := h.pipeline.Discard(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		h.pipeline.RequestStop(ctx)
+	}
+	return &ipc.StopResponse{
+		Info: h.pipeline.Info,
+	}, nil
+}
+
+// MarkStart starts recording an egress requested with await_mark_start, beginning with its pre-roll
+func (h *Handler) MarkStart(ctx context.Context, _ *ipc.MarkStartRequest) (*ipc.MarkStartResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.MarkStart")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	if err := h.pipeline.MarkStart(ctx); err != nil {
+		return nil, err
+	}
+	return &ipc.MarkStartResponse{
+		Info: h.pipeline.Info,
+	}, nil
+}
+
+// UpdateLayout navigates a running web or room composite egress to a new layout or url, keeping its outputs
+func (h *Handler) UpdateLayout(ctx context.Context, req *ipc.UpdateLayoutRequest) (*ipc.UpdateLayoutResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.UpdateLayout")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	if err := h.pipeline.UpdateLayout(ctx, req.Layout, req.WebUrl); err != nil {
+		return nil, err
+	}
+	return &ipc.UpdateLayoutResponse{
+		Info: h.pipeline.Info,
+	}, nil
+}
+
+// GetSnapshot encodes the next composited video frame
+func (h *Handler) GetSnapshot(ctx context.Context, req *ipc.SnapshotRequest) (*ipc.SnapshotResponse, error) {
+	ctx, span := tracer.Start(ctx, "Handler.GetSnapshot")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	var outputType types.OutputType
+	switch req.Format {
+	case "", "jpeg", "jpg":
+		outputType = types.OutputTypeJPEG
+	case "png":
+		outputType = types.OutputTypePNG
+	default:
+		return nil, errors.ErrInvalidInput("format")
+	}
+	if req.Width < 0 || req.Height < 0 {
+		return nil, errors.ErrInvalidInput("dimensions")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	image, err := h.pipeline.GetSnapshot(ctx, int(req.Width), int(req.Height), outputType)
+	if err != nil {
+		return nil, err
+	}
+	return &ipc.SnapshotResponse{
+		Image:       image,
+		ContentType: string(outputType),
+	}, nil
+}
+
+// GetAudioLevels returns the latest rms and peak level of each audio channel
+func (h *Handler) GetAudioLevels(ctx context.Context, _ *ipc.AudioLevelsRequest) (*ipc.AudioLevelsResponse, error) {
+	_, span := tracer.Start(ctx, "Handler.GetAudioLevels")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return nil, errors.ErrEgressNotFound
+	}
+
+	levels, err := h.pipeline.GetAudioLevels()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ipc.AudioLevelsResponse{}
+	if levels != nil {
+		res.MeasuredAt = levels.MeasuredAt.UnixNano()
+		res.Interval = int64(levels.Duration)
+		for i := range levels.RMS {
+			res.Channels = append(res.Channels, &ipc.ChannelLevel{
+				Rms:  levels.RMS[i],
+				Peak: levels.Peak[i],
+			})
+		}
+	}
+	return res, nil
+}
+
+// GetReadiness distinguishes a responsive handler from one whose pipeline is producing media
+func (h *Handler) GetReadiness(ctx context.Context, _ *ipc.ReadinessRequest) (*ipc.ReadinessResponse, error) {
+	_, span := tracer.Start(ctx, "Handler.GetReadiness")
+	defer span.End()
+
+	// the pipeline is nil until it has been created
+	readiness, status := types.ReadinessStarting, h.conf.Info.Status
+	if h.pipeline != nil {
+		readiness, status = h.pipeline.Readiness(), h.pipeline.Status()
+	}
+
+	return &ipc.ReadinessResponse{
+		Live:   true,
+		Ready:  readiness == types.ReadinessReady,
+		State:  string(readiness),
+		Status: status,
+	}, nil
+}
+
+// GetHealth reports whether media is still reaching the output sinks, so that a wedged pipeline can be restarted
+func (h *Handler) GetHealth(ctx context.Context, _ *ipc.HealthRequest) (*ipc.HealthResponse, error) {
+	_, span := tracer.Start(ctx, "Handler.GetHealth")
+	defer span.End()
+
+	if h.pipeline == nil {
+		return &ipc.HealthResponse{
+			Health: string(types.HealthOK),
+			Status: h.conf.Info.Status,
+		}, nil
+	}
+
+	health, idle := h.pipeline.Health()
+	return &ipc.HealthResponse{
+		Health:       string(health),
+		LastBufferAt: h.pipeline.LastBufferAt(),
+		Idle:         int64(idle),
+		Status:       h.pipeline.Status(),
 	}, nil
 }
 
-func renderMetrics(metrics []*dto.MetricFamily) (string, int, error) {
-	// Create a StringWriter to render the metrics into text format
-	writer := &strings.Builder{}
-	totalCnt := 0
+// WatchStats streams pipeline stats at a fixed interval until the client disconnects or the egress ends
+func (h *Handler) WatchStats(req *ipc.WatchStatsRequest, stream ipc.EgressHandler_WatchStatsServer) error {
+	if h.pipeline == nil {
+		return errors.ErrEgressNotFound
+	}
+
+	interval := defaultStatsInterval
+	if req.IntervalMs > 0 {
+		interval = max(time.Duration(req.IntervalMs)*time.Millisecond, minStatsInterval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := h.pipeline.GetPipelineStats()
+	prevTime := time.Now()
+	for {
+		select {
+		case <-stream.Context().Done():
+			// client disconnected, or grpc server stopped at the end of the egress
+			return nil
+
+		case now := <-ticker.C:
+			current := h.pipeline.GetPipelineStats()
+			elapsed := now.Sub(prevTime).Seconds()
+
+			res := &ipc.PipelineStats{
+				Timestamp:     now.UnixNano(),
+				Bitrate:       uint64(float64(current.EncodedBytes-prev.EncodedBytes) * 8 / elapsed),
+				Fps:           float64(current.VideoFrames-prev.VideoFrames) / elapsed,
+				DroppedFrames: current.DroppedFrames,
+			}
+			for _, q := range current.Queues {
+				res.Queues = append(res.Queues, &ipc.QueueLevel{
+					Name:    q.Name,
+					Buffers: q.Buffers,
+					Time:    q.Time,
+				})
+			}
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+
+			prev, prevTime = current, now
+		}
+	}
+}
+
+// renderMetrics encodes the metric families in the requested exposition format, defaulting to text
+func renderMetrics(metrics []*dto.MetricFamily, format ipc.MetricsFormat) ([]byte, int, error) {
+	var f expfmt.Format
+	switch format {
+	case ipc.MetricsFormat_PROTO_DELIMITED:
+		f = expfmt.FmtProtoDelim
+	case ipc.MetricsFormat_OPENMETRICS:
+		f = expfmt.FmtOpenMetrics_1_0_0
+	default:
+		f = expfmt.FmtText
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := expfmt.NewEncoder(buf, f)
 	for _, metric := range metrics {
-		// Write each metric family to text
-		cnt, err := expfmt.MetricFamilyToText(writer, metric)
-		if err != nil {
+		// Write each metric family in the requested format
+		if err := encoder.Encode(metric); err != nil {
 			logger.Errorw("error writing metric family", err)
-			return "", 0, err
+			return nil, 0, err
+		}
+	}
+	// openmetrics requires an EOF marker
+	if closer, ok := encoder.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return nil, 0, err
 		}
-		totalCnt += cnt
 	}
 
-	// Get the rendered metrics as a string from the StringWriter
-	return writer.String(), totalCnt, nil
+	return buf.Bytes(), len(metrics), nil
 }
 
+// Kill sends EOS, allowing outputs to be finalized and uploaded
 func (h *Handler) Kill() {
 	h.kill.Break()
 }
+
+// KillWithTimeout sends EOS, forcing the pipeline to stop if outputs have not been finalized within d
+func (h *Handler) KillWithTimeout(d time.Duration) {
+	h.killTimeout.CompareAndSwap(0, d)
+	h.kill.Break()
+}
+
+// ForceStop stops the pipeline immediately, without waiting for EOS
+func (h *Handler) ForceStop() {
+	h.forceStop.Break()
+}
@@ -15,12 +15,13 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net"
 	"os"
 	"os/exec"
 	"path"
-	"strings"
 	"syscall"
 	"time"
 
@@ -36,6 +37,7 @@ import (
 	"github.com/livekit/egress/pkg/config"
 	"github.com/livekit/egress/pkg/errors"
 	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/types"
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
@@ -43,12 +45,15 @@ import (
 	"github.com/livekit/protocol/utils"
 )
 
+const handlerIDPrefix = "EGH_"
+
 type Process struct {
 	ctx        context.Context
 	handlerID  string
 	req        *rpc.StartEgressRequest
 	info       *livekit.EgressInfo
 	cmd        *exec.Cmd
+	tmpDir     string
 	grpcClient ipc.EgressHandlerClient
 	closed     core.Fuse
 }
@@ -60,6 +65,9 @@ func NewProcess(
 	info *livekit.EgressInfo,
 	cmd *exec.Cmd,
 	tmpDir string,
+	transport types.IPCTransport,
+	secret string,
+	addr *ipcAddress,
 ) (*Process, error) {
 	p := &Process{
 		ctx:       ctx,
@@ -67,14 +75,16 @@ func NewProcess(
 		req:       req,
 		info:      info,
 		cmd:       cmd,
+		tmpDir:    tmpDir,
 		closed:    core.NewFuse(),
 	}
 
-	socketAddr := getSocketAddress(tmpDir)
-	conn, err := grpc.Dial(socketAddr,
+	// the target only names the handler, the dialer resolves its address
+	conn, err := grpc.Dial(path.Join(tmpDir, socketFilename),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithContextDialer(func(_ context.Context, addr string) (net.Conn, error) {
-			return net.Dial(network, addr)
+		grpc.WithPerRPCCredentials(handlerCredentials(secret)),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return dialIPC(ctx, transport, tmpDir, addr)
 		}),
 	)
 	if err != nil {
@@ -90,7 +100,12 @@ func (s *Service) launchHandler(req *rpc.StartEgressRequest, info *livekit.Egres
 	_, span := tracer.Start(context.Background(), "Service.launchHandler")
 	defer span.End()
 
-	handlerID := utils.NewGuid("EGH_")
+	handlerID := utils.NewGuid(handlerIDPrefix)
+	secret, err := newHandlerSecret()
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
 	p := &config.PipelineConfig{
 		BaseConfig: s.conf.BaseConfig,
 		HandlerID:  handlerID,
@@ -117,10 +132,29 @@ func (s *Service) launchHandler(req *rpc.StartEgressRequest, info *livekit.Egres
 		"--request", string(reqString),
 	)
 	cmd.Dir = "/"
+	cmd.Env = append(os.Environ(), handlerSecretEnv+"="+secret)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	if err = cmd.Start(); err != nil {
+	var addr *ipcAddress
+	var addrOut *os.File
+	if s.conf.IPCTransport == types.IPCTransportTCP {
+		// the handler reports its port over a pipe, since anything on the host could write to the tmp dir
+		var addrIn *os.File
+		if addrIn, addrOut, err = os.Pipe(); err != nil {
+			span.RecordError(err)
+			return err
+		}
+		cmd.ExtraFiles = []*os.File{addrOut} // ipcAddressFD in the handler
+		addr = readIPCAddress(addrIn)
+	}
+
+	err = cmd.Start()
+	if addrOut != nil {
+		// the handler holds its own copy, so reading ends when it closes it or exits
+		_ = addrOut.Close()
+	}
+	if err != nil {
 		span.RecordError(err)
 		logger.Errorw("could not launch process", err)
 		return err
@@ -128,7 +162,7 @@ func (s *Service) launchHandler(req *rpc.StartEgressRequest, info *livekit.Egres
 
 	s.EgressStarted(req)
 
-	h, err := NewProcess(context.Background(), handlerID, req, info, cmd, p.TmpDir)
+	h, err := NewProcess(context.Background(), handlerID, req, info, cmd, p.TmpDir, s.conf.IPCTransport, secret, addr)
 	if err != nil {
 		span.RecordError(err)
 		return err
@@ -147,12 +181,18 @@ func (s *Service) AddHandler(egressID string, h *Process) {
 }
 
 func (s *Service) awaitCleanup(p *Process) {
-	if err := p.cmd.Wait(); err != nil {
+	err := p.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == ForcedShutdownExitCode {
+		// handler was forced to stop and has already sent its final update
+		logger.Warnw("handler forcibly stopped", nil, "egressID", p.req.EgressId)
+	} else if err != nil {
 		now := time.Now().UnixNano()
 		p.info.UpdatedAt = now
 		p.info.EndedAt = now
 		p.info.Status = livekit.EgressStatus_EGRESS_FAILED
 		p.info.Error = "internal error"
+		s.recoverEgress(p)
 		_, _ = s.ioClient.UpdateEgress(p.ctx, p.info)
 		s.Stop(false)
 	}
@@ -196,24 +236,28 @@ func (s *Service) KillAll() {
 	}
 }
 
-func getSocketAddress(handlerTmpDir string) string {
-	return path.Join(handlerTmpDir, "service_rpc.sock")
-}
-
 // Gather implements the prometheus.Gatherer interface on server-side to allow aggregation of handler metrics
 func (p *Process) Gather() ([]*dto.MetricFamily, error) {
 	// Get the metrics from the handler via IPC
-	metricsResponse, err := p.grpcClient.GetMetrics(context.Background(), &ipc.MetricsRequest{})
+	metricsResponse, err := p.grpcClient.GetMetrics(context.Background(), &ipc.MetricsRequest{
+		Format: ipc.MetricsFormat_PROTO_DELIMITED,
+	})
 	if err != nil {
 		logger.Warnw("Error obtaining metrics from handler, skipping", err, "egress_id", p.req.EgressId)
 		return make([]*dto.MetricFamily, 0), nil // don't return an error, just skip this handler
 	}
-	// Parse the result to match the Gatherer interface
-	parser := &expfmt.TextParser{}
-	families, err := parser.TextToMetricFamilies(strings.NewReader(metricsResponse.Metrics))
-	if err != nil {
-		logger.Warnw("Error parsing metrics from handler, skipping", err, "egress_id", p.req.EgressId)
-		return make([]*dto.MetricFamily, 0), nil // don't return an error, just skip this handler
+	// Decode the result to match the Gatherer interface, avoiding the cost of parsing text
+	families := make(map[string]*dto.MetricFamily)
+	decoder := expfmt.NewDecoder(bytes.NewReader(metricsResponse.MetricsData), expfmt.FmtProtoDelim)
+	for {
+		family := &dto.MetricFamily{}
+		if err = decoder.Decode(family); err == io.EOF {
+			break
+		} else if err != nil {
+			logger.Warnw("Error parsing metrics from handler, skipping", err, "egress_id", p.req.EgressId)
+			return make([]*dto.MetricFamily, 0), nil // don't return an error, just skip this handler
+		}
+		families[family.GetName()] = family
 	}
 
 	// Add an egress_id label to every metric all the families, if it doesn't already have one
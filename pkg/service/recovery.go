@@ -0,0 +1,154 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/pipeline"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/rpc"
+)
+
+// recoverEgress uploads the closed file chunks left behind by a crashed handler, reporting the egress
+// as partially recovered instead of failing with an internal error
+func (s *Service) recoverEgress(p *Process) {
+	if !s.conf.CrashRecovery {
+		return
+	}
+
+	conf, err := config.GetValidatedPipelineConfig(s.conf, p.req)
+	if err != nil {
+		logger.Warnw("could not recover egress", err, "egressID", p.req.EgressId)
+		return
+	}
+	conf.HandlerID = p.handlerID
+	conf.TmpDir = p.tmpDir
+
+	// another service instance sharing the tmp dir may be recovering it after a restart
+	lock, err := config.LockHandlerDir(p.tmpDir)
+	if err != nil || lock == nil {
+		logger.Warnw("could not lock handler dir", err, "egressID", p.req.EgressId)
+		return
+	}
+	defer lock.Close()
+
+	recovered, err := pipeline.RecoverEgress(conf, p.info)
+	if err != nil {
+		logger.Warnw("could not recover egress", err, "egressID", p.req.EgressId)
+		markRecoveryFailed(p.tmpDir)
+	} else if recovered {
+		logger.Infow("egress recovered", "egressID", p.req.EgressId, "error", p.info.Error)
+	}
+}
+
+// recoverOrphanedEgresses recovers the egresses of handlers that were running when the service last stopped,
+// from the recovery state left in their tmp dirs. It must run before any handler is launched.
+// The tmp dir may be shared with other service instances, so dirs locked by a running handler are skipped
+func (s *Service) recoverOrphanedEgresses() {
+	if !s.conf.CrashRecovery {
+		return
+	}
+
+	files, err := filepath.Glob(path.Join(os.TempDir(), handlerIDPrefix+"*", config.RecoveryStateFilename))
+	if err != nil || len(files) == 0 {
+		return
+	}
+
+	go func() {
+		for _, file := range files {
+			s.recoverOrphanedEgress(path.Dir(file))
+		}
+	}()
+}
+
+func (s *Service) recoverOrphanedEgress(tmpDir string) {
+	lock, err := config.LockHandlerDir(tmpDir)
+	if err != nil {
+		logger.Warnw("could not lock handler dir", err, "path", tmpDir)
+		return
+	}
+	if lock == nil {
+		logger.Debugw("handler still running, skipping recovery", "path", tmpDir)
+		return
+	}
+	defer lock.Close()
+
+	state, err := config.ReadRecoveryState(tmpDir)
+	if err != nil {
+		logger.Warnw("could not read recovery state", err, "path", tmpDir)
+		markRecoveryFailed(tmpDir)
+		return
+	}
+	if state == nil {
+		// recovered by the handler's own service instance
+		return
+	}
+	if len(state.Request) == 0 {
+		logger.Warnw("could not recover egress", errors.New("recovery state has no request, api_secret required"), "egressID", state.EgressID)
+		markRecoveryFailed(tmpDir)
+		return
+	}
+
+	req, err := config.OpenRecoveryRequest(s.conf.ApiSecret, state.Request)
+	if err != nil {
+		logger.Warnw("could not recover egress", err, "egressID", state.EgressID)
+		markRecoveryFailed(tmpDir)
+		return
+	}
+	conf, err := config.GetValidatedPipelineConfig(s.conf, req)
+	if err != nil {
+		logger.Warnw("could not recover egress", err, "egressID", req.EgressId)
+		markRecoveryFailed(tmpDir)
+		return
+	}
+	conf.HandlerID = path.Base(tmpDir)
+	conf.TmpDir = tmpDir
+
+	// the stored info keeps the start time and any results already sent
+	info, err := s.ioClient.GetEgress(context.Background(), &rpc.GetEgressRequest{EgressId: req.EgressId})
+	if err != nil {
+		logger.Warnw("could not get egress info", err, "egressID", req.EgressId)
+		info = conf.Info
+	} else if info.Status == livekit.EgressStatus_EGRESS_COMPLETE {
+		_ = config.RemoveRecoveryState(tmpDir)
+		return
+	}
+
+	recovered, err := pipeline.RecoverEgress(conf, info)
+	if err != nil {
+		logger.Warnw("could not recover egress", err, "egressID", req.EgressId)
+		markRecoveryFailed(tmpDir)
+	} else if recovered {
+		logger.Infow("egress recovered", "egressID", req.EgressId, "error", info.Error)
+		_, _ = s.ioClient.UpdateEgress(context.Background(), info)
+	} else {
+		// nothing left to recover
+		_ = config.RemoveRecoveryState(tmpDir)
+	}
+}
+
+// markRecoveryFailed keeps a failed recovery from being retried on every restart
+func markRecoveryFailed(tmpDir string) {
+	if err := config.MarkRecoveryFailed(tmpDir); err != nil {
+		logger.Warnw("could not mark recovery failed", err, "path", tmpDir)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +30,8 @@ import (
 	dto "github.com/prometheus/client_model/go"
 
 	"github.com/livekit/egress/pkg/config"
+	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/pipeline"
 	"github.com/livekit/egress/pkg/stats"
 	"github.com/livekit/egress/version"
 	"github.com/livekit/protocol/egress"
@@ -36,6 +39,7 @@ import (
 	"github.com/livekit/protocol/logger"
 	"github.com/livekit/protocol/rpc"
 	"github.com/livekit/protocol/tracer"
+	"github.com/livekit/protocol/utils"
 )
 
 const shutdownTimer = time.Second * 30
@@ -94,6 +98,7 @@ func (s *Service) Register(psrpcServer rpc.EgressInternalServer) {
 
 func (s *Service) Run() error {
 	logger.Debugw("starting service", "version", version.Version)
+	s.recoverOrphanedEgresses()
 
 	if err := s.psrpcServer.RegisterStartEgressTopic(s.conf.ClusterID); err != nil {
 		return err
@@ -139,6 +144,7 @@ func (s *Service) StartEgress(ctx context.Context, req *rpc.StartEgressRequest)
 	requestType, outputType := egress.GetTypes(p.Info.Request)
 	logger.Infow("request validated",
 		"egressID", req.EgressId,
+		"correlationID", p.CorrelationID,
 		"requestType", requestType,
 		"outputType", outputType,
 		"room", p.Info.RoomName,
@@ -154,6 +160,32 @@ func (s *Service) StartEgress(ctx context.Context, req *rpc.StartEgressRequest)
 	return p.Info, nil
 }
 
+// ValidateEgress runs the request through the same config parsing as StartEgress, then checks uploads,
+// templates and stream servers without launching a handler
+func (s *Service) ValidateEgress(ctx context.Context, req *rpc.StartEgressRequest) *ipc.ValidateEgressResponse {
+	_, span := tracer.Start(ctx, "Service.ValidateEgress")
+	defer span.End()
+
+	if req.EgressId == "" {
+		req.EgressId = utils.NewGuid(utils.EgressPrefix)
+	}
+
+	res := &ipc.ValidateEgressResponse{}
+	p, err := config.GetValidatedPipelineConfig(s.conf, req)
+	if err != nil {
+		// request metadata errors are collected, one per line
+		res.Errors = append(res.Errors, strings.Split(err.Error(), "\n")...)
+	} else {
+		for _, err = range pipeline.Validate(p) {
+			res.Errors = append(res.Errors, err.Error())
+		}
+	}
+	res.Valid = len(res.Errors) == 0
+
+	logger.Infow("validation complete", "egressID", req.EgressId, "valid", res.Valid, "errors", res.Errors)
+	return res
+}
+
 func (s *Service) StartEgressAffinity(ctx context.Context, req *rpc.StartEgressRequest) float32 {
 	if !s.CanAcceptRequest(req) {
 		// cannot accept
@@ -0,0 +1,184 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"path"
+
+	"github.com/frostbyte73/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/livekit/egress/pkg/errors"
+	"github.com/livekit/egress/pkg/types"
+)
+
+const (
+	socketFilename = "service_rpc.sock"
+
+	// the handler writes its tcp address to this fd, a pipe read by the service
+	ipcAddressFD = 3
+
+	handlerSecretMetadataKey = "x-handler-secret"
+
+	// the handler secret is passed in the environment, since the command line is readable by any local user
+	handlerSecretEnv = "EGRESS_HANDLER_SECRET"
+)
+
+// listenIPC listens for the service on a unix socket in the handler tmp dir, or with the tcp transport on
+// an ephemeral loopback port. The address is written to addrOut, which is then closed
+func listenIPC(transport types.IPCTransport, handlerTmpDir string, addrOut io.WriteCloser) (net.Listener, error) {
+	if transport != types.IPCTransportTCP {
+		return net.Listen("unix", path.Join(handlerTmpDir, socketFilename))
+	}
+	if addrOut == nil {
+		return nil, errors.New("missing ipc address pipe")
+	}
+	defer addrOut.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.WriteString(addrOut, listener.Addr().String()); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// ipcAddress is the tcp address of a handler, read once from its pipe
+type ipcAddress struct {
+	ready core.Fuse
+	addr  string
+	err   error
+}
+
+// readIPCAddress reads the address until the handler closes its end of the pipe
+func readIPCAddress(r io.ReadCloser) *ipcAddress {
+	a := &ipcAddress{
+		ready: core.NewFuse(),
+	}
+	go func() {
+		defer a.ready.Break()
+		defer r.Close()
+
+		b, err := io.ReadAll(r)
+		switch {
+		case err != nil:
+			a.err = err
+		case len(b) == 0:
+			a.err = errors.New("handler exited without listening")
+		default:
+			a.addr = string(b)
+		}
+	}()
+	return a
+}
+
+func (a *ipcAddress) wait(ctx context.Context) (string, error) {
+	select {
+	case <-a.ready.Watch():
+		return a.addr, a.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// dialIPC connects to a handler. Until the handler is listening it fails, and grpc retries with backoff
+func dialIPC(ctx context.Context, transport types.IPCTransport, handlerTmpDir string, addr *ipcAddress) (net.Conn, error) {
+	var d net.Dialer
+	if transport != types.IPCTransportTCP {
+		return d.DialContext(ctx, "unix", path.Join(handlerTmpDir, socketFilename))
+	}
+
+	tcpAddr, err := addr.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.DialContext(ctx, "tcp", tcpAddr)
+}
+
+// newHandlerSecret creates the secret the service sends with every handler request
+func newHandlerSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handlerSecretFromEnv reads the handler secret, removing it so it isn't inherited by the handler's own children
+func handlerSecretFromEnv() string {
+	secret := os.Getenv(handlerSecretEnv)
+	_ = os.Unsetenv(handlerSecretEnv)
+	return secret
+}
+
+// handlerCredentials attaches the handler secret to each request
+type handlerCredentials string
+
+func (c handlerCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{handlerSecretMetadataKey: string(c)}, nil
+}
+
+// RequireTransportSecurity is false, since the connection never leaves the host
+func (c handlerCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// newIPCServer rejects requests without the handler secret, since any local process can reach a tcp port
+func newIPCServer(secret string) *grpc.Server {
+	return grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := checkHandlerSecret(ctx, secret); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkHandlerSecret(ss.Context(), secret); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+}
+
+func checkHandlerSecret(ctx context.Context, secret string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(handlerSecretMetadataKey)
+	if secret == "" || len(values) != 1 || subtle.ConstantTimeCompare([]byte(values[0]), []byte(secret)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid handler secret")
+	}
+	return nil
+}
+
+// ipcAddressPipe is the handler's end of the address pipe, or nil with the unix transport
+func ipcAddressPipe(transport types.IPCTransport) io.WriteCloser {
+	if transport != types.IPCTransportTCP {
+		return nil
+	}
+	return os.NewFile(ipcAddressFD, "ipc_address")
+}
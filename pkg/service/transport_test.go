@@ -0,0 +1,111 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/livekit/egress/pkg/ipc"
+	"github.com/livekit/egress/pkg/types"
+)
+
+func TestIPCTransport(t *testing.T) {
+	for _, transport := range []types.IPCTransport{types.IPCTransportUnix, types.IPCTransportTCP} {
+		t.Run(string(transport), func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			var addr *ipcAddress
+			var addrOut io.WriteCloser
+			if transport == types.IPCTransportTCP {
+				addrIn, w, err := os.Pipe()
+				require.NoError(t, err)
+				addr = readIPCAddress(addrIn)
+				addrOut = w
+			}
+
+			listener, err := listenIPC(transport, tmpDir, addrOut)
+			require.NoError(t, err)
+			if transport == types.IPCTransportTCP {
+				require.Equal(t, "tcp", listener.Addr().Network())
+				require.NoFileExists(t, path.Join(tmpDir, "service_rpc.addr"))
+			}
+
+			secret, err := newHandlerSecret()
+			require.NoError(t, err)
+			server := newIPCServer(secret)
+			ipc.RegisterEgressHandlerServer(server, &ipc.UnimplementedEgressHandlerServer{})
+			go func() {
+				_ = server.Serve(listener)
+			}()
+			t.Cleanup(server.Stop)
+
+			dial := func(secret string) ipc.EgressHandlerClient {
+				conn, err := grpc.Dial(path.Join(tmpDir, socketFilename),
+					grpc.WithTransportCredentials(insecure.NewCredentials()),
+					grpc.WithPerRPCCredentials(handlerCredentials(secret)),
+					grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+						return dialIPC(ctx, transport, tmpDir, addr)
+					}),
+				)
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = conn.Close() })
+				return ipc.NewEgressHandlerClient(conn)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			// reaches the handler, which doesn't implement the call
+			_, err = dial(secret).GetHealth(ctx, &ipc.HealthRequest{})
+			require.Equal(t, codes.Unimplemented, status.Code(err))
+
+			_, err = dial("wrong").GetHealth(ctx, &ipc.HealthRequest{})
+			require.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+}
+
+func TestIPCAddressHandlerExited(t *testing.T) {
+	addrIn, addrOut, err := os.Pipe()
+	require.NoError(t, err)
+	addr := readIPCAddress(addrIn)
+
+	// the handler exits before listening
+	require.NoError(t, addrOut.Close())
+	_, err = dialIPC(context.Background(), types.IPCTransportTCP, t.TempDir(), addr)
+	require.Error(t, err)
+}
+
+func TestHandlerSecretFromEnv(t *testing.T) {
+	t.Setenv(handlerSecretEnv, "secret")
+
+	// read once, and not passed on to processes the handler launches
+	require.Equal(t, "secret", handlerSecretFromEnv())
+	_, ok := os.LookupEnv(handlerSecretEnv)
+	require.False(t, ok)
+	require.Empty(t, handlerSecretFromEnv())
+}
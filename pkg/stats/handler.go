@@ -15,6 +15,9 @@
 package stats
 
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -22,6 +25,22 @@ type HandlerMonitor struct {
 	uploadsCounter      *prometheus.CounterVec
 	uploadsResponseTime *prometheus.HistogramVec
 	backupCounter       *prometheus.CounterVec
+	queueBuffers        *prometheus.GaugeVec
+	queueTime           *prometheus.GaugeVec
+	encoderLatency      *prometheus.GaugeVec
+	avSyncDrift         prometheus.Gauge
+
+	mu      sync.Mutex
+	uploads UploadStats
+}
+
+// UploadStats totals every upload attempt made by the handler
+type UploadStats struct {
+	Count     int
+	Failures  int
+	TotalTime time.Duration
+	MaxTime   time.Duration
+	Bytes     int64 // successfully uploaded
 }
 
 func NewHandlerMonitor(nodeId string, clusterId string, egressId string) *HandlerMonitor {
@@ -54,7 +73,40 @@ func NewHandlerMonitor(nodeId string, clusterId string, egressId string) *Handle
 		ConstLabels: constantLabels,
 	}, []string{"output_type"})
 
-	prometheus.MustRegister(m.uploadsCounter, m.uploadsResponseTime, m.backupCounter)
+	m.queueBuffers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "livekit",
+		Subsystem:   "egress",
+		Name:        "pipeline_queue_buffers",
+		Help:        "number of buffers held by each pipeline queue",
+		ConstLabels: constantLabels,
+	}, []string{"queue"})
+
+	m.queueTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "livekit",
+		Subsystem:   "egress",
+		Name:        "pipeline_queue_time_seconds",
+		Help:        "duration of media held by each pipeline queue",
+		ConstLabels: constantLabels,
+	}, []string{"queue"})
+
+	m.encoderLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "livekit",
+		Subsystem:   "egress",
+		Name:        "pipeline_encoder_latency_seconds",
+		Help:        "difference between the latest input and output timestamps of each encoder",
+		ConstLabels: constantLabels,
+	}, []string{"encoder"})
+
+	m.avSyncDrift = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "livekit",
+		Subsystem:   "egress",
+		Name:        "pipeline_av_sync_drift_seconds",
+		Help:        "latest video encoder output timestamp minus the latest audio encoder output timestamp",
+		ConstLabels: constantLabels,
+	})
+
+	prometheus.MustRegister(m.uploadsCounter, m.uploadsResponseTime, m.backupCounter,
+		m.queueBuffers, m.queueTime, m.encoderLatency, m.avSyncDrift)
 
 	return m
 }
@@ -63,18 +115,62 @@ func (m *HandlerMonitor) IncUploadCountSuccess(uploadType string, elapsed float6
 	labels := prometheus.Labels{"type": uploadType, "status": "success"}
 	m.uploadsCounter.With(labels).Add(1)
 	m.uploadsResponseTime.With(labels).Observe(elapsed)
+	m.addUpload(elapsed, false)
 }
 
 func (m *HandlerMonitor) IncUploadCountFailure(uploadType string, elapsed float64) {
 	labels := prometheus.Labels{"type": uploadType, "status": "failure"}
 	m.uploadsCounter.With(labels).Add(1)
 	m.uploadsResponseTime.With(labels).Observe(elapsed)
+	m.addUpload(elapsed, true)
+}
+
+func (m *HandlerMonitor) addUpload(elapsed float64, failed bool) {
+	d := time.Duration(elapsed * float64(time.Millisecond))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploads.Count++
+	if failed {
+		m.uploads.Failures++
+	}
+	m.uploads.TotalTime += d
+	m.uploads.MaxTime = max(m.uploads.MaxTime, d)
+}
+
+func (m *HandlerMonitor) AddUploadedBytes(size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.uploads.Bytes += size
+}
+
+func (m *HandlerMonitor) GetUploadStats() UploadStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.uploads
 }
 
 func (m *HandlerMonitor) IncBackupStorageWrites(outputType string) {
 	m.backupCounter.With(prometheus.Labels{"output_type": outputType}).Add(1)
 }
 
+// UpdateLatency sets the queue level, encoder latency and sync drift gauges from a stats sample
+func (m *HandlerMonitor) UpdateLatency(s *PipelineStats) {
+	for _, q := range s.Queues {
+		m.queueBuffers.WithLabelValues(q.Name).Set(float64(q.Buffers))
+		m.queueTime.WithLabelValues(q.Name).Set(time.Duration(q.Time).Seconds())
+	}
+	for _, e := range s.Encoders {
+		m.encoderLatency.WithLabelValues(e.Name).Set(e.Latency.Seconds())
+	}
+	if s.AVSyncDrift != nil {
+		m.avSyncDrift.Set(s.AVSyncDrift.Seconds())
+	}
+}
+
 func (m *HandlerMonitor) RegisterSegmentsChannelSizeGauge(nodeId string, clusterId string, egressId string, channelSizeFunction func() float64) {
 	segmentsUploadsGauge := prometheus.NewGaugeFunc(
 		prometheus.GaugeOpts{
@@ -0,0 +1,61 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"time"
+
+	"github.com/livekit/egress/pkg/types"
+)
+
+// PipelineStats holds cumulative counters, current queue levels and latencies sampled from a running pipeline
+type PipelineStats struct {
+	EncodedBytes  uint64
+	VideoFrames   uint64
+	DroppedFrames uint64
+	Queues        []QueueLevel
+	Encoders      []EncoderLatency
+	AVSyncDrift   *time.Duration // video minus audio encoder output timestamps, nil without both
+}
+
+// OutputStats reports the progress of a single output
+type OutputStats struct {
+	BytesWritten    uint64
+	FileSize        int64 // file outputs only
+	SegmentCount    int64 // segment outputs only
+	ImageCount      int64 // image outputs only
+	Discontinuities int32 // segment outputs only
+}
+
+// OutputState reports the destination and connection state of a single output
+type OutputState struct {
+	EgressType  types.EgressType
+	Destination string // storage location, or redacted stream url
+	State       types.OutputState
+	BytesSent   uint64
+	Error       string
+}
+
+type QueueLevel struct {
+	Name    string
+	Buffers uint32
+	Time    uint64
+}
+
+// EncoderLatency is the difference between the latest input and output timestamps of an encoder
+type EncoderLatency struct {
+	Name    string
+	Latency time.Duration
+}
@@ -0,0 +1,360 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frostbyte73/core"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	resourceUpdateInterval = time.Second * 5
+
+	// USER_HZ, which the kernel fixes at 100 for everything it exports through /proc
+	clockTicks = 100
+
+	procRoot   = "/proc"
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// cgroup v1 reports an unlimited memory limit as a page-aligned max int64
+	cgroupV1Unlimited = 1 << 62
+)
+
+// ResourceMonitor tracks cpu and memory used by the handler process, including the gstreamer threads
+// and any child processes (chrome, xvfb, pulse). Memory is also read from the process's cgroup,
+// since that is what container limits are enforced against
+type ResourceMonitor struct {
+	pid  int
+	done core.Fuse
+
+	processCPU    prometheus.Gauge
+	pipelineCPU   prometheus.Gauge
+	processMemory prometheus.Gauge
+	cgroupMemory  prometheus.Gauge
+	cgroupLimit   prometheus.Gauge
+
+	lastSample  time.Time
+	lastTicks   uint64
+	lastThreads map[int]uint64
+}
+
+type procStat struct {
+	comm  string
+	ppid  int
+	ticks uint64 // user and system time
+	rss   uint64 // pages
+}
+
+func NewResourceMonitor(nodeId string, clusterId string, egressId string) *ResourceMonitor {
+	constantLabels := prometheus.Labels{"node_id": nodeId, "cluster_id": clusterId, "egress_id": egressId}
+	newGauge := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "livekit",
+			Subsystem:   "egress",
+			Name:        name,
+			Help:        help,
+			ConstLabels: constantLabels,
+		})
+	}
+
+	m := &ResourceMonitor{
+		pid:           os.Getpid(),
+		done:          core.NewFuse(),
+		processCPU:    newGauge("process_cpu_percent", "cpu used by the handler process and its children, 100 per core"),
+		pipelineCPU:   newGauge("pipeline_threads_cpu_percent", "cpu used by gstreamer threads, 100 per core"),
+		processMemory: newGauge("process_memory_bytes", "resident memory of the handler process and its children"),
+		cgroupMemory:  newGauge("cgroup_memory_bytes", "cgroup memory working set, excluding inactive file cache"),
+		cgroupLimit:   newGauge("cgroup_memory_limit_bytes", "cgroup memory limit, 0 if unlimited"),
+		lastThreads:   make(map[int]uint64),
+	}
+	prometheus.MustRegister(m.processCPU, m.pipelineCPU, m.processMemory, m.cgroupMemory, m.cgroupLimit)
+
+	return m
+}
+
+// Start updates the gauges until Stop is called
+func (m *ResourceMonitor) Start() {
+	m.update()
+
+	go func() {
+		ticker := time.NewTicker(resourceUpdateInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done.Watch():
+				return
+			case <-ticker.C:
+				m.update()
+			}
+		}
+	}()
+}
+
+func (m *ResourceMonitor) Stop() {
+	m.done.Break()
+}
+
+func (m *ResourceMonitor) update() {
+	now := time.Now()
+
+	var ticks, rss uint64
+	for _, pid := range processTree(procRoot, m.pid) {
+		stat, err := readStat(path.Join(procRoot, strconv.Itoa(pid), "stat"))
+		if err != nil {
+			// exited
+			continue
+		}
+		ticks += stat.ticks
+		rss += stat.rss
+	}
+	m.processMemory.Set(float64(rss * uint64(os.Getpagesize())))
+
+	threadTicks := m.pipelineThreadTicks()
+	if !m.lastSample.IsZero() {
+		elapsed := now.Sub(m.lastSample).Seconds()
+		if ticks >= m.lastTicks {
+			m.processCPU.Set(cpuPercent(ticks-m.lastTicks, elapsed))
+		}
+		m.pipelineCPU.Set(cpuPercent(threadTicks, elapsed))
+	}
+	m.lastSample = now
+	m.lastTicks = ticks
+
+	if usage, limit, err := readCgroupMemory(procRoot, cgroupRoot); err == nil {
+		m.cgroupMemory.Set(float64(usage))
+		m.cgroupLimit.Set(float64(limit))
+	} else {
+		logger.Debugw("failed to read cgroup memory", "error", err)
+	}
+}
+
+// pipelineThreadTicks returns the ticks used by gstreamer threads since the last update. Gstreamer names its
+// streaming threads after their pads, while go and glib threads keep the process name
+func (m *ResourceMonitor) pipelineThreadTicks() uint64 {
+	self, err := readStat(path.Join(procRoot, strconv.Itoa(m.pid), "stat"))
+	if err != nil {
+		return 0
+	}
+
+	taskDir := path.Join(procRoot, strconv.Itoa(m.pid), "task")
+	entries, err := os.ReadDir(taskDir)
+	if err != nil {
+		return 0
+	}
+
+	var delta uint64
+	threads := make(map[int]uint64, len(entries))
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readStat(path.Join(taskDir, entry.Name(), "stat"))
+		if err != nil || stat.comm == self.comm {
+			continue
+		}
+		threads[tid] = stat.ticks
+		if last, ok := m.lastThreads[tid]; ok && stat.ticks >= last {
+			delta += stat.ticks - last
+		} else if !ok {
+			delta += stat.ticks
+		}
+	}
+	if m.lastSample.IsZero() {
+		delta = 0
+	}
+	m.lastThreads = threads
+	return delta
+}
+
+func cpuPercent(ticks uint64, elapsed float64) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(ticks) / clockTicks / elapsed * 100
+}
+
+// processTree returns pid and all of its descendants
+func processTree(root string, pid int) []int {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return []int{pid}
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readStat(path.Join(root, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		children[stat.ppid] = append(children[stat.ppid], child)
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
+
+func readStat(filepath string) (*procStat, error) {
+	b, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return parseStat(b)
+}
+
+// parseStat reads /proc/<pid>/stat. The command name may contain spaces and parentheses,
+// so fields are counted from the last closing parenthesis
+func parseStat(b []byte) (*procStat, error) {
+	start := bytes.IndexByte(b, '(')
+	end := bytes.LastIndexByte(b, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid stat")
+	}
+
+	// fields[0] is field 3 (state)
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("invalid stat")
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &procStat{
+		comm:  string(b[start+1 : end]),
+		ppid:  ppid,
+		ticks: utime + stime,
+		rss:   uint64(max(rss, 0)),
+	}, nil
+}
+
+// readCgroupMemory returns the working set and limit of the calling process's memory cgroup, for cgroup v1 or v2.
+// Inside a container the cgroup namespace root is usually mounted directly at the cgroup root
+func readCgroupMemory(procRoot, cgroupRoot string) (uint64, uint64, error) {
+	f, err := os.Open(path.Join(procRoot, "self", "cgroup"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-id:controllers:path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			for _, dir := range []string{path.Join(cgroupRoot, parts[2]), cgroupRoot} {
+				if usage, limit, err := readCgroupFiles(dir, "memory.current", "memory.max", "inactive_file"); err == nil {
+					return usage, limit, nil
+				}
+			}
+		}
+
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller != "memory" {
+				continue
+			}
+			for _, dir := range []string{path.Join(cgroupRoot, "memory", parts[2]), path.Join(cgroupRoot, "memory")} {
+				if usage, limit, err := readCgroupFiles(dir, "memory.usage_in_bytes", "memory.limit_in_bytes", "total_inactive_file"); err == nil {
+					return usage, limit, nil
+				}
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	return 0, 0, fmt.Errorf("memory cgroup not found")
+}
+
+func readCgroupFiles(dir, usageFile, limitFile, inactiveKey string) (uint64, uint64, error) {
+	usage, err := readCgroupValue(path.Join(dir, usageFile))
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err := readCgroupValue(path.Join(dir, limitFile))
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit >= cgroupV1Unlimited {
+		limit = 0
+	}
+
+	// the working set is what the kernel and orchestrators compare against the limit
+	if b, err := os.ReadFile(path.Join(dir, "memory.stat")); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			key, value, ok := strings.Cut(line, " ")
+			if !ok || key != inactiveKey {
+				continue
+			}
+			if inactive, err := strconv.ParseUint(value, 10, 64); err == nil && inactive <= usage {
+				usage -= inactive
+			}
+			break
+		}
+	}
+
+	return usage, limit, nil
+}
+
+// readCgroupValue reads a single value file, where "max" means unlimited
+func readCgroupValue(filepath string) (uint64, error) {
+	b, err := os.ReadFile(filepath)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 LiveKit, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStat(t *testing.T) {
+	stat, err := parseStat([]byte("42 (queue0:src (1)) S 7 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 12 0 1000 2000000 300 18446744073709551615"))
+	require.NoError(t, err)
+	require.Equal(t, "queue0:src (1)", stat.comm)
+	require.Equal(t, 7, stat.ppid)
+	require.Equal(t, uint64(300), stat.ticks)
+	require.Equal(t, uint64(300), stat.rss)
+
+	_, err = parseStat([]byte("42 (egress) S 7"))
+	require.Error(t, err)
+}
+
+func TestReadCgroupMemory(t *testing.T) {
+	write := func(filepath, content string) {
+		require.NoError(t, os.MkdirAll(path.Dir(filepath), 0755))
+		require.NoError(t, os.WriteFile(filepath, []byte(content), 0644))
+	}
+
+	// v2, with the namespace root mounted at the cgroup root
+	dir := t.TempDir()
+	write(path.Join(dir, "proc", "self", "cgroup"), "0::/kubepods/pod1\n")
+	write(path.Join(dir, "cgroup", "memory.current"), "1000\n")
+	write(path.Join(dir, "cgroup", "memory.max"), "4000\n")
+	write(path.Join(dir, "cgroup", "memory.stat"), "anon 600\ninactive_file 300\n")
+	usage, limit, err := readCgroupMemory(path.Join(dir, "proc"), path.Join(dir, "cgroup"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(700), usage)
+	require.Equal(t, uint64(4000), limit)
+
+	write(path.Join(dir, "cgroup", "memory.max"), "max\n")
+	_, limit, err = readCgroupMemory(path.Join(dir, "proc"), path.Join(dir, "cgroup"))
+	require.NoError(t, err)
+	require.Zero(t, limit)
+
+	// v1
+	dir = t.TempDir()
+	write(path.Join(dir, "proc", "self", "cgroup"), "5:cpu,cpuacct:/egress\n4:memory:/egress\n")
+	write(path.Join(dir, "cgroup", "memory", "egress", "memory.usage_in_bytes"), "2000")
+	write(path.Join(dir, "cgroup", "memory", "egress", "memory.limit_in_bytes"), "9223372036854771712")
+	usage, limit, err = readCgroupMemory(path.Join(dir, "proc"), path.Join(dir, "cgroup"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2000), usage)
+	require.Zero(t, limit)
+}
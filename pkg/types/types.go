@@ -14,6 +14,10 @@
 
 package types
 
+import (
+	"github.com/livekit/protocol/livekit"
+)
+
 type RequestType string
 type SourceType string
 type EgressType string
@@ -21,6 +25,22 @@ type MimeType string
 type Profile string
 type OutputType string
 type FileExtension string
+type DisconnectReason string
+type MissingVideoBehavior string
+type TimecodeFormat string
+type LocalFileCleanup string
+type RoomEvent string
+type StreamPlatform string
+type Readiness string
+type UpscaleBehavior string
+type BundleFormat string
+type PipelineState string
+type ErrorCode string
+type Health string
+type OutputState string
+type VideoEncoder string
+type AudioMode string
+type IPCTransport string
 
 const (
 	// request types
@@ -65,10 +85,16 @@ const (
 	OutputTypeTS          OutputType = "video/mp2t"
 	OutputTypeWebM        OutputType = "video/webm"
 	OutputTypeJPEG        OutputType = "image/jpeg"
+	OutputTypePNG         OutputType = "image/png"
+	OutputTypeSRT         OutputType = "application/x-subrip"
+	OutputTypeVTT         OutputType = "text/vtt"
+	OutputTypeEDL         OutputType = "text/plain"
 	OutputTypeRTMP        OutputType = "rtmp"
 	OutputTypeHLS         OutputType = "application/x-mpegurl"
 	OutputTypeJSON        OutputType = "application/json"
 	OutputTypeBlob        OutputType = "application/octet-stream"
+	OutputTypeTar         OutputType = "application/x-tar"
+	OutputTypeZip         OutputType = "application/zip"
 
 	// file extensions
 	FileExtensionRaw  = ".raw"
@@ -79,9 +105,115 @@ const (
 	FileExtensionWebM = ".webm"
 	FileExtensionM3U8 = ".m3u8"
 	FileExtensionJPEG = ".jpeg"
+
+	// room disconnect reasons
+	DisconnectReasonUnknown           DisconnectReason = "unknown"
+	DisconnectReasonClientInitiated   DisconnectReason = "client_initiated"
+	DisconnectReasonDuplicateIdentity DisconnectReason = "duplicate_identity"
+	DisconnectReasonServerShutdown    DisconnectReason = "server_shutdown"
+	DisconnectReasonKicked            DisconnectReason = "kicked"
+	DisconnectReasonRoomClosed        DisconnectReason = "room_closed"
+	DisconnectReasonStateMismatch     DisconnectReason = "state_mismatch"
+	DisconnectReasonJoinFailure       DisconnectReason = "join_failure"
+	DisconnectReasonNetwork           DisconnectReason = "network"
+	DisconnectReasonTokenExpired      DisconnectReason = "token_expired"
+
+	// behavior when video is requested but never published
+	MissingVideoPlaceholder MissingVideoBehavior = "placeholder"
+	MissingVideoAudioOnly   MissingVideoBehavior = "audio_only"
+	MissingVideoFail        MissingVideoBehavior = "fail"
+
+	// timecode reference subtitle formats
+	TimecodeFormatSRT TimecodeFormat = "srt"
+	TimecodeFormatVTT TimecodeFormat = "vtt"
+
+	// local file handling after a failed upload
+	LocalFileCleanupRetainOnFailure LocalFileCleanup = "retain_on_failure"
+	LocalFileCleanupForceDelete     LocalFileCleanup = "force_delete"
+
+	// room events marked in edit decision lists
+	RoomEventActiveSpeaker RoomEvent = "active_speaker"
+	RoomEventScreenShare   RoomEvent = "screen_share"
+	RoomEventHighlight     RoomEvent = "highlight"
+
+	// streaming platforms with ingest encoding constraints
+	StreamPlatformYouTube StreamPlatform = "youtube"
+	StreamPlatformTwitch  StreamPlatform = "twitch"
+
+	// handler readiness, separate from liveness of the process
+	ReadinessStarting        Readiness = "starting"
+	ReadinessWaitingForMedia Readiness = "waiting_for_media"
+	ReadinessReady           Readiness = "ready"
+	ReadinessPaused          Readiness = "paused"
+	ReadinessShuttingDown    Readiness = "shutting_down"
+
+	// handler health, degraded once media stops reaching the output sinks
+	HealthOK       Health = "ok"
+	HealthDegraded Health = "degraded"
+
+	// per destination output state, connected while media is being streamed or written
+	OutputStateStarting     OutputState = "starting"
+	OutputStateConnected    OutputState = "connected"
+	OutputStateReconnecting OutputState = "reconnecting"
+	OutputStateFailed       OutputState = "failed"
+	OutputStateFinished     OutputState = "finished"
+
+	// gstreamer pipeline state reported by egress status
+	PipelineStateStarting PipelineState = "starting"
+	PipelineStatePlaying  PipelineState = "playing"
+	PipelineStatePaused   PipelineState = "paused"
+	PipelineStateEOS      PipelineState = "eos"
+
+	// output handling when the requested resolution exceeds the source
+	UpscaleBehaviorUpscale   UpscaleBehavior = "upscale"
+	UpscaleBehaviorCap       UpscaleBehavior = "cap"
+	UpscaleBehaviorLetterbox UpscaleBehavior = "letterbox"
+
+	// h264 encoders, hardware first, with x264 as the software fallback
+	VideoEncoderNVENC VideoEncoder = "nvh264enc"
+	VideoEncoderVA    VideoEncoder = "vah264enc"
+	VideoEncoderVAAPI VideoEncoder = "vaapih264enc"
+	VideoEncoderQSV   VideoEncoder = "qsvh264enc"
+	VideoEncoderX264  VideoEncoder = "x264enc"
+
+	// handling of multiple track composite audio tracks
+	AudioModeMix        AudioMode = "mix"
+	AudioModeMultitrack AudioMode = "multitrack"
+
+	// transport between the service and its handler processes
+	IPCTransportUnix IPCTransport = "unix"
+	IPCTransportTCP  IPCTransport = "tcp"
+
+	// archives packaging a file output with its sidecars
+	BundleFormatTar BundleFormat = "tar"
+	BundleFormatZip BundleFormat = "zip"
+
+	// error codes reported for failed egresses
+	ErrorCodeInvalidRequest      ErrorCode = "INVALID_REQUEST"
+	ErrorCodeInvalidUrl          ErrorCode = "INVALID_URL"
+	ErrorCodeUnreachableTemplate ErrorCode = "UNREACHABLE_TEMPLATE"
+	ErrorCodeUnsupportedCodec    ErrorCode = "UNSUPPORTED_CODEC"
+	ErrorCodeUploadAuthFailed    ErrorCode = "UPLOAD_AUTH_FAILED"
+	ErrorCodeUploadFailed        ErrorCode = "UPLOAD_FAILED"
+	ErrorCodeNotFound            ErrorCode = "NOT_FOUND"
+	ErrorCodeUnavailable         ErrorCode = "UNAVAILABLE"
+	ErrorCodeDiskFull            ErrorCode = "DISK_FULL"
+	ErrorCodeNoInput             ErrorCode = "NO_INPUT"
+	ErrorCodeInternal            ErrorCode = "INTERNAL"
 )
 
 var (
+	DisconnectReasons = map[livekit.DisconnectReason]DisconnectReason{
+		livekit.DisconnectReason_UNKNOWN_REASON:      DisconnectReasonUnknown,
+		livekit.DisconnectReason_CLIENT_INITIATED:    DisconnectReasonClientInitiated,
+		livekit.DisconnectReason_DUPLICATE_IDENTITY:  DisconnectReasonDuplicateIdentity,
+		livekit.DisconnectReason_SERVER_SHUTDOWN:     DisconnectReasonServerShutdown,
+		livekit.DisconnectReason_PARTICIPANT_REMOVED: DisconnectReasonKicked,
+		livekit.DisconnectReason_ROOM_DELETED:        DisconnectReasonRoomClosed,
+		livekit.DisconnectReason_STATE_MISMATCH:      DisconnectReasonStateMismatch,
+		livekit.DisconnectReason_JOIN_FAILURE:        DisconnectReasonJoinFailure,
+	}
+
 	DefaultAudioCodecs = map[OutputType]MimeType{
 		OutputTypeRaw:  MimeTypeRawAudio,
 		OutputTypeOGG:  MimeTypeOpus,
@@ -231,3 +363,10 @@ func GetMapIntersection[K comparable](mapA map[K]bool, mapB map[K]bool) map[K]bo
 
 	return res
 }
+
+func GetDisconnectReason(reason livekit.DisconnectReason) DisconnectReason {
+	if r, ok := DisconnectReasons[reason]; ok {
+		return r
+	}
+	return DisconnectReasonUnknown
+}
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/livekit/protocol/livekit"
 )
 
 func TestGetMapIntersection(t *testing.T) {
@@ -62,3 +64,13 @@ func TestGetOutputTypesCompatibleWithCodecs(t *testing.T) {
 	res = GetOutputTypeCompatibleWithCodecs(outputTypes, audioCodecs, videoCodecs)
 	require.Equal(t, OutputTypeMP4, res)
 }
+
+func TestGetDisconnectReason(t *testing.T) {
+	for reason := range livekit.DisconnectReason_name {
+		require.NotEmpty(t, GetDisconnectReason(livekit.DisconnectReason(reason)))
+	}
+
+	require.Equal(t, DisconnectReasonKicked, GetDisconnectReason(livekit.DisconnectReason_PARTICIPANT_REMOVED))
+	require.Equal(t, DisconnectReasonRoomClosed, GetDisconnectReason(livekit.DisconnectReason_ROOM_DELETED))
+	require.Equal(t, DisconnectReasonUnknown, GetDisconnectReason(livekit.DisconnectReason(100)))
+}
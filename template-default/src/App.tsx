@@ -21,6 +21,7 @@ import './App.css';
 import RoomPage from './Room';
 
 function App() {
+  const params = new URLSearchParams(window.location.search);
   return (
     <div className="container">
       <RoomPage
@@ -28,6 +29,8 @@ function App() {
         url={EgressHelper.getLiveKitURL()}
         token={EgressHelper.getAccessToken()}
         layout={EgressHelper.getLayout()}
+        soloFullscreen={params.get('solo') === 'fullscreen'}
+        staleTimeout={Number(params.get('stale') ?? 0)}
       />
     </div>
   );
@@ -17,7 +17,6 @@
 import {
   GridLayout,
   LiveKitRoom,
-  ParticipantTile,
   RoomAudioRenderer,
   useRoomContext,
   useTracks,
@@ -25,16 +24,26 @@ import {
 import EgressHelper from '@livekit/egress-sdk';
 import { ConnectionState, RoomEvent, Track } from 'livekit-client';
 import { ReactElement, useEffect, useState } from 'react';
+import { useSoloParticipant, useStaleTracks } from './common';
 import SingleSpeakerLayout from './SingleSpeakerLayout';
 import SpeakerLayout from './SpeakerLayout';
+import { StaleAwareTile, StaleTracksContext } from './StaleTile';
 
 interface RoomPageProps {
   url: string;
   token: string;
   layout: string;
+  soloFullscreen: boolean;
+  staleTimeout: number;
 }
 
-export default function RoomPage({ url, token, layout }: RoomPageProps) {
+export default function RoomPage({
+  url,
+  token,
+  layout,
+  soloFullscreen,
+  staleTimeout,
+}: RoomPageProps) {
   const [error, setError] = useState<Error>();
   if (!url || !token) {
     return <div className="error">missing required params url and token</div>;
@@ -42,16 +51,30 @@ export default function RoomPage({ url, token, layout }: RoomPageProps) {
 
   return (
     <LiveKitRoom serverUrl={url} token={token} onError={setError}>
-      {error ? <div className="error">{error.message}</div> : <CompositeTemplate layout={layout} />}
+      {error ? (
+        <div className="error">{error.message}</div>
+      ) : (
+        <CompositeTemplate
+          layout={layout}
+          soloFullscreen={soloFullscreen}
+          staleTimeout={staleTimeout}
+        />
+      )}
     </LiveKitRoom>
   );
 }
 
 interface CompositeTemplateProps {
   layout: string;
+  soloFullscreen: boolean;
+  staleTimeout: number;
 }
 
-function CompositeTemplate({ layout: initialLayout }: CompositeTemplateProps) {
+function CompositeTemplate({
+  layout: initialLayout,
+  soloFullscreen,
+  staleTimeout,
+}: CompositeTemplateProps) {
   const room = useRoomContext();
   const [layout, setLayout] = useState(initialLayout);
   const [hasScreenShare, setHasScreenShare] = useState(false);
@@ -106,6 +129,9 @@ function CompositeTemplate({ layout: initialLayout }: CompositeTemplateProps) {
       tr.participant.identity !== room.localParticipant.identity,
   );
 
+  const solo = useSoloParticipant(filteredTracks, soloFullscreen);
+  const stale = useStaleTracks(filteredTracks, staleTimeout);
+
   let interfaceStyle = 'dark';
   if (layout.endsWith('-light')) {
     interfaceStyle = 'light';
@@ -127,10 +153,16 @@ function CompositeTemplate({ layout: initialLayout }: CompositeTemplateProps) {
       main = <SpeakerLayout tracks={filteredTracks} />;
     } else if (effectiveLayout.startsWith('single-speaker')) {
       main = <SingleSpeakerLayout tracks={filteredTracks} />;
+    } else if (solo) {
+      main = (
+        <div className="soloLayout">
+          <SingleSpeakerLayout tracks={filteredTracks} />
+        </div>
+      );
     } else {
       main = (
         <GridLayout tracks={filteredTracks}>
-          <ParticipantTile />
+          <StaleAwareTile />
         </GridLayout>
       );
     }
@@ -138,7 +170,7 @@ function CompositeTemplate({ layout: initialLayout }: CompositeTemplateProps) {
 
   return (
     <div className={containerClass}>
-      {main}
+      <StaleTracksContext.Provider value={stale}>{main}</StaleTracksContext.Provider>
       <RoomAudioRenderer />
     </div>
   );
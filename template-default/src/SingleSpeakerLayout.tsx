@@ -16,13 +16,19 @@
 
 import { useVisualStableUpdate, VideoTrack } from '@livekit/components-react';
 import { LayoutProps } from './common';
+import { StaleOverlay } from './StaleTile';
 
 const SingleSpeakerLayout = ({ tracks: references }: LayoutProps) => {
   const sortedReferences = useVisualStableUpdate(references, 1);
   if (sortedReferences.length === 0) {
     return null;
   }
-  return <VideoTrack {...sortedReferences[0]} />;
+  return (
+    <div className="staleTile">
+      <VideoTrack {...sortedReferences[0]} />
+      <StaleOverlay trackRef={sortedReferences[0]} />
+    </div>
+  );
 };
 
 export default SingleSpeakerLayout;
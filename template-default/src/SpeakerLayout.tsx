@@ -18,11 +18,11 @@ import { TrackReference } from '@livekit/components-core';
 import {
   CarouselView,
   FocusLayout,
-  ParticipantTile,
   VideoTrack,
   useVisualStableUpdate,
 } from '@livekit/components-react';
 import { LayoutProps } from './common';
+import { StaleAwareTile, StaleOverlay } from './StaleTile';
 
 const SpeakerLayout = ({ tracks: references }: LayoutProps) => {
   const sortedTracks = useVisualStableUpdate(references, 1);
@@ -33,13 +33,18 @@ const SpeakerLayout = ({ tracks: references }: LayoutProps) => {
     return <></>;
   } else if (remainingTracks.length === 0) {
     const trackRef = mainTrack as TrackReference;
-    return <VideoTrack {...trackRef} />;
+    return (
+      <div className="staleTile">
+        <VideoTrack {...trackRef} />
+        <StaleOverlay trackRef={trackRef} />
+      </div>
+    );
   }
 
   return (
     <div className="lk-focus-layout">
       <CarouselView tracks={remainingTracks}>
-        <ParticipantTile />
+        <StaleAwareTile />
       </CarouselView>
       <FocusLayout track={mainTrack as TrackReference} />
     </div>
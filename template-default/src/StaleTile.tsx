@@ -0,0 +1,47 @@
+/**
+ * Copyright 2023 LiveKit, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+
+import { TrackReferenceOrPlaceholder } from '@livekit/components-core';
+import { ParticipantTile, useTrackContext } from '@livekit/components-react';
+import { createContext, useContext } from 'react';
+
+// track sids that stopped receiving video, provided by the composite template
+export const StaleTracksContext = createContext<Set<string>>(new Set());
+
+interface StaleOverlayProps {
+  trackRef?: TrackReferenceOrPlaceholder;
+}
+
+// StaleOverlay covers a track that stopped receiving video with a connection lost placeholder
+export function StaleOverlay({ trackRef }: StaleOverlayProps) {
+  const stale = useContext(StaleTracksContext);
+  if (!trackRef?.publication || !stale.has(trackRef.publication.trackSid)) {
+    return null;
+  }
+  return <div className="staleOverlay">Connection lost</div>;
+}
+
+// StaleAwareTile is a participant tile for grid and carousel layouts
+export function StaleAwareTile() {
+  const trackRef = useTrackContext();
+  return (
+    <div className="staleTile">
+      <ParticipantTile />
+      <StaleOverlay trackRef={trackRef} />
+    </div>
+  );
+}
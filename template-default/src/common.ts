@@ -15,7 +15,91 @@
  */
 
 import { TrackReference } from '@livekit/components-core';
+import { RemoteVideoTrack } from 'livekit-client';
+import { useEffect, useRef, useState } from 'react';
 
 export interface LayoutProps {
   tracks: TrackReference[];
 }
+
+// going back to a single participant waits this long, so brief joins and leaves don't flicker
+const soloSwitchDelay = 1000;
+
+// useSoloParticipant returns true while exactly one remote participant has video.
+// A second participant switches back to the grid immediately.
+export function useSoloParticipant(tracks: TrackReference[], enabled: boolean): boolean {
+  const identities = new Set(tracks.map((tr) => tr.participant.identity));
+  const isSolo = enabled && identities.size === 1;
+  const [solo, setSolo] = useState(isSolo);
+
+  useEffect(() => {
+    if (!isSolo) {
+      setSolo(false);
+      return;
+    }
+    const timeout = setTimeout(() => setSolo(true), soloSwitchDelay);
+    return () => clearTimeout(timeout);
+  }, [isSolo]);
+
+  return solo && isSolo;
+}
+
+// how often receiver stats are checked for stale video
+const staleCheckInterval = 1000;
+
+interface receivedBytes {
+  bytes: number;
+  since: number;
+}
+
+// useStaleTracks returns the sids of video tracks that have received no packets for timeout ms.
+// Publishers keep sending packets for static content, so only a publisher that stopped sending
+// goes stale, and a track recovers as soon as packets arrive again.
+export function useStaleTracks(tracks: TrackReference[], timeout: number): Set<string> {
+  const [stale, setStale] = useState<Set<string>>(new Set());
+  const tracksRef = useRef(tracks);
+  tracksRef.current = tracks;
+
+  useEffect(() => {
+    if (timeout <= 0) {
+      return;
+    }
+
+    const received = new Map<string, receivedBytes>();
+    const interval = setInterval(async () => {
+      const now = Date.now();
+      const next = new Set<string>();
+      for (const tr of tracksRef.current) {
+        const track = tr.publication.track;
+        if (!(track instanceof RemoteVideoTrack) || !track.receiver || tr.publication.isMuted) {
+          // muted tracks already show a placeholder
+          received.delete(tr.publication.trackSid);
+          continue;
+        }
+
+        let bytes = 0;
+        const report = await track.receiver.getStats();
+        report.forEach((s) => {
+          if (s.type === 'inbound-rtp') {
+            bytes += s.bytesReceived ?? 0;
+          }
+        });
+
+        const last = received.get(tr.publication.trackSid);
+        if (!last || bytes > last.bytes) {
+          received.set(tr.publication.trackSid, { bytes, since: now });
+        } else if (now - last.since >= timeout) {
+          next.add(tr.publication.trackSid);
+        }
+      }
+
+      setStale((prev) =>
+        prev.size === next.size && Array.from(next).every((sid) => prev.has(sid)) ? prev : next,
+      );
+    }, staleCheckInterval);
+
+    return () => clearInterval(interval);
+  }, [timeout]);
+
+  return stale;
+}
@@ -66,6 +66,7 @@ const EgressHelper = {
     if (currentRoom) {
       currentRoom.off(RoomEvent.ParticipantDisconnected, onParticipantDisconnected);
       currentRoom.off(RoomEvent.Disconnected, EgressHelper.endRecording);
+      currentRoom.off(RoomEvent.Reconnected, onReconnected);
     }
 
     currentRoom = room;
@@ -74,6 +75,7 @@ const EgressHelper = {
       currentRoom.on(RoomEvent.ParticipantDisconnected, onParticipantDisconnected);
     }
     currentRoom.on(RoomEvent.Disconnected, EgressHelper.endRecording);
+    currentRoom.on(RoomEvent.Reconnected, onReconnected);
     onMetadataChanged();
   },
 
@@ -132,6 +134,11 @@ function onParticipantDisconnected() {
   }
 }
 
+// lets egress mark a discontinuity in segment outputs
+function onReconnected() {
+  console.log('RECONNECTED');
+}
+
 function getURLParam(name: string): string | null {
   const query = new URLSearchParams(window.location.search);
   return query.get(name);